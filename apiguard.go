@@ -18,9 +18,6 @@
 package main
 
 import (
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/base64"
 	"encoding/gob"
 	"encoding/json"
 	"flag"
@@ -37,7 +34,6 @@ import (
 	"github.com/czcorpus/apiguard/guard/token"
 	"github.com/czcorpus/apiguard/services"
 
-	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
@@ -83,8 +79,9 @@ func main() {
 	flag.IntVar(&cmdOpts.ReadTimeoutSecs, "write-timeout", 0, "Server write timeout in seconds")
 	flag.StringVar(&cmdOpts.LogPath, "log-path", "", "A file to log to (if empty then stderr is used)")
 	flag.StringVar(&cmdOpts.LogLevel, "log-level", "", "A log level (debug, info, warn/warning, error)")
-	flag.IntVar(&cmdOpts.MaxAgeDays, "max-age-days", 0, "When cleaning old records, this specifies the oldes records (in days) to keep in database.")
+	flag.IntVar(&cmdOpts.MaxAgeDays, "max-age-days", 0, "When cleaning old records, this specifies the oldes records (in days) to keep in database. When listing bans, this specifies how old expired bans are listed.")
 	flag.StringVar(&cmdOpts.BanDurationStr, "ban-duration", "0", "A duration for the ban (e.g. 90s, 2d, 8h30m)")
+	flag.BoolVar(&cmdOpts.JSONOutput, "json", false, "If used, commands printing information (e.g. status) will produce JSON")
 	flag.BoolVar(&cmdOpts.IgnoreStoredState, "ignore-stored-state", false, "If used then no alarm state will be loaded from a configured location. This is usefull e.g. in case of an application configuration change.")
 
 	flag.Usage = func() {
@@ -95,10 +92,15 @@ func main() {
 				"\n\t%s [options] start [conf.json]"+
 				"\n\t%s [options] status [session id / IP address] [conf.json]"+
 				"\n\t%s [options] learn [conf.json]"+
+				"\n\t%s [options] ban [IP address / CIDR range] [conf.json]"+
+				"\n\t%s [options] unban [IP address / CIDR range] [conf.json]"+
+				"\n\t%s [options] bans [conf.json]"+
+				"\n\t%s [options] cleanup [conf.json]"+
 				"\n\t%s generate-token"+
 				"\n\t%s [options] version\n",
 			filepath.Base(os.Args[0]), filepath.Base(os.Args[0]), filepath.Base(os.Args[0]),
-			filepath.Base(os.Args[0]), filepath.Base(os.Args[0]),
+			filepath.Base(os.Args[0]), filepath.Base(os.Args[0]), filepath.Base(os.Args[0]),
+			filepath.Base(os.Args[0]), filepath.Base(os.Args[0]), filepath.Base(os.Args[0]),
 		)
 		flag.PrintDefaults()
 	}
@@ -120,23 +122,61 @@ func main() {
 			Msg("Starting CNC APIGuard")
 
 		server.RunService(conf)
+	case "status":
+		if flag.Arg(1) == "" {
+			fmt.Fprintln(os.Stderr, "missing session ID / IP address")
+			os.Exit(1)
+		}
+		conf := server.FindAndLoadConfig(determineConfigPath(2), cmdOpts)
+		if err := server.PrintClientStatus(conf, flag.Arg(1), cmdOpts.JSONOutput); err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+	case "ban", "unban":
+		if flag.Arg(1) == "" {
+			fmt.Fprintln(os.Stderr, "missing IP address")
+			os.Exit(1)
+		}
+		conf := server.FindAndLoadConfig(determineConfigPath(2), cmdOpts)
+		var err error
+		if action == "ban" {
+			err = server.RunBan(conf, flag.Arg(1))
+
+		} else {
+			err = server.RunUnban(conf, flag.Arg(1))
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+	case "bans":
+		conf := server.FindAndLoadConfig(determineConfigPath(1), cmdOpts)
+		if err := server.PrintBans(conf, cmdOpts.MaxAgeDays, cmdOpts.JSONOutput); err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+	case "cleanup":
+		conf := server.FindAndLoadConfig(determineConfigPath(1), cmdOpts)
+		if err := server.RunCleanup(conf, cmdOpts.MaxAgeDays, cmdOpts.JSONOutput); err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+	case "learn":
+		conf := server.FindAndLoadConfig(determineConfigPath(1), cmdOpts)
+		if err := server.RunLearning(conf); err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
 	case "generate-token":
-		id := uuid.New()
-		bytes := make([]byte, 16)
-		if _, err := rand.Read(bytes); err != nil {
+		tk, hashedTk, err := token.GenerateToken()
+		if err != nil {
 			fmt.Println("failed to generate token: ", err)
 			os.Exit(1)
 			return
 		}
-		tk := base64.URLEncoding.EncodeToString(append([]byte(id.String()), bytes...))
 		var tkJS token.TokenConf
-		tkJS.HashedValue = fmt.Sprintf("%x", sha256.Sum256([]byte(tk)))
+		tkJS.HashedValue = hashedTk
 		tkJS.UserID = 1
 		fmt.Println("token: ", tk)
 		var jsonOut strings.Builder
 		mrs := json.NewEncoder(&jsonOut)
 		mrs.SetIndent("", "  ")
-		err := mrs.Encode(tkJS)
+		err = mrs.Encode(tkJS)
 		if err != nil {
 			fmt.Println("failed to generate token: ", err)
 			os.Exit(1)
@@ -0,0 +1,305 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cnc
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltSessionCacheMaxEntries  = 10000
+	dfltSessionCachePositiveTTL = 300
+	dfltSessionCacheNegativeTTL = 30
+)
+
+// SessionCacheConf configures caching of session->user lookups
+// against the user_session table.
+type SessionCacheConf struct {
+	MaxEntries      int `json:"maxEntries"`
+	PositiveTTLSecs int `json:"positiveTtlSecs"`
+	NegativeTTLSecs int `json:"negativeTtlSecs"`
+
+	// LogoutPathSuffixes specifies proxied paths (matched by suffix)
+	// which end a user session. Once such a request is processed,
+	// all the cached entries for the request's session are removed.
+	LogoutPathSuffixes []string `json:"logoutPathSuffixes"`
+}
+
+func (conf *SessionCacheConf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return nil
+	}
+	if conf.MaxEntries < 0 {
+		return fmt.Errorf("%s.maxEntries must be a positive number", context)
+
+	} else if conf.MaxEntries == 0 {
+		log.Warn().
+			Int("default", dfltSessionCacheMaxEntries).
+			Msgf("%s.maxEntries not set, using default", context)
+		conf.MaxEntries = dfltSessionCacheMaxEntries
+	}
+	if conf.PositiveTTLSecs < 0 {
+		return fmt.Errorf("%s.positiveTtlSecs must be a positive number", context)
+
+	} else if conf.PositiveTTLSecs == 0 {
+		log.Warn().
+			Int("default", dfltSessionCachePositiveTTL).
+			Msgf("%s.positiveTtlSecs not set, using default", context)
+		conf.PositiveTTLSecs = dfltSessionCachePositiveTTL
+	}
+	if conf.NegativeTTLSecs < 0 {
+		return fmt.Errorf("%s.negativeTtlSecs must be a positive number", context)
+
+	} else if conf.NegativeTTLSecs == 0 {
+		log.Warn().
+			Int("default", dfltSessionCacheNegativeTTL).
+			Msgf("%s.negativeTtlSecs not set, using default", context)
+		conf.NegativeTTLSecs = dfltSessionCacheNegativeTTL
+	}
+	for i, suff := range conf.LogoutPathSuffixes {
+		if suff == "" {
+			return fmt.Errorf("%s.logoutPathSuffixes[%d] is empty", context, i)
+		}
+	}
+	return nil
+}
+
+// SessionCacheStats provides basic usage metrics of a SessionCache
+type SessionCacheStats struct {
+	Entries       int     `json:"entries"`
+	MaxEntries    int     `json:"maxEntries"`
+	Hits          int64   `json:"hits"`
+	NegativeHits  int64   `json:"negativeHits"`
+	Misses        int64   `json:"misses"`
+	Coalesced     int64   `json:"coalesced"`
+	Evictions     int64   `json:"evictions"`
+	Invalidations int64   `json:"invalidations"`
+	HitRatio      float64 `json:"hitRatio"`
+}
+
+type sessionCacheEntry struct {
+	key      string
+	selector string
+	userID   common.UserID
+	expires  time.Time
+}
+
+type sessionLookup struct {
+	done   chan struct{}
+	userID common.UserID
+	err    error
+}
+
+// SessionCache is a bounded LRU cache of session->user lookups.
+// Found users are cached for PositiveTTLSecs, failed lookups
+// (i.e. common.InvalidUserID) for NegativeTTLSecs. Errors are never
+// cached. Concurrent lookups of the same session are coalesced so
+// only one of them actually runs the loading function.
+// A nil *SessionCache is valid and it just calls the loading function.
+type SessionCache struct {
+	mu          sync.Mutex
+	conf        SessionCacheConf
+	entries     map[string]*list.Element
+	lru         *list.List
+	inflight    map[string]*sessionLookup
+	generation  uint64
+	stats       SessionCacheStats
+	nowProvider func() time.Time
+}
+
+// sessionCacheKey creates a cache key which respects the whole
+// session value (i.e. the validator part too) so different values
+// with the same selector cannot share a cached user. The key is
+// hashed so no usable session value is kept in memory.
+func sessionCacheKey(selector, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return selector + ":" + hex.EncodeToString(sum[:])
+}
+
+func (sc *SessionCache) ttl(userID common.UserID) time.Duration {
+	if userID.IsValid() {
+		return time.Duration(sc.conf.PositiveTTLSecs) * time.Second
+	}
+	return time.Duration(sc.conf.NegativeTTLSecs) * time.Second
+}
+
+// lookup must be called with sc.mu locked
+func (sc *SessionCache) lookup(key string, now time.Time) (common.UserID, bool) {
+	elm, ok := sc.entries[key]
+	if !ok {
+		return common.InvalidUserID, false
+	}
+	entry := elm.Value.(*sessionCacheEntry)
+	if !now.Before(entry.expires) {
+		sc.lru.Remove(elm)
+		delete(sc.entries, key)
+		return common.InvalidUserID, false
+	}
+	sc.lru.MoveToFront(elm)
+	return entry.userID, true
+}
+
+// store must be called with sc.mu locked
+func (sc *SessionCache) store(key, selector string, userID common.UserID, now time.Time) {
+	if elm, ok := sc.entries[key]; ok {
+		entry := elm.Value.(*sessionCacheEntry)
+		entry.userID = userID
+		entry.expires = now.Add(sc.ttl(userID))
+		sc.lru.MoveToFront(elm)
+		return
+	}
+	sc.entries[key] = sc.lru.PushFront(&sessionCacheEntry{
+		key:      key,
+		selector: selector,
+		userID:   userID,
+		expires:  now.Add(sc.ttl(userID)),
+	})
+	for sc.lru.Len() > sc.conf.MaxEntries {
+		oldest := sc.lru.Back()
+		sc.lru.Remove(oldest)
+		delete(sc.entries, oldest.Value.(*sessionCacheEntry).key)
+		sc.stats.Evictions++
+	}
+}
+
+// FindUser returns a user ID for the session specified by its selector
+// and its full value. In case there is no valid cached record, the `load`
+// function is used to obtain the value.
+func (sc *SessionCache) FindUser(
+	selector, value string,
+	load func() (common.UserID, error),
+) (common.UserID, error) {
+	if sc == nil {
+		return load()
+	}
+	key := sessionCacheKey(selector, value)
+	sc.mu.Lock()
+	if userID, ok := sc.lookup(key, sc.nowProvider()); ok {
+		if userID.IsValid() {
+			sc.stats.Hits++
+
+		} else {
+			sc.stats.NegativeHits++
+		}
+		sc.mu.Unlock()
+		return userID, nil
+	}
+	if call, ok := sc.inflight[key]; ok {
+		sc.stats.Coalesced++
+		sc.mu.Unlock()
+		<-call.done
+		return call.userID, call.err
+	}
+	sc.stats.Misses++
+	call := &sessionLookup{done: make(chan struct{})}
+	sc.inflight[key] = call
+	generation := sc.generation
+	sc.mu.Unlock()
+
+	call.userID, call.err = load()
+
+	sc.mu.Lock()
+	delete(sc.inflight, key)
+	// if some invalidation happened in the meantime, we cannot be sure
+	// the loaded value is still valid so we rather do not store it
+	if call.err == nil && generation == sc.generation {
+		sc.store(key, selector, call.userID, sc.nowProvider())
+	}
+	sc.mu.Unlock()
+	close(call.done)
+	return call.userID, call.err
+}
+
+// Invalidate removes all the cached entries of a session
+// specified by its selector. It returns number of removed entries.
+func (sc *SessionCache) Invalidate(selector string) int {
+	if sc == nil {
+		return 0
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.generation++
+	var removed int
+	for elm := sc.lru.Front(); elm != nil; {
+		next := elm.Next()
+		entry := elm.Value.(*sessionCacheEntry)
+		if entry.selector == selector {
+			sc.lru.Remove(elm)
+			delete(sc.entries, entry.key)
+			removed++
+		}
+		elm = next
+	}
+	sc.stats.Invalidations += int64(removed)
+	return removed
+}
+
+// IsLogoutPath tests whether the path matches any of configured
+// logout path suffixes.
+func (sc *SessionCache) IsLogoutPath(path string) bool {
+	if sc == nil {
+		return false
+	}
+	for _, suff := range sc.conf.LogoutPathSuffixes {
+		if strings.HasSuffix(path, suff) {
+			return true
+		}
+	}
+	return false
+}
+
+func (sc *SessionCache) Stats() SessionCacheStats {
+	if sc == nil {
+		return SessionCacheStats{}
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	ans := sc.stats
+	ans.Entries = sc.lru.Len()
+	ans.MaxEntries = sc.conf.MaxEntries
+	total := ans.Hits + ans.NegativeHits + ans.Misses + ans.Coalesced
+	if total > 0 {
+		ans.HitRatio = float64(ans.Hits+ans.NegativeHits+ans.Coalesced) / float64(total)
+	}
+	return ans
+}
+
+// NewSessionCache creates a new session cache. For a nil conf,
+// nil is returned (which is a valid, non-caching, value).
+// The conf is expected to be validated already.
+func NewSessionCache(conf *SessionCacheConf) *SessionCache {
+	if conf == nil {
+		return nil
+	}
+	return &SessionCache{
+		conf:        *conf,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+		inflight:    make(map[string]*sessionLookup),
+		nowProvider: time.Now,
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cnc
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSessionCache(maxEntries int) (*SessionCache, *time.Time) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	sc := NewSessionCache(&SessionCacheConf{
+		MaxEntries:         maxEntries,
+		PositiveTTLSecs:    60,
+		NegativeTTLSecs:    10,
+		LogoutPathSuffixes: []string{"/user/logout"},
+	})
+	sc.nowProvider = func() time.Time { return now }
+	return sc, &now
+}
+
+func loaderOf(userID common.UserID, calls *int) func() (common.UserID, error) {
+	return func() (common.UserID, error) {
+		*calls++
+		return userID, nil
+	}
+}
+
+func TestSessionCacheNilIsPassThrough(t *testing.T) {
+	var sc *SessionCache
+	var calls int
+	userID, err := sc.FindUser("sel", "sel-val", loaderOf(3, &calls))
+	assert.NoError(t, err)
+	assert.Equal(t, common.UserID(3), userID)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 0, sc.Invalidate("sel"))
+	assert.False(t, sc.IsLogoutPath("/user/logout"))
+}
+
+func TestSessionCachePositiveAndNegativeTTL(t *testing.T) {
+	sc, now := newTestSessionCache(10)
+	var posCalls, negCalls int
+	for i := 0; i < 3; i++ {
+		userID, err := sc.FindUser("a", "a-val", loaderOf(7, &posCalls))
+		assert.NoError(t, err)
+		assert.Equal(t, common.UserID(7), userID)
+		userID, err = sc.FindUser("b", "b-val", loaderOf(common.InvalidUserID, &negCalls))
+		assert.NoError(t, err)
+		assert.Equal(t, common.InvalidUserID, userID)
+	}
+	assert.Equal(t, 1, posCalls)
+	assert.Equal(t, 1, negCalls)
+
+	*now = now.Add(15 * time.Second)
+	sc.FindUser("a", "a-val", loaderOf(7, &posCalls))
+	sc.FindUser("b", "b-val", loaderOf(common.InvalidUserID, &negCalls))
+	assert.Equal(t, 1, posCalls)
+	assert.Equal(t, 2, negCalls)
+
+	*now = now.Add(60 * time.Second)
+	sc.FindUser("a", "a-val", loaderOf(7, &posCalls))
+	assert.Equal(t, 2, posCalls)
+
+	stats := sc.Stats()
+	assert.Equal(t, int64(3), stats.Hits)
+	assert.Equal(t, int64(2), stats.NegativeHits)
+	assert.Equal(t, int64(4), stats.Misses)
+	assert.InDelta(t, 5.0/9.0, stats.HitRatio, 0.0001)
+}
+
+func TestSessionCacheDistinguishesValidators(t *testing.T) {
+	sc, _ := newTestSessionCache(10)
+	var calls int
+	sc.FindUser("a", "a-valid", loaderOf(7, &calls))
+	userID, _ := sc.FindUser("a", "a-forged", loaderOf(common.InvalidUserID, &calls))
+	assert.Equal(t, common.InvalidUserID, userID)
+	assert.Equal(t, 2, calls)
+}
+
+func TestSessionCacheDoesNotCacheErrors(t *testing.T) {
+	sc, _ := newTestSessionCache(10)
+	var calls int
+	failing := func() (common.UserID, error) {
+		calls++
+		return common.InvalidUserID, errors.New("db down")
+	}
+	_, err := sc.FindUser("a", "a-val", failing)
+	assert.Error(t, err)
+	_, err = sc.FindUser("a", "a-val", failing)
+	assert.Error(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 0, sc.Stats().Entries)
+}
+
+func TestSessionCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	sc, _ := newTestSessionCache(2)
+	var calls int
+	sc.FindUser("a", "a-val", loaderOf(1, &calls))
+	sc.FindUser("b", "b-val", loaderOf(2, &calls))
+	sc.FindUser("a", "a-val", loaderOf(1, &calls)) // "b" becomes the oldest one
+	sc.FindUser("c", "c-val", loaderOf(3, &calls))
+	assert.Equal(t, 3, calls)
+
+	sc.FindUser("a", "a-val", loaderOf(1, &calls))
+	assert.Equal(t, 3, calls)
+	sc.FindUser("b", "b-val", loaderOf(2, &calls))
+	assert.Equal(t, 4, calls)
+
+	stats := sc.Stats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, int64(2), stats.Evictions)
+}
+
+func TestSessionCacheInvalidate(t *testing.T) {
+	sc, _ := newTestSessionCache(10)
+	var calls int
+	sc.FindUser("a", "a-val1", loaderOf(1, &calls))
+	sc.FindUser("a", "a-val2", loaderOf(common.InvalidUserID, &calls))
+	sc.FindUser("b", "b-val", loaderOf(2, &calls))
+	assert.Equal(t, 2, sc.Invalidate("a"))
+	assert.True(t, sc.IsLogoutPath("/service/3/kontext/user/logout"))
+	assert.False(t, sc.IsLogoutPath("/service/3/kontext/user/login"))
+
+	sc.FindUser("a", "a-val1", loaderOf(1, &calls))
+	sc.FindUser("b", "b-val", loaderOf(2, &calls))
+	assert.Equal(t, 4, calls)
+	assert.Equal(t, int64(2), sc.Stats().Invalidations)
+}
+
+func TestSessionCacheCoalescesConcurrentLookups(t *testing.T) {
+	sc, _ := newTestSessionCache(10)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func() (common.UserID, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+	var wg sync.WaitGroup
+	results := make([]common.UserID, 5)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _ = sc.FindUser("a", "a-val", loader)
+	}()
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	for i := 1; i < len(results); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = sc.FindUser("a", "a-val", loader)
+		}(i)
+	}
+	assert.Eventually(
+		t, func() bool { return sc.Stats().Coalesced == 4 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+	for _, v := range results {
+		assert.Equal(t, common.UserID(42), v)
+	}
+}
+
+func TestSessionCacheSkipsStoreAfterInvalidation(t *testing.T) {
+	sc, _ := newTestSessionCache(10)
+	var calls int
+	sc.FindUser("a", "a-val", func() (common.UserID, error) {
+		calls++
+		sc.Invalidate("a") // e.g. a logout during a running lookup
+		return 1, nil
+	})
+	sc.FindUser("a", "a-val", loaderOf(1, &calls))
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,251 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cnc
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/cnc-gokit/collections"
+)
+
+const (
+	// userBanCacheTTL specifies how long a user ban status is cached.
+	// It should be short as bans can be also created/removed by other
+	// APIGuard instances or directly in the database.
+	userBanCacheTTL = 30 * time.Second
+)
+
+var (
+	ErrUserBanNotFound   = errors.New("no active ban found for the user")
+	ErrUserAlreadyBanned = errors.New("user already banned")
+	ErrNoDatabaseForBans = errors.New("user bans require the CNC database")
+)
+
+// UserBan is an active or historical ban of a registered user
+// (see the api_user_ban table)
+type UserBan struct {
+	ID       int64         `json:"id"`
+	ReportID string        `json:"reportId,omitempty"`
+	UserID   common.UserID `json:"userId"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Active   bool          `json:"active"`
+}
+
+type userBanCacheEntry struct {
+	ban     *UserBan
+	expires time.Time
+}
+
+// UserBans provides access to user bans stored in the api_user_ban
+// table. Tested bans are cached for a short time. In case no database
+// is available, no user is considered banned.
+type UserBans struct {
+	db       *sql.DB
+	location *time.Location
+	cache    *collections.ConcurrentMap[common.UserID, userBanCacheEntry]
+
+	// lastPrune stores the time (in Unix nanoseconds) expired
+	// entries were last removed from the cache
+	lastPrune atomic.Int64
+}
+
+func (ub *UserBans) now() time.Time {
+	return time.Now().In(ub.location)
+}
+
+func (ub *UserBans) findActive(userID common.UserID, now time.Time) (*UserBan, error) {
+	row := ub.db.QueryRow(
+		"SELECT id, report_id, user_id, start_dt, end_dt FROM api_user_ban "+
+			"WHERE user_id = ? AND active = 1 AND start_dt <= ? AND end_dt > ? "+
+			"ORDER BY end_dt DESC LIMIT 1",
+		userID, now, now,
+	)
+	var ban UserBan
+	var reportID sql.NullString
+	err := row.Scan(&ban.ID, &reportID, &ban.UserID, &ban.Start, &ban.End)
+	if err == sql.ErrNoRows {
+		return nil, nil
+
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to find user ban: %w", err)
+	}
+	ban.ReportID = reportID.String
+	ban.Active = true
+	return &ban, nil
+}
+
+// pruneCache removes expired entries from the cache. To keep
+// FindActive cheap, the cache is pruned at most once per userBanCacheTTL.
+func (ub *UserBans) pruneCache(now time.Time) {
+	last := ub.lastPrune.Load()
+	if now.UnixNano()-last < int64(userBanCacheTTL) || !ub.lastPrune.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	for _, userID := range ub.cache.Keys() {
+		if entry, ok := ub.cache.GetWithTest(userID); ok && !now.Before(entry.expires) {
+			ub.cache.Delete(userID)
+		}
+	}
+}
+
+// FindActive returns an active ban of the user or nil
+// if the user is not banned.
+func (ub *UserBans) FindActive(userID common.UserID) (*UserBan, error) {
+	if ub == nil || ub.db == nil || !userID.IsValid() {
+		return nil, nil
+	}
+	now := ub.now()
+	if entry, ok := ub.cache.GetWithTest(userID); ok && now.Before(entry.expires) {
+		if entry.ban != nil && !now.Before(entry.ban.End) {
+			return nil, nil
+		}
+		return entry.ban, nil
+	}
+	ub.pruneCache(now)
+	ban, err := ub.findActive(userID, now)
+	if err != nil {
+		return nil, err
+	}
+	ub.cache.Set(userID, userBanCacheEntry{ban: ban, expires: now.Add(userBanCacheTTL)})
+	return ban, nil
+}
+
+// Insert bans the user for the specified duration. The reportID
+// links the ban with an alarm report (it can be empty).
+func (ub *UserBans) Insert(userID common.UserID, reportID string, duration time.Duration) (*UserBan, error) {
+	if ub.db == nil {
+		return nil, ErrNoDatabaseForBans
+	}
+	now := ub.now()
+	tx, err := ub.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert user ban: %w", err)
+	}
+	row := tx.QueryRow(
+		"SELECT COUNT(*) FROM api_user_ban "+
+			"WHERE user_id = ? AND active = 1 AND start_dt <= ? AND end_dt > ?",
+		userID, now, now,
+	)
+	var numActive int
+	if err := row.Scan(&numActive); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to insert user ban: %w", err)
+	}
+	if numActive > 0 {
+		tx.Rollback()
+		return nil, ErrUserAlreadyBanned
+	}
+	ban := &UserBan{
+		ReportID: reportID,
+		UserID:   userID,
+		Start:    now,
+		End:      now.Add(duration),
+		Active:   true,
+	}
+	res, err := tx.Exec(
+		"INSERT INTO api_user_ban (report_id, user_id, start_dt, end_dt) VALUES (?, ?, ?, ?)",
+		sql.NullString{String: reportID, Valid: reportID != ""}, userID, ban.Start, ban.End,
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to insert user ban: %w", err)
+	}
+	if ban.ID, err = res.LastInsertId(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to insert user ban: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to insert user ban: %w", err)
+	}
+	ub.cache.Delete(userID)
+	return ban, nil
+}
+
+// Remove deactivates all the active bans of the user. The records
+// are kept for auditing purposes.
+func (ub *UserBans) Remove(userID common.UserID) error {
+	if ub.db == nil {
+		return ErrNoDatabaseForBans
+	}
+	now := ub.now()
+	res, err := ub.db.Exec(
+		"UPDATE api_user_ban SET active = 0 "+
+			"WHERE user_id = ? AND active = 1 AND start_dt <= ? AND end_dt > ?",
+		userID, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to remove user ban: %w", err)
+	}
+	numAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to remove user ban: %w", err)
+	}
+	ub.cache.Delete(userID)
+	if numAffected == 0 {
+		return ErrUserBanNotFound
+	}
+	return nil
+}
+
+// ListActive returns all the currently active user bans
+func (ub *UserBans) ListActive() ([]UserBan, error) {
+	if ub.db == nil {
+		return []UserBan{}, nil
+	}
+	now := ub.now()
+	rows, err := ub.db.Query(
+		"SELECT id, report_id, user_id, start_dt, end_dt FROM api_user_ban "+
+			"WHERE active = 1 AND start_dt <= ? AND end_dt > ? ORDER BY start_dt",
+		now, now,
+	)
+	if err != nil {
+		return []UserBan{}, fmt.Errorf("failed to list user bans: %w", err)
+	}
+	defer rows.Close()
+	ans := make([]UserBan, 0, 20)
+	for rows.Next() {
+		var ban UserBan
+		var reportID sql.NullString
+		if err := rows.Scan(&ban.ID, &reportID, &ban.UserID, &ban.Start, &ban.End); err != nil {
+			return []UserBan{}, fmt.Errorf("failed to list user bans: %w", err)
+		}
+		ban.ReportID = reportID.String
+		ban.Active = true
+		ans = append(ans, ban)
+	}
+	return ans, rows.Err()
+}
+
+// NewUserBans creates a new UserBans instance. The db can be nil
+// in which case no user is considered banned.
+func NewUserBans(db *sql.DB, loc *time.Location) *UserBans {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &UserBans{
+		db:       db,
+		location: loc,
+		cache:    collections.NewConcurrentMap[common.UserID, userBanCacheEntry](),
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cnc
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/czcorpus/apiguard/common"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	findUserBanQuery   = regexp.QuoteMeta("SELECT id, report_id, user_id, start_dt, end_dt FROM api_user_ban WHERE user_id = ?")
+	countUserBansQuery = regexp.QuoteMeta("SELECT COUNT(*) FROM api_user_ban")
+	insertUserBanQuery = regexp.QuoteMeta("INSERT INTO api_user_ban")
+	removeUserBanQuery = regexp.QuoteMeta("UPDATE api_user_ban SET active = 0")
+)
+
+func newMockUserBans(t *testing.T) (*UserBans, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return NewUserBans(db, time.UTC), mock
+}
+
+func userBanRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "report_id", "user_id", "start_dt", "end_dt"})
+}
+
+func TestUserBansFindActive(t *testing.T) {
+	bans, mock := newMockUserBans(t)
+	now := time.Now().In(time.UTC)
+	mock.ExpectQuery(findUserBanQuery).
+		WithArgs(common.UserID(42), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(userBanRows().AddRow(7, "r1", 42, now.Add(-time.Hour), now.Add(time.Hour)))
+
+	ban, err := bans.FindActive(42)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), ban.ID)
+	assert.Equal(t, "r1", ban.ReportID)
+	assert.True(t, ban.Active)
+	// the cached ban is used
+	ban, err = bans.FindActive(42)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), ban.ID)
+
+	mock.ExpectQuery(findUserBanQuery).
+		WithArgs(common.UserID(43), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(userBanRows())
+	ban, err = bans.FindActive(43)
+	assert.NoError(t, err)
+	assert.Nil(t, ban)
+
+	ban, err = bans.FindActive(common.InvalidUserID)
+	assert.NoError(t, err)
+	assert.Nil(t, ban)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserBansFindActiveExpiredCachedBan(t *testing.T) {
+	bans, mock := newMockUserBans(t)
+	now := time.Now().In(time.UTC)
+	bans.cache.Set(42, userBanCacheEntry{
+		ban:     &UserBan{ID: 7, UserID: 42, Start: now.Add(-time.Hour), End: now.Add(-time.Second)},
+		expires: now.Add(userBanCacheTTL),
+	})
+	ban, err := bans.FindActive(42)
+	assert.NoError(t, err)
+	assert.Nil(t, ban)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserBansFindActivePrunesCache(t *testing.T) {
+	bans, mock := newMockUserBans(t)
+	now := time.Now().In(time.UTC)
+	bans.cache.Set(42, userBanCacheEntry{expires: now.Add(-time.Second)})
+	bans.cache.Set(43, userBanCacheEntry{expires: now.Add(userBanCacheTTL)})
+	mock.ExpectQuery(findUserBanQuery).
+		WithArgs(common.UserID(44), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(userBanRows())
+
+	_, err := bans.FindActive(44)
+	assert.NoError(t, err)
+	assert.False(t, bans.cache.HasKey(42))
+	assert.True(t, bans.cache.HasKey(43))
+	assert.True(t, bans.cache.HasKey(44))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserBansInsert(t *testing.T) {
+	bans, mock := newMockUserBans(t)
+	mock.ExpectQuery(findUserBanQuery).WillReturnRows(userBanRows())
+	ban, err := bans.FindActive(42)
+	assert.NoError(t, err)
+	assert.Nil(t, ban)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(countUserBansQuery).
+		WithArgs(common.UserID(42), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(insertUserBanQuery).
+		WithArgs("r1", common.UserID(42), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectCommit()
+	ban, err = bans.Insert(42, "r1", 2*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), ban.ID)
+	assert.Equal(t, 2*time.Hour, ban.End.Sub(ban.Start))
+	// the cached "not banned" status must not be used anymore
+	assert.False(t, bans.cache.HasKey(42))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserBansInsertAlreadyBanned(t *testing.T) {
+	bans, mock := newMockUserBans(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(countUserBansQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+	_, err := bans.Insert(42, "", time.Hour)
+	assert.ErrorIs(t, err, ErrUserAlreadyBanned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserBansRemove(t *testing.T) {
+	bans, mock := newMockUserBans(t)
+	now := time.Now().In(time.UTC)
+	mock.ExpectQuery(findUserBanQuery).
+		WillReturnRows(userBanRows().AddRow(7, nil, 42, now.Add(-time.Hour), now.Add(time.Hour)))
+	ban, err := bans.FindActive(42)
+	assert.NoError(t, err)
+	assert.NotNil(t, ban)
+
+	mock.ExpectExec(removeUserBanQuery).
+		WithArgs(common.UserID(42), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, bans.Remove(42))
+	assert.False(t, bans.cache.HasKey(42))
+
+	mock.ExpectExec(removeUserBanQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, bans.Remove(42), ErrUserBanNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserBansWithoutDatabase(t *testing.T) {
+	bans := NewUserBans(nil, time.UTC)
+	ban, err := bans.FindActive(42)
+	assert.NoError(t, err)
+	assert.Nil(t, ban)
+	_, err = bans.Insert(42, "", time.Hour)
+	assert.ErrorIs(t, err, ErrNoDatabaseForBans)
+	assert.ErrorIs(t, bans.Remove(42), ErrNoDatabaseForBans)
+}
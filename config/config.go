@@ -22,13 +22,16 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"regexp"
 	"time"
 
 	"github.com/czcorpus/apiguard/botwatch"
 	"github.com/czcorpus/apiguard/cnc"
 	"github.com/czcorpus/apiguard/monitoring"
 	"github.com/czcorpus/apiguard/proxy"
+	"github.com/czcorpus/apiguard/ratelimit"
 	"github.com/czcorpus/apiguard/reporting"
+	"github.com/czcorpus/apiguard/reputation"
 	"github.com/czcorpus/apiguard/session"
 	"github.com/czcorpus/apiguard/telemetry"
 
@@ -59,6 +62,10 @@ type GeneralServiceConf struct {
 
 type CNCAuthConf struct {
 	SessionCookieName string `json:"sessionCookieName"`
+
+	// SessionCache enables caching of user lookups by session.
+	// If nil, each lookup queries the CNC database.
+	SessionCache *cnc.SessionCacheConf `json:"sessionCache"`
 }
 
 type OperationMode string
@@ -146,7 +153,15 @@ type Configuration struct {
 	Mail              *monitoring.MailConf     `json:"mail"`
 	CNCAuth           CNCAuthConf              `json:"cncAuth"`
 	Auth              *AuthConf                `json:"auth"`
-	IgnoreStoredState bool                     `json:"-"`
+	RateLimiting      *ratelimit.Conf          `json:"rateLimiting"`
+	Honeypot          *HoneypotConf            `json:"honeypot"`
+	Reputation        *reputation.Conf         `json:"reputation"`
+
+	// AuditLogPath specifies a file where requests denied by service
+	// guards are logged. Denials are also written to the reporting.
+	AuditLogPath string `json:"auditLogPath"`
+
+	IgnoreStoredState bool `json:"-"`
 }
 
 func (c *Configuration) loadAPIAllowlist() error {
@@ -198,6 +213,9 @@ func (c *Configuration) Validate() error {
 			return err
 		}
 	}
+	if err := c.CNCAuth.SessionCache.ValidateAndDefaults("cncAuth.sessionCache"); err != nil {
+		return err
+	}
 	if _, err := time.LoadLocation(c.TimeZone); err != nil {
 		return err
 	}
@@ -207,6 +225,24 @@ func (c *Configuration) Validate() error {
 	if err := c.Reporting.ValidateAndDefaults(); err != nil {
 		return err
 	}
+	if c.RateLimiting == nil {
+		c.RateLimiting = &ratelimit.Conf{}
+	}
+	if err := c.RateLimiting.ValidateAndDefaults("rateLimiting"); err != nil {
+		return err
+	}
+	if c.RateLimiting.Backend == ratelimit.BackendRedis && (c.Cache == nil || c.Cache.RedisAddr == "") {
+		return fmt.Errorf("rateLimiting.backend `redis` requires cache.redisAddr to be configured")
+	}
+	if err := c.Honeypot.Validate("honeypot"); err != nil {
+		return err
+	}
+	if c.Honeypot != nil && len(c.Honeypot.Recipients) > 0 && c.Mail == nil {
+		return fmt.Errorf("honeypot.recipients require the `mail` section to be configured")
+	}
+	if err := c.Reputation.ValidateAndDefaults("reputation"); err != nil {
+		return err
+	}
 	if err := c.OperationMode.Validate(); err != nil {
 		return err
 	}
@@ -264,3 +300,40 @@ type AuthConf struct {
 func (ac *AuthConf) IsDefined() bool {
 	return ac.TokenHeaderName != "" && len(ac.Tokens) > 0
 }
+
+// HoneypotConf configures paths no legitimate client should ever request
+// (e.g. /wp-login.php, /.env). Clients accessing them are banned immediately.
+// Clients from auth.localNetworks are exempt. Forwarding headers (X-Forwarded-For,
+// X-Real-IP) are considered only for requests coming from auth.knownProxies.
+type HoneypotConf struct {
+
+	// PathPatterns are regular expressions matched (unanchored)
+	// against request URL paths (e.g. "/wp-login\\.php$")
+	PathPatterns []string `json:"pathPatterns"`
+
+	// BanTTLSecs specifies how long a ban lasts. If zero,
+	// IpBanTtlSecs (or its default) is used.
+	BanTTLSecs int `json:"banTtlSecs"`
+
+	// Recipients (optional) specifies e-mail addresses notified
+	// about each new ban (the `mail` section must be configured).
+	Recipients []string `json:"recipients"`
+}
+
+func (hc *HoneypotConf) Validate(context string) error {
+	if hc == nil {
+		return nil
+	}
+	if len(hc.PathPatterns) == 0 {
+		return fmt.Errorf("%s.pathPatterns must contain at least one pattern", context)
+	}
+	for i, pattern := range hc.PathPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("%s.pathPatterns[%d] is invalid: %w", context, i, err)
+		}
+	}
+	if hc.BanTTLSecs < 0 {
+		return fmt.Errorf("%s.banTtlSecs must be a non-negative number", context)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package globctx
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/czcorpus/apiguard/reporting"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// AuditLogger writes records of requests denied by guards
+// to a dedicated log file (if configured) and to the reporting.
+type AuditLogger struct {
+	tDBWriter  reporting.ReportingWriter
+	fileLogger *zerolog.Logger
+}
+
+// Log writes the denial record. A nil AuditLogger is valid
+// and it ignores all the records.
+func (a *AuditLogger) Log(record *reporting.GuardDenial) {
+	if a == nil {
+		return
+	}
+	a.tDBWriter.Write(record)
+	if a.fileLogger == nil {
+		return
+	}
+	event := a.fileLogger.Info().
+		Bool("auditLog", true).
+		Str("service", record.Service).
+		Int("status", record.Status).
+		Str("reason", record.ReasonCode).
+		Str("guardType", record.GuardType).
+		Str("clientIp", record.ClientIP).
+		Str("method", record.Method).
+		Str("path", record.Path)
+	if record.Rule != "" {
+		event.Str("rule", record.Rule)
+	}
+	if record.Limit != "" {
+		event.Str("exceededLimit", record.Limit)
+	}
+	if record.ClientID.IsValid() {
+		event.Int("clientId", int(record.ClientID))
+	}
+	event.Send()
+}
+
+// NewAuditLogger creates a new audit logger. In case logPath
+// is empty, denials are written only to the reporting.
+func NewAuditLogger(tDBWriter reporting.ReportingWriter, logPath string) (*AuditLogger, error) {
+	if logPath == "" {
+		log.Warn().Msg("auditLogPath not set - guard denials will be written only to the reporting")
+		return &AuditLogger{tDBWriter: tDBWriter}, nil
+	}
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit logger with file %s: %w", logPath, err)
+	}
+	fileLogger := zerolog.New(file).With().Timestamp().Logger()
+	return &AuditLogger{
+		tDBWriter:  tDBWriter,
+		fileLogger: &fileLogger,
+	}, nil
+}
@@ -56,7 +56,8 @@ type BackendLogger struct {
 
 // Log logs a service backend (e.g. KonText, Treq, some UJC server) access
 // using application logging (zerolog) and also by sending data to a monitoring
-// module (currently TimescaleDB).
+// module (currently TimescaleDB). The guardReason describes the decision of
+// the service guard (it can be nil if no guard was involved).
 func (b *BackendLogger) Log(
 	req *http.Request,
 	service string,
@@ -65,6 +66,7 @@ func (b *BackendLogger) Log(
 	userID common.UserID,
 	internalCall bool,
 	actionType reporting.BackendActionType,
+	guardReason zerolog.LogObjectMarshaler,
 ) {
 	if b == nil {
 		log.Error().Msg("trying to call nil backend logger - ignoring")
@@ -96,6 +98,9 @@ func (b *BackendLogger) Log(
 	if bReq.UserID.IsValid() {
 		event.Int("userId", int(bReq.UserID))
 	}
+	if guardReason != nil {
+		event.Object("guardReason", guardReason)
+	}
 	event.Send()
 }
 
@@ -22,9 +22,13 @@ import (
 	"database/sql"
 	"time"
 
+	"github.com/czcorpus/apiguard/cnc"
 	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/proxy"
 	"github.com/czcorpus/apiguard/proxy/cache"
+	"github.com/czcorpus/apiguard/ratelimit"
 	"github.com/czcorpus/apiguard/reporting"
+	"github.com/czcorpus/apiguard/reputation"
 	"github.com/czcorpus/apiguard/telemetry"
 )
 
@@ -48,8 +52,17 @@ type Context struct {
 	BackendLoggers   BackendLoggers
 	CNCDB            *sql.DB
 	TelemetryDB      telemetry.Storage
+	ClientStats      *telemetry.ClientStatsCache
 	ReportingWriter  reporting.ReportingWriter
 	Cache            cache.Cache
+	RateLimiters     ratelimit.Limiter
+	Quotas           *ratelimit.QuotaStore
+	UserBans         *cnc.UserBans
+	UserSessions     *cnc.SessionCache
+	Audit            *AuditLogger
+	BackendLoad      *proxy.BackendLoadRegistry
+	Reputation       *reputation.Blocklists
+	KnownProxies     []string
 	wCtx             context.Context
 	AnonymousUserIDs common.AnonymousUsers
 }
@@ -3,6 +3,7 @@ module github.com/czcorpus/apiguard
 go 1.25.0
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
 	github.com/bytedance/sonic v1.15.0
 	github.com/czcorpus/cnc-gokit v0.22.0
 	github.com/czcorpus/hltscl v0.2.0
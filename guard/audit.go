@@ -0,0 +1,72 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/czcorpus/apiguard/globctx"
+	"github.com/czcorpus/apiguard/logging"
+	"github.com/czcorpus/apiguard/reporting"
+)
+
+// AuditGuard wraps a guard and writes each denied request
+// to the audit trail (see globctx.AuditLogger).
+type AuditGuard struct {
+	ServiceGuard
+	serviceKey string
+	audit      *globctx.AuditLogger
+	tzLocation *time.Location
+}
+
+func (g *AuditGuard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) ReqEvaluation {
+	ans := g.ServiceGuard.EvaluateRequest(req, fallbackCookie)
+	if !ans.ForbidsAccess() {
+		return ans
+	}
+	var limit string
+	if ans.Reason.Limit != nil {
+		limit = ans.Reason.Limit.String()
+	}
+	g.audit.Log(&reporting.GuardDenial{
+		Created:    time.Now().In(g.tzLocation),
+		Service:    g.serviceKey,
+		Status:     ans.ProposedResponse,
+		ReasonCode: string(ans.Reason.Code),
+		GuardType:  string(ans.Reason.Guard),
+		Rule:       ans.Reason.Rule,
+		Limit:      limit,
+		ClientID:   ans.ClientID,
+		ClientIP:   logging.ExtractClientIP(req),
+		Method:     req.Method,
+		Path:       req.URL.Path,
+	})
+	return ans
+}
+
+// WithAudit wraps the guard by AuditGuard. It should be the outermost
+// wrapper (e.g. around ShadowGuard) so only real denials are audited.
+func WithAudit(globalCtx *globctx.Context, serviceKey string, grd ServiceGuard) ServiceGuard {
+	return &AuditGuard{
+		ServiceGuard: grd,
+		serviceKey:   serviceKey,
+		audit:        globalCtx.Audit,
+		tzLocation:   globalCtx.TimezoneLocation,
+	}
+}
@@ -21,20 +21,20 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"sync"
 	"time"
 
+	"github.com/czcorpus/apiguard/cnc"
 	"github.com/czcorpus/apiguard/common"
 	"github.com/czcorpus/apiguard/globctx"
 	"github.com/czcorpus/apiguard/guard"
 	guardImpl "github.com/czcorpus/apiguard/guard"
 	"github.com/czcorpus/apiguard/logging"
 	"github.com/czcorpus/apiguard/proxy"
+	"github.com/czcorpus/apiguard/ratelimit"
 	"github.com/czcorpus/apiguard/session"
 	"github.com/czcorpus/apiguard/telemetry"
 
 	"github.com/rs/zerolog/log"
-	"golang.org/x/time/rate"
 )
 
 // Guard in the cncauth package allows access to any user
@@ -93,15 +93,19 @@ type Guard struct {
 
 	anonymousUsers common.AnonymousUsers
 
-	rateLimiters map[string]*rate.Limiter
+	serviceKey string
 
-	confLimits []proxy.Limit
+	rateLimiters ratelimit.Limiter
 
-	rateLimitersMu sync.Mutex
+	confLimits []proxy.Limit
 
 	sessionValFactory func() session.HTTPSession
 
 	userFinder guardImpl.UserFinder
+
+	userBans *cnc.UserBans
+
+	delayPolicy *guardImpl.DelayPolicy
 }
 
 func (kua *Guard) TestUserIsAnonymous(userID common.UserID) bool {
@@ -109,11 +113,14 @@ func (kua *Guard) TestUserIsAnonymous(userID common.UserID) bool {
 }
 
 // CalcDelay calculates a delay user deserves.
-// CNC-auth guard applies only two delays:
-// 1) zero for non-banned users
-// 2) guard.UltraDuration which is basically a ban
+// Unless a tarpit is configured for the service, the delay
+// is always zero.
 func (kua *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
-	return 0, nil
+	return kua.delayPolicy.CalcDelay(req, clientID)
+}
+
+func (kua *Guard) EstimateDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return kua.delayPolicy.EstimateDelay(req, clientID)
 }
 
 func (kua *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
@@ -207,6 +214,7 @@ func (analyzer *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.C
 				ClientID:               common.InvalidUserID,
 				Error:                  fmt.Errorf("session cookie not found"),
 				RequiresFallbackCookie: requiresFallbackCookie,
+				Reason:                 guard.Reason{Code: guard.ReasonNoCredentials, Guard: guard.GuardTypeCNCAuth},
 			}
 
 		} else {
@@ -221,6 +229,7 @@ func (analyzer *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.C
 			ClientID:               apiUserID,
 			RequiresFallbackCookie: requiresFallbackCookie,
 			Error:                  fmt.Errorf("failed to determine userID: %w", err),
+			Reason:                 guard.Reason{Code: guard.ReasonInternalError, Guard: guard.GuardTypeCNCAuth},
 		}
 	}
 	if !apiUserID.IsValid() {
@@ -230,33 +239,28 @@ func (analyzer *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.C
 				ClientID:         common.InvalidUserID,
 				SessionID:        "",
 				Error:            nil,
+				Reason:           guard.Reason{Code: guard.ReasonAllowed, Guard: guard.GuardTypeCNCAuth},
 			}
 		}
 		return guard.ReqEvaluation{
 			ProposedResponse:       http.StatusUnauthorized,
 			RequiresFallbackCookie: true,
+			Reason:                 guard.Reason{Code: guard.ReasonInvalidCredentials, Guard: guard.GuardTypeCNCAuth},
 		}
 	}
-	if len(analyzer.confLimits) > 0 {
-		analyzer.rateLimitersMu.Lock()
-		defer analyzer.rateLimitersMu.Unlock()
-		limiter, exists := analyzer.rateLimiters[clientIP]
-		if !exists {
-			flimit := analyzer.confLimits[0]
-			limiter = rate.NewLimiter(
-				flimit.NormLimitPerSec(),
-				flimit.BurstLimit,
-			)
-			analyzer.rateLimiters[clientIP] = limiter
-		}
-		if !limiter.Allow() {
-			log.Debug().Str("clientIp", clientIP).Msg("limiting client with status 429")
-			return guard.ReqEvaluation{
-				ProposedResponse:       http.StatusTooManyRequests,
-				ClientID:               apiUserID,
-				SessionID:              cookieValue.String(),
-				RequiresFallbackCookie: requiresFallbackCookie,
-			}
+	if ok, limit := analyzer.rateLimiters.AllowN(analyzer.serviceKey, clientIP, analyzer.confLimits, guard.RequestCost(req)); !ok {
+		log.Debug().
+			Str("clientIp", clientIP).
+			Stringer("limit", limit).
+			Msg("limiting client with status 429")
+		return guard.ReqEvaluation{
+			ProposedResponse:       http.StatusTooManyRequests,
+			ClientID:               apiUserID,
+			SessionID:              cookieValue.String(),
+			RequiresFallbackCookie: requiresFallbackCookie,
+			ExceededLimit:          limit,
+			Reason: guard.Reason{
+				Code: guard.ReasonRateLimit, Guard: guard.GuardTypeCNCAuth, Limit: limit},
 		}
 	}
 
@@ -267,30 +271,40 @@ func (analyzer *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.C
 			ProposedResponse:       http.StatusInternalServerError,
 			RequiresFallbackCookie: requiresFallbackCookie,
 			Error:                  err,
+			Reason:                 guard.Reason{Code: guard.ReasonInternalError, Guard: guard.GuardTypeCNCAuth},
 		}
 	}
 	if banned {
 		return guard.ReqEvaluation{
 			ProposedResponse:       http.StatusForbidden,
 			RequiresFallbackCookie: requiresFallbackCookie,
+			Reason: guard.Reason{
+				Code: guard.ReasonIPBan, Guard: guard.GuardTypeCNCAuth, Rule: clientIP},
 		}
 	}
+	if ev, banned := guard.CheckUserBan(analyzer.userBans, analyzer.anonymousUsers, apiUserID); banned {
+		ev.RequiresFallbackCookie = requiresFallbackCookie
+		ev.Reason.Guard = guard.GuardTypeCNCAuth
+		return ev
+	}
 	return guard.ReqEvaluation{
 		ProposedResponse:       http.StatusOK,
 		ClientID:               apiUserID,
 		SessionID:              cookieValue.String(),
 		RequiresFallbackCookie: requiresFallbackCookie,
 		Error:                  err,
+		Reason:                 guard.Reason{Code: guard.ReasonAllowed, Guard: guard.GuardTypeCNCAuth},
 	}
 }
 
 func New(
 	globalCtx *globctx.Context,
+	serviceKey string,
 	backendSessionCookie string,
 	frontendSessionCookie string,
 	sessionType session.SessionType,
 	confLimits []proxy.Limit,
-
+	delayPolicy *guardImpl.DelayPolicy,
 ) *Guard {
 	return &Guard{
 		tlmtrStorage:          globalCtx.TelemetryDB,
@@ -299,8 +313,11 @@ func New(
 		frontendSessionCookie: frontendSessionCookie,
 		anonymousUsers:        globalCtx.AnonymousUserIDs,
 		confLimits:            confLimits,
-		rateLimiters:          make(map[string]*rate.Limiter),
+		serviceKey:            serviceKey,
+		rateLimiters:          globalCtx.RateLimiters,
 		sessionValFactory:     guardImpl.CreateSessionValFactory(sessionType),
 		userFinder:            guardImpl.NewUserFinder(globalCtx),
+		userBans:              globalCtx.UserBans,
+		delayPolicy:           delayPolicy,
 	}
 }
@@ -0,0 +1,283 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composite
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/apiguard/proxy"
+
+	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// ModeAnd requires all the child guards to accept a request
+	ModeAnd = "and"
+
+	// ModeOr requires at least one child guard to accept a request
+	ModeOr = "or"
+)
+
+// ChildConf specifies a guard used within a composite guard
+type ChildConf struct {
+	Type guard.GuardType `json:"type"`
+
+	// Limits optionally overrides the service limits for the guard.
+	// Please note that each child guard has its own rate limiting
+	// namespace so the children never share their limits.
+	Limits []proxy.Limit `json:"limits"`
+}
+
+// Conf configures a composite guard
+type Conf struct {
+	Mode   string      `json:"mode"`
+	Guards []ChildConf `json:"guards"`
+}
+
+func (c *Conf) Validate(context string) error {
+	if c == nil {
+		return fmt.Errorf("%s is missing", context)
+	}
+	if c.Mode != ModeAnd && c.Mode != ModeOr {
+		return fmt.Errorf("%s.mode has an invalid value `%s` (expected `and` or `or`)", context, c.Mode)
+	}
+	if len(c.Guards) < 2 {
+		return fmt.Errorf("%s.guards must contain at least two guards", context)
+	}
+	used := make(map[guard.GuardType]bool)
+	for i, child := range c.Guards {
+		if !child.Type.IsValid() {
+			return fmt.Errorf("%s.guards[%d].type has an invalid value `%s`", context, i, child.Type)
+		}
+		if child.Type == guard.GuardTypeComposite || child.Type == guard.GuardTypeNull {
+			return fmt.Errorf("%s.guards[%d].type cannot be `%s`", context, i, child.Type)
+		}
+		if used[child.Type] {
+			return fmt.Errorf("%s.guards[%d].type `%s` is used more than once", context, i, child.Type)
+		}
+		used[child.Type] = true
+		for j, limit := range child.Limits {
+			if limit.ReqPerTimeThreshold <= 0 || limit.ReqCheckingIntervalSecs <= 0 {
+				return fmt.Errorf("%s.guards[%d].limits[%d] has an invalid value", context, i, j)
+			}
+			if limit.BurstLimit == 0 {
+				log.Warn().
+					Int("default", limit.ReqPerTimeThreshold).
+					Msgf("%s.guards[%d].limits[%d].burstLimit not set, using reqPerTimeThreshold", context, i, j)
+				c.Guards[i].Limits[j].BurstLimit = limit.ReqPerTimeThreshold
+			}
+		}
+	}
+	return nil
+}
+
+// Includes tests whether the composite guard contains
+// a child guard of the specified type.
+func (c *Conf) Includes(gt guard.GuardType) bool {
+	if c == nil {
+		return false
+	}
+	for _, child := range c.Guards {
+		if child.Type == gt {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictiveness ranks proposed responses of child guards
+// so their evaluations can be merged
+func restrictiveness(status int) int {
+	switch {
+	case status < 400:
+		return 0
+	case status == http.StatusTooManyRequests:
+		return 1
+	case status == http.StatusUnauthorized:
+		return 2
+	case status < 500:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// Guard combines several guards with AND/OR semantics.
+//
+// In the AND mode, all the children evaluate each request (so their
+// rate limits are applied consistently) and the most restrictive
+// evaluation wins. In the OR mode, children are tried in the configured
+// order and the first accepting one wins. In case none of them accepts
+// the request, the least restrictive evaluation is returned.
+type Guard struct {
+	mode     string
+	children []guard.ServiceGuard
+
+	// winners maps evaluated requests to the index of the child
+	// which produced the resulting evaluation. Requests are identified
+	// by their URL as requests derived via WithContext (e.g. by the cost
+	// guard) share it with the original one. Entries are removed once
+	// the request's context is done.
+	winners *collections.ConcurrentMap[*url.URL, int]
+}
+
+// CalcDelay returns the longest delay proposed by the children.
+// As all the children record requests to the same client stats,
+// only the first child able to estimate delays without recording
+// actually records the request. The others just estimate their delay.
+func (g *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	var ans time.Duration
+	var recorded bool
+	for _, child := range g.children {
+		var delay time.Duration
+		var err error
+		estimator, ok := child.(guard.DelayEstimator)
+		if ok && recorded {
+			delay, err = estimator.EstimateDelay(req, clientID)
+
+		} else {
+			delay, err = child.CalcDelay(req, clientID)
+			recorded = recorded || ok
+		}
+		if err != nil {
+			return 0, err
+		}
+		ans = max(ans, delay)
+	}
+	return ans, nil
+}
+
+// LogAppliedDelay logs the delay via the first child only as all
+// the children write to the same telemetry storage.
+func (g *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return g.children[0].LogAppliedDelay(respDelay, clientID)
+}
+
+// authenticated finds the index of the first evaluation
+// with a valid client ID (or 0 if there is no such evaluation)
+func authenticated(evals []guard.ReqEvaluation) int {
+	for i, ev := range evals {
+		if ev.ClientID.IsValid() {
+			return i
+		}
+	}
+	return 0
+}
+
+// evaluateAnd returns the resulting evaluation along with
+// the index of the child which produced it
+func (g *Guard) evaluateAnd(req *http.Request, fallbackCookie *http.Cookie) (guard.ReqEvaluation, int) {
+	evals := make([]guard.ReqEvaluation, len(g.children))
+	worst := 0
+	for i, child := range g.children {
+		evals[i] = child.EvaluateRequest(req, fallbackCookie)
+		if restrictiveness(evals[i].ProposedResponse) > restrictiveness(evals[worst].ProposedResponse) {
+			worst = i
+		}
+	}
+	if restrictiveness(evals[worst].ProposedResponse) > 0 {
+		return evals[worst], worst
+	}
+	winner := authenticated(evals)
+	return evals[winner], winner
+}
+
+// evaluateOr returns the resulting evaluation along with
+// the index of the child which produced it
+func (g *Guard) evaluateOr(req *http.Request, fallbackCookie *http.Cookie) (guard.ReqEvaluation, int) {
+	var ans guard.ReqEvaluation
+	var winner int
+	for i, child := range g.children {
+		ev := child.EvaluateRequest(req, fallbackCookie)
+		if restrictiveness(ev.ProposedResponse) == 0 {
+			return ev, i
+		}
+		if i == 0 || restrictiveness(ev.ProposedResponse) < restrictiveness(ans.ProposedResponse) {
+			ans = ev
+			winner = i
+		}
+	}
+	return ans, winner
+}
+
+func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	var ans guard.ReqEvaluation
+	var winner int
+	if g.mode == ModeAnd {
+		ans, winner = g.evaluateAnd(req, fallbackCookie)
+
+	} else {
+		ans, winner = g.evaluateOr(req, fallbackCookie)
+	}
+	if !g.winners.HasKey(req.URL) {
+		key := req.URL
+		context.AfterFunc(req.Context(), func() { g.winners.Delete(key) })
+	}
+	g.winners.Set(req.URL, winner)
+	return ans
+}
+
+// TestUserIsAnonymous prefers the safe evaluation - i.e. a user
+// is considered anonymous if any of the children says so.
+func (g *Guard) TestUserIsAnonymous(userID common.UserID) bool {
+	for _, child := range g.children {
+		if child.TestUserIsAnonymous(userID) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetermineTrueUserID delegates to the child which produced the winning
+// evaluation of the request. For requests not evaluated by the guard,
+// the first child able to authenticate the request is used.
+func (g *Guard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	if winner, ok := g.winners.GetWithTest(req.URL); ok {
+		return g.children[winner].DetermineTrueUserID(req)
+	}
+	var firstErr error
+	for _, child := range g.children {
+		userID, err := child.DetermineTrueUserID(req)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if userID.IsValid() {
+			return userID, nil
+		}
+	}
+	return common.InvalidUserID, firstErr
+}
+
+// New creates a new composite guard. The mode is expected to be validated.
+func New(mode string, children []guard.ServiceGuard) *Guard {
+	return &Guard{
+		mode:     mode,
+		children: children,
+		winners:  collections.NewConcurrentMap[*url.URL, int](),
+	}
+}
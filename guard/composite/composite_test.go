@@ -0,0 +1,180 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/guard"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeGuard struct {
+	status   int
+	userID   common.UserID
+	numEvals int
+}
+
+func (fg *fakeGuard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return time.Duration(fg.status) * time.Millisecond, nil
+}
+
+func (fg *fakeGuard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return nil
+}
+
+func (fg *fakeGuard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	fg.numEvals++
+	return guard.ReqEvaluation{ProposedResponse: fg.status, ClientID: fg.userID}
+}
+
+func (fg *fakeGuard) TestUserIsAnonymous(userID common.UserID) bool {
+	return false
+}
+
+func (fg *fakeGuard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	if fg.status == http.StatusOK {
+		return fg.userID, nil
+	}
+	return common.InvalidUserID, nil
+}
+
+// estimatingGuard records each request via CalcDelay and
+// supports delay estimation without recording
+type estimatingGuard struct {
+	fakeGuard
+	delay        time.Duration
+	numRecorded  int
+	numEstimated int
+}
+
+func (eg *estimatingGuard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	eg.numRecorded++
+	return eg.delay, nil
+}
+
+func (eg *estimatingGuard) EstimateDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	eg.numEstimated++
+	return eg.delay, nil
+}
+
+// identifyingGuard recognizes a user regardless of its evaluation
+type identifyingGuard struct {
+	fakeGuard
+	trueUserID common.UserID
+}
+
+func (ig *identifyingGuard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	return ig.trueUserID, nil
+}
+
+func TestAndMostRestrictiveWins(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	limited := &fakeGuard{status: http.StatusTooManyRequests, userID: common.InvalidUserID}
+	forbidden := &fakeGuard{status: http.StatusForbidden, userID: 3}
+	ok := &fakeGuard{status: http.StatusOK, userID: 5}
+	g := New(ModeAnd, []guard.ServiceGuard{ok, limited, forbidden})
+	assert.Equal(t, http.StatusForbidden, g.EvaluateRequest(req, nil).ProposedResponse)
+	// all the children must evaluate the request
+	assert.Equal(t, 1, ok.numEvals)
+	assert.Equal(t, 1, limited.numEvals)
+
+	anon := &fakeGuard{status: http.StatusOK, userID: common.InvalidUserID}
+	g = New(ModeAnd, []guard.ServiceGuard{anon, ok})
+	ev := g.EvaluateRequest(req, nil)
+	assert.Equal(t, http.StatusOK, ev.ProposedResponse)
+	assert.Equal(t, common.UserID(5), ev.ClientID)
+
+	delay, err := New(ModeAnd, []guard.ServiceGuard{ok, forbidden}).CalcDelay(req, common.ClientID{})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(http.StatusForbidden)*time.Millisecond, delay)
+}
+
+func TestCalcDelayRecordsRequestOnce(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	plain := &fakeGuard{status: http.StatusOK}
+	first := &estimatingGuard{delay: time.Second}
+	second := &estimatingGuard{delay: 2 * time.Second}
+	for _, mode := range []string{ModeAnd, ModeOr} {
+		delay, err := New(mode, []guard.ServiceGuard{plain, first, second}).CalcDelay(req, common.ClientID{})
+		assert.NoError(t, err)
+		assert.Equal(t, 2*time.Second, delay)
+	}
+	assert.Equal(t, 2, first.numRecorded)
+	assert.Equal(t, 0, first.numEstimated)
+	assert.Equal(t, 0, second.numRecorded)
+	assert.Equal(t, 2, second.numEstimated)
+}
+
+func TestOrFirstSuccessWins(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	unauthorized := &fakeGuard{status: http.StatusUnauthorized, userID: common.InvalidUserID}
+	ok1 := &fakeGuard{status: http.StatusOK, userID: 5}
+	ok2 := &fakeGuard{status: http.StatusOK, userID: 7}
+	g := New(ModeOr, []guard.ServiceGuard{unauthorized, ok1, ok2})
+	ev := g.EvaluateRequest(req, nil)
+	assert.Equal(t, http.StatusOK, ev.ProposedResponse)
+	assert.Equal(t, common.UserID(5), ev.ClientID)
+	assert.Equal(t, 0, ok2.numEvals)
+
+	userID, err := g.DetermineTrueUserID(req)
+	assert.NoError(t, err)
+	assert.Equal(t, common.UserID(5), userID)
+
+	limited := &fakeGuard{status: http.StatusTooManyRequests, userID: 5}
+	g = New(ModeOr, []guard.ServiceGuard{unauthorized, limited})
+	assert.Equal(t, http.StatusTooManyRequests, g.EvaluateRequest(req, nil).ProposedResponse)
+}
+
+func TestDetermineTrueUserIDUsesWinningChild(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	rejecting := &identifyingGuard{
+		fakeGuard:  fakeGuard{status: http.StatusUnauthorized, userID: common.InvalidUserID},
+		trueUserID: 3,
+	}
+	ok := &fakeGuard{status: http.StatusOK, userID: 5}
+	g := New(ModeOr, []guard.ServiceGuard{rejecting, ok})
+	// guards wrapping the composite one may evaluate a derived request
+	g.EvaluateRequest(req.WithContext(ctx), nil)
+
+	userID, err := g.DetermineTrueUserID(req)
+	assert.NoError(t, err)
+	assert.Equal(t, common.UserID(5), userID)
+
+	cancel()
+	assert.Eventually(t, func() bool { return g.winners.Len() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestConfValidate(t *testing.T) {
+	conf := &Conf{Mode: ModeOr, Guards: []ChildConf{{Type: guard.GuardTypeToken}, {Type: guard.GuardTypeCNCAuth}}}
+	assert.NoError(t, conf.Validate("compositeGuard"))
+	assert.True(t, conf.Includes(guard.GuardTypeToken))
+	assert.False(t, conf.Includes(guard.GuardTypeJWT))
+
+	conf.Guards = append(conf.Guards, ChildConf{Type: guard.GuardTypeComposite})
+	assert.Error(t, conf.Validate("compositeGuard"))
+
+	conf = &Conf{Mode: "xor", Guards: []ChildConf{{Type: guard.GuardTypeToken}, {Type: guard.GuardTypeDflt}}}
+	assert.Error(t, conf.Validate("compositeGuard"))
+}
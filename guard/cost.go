@@ -0,0 +1,151 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+type costCtxKey struct{}
+
+// CostRule assigns a cost to matching requests. The cost specifies
+// how many tokens a request consumes from client's rate limits
+// (and how many requests it represents in alarm statistics).
+type CostRule struct {
+
+	// PathPattern is a regular expression matched (unanchored)
+	// against the request URL path (e.g. "/freqs$")
+	PathPattern string `json:"pathPattern"`
+
+	// Args (optional) maps query argument names to regular expressions
+	// at least one of respective argument values must match. An empty
+	// expression just requires the argument to be present.
+	Args map[string]string `json:"args"`
+
+	Cost int `json:"cost"`
+
+	pathRegexp  *regexp.Regexp
+	argsRegexps map[string]*regexp.Regexp
+}
+
+func (rule *CostRule) matches(req *http.Request) bool {
+	if rule.pathRegexp == nil || !rule.pathRegexp.MatchString(req.URL.Path) {
+		return false
+	}
+	if len(rule.argsRegexps) == 0 {
+		return true
+	}
+	query := req.URL.Query()
+	for name, rx := range rule.argsRegexps {
+		var found bool
+		for _, v := range query[name] {
+			if rx.MatchString(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// CostRules is a list of cost rules of a service. The first matching
+// rule determines the cost of a request, for requests matching no rule,
+// the cost is 1.
+type CostRules []CostRule
+
+// Validate checks the rules and prepares them for matching. It must be
+// called before the rules are used.
+func (rules CostRules) Validate(context string) error {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Cost < 1 {
+			return fmt.Errorf("%s[%d].cost must be a positive number", context, i)
+		}
+		var err error
+		rule.pathRegexp, err = regexp.Compile(rule.PathPattern)
+		if err != nil {
+			return fmt.Errorf("%s[%d].pathPattern is invalid: %w", context, i, err)
+		}
+		rule.argsRegexps = make(map[string]*regexp.Regexp, len(rule.Args))
+		for name, pattern := range rule.Args {
+			rule.argsRegexps[name], err = regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s[%d].args.%s is invalid: %w", context, i, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// CostOf determines the cost of a request.
+func (rules CostRules) CostOf(req *http.Request) int {
+	for i := range rules {
+		if rules[i].matches(req) {
+			return rules[i].Cost
+		}
+	}
+	return 1
+}
+
+// WithRequestCost attaches a cost to a request so guards
+// can charge respective number of tokens (see RequestCost).
+func WithRequestCost(req *http.Request, cost int) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), costCtxKey{}, cost))
+}
+
+// RequestCost returns a cost attached to a request via WithRequestCost.
+// For requests without an attached cost, 1 is returned.
+func RequestCost(req *http.Request) int {
+	if cost, ok := req.Context().Value(costCtxKey{}).(int); ok {
+		return cost
+	}
+	return 1
+}
+
+// -------
+
+// CostGuard wraps a guard and attaches a cost (based on configured
+// cost rules) to each evaluated request so the wrapped guard's rate
+// limiting consumes more tokens for expensive requests.
+type CostGuard struct {
+	ServiceGuard
+	costs CostRules
+}
+
+func (g *CostGuard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) ReqEvaluation {
+	return g.ServiceGuard.EvaluateRequest(WithRequestCost(req, g.costs.CostOf(req)), fallbackCookie)
+}
+
+// WithCosts wraps the guard by CostGuard. In case there are no
+// cost rules, the original guard is returned. The wrapper should
+// be the innermost one as it only affects the wrapped guard's limiting.
+func WithCosts(costs CostRules, grd ServiceGuard) ServiceGuard {
+	if len(costs) == 0 {
+		return grd
+	}
+	return &CostGuard{
+		ServiceGuard: grd,
+		costs:        costs,
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCostRulesFirstMatchWins(t *testing.T) {
+	rules := CostRules{
+		{PathPattern: "/freqs$", Args: map[string]string{"flimit": "^[0-9]+$"}, Cost: 20},
+		{PathPattern: "/freqs$", Cost: 10},
+		{PathPattern: "/view$", Cost: 3},
+	}
+	assert.NoError(t, rules.Validate("costs"))
+	req := httptest.NewRequest(http.MethodGet, "/service/1/kontext/freqs?flimit=10", nil)
+	assert.Equal(t, 20, rules.CostOf(req))
+	req = httptest.NewRequest(http.MethodGet, "/service/1/kontext/freqs?flimit=x", nil)
+	assert.Equal(t, 10, rules.CostOf(req))
+	req = httptest.NewRequest(http.MethodGet, "/service/1/kontext/view", nil)
+	assert.Equal(t, 3, rules.CostOf(req))
+	req = httptest.NewRequest(http.MethodGet, "/service/1/kontext/corpora/corpus-info", nil)
+	assert.Equal(t, 1, rules.CostOf(req))
+}
+
+func TestCostRulesArgPresence(t *testing.T) {
+	rules := CostRules{
+		{PathPattern: "/query", Args: map[string]string{"q": ""}, Cost: 5},
+	}
+	assert.NoError(t, rules.Validate("costs"))
+	req := httptest.NewRequest(http.MethodGet, "/query?q=", nil)
+	assert.Equal(t, 5, rules.CostOf(req))
+	req = httptest.NewRequest(http.MethodGet, "/query", nil)
+	assert.Equal(t, 1, rules.CostOf(req))
+}
+
+func TestCostRulesValidate(t *testing.T) {
+	assert.Error(t, CostRules{{PathPattern: "/freqs", Cost: 0}}.Validate("costs"))
+	assert.Error(t, CostRules{{PathPattern: "(", Cost: 2}}.Validate("costs"))
+	assert.Error(
+		t,
+		CostRules{{PathPattern: "/freqs", Args: map[string]string{"q": "["}, Cost: 2}}.Validate("costs"),
+	)
+}
+
+type costRecordingGuard struct {
+	fixedGuard
+	cost int
+}
+
+func (g *costRecordingGuard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) ReqEvaluation {
+	g.cost = RequestCost(req)
+	return g.eval
+}
+
+func TestCostGuardAttachesCost(t *testing.T) {
+	rules := CostRules{{PathPattern: "/freqs$", Cost: 7}}
+	assert.NoError(t, rules.Validate("costs"))
+	inner := &costRecordingGuard{}
+	grd := WithCosts(rules, inner)
+	grd.EvaluateRequest(httptest.NewRequest(http.MethodGet, "/freqs", nil), nil)
+	assert.Equal(t, 7, inner.cost)
+	grd.EvaluateRequest(httptest.NewRequest(http.MethodGet, "/view", nil), nil)
+	assert.Equal(t, 1, inner.cost)
+}
+
+func TestWithCostsWithoutRules(t *testing.T) {
+	inner := &fixedGuard{}
+	assert.Same(t, inner, WithCosts(nil, inner))
+}
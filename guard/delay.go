@@ -0,0 +1,222 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/czcorpus/apiguard/botwatch"
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/logging"
+	"github.com/czcorpus/apiguard/telemetry"
+	"github.com/rs/zerolog/log"
+)
+
+// DelayPoint is a single point of a delay curve
+type DelayPoint struct {
+	Pressure  float64 `json:"pressure"`
+	DelaySecs float64 `json:"delaySecs"`
+}
+
+// TarpitConf configures progressive response delays for clients
+// approaching (or exceeding) service limits.
+//
+// For each request, a client "pressure" is calculated. Zero pressure
+// means no recent activity, 1.0 means the client has reached one of
+// its limits. The pressure is then mapped to a delay using the Curve.
+type TarpitConf struct {
+
+	// Curve is a piecewise linear function mapping client pressure
+	// to a delay. Points must be sorted by pressure. Below the first
+	// point, no delay is applied. Above the last point, the last point's
+	// delay is applied.
+	Curve []DelayPoint `json:"curve"`
+
+	// ExceedingWeight specifies how much a client's recent limit
+	// exceeding history (as measured by the alarm module) increases
+	// the pressure.
+	ExceedingWeight float64 `json:"exceedingWeight"`
+
+	// BotLikePenalty is added to the pressure in case the client's
+	// request intervals look scripted (see the `botwatch` section).
+	BotLikePenalty float64 `json:"botLikePenalty"`
+}
+
+func (conf *TarpitConf) Validate(context string) error {
+	if conf == nil {
+		return nil
+	}
+	if len(conf.Curve) == 0 {
+		return fmt.Errorf("%s.curve must contain at least one point", context)
+	}
+	for i, point := range conf.Curve {
+		if point.Pressure < 0 || point.DelaySecs < 0 {
+			return fmt.Errorf("%s.curve[%d] contains a negative value", context, i)
+		}
+		if i > 0 && point.Pressure <= conf.Curve[i-1].Pressure {
+			return fmt.Errorf("%s.curve must be sorted by pressure (see item %d)", context, i)
+		}
+	}
+	if conf.ExceedingWeight < 0 {
+		return fmt.Errorf("%s.exceedingWeight cannot be negative", context)
+	}
+	if conf.BotLikePenalty < 0 {
+		return fmt.Errorf("%s.botLikePenalty cannot be negative", context)
+	}
+	return nil
+}
+
+func (conf *TarpitConf) delayFor(pressure float64) time.Duration {
+	if pressure < conf.Curve[0].Pressure {
+		return 0
+	}
+	last := conf.Curve[len(conf.Curve)-1]
+	ans := last.DelaySecs
+	for i := 1; i < len(conf.Curve); i++ {
+		p0, p1 := conf.Curve[i-1], conf.Curve[i]
+		if pressure < p1.Pressure {
+			ratio := (pressure - p0.Pressure) / (p1.Pressure - p0.Pressure)
+			ans = p0.DelaySecs + ratio*(p1.DelaySecs-p0.DelaySecs)
+			break
+		}
+	}
+	return time.Duration(ans * float64(time.Second))
+}
+
+// ClientActivity describes recent activity of a client
+// with respect to configured service limits.
+type ClientActivity struct {
+
+	// Density is a ratio between the number of recent requests
+	// and the limit (the highest one from all the checked intervals)
+	Density float64
+
+	// Exceeding is a time-weighted, limit-relative measure
+	// of recent limit exceedings
+	Exceeding float64
+}
+
+// ClientActivityProvider provides recent activity of service clients
+// (see monitoring.AlarmTicker)
+type ClientActivityProvider interface {
+	ClientActivity(service string, clientID common.ClientID) ClientActivity
+}
+
+// DelayEstimator is implemented by guards able to calculate a response
+// delay without recording the request in client stats. Guards combining
+// other guards use it to make sure each request is recorded only once.
+type DelayEstimator interface {
+	EstimateDelay(req *http.Request, clientID common.ClientID) (time.Duration, error)
+}
+
+// DelayPolicy calculates progressive response delays ("tarpit")
+// for a service. A nil DelayPolicy always returns zero delay.
+type DelayPolicy struct {
+	serviceKey   string
+	conf         *TarpitConf
+	activity     ClientActivityProvider
+	clientStats  *telemetry.ClientStatsCache
+	botwatchConf *botwatch.Conf
+}
+
+// Pressure calculates how close the client is to the service limits.
+// The request is recorded in the client's stats.
+func (dp *DelayPolicy) Pressure(req *http.Request, clientID common.ClientID) (float64, error) {
+	return dp.pressure(req, clientID, true)
+}
+
+func (dp *DelayPolicy) pressure(req *http.Request, clientID common.ClientID, record bool) (float64, error) {
+	var activity ClientActivity
+	if dp.activity != nil {
+		activity = dp.activity.ClientActivity(dp.serviceKey, clientID)
+	}
+	ip, sessionID := logging.ExtractRequestIdentifiers(req)
+	var ipStats telemetry.IPProcData
+	var err error
+	if record {
+		ipStats, err = dp.clientStats.RecordRequest(ip, sessionID)
+	} else {
+		ipStats, err = dp.clientStats.Stats(ip, sessionID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to calculate client pressure: %w", err)
+	}
+	ipDensity := float64(ipStats.Count) / float64(dp.botwatchConf.NumRequestsThreshold)
+	ans := max(activity.Density, ipDensity) + dp.conf.ExceedingWeight*activity.Exceeding
+	if ipStats.Mean > 0 && ipStats.IsSuspicious(dp.botwatchConf) {
+		ans += dp.conf.BotLikePenalty
+	}
+	return ans, nil
+}
+
+// CalcDelay calculates response delay for the client based
+// on its current pressure. The request is recorded in the client's
+// stats so the method should be called once per request.
+func (dp *DelayPolicy) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return dp.calcDelay(req, clientID, true)
+}
+
+// EstimateDelay calculates response delay the same way as CalcDelay
+// but it does not record the request in the client's stats.
+func (dp *DelayPolicy) EstimateDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return dp.calcDelay(req, clientID, false)
+}
+
+func (dp *DelayPolicy) calcDelay(req *http.Request, clientID common.ClientID, record bool) (time.Duration, error) {
+	if dp == nil {
+		return 0, nil
+	}
+	pressure, err := dp.pressure(req, clientID, record)
+	if err != nil {
+		return 0, err
+	}
+	delay := dp.conf.delayFor(pressure)
+	if delay > 0 {
+		log.Debug().
+			Str("service", dp.serviceKey).
+			Str("clientId", clientID.GetKey()).
+			Float64("pressure", pressure).
+			Dur("delay", delay).
+			Msg("applying tarpit delay")
+	}
+	return delay, nil
+}
+
+// NewDelayPolicy creates a delay policy for a service. In case
+// the tarpit is not configured, nil is returned (which is a valid
+// policy applying no delays).
+func NewDelayPolicy(
+	serviceKey string,
+	conf *TarpitConf,
+	activity ClientActivityProvider,
+	clientStats *telemetry.ClientStatsCache,
+	botwatchConf *botwatch.Conf,
+) *DelayPolicy {
+	if conf == nil {
+		return nil
+	}
+	return &DelayPolicy{
+		serviceKey:   serviceKey,
+		conf:         conf,
+		activity:     activity,
+		clientStats:  clientStats,
+		botwatchConf: botwatchConf,
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard/botwatch"
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTarpitConfValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		conf  *TarpitConf
+		valid bool
+	}{
+		{"nil conf", nil, true},
+		{"valid", &TarpitConf{Curve: []DelayPoint{{0.5, 0}, {1, 2}}, ExceedingWeight: 1}, true},
+		{"empty curve", &TarpitConf{}, false},
+		{"negative delay", &TarpitConf{Curve: []DelayPoint{{0.5, -1}}}, false},
+		{"unsorted curve", &TarpitConf{Curve: []DelayPoint{{1, 0}, {0.5, 2}}}, false},
+		{"duplicate pressure", &TarpitConf{Curve: []DelayPoint{{1, 0}, {1, 2}}}, false},
+		{"negative weight", &TarpitConf{Curve: []DelayPoint{{1, 1}}, ExceedingWeight: -1}, false},
+		{"negative penalty", &TarpitConf{Curve: []DelayPoint{{1, 1}}, BotLikePenalty: -0.1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.conf.Validate("tarpit")
+			if tt.valid {
+				assert.NoError(t, err)
+
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestTarpitConfDelayFor(t *testing.T) {
+	conf := &TarpitConf{
+		Curve: []DelayPoint{{0.5, 0}, {1.0, 2}, {2.0, 5}},
+	}
+	tests := []struct {
+		pressure float64
+		expected time.Duration
+	}{
+		{0, 0},
+		{0.49, 0},
+		{0.5, 0},
+		{0.75, time.Second},
+		{1.0, 2 * time.Second},
+		{1.5, 3500 * time.Millisecond},
+		{2.0, 5 * time.Second},
+		{10.0, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, conf.delayFor(tt.pressure), "pressure %.2f", tt.pressure)
+	}
+}
+
+func TestTarpitConfDelayForSinglePoint(t *testing.T) {
+	conf := &TarpitConf{Curve: []DelayPoint{{1.0, 3}}}
+	assert.Equal(t, time.Duration(0), conf.delayFor(0.9))
+	assert.Equal(t, 3*time.Second, conf.delayFor(1.0))
+	assert.Equal(t, 3*time.Second, conf.delayFor(4.0))
+}
+
+type fixedActivity struct {
+	activity ClientActivity
+}
+
+func (a *fixedActivity) ClientActivity(service string, clientID common.ClientID) ClientActivity {
+	return a.activity
+}
+
+type fakeStatsStorage struct {
+	telemetry.Storage
+	stats telemetry.IPProcData
+}
+
+func (s *fakeStatsStorage) LoadStats(
+	clientIP, sessionID string, maxAgeSecs int, insertIfNone bool,
+) (*telemetry.IPProcData, error) {
+	ans := s.stats
+	return &ans, nil
+}
+
+func newTestDelayPolicy(activity ClientActivity, stats telemetry.IPProcData) *DelayPolicy {
+	return NewDelayPolicy(
+		"1/test",
+		&TarpitConf{
+			Curve:           []DelayPoint{{0.5, 0}, {1.0, 2}},
+			ExceedingWeight: 0.5,
+			BotLikePenalty:  0.3,
+		},
+		&fixedActivity{activity: activity},
+		telemetry.NewClientStatsCache(&fakeStatsStorage{stats: stats}, 60, time.UTC),
+		&botwatch.Conf{WatchedTimeWindowSecs: 60, NumRequestsThreshold: 10, RSDThreshold: 0.2},
+	)
+}
+
+func TestDelayPolicyPressure(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		activity ClientActivity
+		stats    telemetry.IPProcData
+		expected float64
+	}{
+		{
+			name:     "new client",
+			stats:    telemetry.IPProcData{FirstAccess: now, LastAccess: now},
+			expected: 0.1,
+		},
+		{
+			name:     "limits density",
+			activity: ClientActivity{Density: 0.8, Exceeding: 0.4},
+			stats:    telemetry.IPProcData{FirstAccess: now, LastAccess: now},
+			expected: 1.0,
+		},
+		{
+			name:  "dense requests",
+			stats: telemetry.IPProcData{Count: 4, Mean: 1, M2: 4, FirstAccess: now, LastAccess: now},
+			// (the recorded request increments the count)
+			expected: 0.5,
+		},
+		{
+			name: "bot-like regular requests",
+			stats: telemetry.IPProcData{
+				Count: 19, Mean: 1, M2: 0, FirstAccess: now.Add(-20 * time.Second),
+				LastAccess: now.Add(-time.Second),
+			},
+			expected: 2.3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dp := newTestDelayPolicy(tt.activity, tt.stats)
+			req := httptest.NewRequest(http.MethodGet, "/query", nil)
+			pressure, err := dp.Pressure(req, common.ClientID{IP: "192.168.1.10"})
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.expected, pressure, 0.01)
+		})
+	}
+}
+
+func TestDelayPolicyCalcDelay(t *testing.T) {
+	now := time.Now()
+	dp := newTestDelayPolicy(
+		ClientActivity{Density: 0.75}, telemetry.IPProcData{FirstAccess: now, LastAccess: now})
+	delay, err := dp.CalcDelay(
+		httptest.NewRequest(http.MethodGet, "/query", nil), common.ClientID{IP: "192.168.1.10"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, delay)
+}
+
+func TestDelayPolicyEstimateDelay(t *testing.T) {
+	now := time.Now()
+	dp := newTestDelayPolicy(
+		ClientActivity{}, telemetry.IPProcData{Count: 4, Mean: 1, M2: 4, FirstAccess: now, LastAccess: now})
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	clientID := common.ClientID{IP: "192.168.1.10"}
+	for i := 0; i < 3; i++ {
+		delay, err := dp.EstimateDelay(req, clientID)
+		assert.NoError(t, err)
+		assert.Equal(t, time.Duration(0), delay)
+	}
+	// only the recorded request increments the count
+	pressure, err := dp.Pressure(req, clientID)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.5, pressure, 0.01)
+}
+
+func TestNilDelayPolicy(t *testing.T) {
+	dp := NewDelayPolicy("1/test", nil, nil, nil, nil)
+	assert.Nil(t, dp)
+	delay, err := dp.CalcDelay(httptest.NewRequest(http.MethodGet, "/query", nil), common.ClientID{})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), delay)
+}
@@ -20,7 +20,6 @@ package dflt
 import (
 	"net"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/czcorpus/apiguard/common"
@@ -29,10 +28,10 @@ import (
 	guardImpl "github.com/czcorpus/apiguard/guard"
 	"github.com/czcorpus/apiguard/logging"
 	"github.com/czcorpus/apiguard/proxy"
+	"github.com/czcorpus/apiguard/ratelimit"
 	"github.com/czcorpus/apiguard/session"
 	"github.com/czcorpus/apiguard/telemetry"
 	"github.com/rs/zerolog/log"
-	"golang.org/x/time/rate"
 )
 
 const (
@@ -49,10 +48,11 @@ type Guard struct {
 	cleanupInterval   time.Duration
 	loc               *time.Location
 	anonymousUsers    common.AnonymousUsers
-	rateLimiters      map[string]*rate.Limiter
+	serviceKey        string
+	rateLimiters      ratelimit.Limiter
 	confLimits        []proxy.Limit
-	rateLimitersMu    sync.Mutex
 	sessionValFactory func() session.HTTPSession
+	delayPolicy       *guardImpl.DelayPolicy
 }
 
 func (sra *Guard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
@@ -64,7 +64,11 @@ func (sra *Guard) ExposeAsCounter() chan<- common.ClientID {
 }
 
 func (sra *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
-	return 0, nil
+	return sra.delayPolicy.CalcDelay(req, clientID)
+}
+
+func (sra *Guard) EstimateDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return sra.delayPolicy.EstimateDelay(req, clientID)
 }
 
 func (sra *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
@@ -92,23 +96,16 @@ func (sra *Guard) checkForBan(req *http.Request, clientID common.ClientID) (bool
 
 func (sra *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
 	clientIP := logging.ExtractClientIP(req)
-	if len(sra.confLimits) > 0 {
-		sra.rateLimitersMu.Lock()
-		defer sra.rateLimitersMu.Unlock()
-		limiter, exists := sra.rateLimiters[clientIP]
-		if !exists {
-			flimit := sra.confLimits[0]
-			limiter = rate.NewLimiter(
-				flimit.NormLimitPerSec(),
-				flimit.BurstLimit,
-			)
-			sra.rateLimiters[clientIP] = limiter
-		}
-		if !limiter.Allow() {
-			log.Debug().Str("clientIp", clientIP).Msg("limiting client with status 429")
-			return guard.ReqEvaluation{
-				ProposedResponse: http.StatusTooManyRequests,
-			}
+	if ok, limit := sra.rateLimiters.AllowN(sra.serviceKey, clientIP, sra.confLimits, guard.RequestCost(req)); !ok {
+		log.Debug().
+			Str("clientIp", clientIP).
+			Stringer("limit", limit).
+			Msg("limiting client with status 429")
+		return guard.ReqEvaluation{
+			ProposedResponse: http.StatusTooManyRequests,
+			ExceededLimit:    limit,
+			Reason: guard.Reason{
+				Code: guard.ReasonRateLimit, Guard: guard.GuardTypeDflt, Limit: limit},
 		}
 	}
 	banned, err := sra.checkForBan(req, common.ClientID{IP: clientIP, ID: common.InvalidUserID})
@@ -116,15 +113,19 @@ func (sra *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie
 		return guard.ReqEvaluation{
 			ProposedResponse: http.StatusInternalServerError,
 			Error:            err,
+			Reason:           guard.Reason{Code: guard.ReasonInternalError, Guard: guard.GuardTypeDflt},
 		}
 	}
 	if banned {
 		return guard.ReqEvaluation{
 			ProposedResponse: http.StatusForbidden,
+			Reason: guard.Reason{
+				Code: guard.ReasonIPBan, Guard: guard.GuardTypeDflt, Rule: clientIP},
 		}
 	}
 	return guard.ReqEvaluation{
 		ProposedResponse: http.StatusOK,
+		Reason:           guard.Reason{Code: guard.ReasonAllowed, Guard: guard.GuardTypeDflt},
 	}
 }
 
@@ -142,9 +143,11 @@ func (sra *Guard) Run() {
 
 func New(
 	globalCtx *globctx.Context,
+	serviceKey string,
 	sessionCookieName string,
 	sessionType session.SessionType,
 	confLimits []proxy.Limit,
+	delayPolicy *guardImpl.DelayPolicy,
 ) *Guard {
 	return &Guard{
 		storage:           globalCtx.TelemetryDB,
@@ -154,7 +157,9 @@ func New(
 		loc:               globalCtx.TimezoneLocation,
 		anonymousUsers:    globalCtx.AnonymousUserIDs,
 		confLimits:        confLimits,
-		rateLimiters:      make(map[string]*rate.Limiter),
+		serviceKey:        serviceKey,
+		rateLimiters:      globalCtx.RateLimiters,
 		sessionValFactory: guardImpl.CreateSessionValFactory(sessionType),
+		delayPolicy:       delayPolicy,
 	}
 }
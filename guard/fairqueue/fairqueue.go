@@ -0,0 +1,231 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fairqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/apiguard/logging"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltMaxQueueLength   = 100
+	dfltMaxWaitMs        = 5000
+	dfltWeightRegistered = 4
+	dfltWeightToken      = 2
+	dfltWeightAnonymous  = 1
+)
+
+// Class is a category of clients sharing the same queue weight
+type Class string
+
+const (
+	ClassRegistered Class = "registered"
+	ClassToken      Class = "token"
+	ClassAnonymous  Class = "anonymous"
+)
+
+type Weights struct {
+	Registered float64 `json:"registered"`
+	Token      float64 `json:"token"`
+	Anonymous  float64 `json:"anonymous"`
+}
+
+func (w Weights) Of(class Class) float64 {
+	switch class {
+	case ClassRegistered:
+		return w.Registered
+	case ClassToken:
+		return w.Token
+	default:
+		return w.Anonymous
+	}
+}
+
+// Conf configures an admission queue for requests exceeding
+// rate limits of a service.
+type Conf struct {
+
+	// ReleasePerSec specifies how many queued requests per second
+	// are let through to the backend (on top of the requests
+	// passing the rate limits).
+	ReleasePerSec float64 `json:"releasePerSec"`
+
+	MaxQueueLength int `json:"maxQueueLength"`
+
+	MaxWaitMs int `json:"maxWaitMs"`
+
+	Weights Weights `json:"weights"`
+}
+
+func (conf *Conf) MaxWait() time.Duration {
+	return time.Duration(conf.MaxWaitMs) * time.Millisecond
+}
+
+func (conf *Conf) Validate(context string) error {
+	if conf == nil {
+		return nil
+	}
+	if conf.ReleasePerSec <= 0 {
+		return fmt.Errorf("%s.releasePerSec must be a positive number", context)
+	}
+	if conf.MaxQueueLength < 0 {
+		return fmt.Errorf("%s.maxQueueLength must be a positive number", context)
+
+	} else if conf.MaxQueueLength == 0 {
+		log.Warn().
+			Int("default", dfltMaxQueueLength).
+			Msgf("%s.maxQueueLength not set, using default", context)
+		conf.MaxQueueLength = dfltMaxQueueLength
+	}
+	if conf.MaxWaitMs < 0 {
+		return fmt.Errorf("%s.maxWaitMs must be a positive number", context)
+
+	} else if conf.MaxWaitMs == 0 {
+		log.Warn().
+			Int("default", dfltMaxWaitMs).
+			Msgf("%s.maxWaitMs not set, using default", context)
+		conf.MaxWaitMs = dfltMaxWaitMs
+	}
+	if conf.Weights == (Weights{}) {
+		log.Warn().
+			Float64("registered", dfltWeightRegistered).
+			Float64("token", dfltWeightToken).
+			Float64("anonymous", dfltWeightAnonymous).
+			Msgf("%s.weights not set, using defaults", context)
+		conf.Weights = Weights{
+			Registered: dfltWeightRegistered,
+			Token:      dfltWeightToken,
+			Anonymous:  dfltWeightAnonymous,
+		}
+	}
+	if conf.Weights.Registered <= 0 || conf.Weights.Token <= 0 || conf.Weights.Anonymous <= 0 {
+		return fmt.Errorf("%s.weights must be positive numbers", context)
+	}
+	return nil
+}
+
+// -------
+
+// Guard wraps a service guard and, instead of rejecting requests
+// exceeding rate limits, it puts them into a weighted fair queue.
+// A request is rejected only if the queue is full or if the request
+// waits for too long. Other denials (bans, auth. errors) are returned
+// as they are.
+type Guard struct {
+	guard.ServiceGuard
+	serviceKey string
+	conf       *Conf
+	queue      *Queue
+
+	// findUser is used to determine users of requests (typically
+	// by their CNC session)
+	findUser func(req *http.Request) (common.UserID, error)
+}
+
+// classify determines a queue class and a flow key of a request
+func (g *Guard) classify(req *http.Request, eval guard.ReqEvaluation) (Class, string) {
+	if eval.ClientID.IsValid() &&
+		(eval.Reason.Guard == guard.GuardTypeToken || eval.Reason.Guard == guard.GuardTypeJWT) {
+		return ClassToken, eval.ClientID.String()
+	}
+	// note: we cannot rely on eval.ClientID here as some guards
+	// (e.g. `dflt`) do not identify users at all
+	userID := common.InvalidUserID
+	if g.findUser != nil {
+		var err error
+		userID, err = g.findUser(req)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to determine user for request queue, using anonymous class")
+		}
+	}
+	if userID.IsValid() && !g.TestUserIsAnonymous(userID) {
+		return ClassRegistered, userID.String()
+	}
+	return ClassAnonymous, logging.ExtractClientIP(req)
+}
+
+func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	ans := g.ServiceGuard.EvaluateRequest(req, fallbackCookie)
+	if ans.ProposedResponse != http.StatusTooManyRequests || ans.Reason.Code != guard.ReasonRateLimit {
+		return ans
+	}
+	class, flowKey := g.classify(req, ans)
+	t0 := time.Now()
+	err := g.queue.Wait(req.Context(), fmt.Sprintf("%s:%s", class, flowKey), g.conf.Weights.Of(class))
+	if err == nil {
+		log.Debug().
+			Str("serviceKey", g.serviceKey).
+			Str("class", string(class)).
+			Dur("wait", time.Since(t0)).
+			Msg("admitted queued request")
+		ans.ProposedResponse = http.StatusOK
+		ans.ExceededLimit = nil
+		ans.Reason.Code = guard.ReasonQueued
+		ans.Reason.Rule = string(class)
+		return ans
+	}
+	if errors.Is(err, ErrQueueFull) {
+		ans.Reason.Code = guard.ReasonQueueFull
+
+	} else if errors.Is(err, ErrQueueTimeout) {
+		ans.Reason.Code = guard.ReasonQueueTimeout
+
+	} else {
+		// the client is gone, the response does not really matter
+		log.Debug().Err(err).Str("serviceKey", g.serviceKey).Msg("queued request cancelled")
+	}
+	ans.Reason.Rule = string(class)
+	ans.DenialReason = err.Error()
+	return ans
+}
+
+// New creates a queueing guard wrapping the provided guard
+// and starts releasing of queued requests. The queue runs until
+// the ctx is cancelled.
+func New(
+	ctx context.Context,
+	serviceKey string,
+	conf *Conf,
+	grd guard.ServiceGuard,
+	findUser func(req *http.Request) (common.UserID, error),
+) *Guard {
+	queue := NewQueue(conf.MaxQueueLength, conf.MaxWait())
+	go queue.Run(ctx, conf.ReleasePerSec)
+	log.Info().
+		Str("serviceKey", serviceKey).
+		Float64("releasePerSec", conf.ReleasePerSec).
+		Int("maxQueueLength", conf.MaxQueueLength).
+		Int("maxWaitMs", conf.MaxWaitMs).
+		Msg("using fair queue for requests exceeding rate limits")
+	return &Guard{
+		ServiceGuard: grd,
+		serviceKey:   serviceKey,
+		conf:         conf,
+		queue:        queue,
+		findUser:     findUser,
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fairqueue
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/apiguard/proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+// waitForLen waits until the queue contains n requests
+func waitForLen(t *testing.T, q *Queue, n int) {
+	assert.Eventually(t, func() bool { return q.Len() == n }, time.Second, time.Millisecond)
+}
+
+func TestQueueReleasesByWeight(t *testing.T) {
+	q := NewQueue(100, time.Minute)
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(flow string, weight float64) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, q.Wait(context.Background(), flow, weight))
+			mu.Lock()
+			order = append(order, flow)
+			mu.Unlock()
+		}()
+	}
+	// the enqueue order is fixed by waiting for each item
+	for i := 0; i < 4; i++ {
+		enqueue("anon", 1)
+		waitForLen(t, q, 2*i+1)
+		enqueue("reg", 4)
+		waitForLen(t, q, 2*i+2)
+	}
+	for i := 0; i < 8; i++ {
+		assert.True(t, q.releaseNext())
+		assert.Eventually(
+			t,
+			func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(order) == i+1
+			},
+			time.Second,
+			time.Millisecond,
+		)
+	}
+	wg.Wait()
+	assert.False(t, q.releaseNext())
+	// registered flow finishes at virtual times 0.25, 0.5, 0.75, 1,
+	// the anonymous one at 1, 2, 3, 4 (ties are resolved by arrival)
+	assert.Equal(t, []string{"reg", "reg", "reg", "anon", "reg", "anon", "anon", "anon"}, order)
+}
+
+func TestQueueFull(t *testing.T) {
+	q := NewQueue(1, time.Minute)
+	done := make(chan error)
+	go func() {
+		done <- q.Wait(context.Background(), "a", 1)
+	}()
+	waitForLen(t, q, 1)
+	assert.ErrorIs(t, q.Wait(context.Background(), "b", 1), ErrQueueFull)
+	q.releaseNext()
+	assert.NoError(t, <-done)
+}
+
+func TestQueueFullPushesOutLastRequest(t *testing.T) {
+	q := NewQueue(3, time.Minute)
+	results := make(chan error, 3)
+	// an anonymous flood (finishing at virtual times 1, 2, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			results <- q.Wait(context.Background(), "anon", 1)
+		}()
+		waitForLen(t, q, i+1)
+	}
+	// another request of the flooding flow would be the last one
+	assert.ErrorIs(t, q.Wait(context.Background(), "anon", 1), ErrQueueFull)
+
+	// a registered request pushes out the last anonymous one
+	done := make(chan error)
+	go func() {
+		done <- q.Wait(context.Background(), "reg", 4)
+	}()
+	assert.ErrorIs(t, <-results, ErrQueueFull)
+	assert.Equal(t, 3, q.Len())
+	assert.Equal(t, 2, q.flows["anon"].pending)
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, q.releaseNext())
+	}
+	assert.NoError(t, <-done)
+	assert.NoError(t, <-results)
+	assert.NoError(t, <-results)
+	assert.Empty(t, q.flows)
+}
+
+func TestQueueTimeoutRemovesRequest(t *testing.T) {
+	q := NewQueue(10, 20*time.Millisecond)
+	assert.ErrorIs(t, q.Wait(context.Background(), "a", 1), ErrQueueTimeout)
+	assert.Equal(t, 0, q.Len())
+	assert.Empty(t, q.flows)
+}
+
+func TestQueueCancelledRequest(t *testing.T) {
+	q := NewQueue(10, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, q.Wait(ctx, "a", 1), context.Canceled)
+	assert.Equal(t, 0, q.Len())
+}
+
+// --------
+
+type limitingGuard struct {
+	status int
+	reason guard.ReasonCode
+}
+
+func (g *limitingGuard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return 0, nil
+}
+
+func (g *limitingGuard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return nil
+}
+
+func (g *limitingGuard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	return guard.ReqEvaluation{
+		ProposedResponse: g.status,
+		ExceededLimit:    &proxy.Limit{ReqPerTimeThreshold: 1, ReqCheckingIntervalSecs: 1},
+		Reason:           guard.Reason{Code: g.reason, Guard: guard.GuardTypeDflt},
+	}
+}
+
+func (g *limitingGuard) TestUserIsAnonymous(userID common.UserID) bool {
+	return userID == 1
+}
+
+func (g *limitingGuard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	return common.InvalidUserID, nil
+}
+
+func newTestGuard(inner guard.ServiceGuard, userID common.UserID) *Guard {
+	conf := &Conf{ReleasePerSec: 1000}
+	conf.Validate("fairQueue")
+	return &Guard{
+		ServiceGuard: inner,
+		serviceKey:   "1/test",
+		conf:         conf,
+		queue:        NewQueue(conf.MaxQueueLength, 30*time.Millisecond),
+		findUser: func(req *http.Request) (common.UserID, error) {
+			return userID, nil
+		},
+	}
+}
+
+func TestGuardClassifiesRequests(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/service/1/test/foo", nil)
+	inner := &limitingGuard{status: http.StatusTooManyRequests, reason: guard.ReasonRateLimit}
+
+	class, _ := newTestGuard(inner, 7).classify(req, guard.ReqEvaluation{})
+	assert.Equal(t, ClassRegistered, class)
+	class, _ = newTestGuard(inner, 1).classify(req, guard.ReqEvaluation{})
+	assert.Equal(t, ClassAnonymous, class)
+	class, _ = newTestGuard(inner, common.InvalidUserID).classify(req, guard.ReqEvaluation{})
+	assert.Equal(t, ClassAnonymous, class)
+	class, flow := newTestGuard(inner, common.InvalidUserID).classify(
+		req,
+		guard.ReqEvaluation{ClientID: 9, Reason: guard.Reason{Guard: guard.GuardTypeToken}},
+	)
+	assert.Equal(t, ClassToken, class)
+	assert.Equal(t, "9", flow)
+}
+
+func TestGuardQueuesRateLimitedRequests(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/service/1/test/foo", nil)
+	g := newTestGuard(
+		&limitingGuard{status: http.StatusTooManyRequests, reason: guard.ReasonRateLimit}, 7)
+
+	// nobody releases the queue so the request times out
+	ev := g.EvaluateRequest(req, nil)
+	assert.Equal(t, http.StatusTooManyRequests, ev.ProposedResponse)
+	assert.Equal(t, guard.ReasonQueueTimeout, ev.Reason.Code)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go g.queue.Run(ctx, 1000)
+	ev = g.EvaluateRequest(req, nil)
+	assert.Equal(t, http.StatusOK, ev.ProposedResponse)
+	assert.Equal(t, guard.ReasonQueued, ev.Reason.Code)
+	assert.Equal(t, string(ClassRegistered), ev.Reason.Rule)
+	assert.Nil(t, ev.ExceededLimit)
+}
+
+func TestGuardDoesNotQueueOtherDenials(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/service/1/test/foo", nil)
+	g := newTestGuard(&limitingGuard{status: http.StatusForbidden, reason: guard.ReasonIPBan}, 7)
+	ev := g.EvaluateRequest(req, nil)
+	assert.Equal(t, http.StatusForbidden, ev.ProposedResponse)
+	assert.Equal(t, guard.ReasonIPBan, ev.Reason.Code)
+	assert.Equal(t, 0, g.queue.Len())
+}
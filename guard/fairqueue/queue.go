@@ -0,0 +1,252 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fairqueue
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrQueueFull    = errors.New("request queue is full")
+	ErrQueueTimeout = errors.New("maximum queue wait exceeded")
+)
+
+type waiter struct {
+	flow   string
+	finish float64
+	seq    uint64
+	index  int
+	ready  chan struct{}
+
+	// evicted is set (before closing the ready channel) in case
+	// the waiter has been pushed out of a full queue
+	evicted bool
+}
+
+type waiterHeap []*waiter
+
+func (h waiterHeap) Len() int {
+	return len(h)
+}
+
+func (h waiterHeap) Less(i, j int) bool {
+	if h[i].finish == h[j].finish {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].finish < h[j].finish
+}
+
+func (h waiterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *waiterHeap) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+
+func (h *waiterHeap) Pop() any {
+	old := *h
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*h = old[:n-1]
+	return w
+}
+
+type flowState struct {
+	lastFinish float64
+	pending    int
+}
+
+// Queue is a weighted fair queue of requests waiting for admission.
+// Each flow (typically a client of some class) gets a share of released
+// requests proportional to its weight. The implementation follows
+// the classic WFQ approach with virtual finish times - a request
+// of a flow with weight w advances the flow's virtual time by 1/w
+// and requests are released in order of their virtual finish times.
+type Queue struct {
+	mu          sync.Mutex
+	waiters     waiterHeap
+	flows       map[string]*flowState
+	virtualTime float64
+	seq         uint64
+	maxLength   int
+	maxWait     time.Duration
+}
+
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiters.Len()
+}
+
+// last finds a waiting request which would be released as the last one.
+// It must be called with q.mu locked.
+func (q *Queue) last() *waiter {
+	var ans *waiter
+	for _, w := range q.waiters {
+		if ans == nil || w.finish > ans.finish || w.finish == ans.finish && w.seq > ans.seq {
+			ans = w
+		}
+	}
+	return ans
+}
+
+// enqueue puts a request to the queue. In case the queue is full,
+// the request pushes out a waiting request which would be released
+// as the last one. This prevents flows with low weights (or huge
+// numbers of requests) from occupying the whole queue. In case there
+// is no such request (i.e. the new request would be the last one),
+// ErrQueueFull is returned.
+func (q *Queue) enqueue(flow string, weight float64) (*waiter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	fs, ok := q.flows[flow]
+	start := q.virtualTime
+	if ok {
+		start = max(fs.lastFinish, q.virtualTime)
+	}
+	finish := start + 1/weight
+	if q.waiters.Len() >= q.maxLength {
+		victim := q.last()
+		if victim == nil || victim.finish <= finish {
+			return nil, ErrQueueFull
+		}
+		heap.Remove(&q.waiters, victim.index)
+		q.finishFlowItem(victim)
+		victim.evicted = true
+		close(victim.ready)
+		fs, ok = q.flows[flow]
+	}
+	if !ok {
+		fs = &flowState{}
+		q.flows[flow] = fs
+	}
+	q.seq++
+	w := &waiter{
+		flow:   flow,
+		finish: finish,
+		seq:    q.seq,
+		ready:  make(chan struct{}),
+	}
+	fs.lastFinish = w.finish
+	fs.pending++
+	heap.Push(&q.waiters, w)
+	return w, nil
+}
+
+// finishFlowItem must be called with q.mu locked
+func (q *Queue) finishFlowItem(w *waiter) {
+	fs := q.flows[w.flow]
+	fs.pending--
+	if fs.pending == 0 {
+		delete(q.flows, w.flow)
+	}
+}
+
+// remove removes a waiting request from the queue. It returns false
+// in case the request is not in the queue anymore (i.e. it has been
+// already released).
+func (q *Queue) remove(w *waiter) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if w.index < 0 {
+		return false
+	}
+	heap.Remove(&q.waiters, w.index)
+	q.finishFlowItem(w)
+	return true
+}
+
+// releaseNext releases a waiting request with the lowest virtual
+// finish time. It returns false if there is nothing to release.
+func (q *Queue) releaseNext() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.waiters.Len() == 0 {
+		return false
+	}
+	w := heap.Pop(&q.waiters).(*waiter)
+	q.virtualTime = w.finish
+	q.finishFlowItem(w)
+	close(w.ready)
+	return true
+}
+
+// Wait puts a request of a specified flow to the queue and waits
+// until it is released. In case the queue is full (or the request
+// is pushed out of the queue by a request with an earlier virtual
+// finish time), ErrQueueFull is returned. In case the request waits
+// for too long, ErrQueueTimeout is returned.
+func (q *Queue) Wait(ctx context.Context, flow string, weight float64) error {
+	w, err := q.enqueue(flow, weight)
+	if err != nil {
+		return err
+	}
+	timer := time.NewTimer(q.maxWait)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+		if w.evicted {
+			return ErrQueueFull
+		}
+		return nil
+	case <-timer.C:
+		if q.remove(w) {
+			return ErrQueueTimeout
+		}
+		return nil
+	case <-ctx.Done():
+		if q.remove(w) {
+			return ctx.Err()
+		}
+		return nil
+	}
+}
+
+// Run releases waiting requests with the specified rate
+// until the context is cancelled.
+func (q *Queue) Run(ctx context.Context, releasePerSec float64) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / releasePerSec))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.releaseNext()
+		}
+	}
+}
+
+func NewQueue(maxLength int, maxWait time.Duration) *Queue {
+	return &Queue{
+		flows:     make(map[string]*flowState),
+		maxLength: maxLength,
+		maxWait:   maxWait,
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/proxy"
 	"github.com/czcorpus/cnc-gokit/uniresp"
 )
 
@@ -35,15 +36,17 @@ const (
 	// can be considered an "infinite wait".
 	UltraDuration = time.Duration(24) * time.Hour
 
-	GuardTypeNull    GuardType = "null"
-	GuardTypeDflt    GuardType = "dflt"
-	GuardTypeCNCAuth GuardType = "cncauth"
-	GuardTypeToken   GuardType = "token"
+	GuardTypeNull      GuardType = "null"
+	GuardTypeDflt      GuardType = "dflt"
+	GuardTypeCNCAuth   GuardType = "cncauth"
+	GuardTypeToken     GuardType = "token"
+	GuardTypeJWT       GuardType = "jwt"
+	GuardTypeComposite GuardType = "composite"
 )
 
 func (gt GuardType) IsValid() bool {
 	return gt == GuardTypeNull || gt == GuardTypeDflt || gt == GuardTypeCNCAuth ||
-		gt == GuardTypeToken
+		gt == GuardTypeToken || gt == GuardTypeJWT || gt == GuardTypeComposite
 }
 
 type RequestInfo struct {
@@ -99,12 +102,43 @@ type ReqEvaluation struct {
 	// Note that the 'true' value does not imply the evalutation
 	// will propose status 200.
 	RequiresFallbackCookie bool
+
+	// ExceededLimit is set in case the request has been rejected
+	// because of a rate limit. It specifies the (first) limit
+	// the request did not pass.
+	ExceededLimit *proxy.Limit
+
+	// DenialReason may provide a more specific reason of a denied
+	// access (e.g. an exhausted quota) to be reported to the client.
+	DenialReason string
+
+	// Reason describes the decision in a structured way. Unlike
+	// DenialReason, it is not sent to clients - it is intended
+	// for access logs and the audit trail.
+	Reason Reason
 }
 
 func (rp ReqEvaluation) ForbidsAccess() bool {
 	return rp.ProposedResponse >= 400 && rp.ProposedResponse < 500
 }
 
+// DenialMessage provides a message for a client whose request
+// has been denied. In case a rate limit has been applied, the message
+// specifies the limit.
+func (rp ReqEvaluation) DenialMessage() string {
+	if rp.DenialReason != "" {
+		return fmt.Sprintf("%s (%s)", http.StatusText(rp.ProposedResponse), rp.DenialReason)
+	}
+	if rp.ExceededLimit != nil {
+		return fmt.Sprintf(
+			"%s (exceeded limit: %s)",
+			http.StatusText(rp.ProposedResponse),
+			rp.ExceededLimit,
+		)
+	}
+	return http.StatusText(rp.ProposedResponse)
+}
+
 // -----------
 
 // ServiceGuard is an object which helps a proxy to decide
@@ -161,13 +195,10 @@ func RestrictResponseTime(
 		)
 		return fmt.Errorf("failed to restrict response time: %w", err)
 	}
-	if err := guard.LogAppliedDelay(respDelay, client); err != nil {
-		uniresp.WriteJSONErrorResponse(
-			w,
-			uniresp.NewActionError("service handling error: %s", err),
-			http.StatusInternalServerError,
-		)
-		return fmt.Errorf("failed to restrict response time: %w", err)
+	if respDelay > 0 {
+		if err := guard.LogAppliedDelay(respDelay, client); err != nil {
+			log.Error().Err(err).Msg("failed to log applied delay")
+		}
 	}
 	time.Sleep(respDelay)
 	return nil
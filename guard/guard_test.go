@@ -0,0 +1,70 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// delayLoggingGuard proposes a fixed delay and records
+// logged delays
+type delayLoggingGuard struct {
+	ServiceGuard
+	delay     time.Duration
+	logErr    error
+	numLogged int
+}
+
+func (g *delayLoggingGuard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return g.delay, nil
+}
+
+func (g *delayLoggingGuard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	g.numLogged++
+	return g.logErr
+}
+
+func TestRestrictResponseTimeLogsOnlyAppliedDelays(t *testing.T) {
+	grd := &delayLoggingGuard{}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.NoError(t, RestrictResponseTime(w, req, 10, grd, common.ClientID{}))
+	assert.Equal(t, 0, grd.numLogged)
+
+	grd.delay = time.Millisecond
+	assert.NoError(t, RestrictResponseTime(w, req, 10, grd, common.ClientID{}))
+	assert.Equal(t, 1, grd.numLogged)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRestrictResponseTimeIgnoresLoggingErrors(t *testing.T) {
+	grd := &delayLoggingGuard{delay: time.Millisecond, logErr: errors.New("db down")}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.NoError(t, RestrictResponseTime(w, req, 10, grd, common.ClientID{}))
+	assert.Equal(t, 1, grd.numLogged)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+}
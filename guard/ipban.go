@@ -21,11 +21,24 @@ import (
 	"database/sql"
 	"fmt"
 	"net"
-	"strings"
 	"time"
+
+	"github.com/czcorpus/apiguard/telemetry"
+)
+
+const (
+	IPBanSourceCLI      = "cli"
+	IPBanSourceAdminAPI = "admin-api"
+	IPBanSourceHoneypot = "honeypot"
+
+	dfltIPBanTTLSecs = 86400
 )
 
-func InsertIPBan(db *sql.DB, IP net.IP, ttl int, loc *time.Location) error {
+// InsertIPBan bans an IP address or an IP range (see telemetry.ParseIPBanTarget)
+// for ttl seconds (or for 24 hours in case ttl is not positive). The source
+// describes where the ban comes from (e.g. IPBanSourceCLI). In case the address
+// or range is already banned, an error is returned.
+func InsertIPBan(db *sql.DB, target *net.IPNet, ttl int, source string, loc *time.Location) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
@@ -34,32 +47,53 @@ func InsertIPBan(db *sql.DB, IP net.IP, ttl int, loc *time.Location) error {
 	if loc != nil {
 		now = now.In(loc)
 	}
-	if ttl > 0 {
-		end_dt := now.Add(time.Duration(ttl) * time.Second)
-		_, err = tx.Exec(`INSERT INTO api_ip_ban (ip_address, start_dt, end_dt) VALUES (?, ?, ?)`, IP.String(), now, end_dt)
-
-	} else {
-		end_dt := now.Add(time.Duration(86400) * time.Second)
-		_, err = tx.Exec(`INSERT INTO api_ip_ban (ip_address, start_dt, end_dt) VALUES (?, ?, ?)`, IP.String(), now, end_dt)
+	if ttl <= 0 {
+		ttl = dfltIPBanTTLSecs
+	}
+	row := tx.QueryRow(
+		`SELECT COUNT(*) FROM api_ip_ban WHERE ip_address = ? AND start_dt <= ? AND end_dt > ?`,
+		telemetry.IPBanKey(target), now, now,
+	)
+	var numActive int
+	if err := row.Scan(&numActive); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if numActive > 0 {
+		tx.Rollback()
+		return fmt.Errorf("failed to insert ban - address %s already banned", telemetry.IPBanKey(target))
 	}
+	end_dt := now.Add(time.Duration(ttl) * time.Second)
+	_, err = tx.Exec(
+		`INSERT INTO api_ip_ban (ip_address, start_dt, end_dt, source) VALUES (?, ?, ?, ?)`,
+		telemetry.IPBanKey(target), now, end_dt, source,
+	)
 	if err != nil {
-		if strings.HasPrefix(err.Error(), "Error 1062: Duplicate entry") {
-			return fmt.Errorf("failed to insert ban - address %s already banned", IP.String())
-		}
+		tx.Rollback()
 		return err
 	}
 	err = tx.Commit()
 	return err
 }
 
-func RemoveIPBan(db *sql.DB, IP net.IP) error {
+// RemoveIPBan lifts an active ban of an IP address or an IP range. Please note
+// that a range must be specified exactly as it was banned. The ban record
+// is kept (with its end set to the current time) so it is still
+// available in ban listings.
+func RemoveIPBan(db *sql.DB, target *net.IPNet, loc *time.Location) error {
 	tx, err := db.Begin()
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
+	now := time.Now()
+	if loc != nil {
+		now = now.In(loc)
+	}
 	var res sql.Result
-	res, err = tx.Exec(`DELETE FROM api_ip_ban WHERE ip_address = ?`, IP.String())
+	res, err = tx.Exec(
+		`UPDATE api_ip_ban SET end_dt = ? WHERE ip_address = ? AND start_dt <= ? AND end_dt > ?`,
+		now, telemetry.IPBanKey(target), now, now,
+	)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -72,8 +106,38 @@ func RemoveIPBan(db *sql.DB, IP net.IP) error {
 	}
 	if numDel == 0 {
 		tx.Rollback()
-		return fmt.Errorf("cannot unban ip %s - address not banned", IP.String())
+		return fmt.Errorf("cannot unban ip %s - address not banned", telemetry.IPBanKey(target))
 	}
 	err = tx.Commit()
 	return err
 }
+
+// ListIPBans returns all the active bans and all the bans
+// which ended after a specified time.
+func ListIPBans(db *sql.DB, since time.Time, loc *time.Location) ([]*telemetry.IPBan, error) {
+	now := time.Now()
+	if loc != nil {
+		now = now.In(loc)
+	}
+	rows, err := db.Query(
+		`SELECT ip_address, start_dt, end_dt, source FROM api_ip_ban
+		WHERE end_dt >= ? ORDER BY start_dt DESC`,
+		since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ans := make([]*telemetry.IPBan, 0, 50)
+	for rows.Next() {
+		item := &telemetry.IPBan{}
+		var source sql.NullString
+		if err := rows.Scan(&item.ClientIP, &item.Start, &item.End, &source); err != nil {
+			return nil, err
+		}
+		item.Source = source.String
+		item.Active = !item.Start.After(now) && item.End.After(now)
+		ans = append(ans, item)
+	}
+	return ans, rows.Err()
+}
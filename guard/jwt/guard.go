@@ -0,0 +1,272 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/czcorpus/apiguard/cnc"
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/globctx"
+	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/apiguard/logging"
+	"github.com/czcorpus/apiguard/proxy"
+	"github.com/czcorpus/apiguard/ratelimit"
+	"github.com/czcorpus/apiguard/telemetry"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Guard in the `jwt` package allows access only to clients with
+// a valid signed JWT provided as a bearer token in the Authorization
+// header. Besides that, it throttles too high request rates and
+// applies IP bans (just like the `token` guard).
+type Guard struct {
+	servicePath string
+
+	tlmtrStorage telemetry.Storage
+
+	anonymousUsers common.AnonymousUsers
+
+	serviceKey string
+
+	rateLimiters ratelimit.Limiter
+
+	confLimits []proxy.Limit
+
+	verifier *Verifier
+
+	userBans *cnc.UserBans
+
+	authExcludedPathPrefixes []string
+
+	corpusExtractor guard.CorpusExtractor
+
+	delayPolicy *guard.DelayPolicy
+}
+
+func (g *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return g.delayPolicy.CalcDelay(req, clientID)
+}
+
+func (g *Guard) EstimateDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return g.delayPolicy.EstimateDelay(req, clientID)
+}
+
+func (g *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return g.tlmtrStorage.LogAppliedDelay(respDelay, clientID)
+}
+
+// bearerToken extracts a bearer token from the Authorization header
+func bearerToken(req *http.Request) string {
+	value := req.Header.Get("Authorization")
+	if len(value) > 7 && strings.EqualFold(value[:7], "bearer ") {
+		return strings.TrimSpace(value[7:])
+	}
+	return ""
+}
+
+func (g *Guard) checkForBan(req *http.Request, clientID common.ClientID) (bool, error) {
+	ip, _ := logging.ExtractRequestIdentifiers(req)
+	isBanned, err := g.tlmtrStorage.TestIPBan(net.ParseIP(ip))
+	if err != nil {
+		return isBanned, err
+	}
+	if isBanned {
+		log.Debug().
+			Str("guardType", "jwt").
+			Str("clientId", clientID.GetKey()).
+			Msg("applied IP ban")
+		return true, nil
+	}
+	return false, nil
+}
+
+func (g *Guard) pathMatchesExclude(req *http.Request) bool {
+	for _, excl := range g.authExcludedPathPrefixes {
+		tst, err := url.JoinPath(g.servicePath, excl)
+		if err != nil {
+			log.Error().Err(err).Msg("pathMatchesExclude failed to join service path and exclusion path")
+			return false
+		}
+		if req.URL.Path == tst {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	isExcluded := g.pathMatchesExclude(req)
+	var claims *Claims
+	if rawToken := bearerToken(req); rawToken != "" {
+		var err error
+		claims, err = g.verifier.Verify(rawToken, time.Now())
+		if err != nil && !isExcluded {
+			log.Debug().Err(err).Str("service", g.serviceKey).Msg("rejected JWT")
+			reason := "invalid authentication token"
+			if errors.Is(err, ErrTokenExpired) {
+				reason = "authentication token expired"
+			}
+			return guard.ReqEvaluation{
+				ProposedResponse: http.StatusUnauthorized,
+				ClientID:         common.InvalidUserID,
+				SessionID:        "",
+				DenialReason:     reason,
+				Reason: guard.Reason{
+					Code: guard.ReasonInvalidCredentials, Guard: guard.GuardTypeJWT, Rule: err.Error()},
+			}
+		}
+	}
+	userID := common.InvalidUserID
+	if claims != nil {
+		userID = claims.UserID
+	}
+	if !(userID.IsValid() || isExcluded) {
+		return guard.ReqEvaluation{
+			ProposedResponse: http.StatusUnauthorized,
+			ClientID:         common.InvalidUserID,
+			SessionID:        "",
+			Error:            fmt.Errorf("missing authentication token"),
+			Reason:           guard.Reason{Code: guard.ReasonNoCredentials, Guard: guard.GuardTypeJWT},
+		}
+	}
+	if claims != nil && !isExcluded {
+		relPath := strings.TrimPrefix(req.URL.Path, g.servicePath)
+		if failed := claims.Scope.Check(req, relPath, g.corpusExtractor); failed != "" {
+			log.Debug().
+				Int("userId", int(userID)).
+				Str("path", relPath).
+				Str("scope", failed).
+				Msg("JWT used outside of its scope")
+			return guard.ReqEvaluation{
+				ProposedResponse: http.StatusForbidden,
+				ClientID:         userID,
+				SessionID:        "",
+				DenialReason:     guard.ScopeDenialReason(failed),
+				Reason:           guard.Reason{Code: guard.ReasonScope, Guard: guard.GuardTypeJWT, Rule: failed},
+			}
+		}
+	}
+	clientIP := logging.ExtractClientIP(req)
+
+	// requests with a JWT are limited per user, the rest per IP
+	limitingKey := clientIP
+	if claims != nil {
+		limitingKey = fmt.Sprintf("jwt:%d", claims.UserID)
+	}
+	if ok, limit := g.rateLimiters.AllowN(g.serviceKey, limitingKey, g.confLimits, guard.RequestCost(req)); !ok {
+		log.Debug().
+			Str("clientIp", clientIP).
+			Int("userId", int(userID)).
+			Stringer("limit", limit).
+			Msg("limiting client with status 429")
+		return guard.ReqEvaluation{
+			ProposedResponse: http.StatusTooManyRequests,
+			ClientID:         userID,
+			SessionID:        "",
+			ExceededLimit:    limit,
+			Reason:           guard.Reason{Code: guard.ReasonRateLimit, Guard: guard.GuardTypeJWT, Limit: limit},
+		}
+	}
+
+	// test ip ban
+	banned, err := g.checkForBan(req, common.ClientID{IP: clientIP, ID: userID})
+	if err != nil {
+		return guard.ReqEvaluation{
+			ProposedResponse: http.StatusInternalServerError,
+			Error:            err,
+			Reason:           guard.Reason{Code: guard.ReasonInternalError, Guard: guard.GuardTypeJWT},
+		}
+	}
+	if banned {
+		return guard.ReqEvaluation{
+			ProposedResponse: http.StatusForbidden,
+			Reason:           guard.Reason{Code: guard.ReasonIPBan, Guard: guard.GuardTypeJWT, Rule: clientIP},
+		}
+	}
+	if ev, banned := guard.CheckUserBan(g.userBans, g.anonymousUsers, userID); banned {
+		ev.Reason.Guard = guard.GuardTypeJWT
+		return ev
+	}
+
+	reason := guard.Reason{Code: guard.ReasonAllowed, Guard: guard.GuardTypeJWT}
+	if claims == nil && isExcluded {
+		reason.Code = guard.ReasonAuthExcluded
+	}
+	return guard.ReqEvaluation{
+		ProposedResponse: http.StatusOK,
+		ClientID:         userID,
+		SessionID:        "",
+		Reason:           reason,
+	}
+}
+
+func (g *Guard) TestUserIsAnonymous(userID common.UserID) bool {
+	return g.anonymousUsers.IsAnonymous(userID)
+}
+
+func (g *Guard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	rawToken := bearerToken(req)
+	if rawToken == "" {
+		return common.InvalidUserID, nil
+	}
+	claims, err := g.verifier.Verify(rawToken, time.Now())
+	if err != nil {
+		return common.InvalidUserID, nil
+	}
+	return claims.UserID, nil
+}
+
+// NewGuard creates a new JWT guard. The conf is expected to be validated.
+// For the meaning of `authExcludedPathPrefixes` and `corpusExtractor`,
+// see token.NewGuard.
+func NewGuard(
+	globalCtx *globctx.Context,
+	serviceKey string,
+	servicePath string,
+	conf *Conf,
+	confLimits []proxy.Limit,
+	authExcludedPathPrefixes []string,
+	corpusExtractor guard.CorpusExtractor,
+	delayPolicy *guard.DelayPolicy,
+) (*Guard, error) {
+	verifier, err := NewVerifier(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &Guard{
+		servicePath:              servicePath,
+		tlmtrStorage:             globalCtx.TelemetryDB,
+		anonymousUsers:           globalCtx.AnonymousUserIDs,
+		serviceKey:               serviceKey,
+		rateLimiters:             globalCtx.RateLimiters,
+		confLimits:               confLimits,
+		verifier:                 verifier,
+		userBans:                 globalCtx.UserBans,
+		authExcludedPathPrefixes: authExcludedPathPrefixes,
+		corpusExtractor:          corpusExtractor,
+		delayPolicy:              delayPolicy,
+	}, nil
+}
@@ -0,0 +1,311 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	dfltUserIDClaim = "sub"
+	dfltScopeClaim  = "apiguard_scope"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid JWT")
+	ErrTokenExpired = errors.New("JWT expired")
+)
+
+// Conf configures validation of JWTs
+type Conf struct {
+
+	// KeysPath specifies a local file with verification keys - either
+	// a JWKS document or PEM encoded public keys/certificates.
+	// Please note that HS256 secrets can be defined only via JWKS
+	// (key type `oct`).
+	KeysPath string `json:"keysPath"`
+
+	// Algorithms lists accepted signing algorithms (HS256, RS256, EdDSA).
+	// By default, all of them are accepted.
+	Algorithms []string `json:"algorithms"`
+
+	// Issuer is the required value of the `iss` claim (if set)
+	Issuer string `json:"issuer"`
+
+	// Audience is a value the `aud` claim must contain (if set)
+	Audience string `json:"audience"`
+
+	// UserIDClaim specifies a claim containing a numeric user ID
+	// (`sub` by default)
+	UserIDClaim string `json:"userIdClaim"`
+
+	// ScopeClaim specifies a claim with an optional scope in the same
+	// format as used for tokens, e.g. {"paths": ["/freqs"], "corpora": ["syn2020"]}
+	// (`apiguard_scope` by default)
+	ScopeClaim string `json:"scopeClaim"`
+
+	// LeewaySecs is a tolerance applied when checking the `exp`
+	// and `nbf` claims to compensate for clock skew
+	LeewaySecs int `json:"leewaySecs"`
+}
+
+func (c *Conf) Validate(context string) error {
+	if c == nil {
+		return fmt.Errorf("%s is missing", context)
+	}
+	if c.KeysPath == "" {
+		return fmt.Errorf("%s.keysPath is missing/empty", context)
+	}
+	if len(c.Algorithms) == 0 {
+		c.Algorithms = []string{AlgHS256, AlgRS256, AlgEdDSA}
+		log.Warn().
+			Strs("default", c.Algorithms).
+			Msgf("%s.algorithms not set, using default", context)
+	}
+	for i, alg := range c.Algorithms {
+		if alg != AlgHS256 && alg != AlgRS256 && alg != AlgEdDSA {
+			return fmt.Errorf("%s.algorithms[%d] has an unsupported value `%s`", context, i, alg)
+		}
+	}
+	if c.Issuer == "" {
+		log.Warn().Msgf("%s.issuer not set - the `iss` claim won't be checked", context)
+	}
+	if c.Audience == "" {
+		log.Warn().Msgf("%s.audience not set - the `aud` claim won't be checked", context)
+	}
+	if c.UserIDClaim == "" {
+		log.Warn().
+			Str("default", dfltUserIDClaim).
+			Msgf("%s.userIdClaim not set, using default", context)
+		c.UserIDClaim = dfltUserIDClaim
+	}
+	if c.ScopeClaim == "" {
+		c.ScopeClaim = dfltScopeClaim
+	}
+	if c.LeewaySecs < 0 {
+		return fmt.Errorf("%s.leewaySecs has an invalid value", context)
+	}
+	return nil
+}
+
+// Claims contains information extracted from a valid JWT
+type Claims struct {
+	UserID    common.UserID
+	Scope     *guard.Scope
+	ExpiresAt time.Time
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verifier validates JWTs signatures and standard claims
+type Verifier struct {
+	conf *Conf
+	keys []verificationKey
+}
+
+func (v *Verifier) verifySignature(hdr header, signingInput, signature []byte) error {
+	for _, key := range v.keys {
+		if !key.supports(hdr.Alg) || (hdr.Kid != "" && key.kid != "" && key.kid != hdr.Kid) {
+			continue
+		}
+		switch hdr.Alg {
+		case AlgHS256:
+			mac := hmac.New(sha256.New, key.hmac)
+			mac.Write(signingInput)
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return nil
+			}
+		case AlgRS256:
+			digest := sha256.Sum256(signingInput)
+			if rsa.VerifyPKCS1v15(key.rsa, crypto.SHA256, digest[:], signature) == nil {
+				return nil
+			}
+		case AlgEdDSA:
+			if ed25519.Verify(key.ed, signingInput, signature) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+}
+
+func numericClaim(claims map[string]any, name string) (time.Time, bool, error) {
+	v, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	num, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, true, fmt.Errorf("%w: invalid `%s` claim", ErrInvalidToken, name)
+	}
+	secs, err := num.Float64()
+	if err != nil {
+		return time.Time{}, true, fmt.Errorf("%w: invalid `%s` claim", ErrInvalidToken, name)
+	}
+	return time.Unix(int64(secs), 0), true, nil
+}
+
+func audienceContains(aud any, value string) bool {
+	switch tAud := aud.(type) {
+	case string:
+		return tAud == value
+	case []any:
+		for _, item := range tAud {
+			if s, ok := item.(string); ok && s == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseUserID(v any) (common.UserID, error) {
+	var raw string
+	switch tv := v.(type) {
+	case json.Number:
+		raw = tv.String()
+	case string:
+		raw = tv
+	default:
+		return common.InvalidUserID, fmt.Errorf("unsupported type")
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil {
+		return common.InvalidUserID, err
+	}
+	return common.UserID(id), nil
+}
+
+// Verify validates a raw (compact serialized) JWT and returns
+// its relevant claims. The `exp` claim is required.
+func (v *Verifier) Verify(rawToken string, now time.Time) (*Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	var hdr header
+	if err := json.Unmarshal(rawHeader, &hdr); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	if !collections.SliceContains(v.conf.Algorithms, hdr.Alg) {
+		return nil, fmt.Errorf("%w: algorithm `%s` not accepted", ErrInvalidToken, hdr.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	if err := v.verifySignature(hdr, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	rawPayload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed payload", ErrInvalidToken)
+	}
+	dec := json.NewDecoder(bytes.NewReader(rawPayload))
+	dec.UseNumber()
+	var claims map[string]any
+	if err := dec.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed payload", ErrInvalidToken)
+	}
+
+	leeway := time.Duration(v.conf.LeewaySecs) * time.Second
+	exp, found, err := numericClaim(claims, "exp")
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: missing `exp` claim", ErrInvalidToken)
+	}
+	if !now.Before(exp.Add(leeway)) {
+		return nil, ErrTokenExpired
+	}
+	nbf, found, err := numericClaim(claims, "nbf")
+	if err != nil {
+		return nil, err
+	}
+	if found && now.Add(leeway).Before(nbf) {
+		return nil, fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	}
+	if v.conf.Issuer != "" && claims["iss"] != v.conf.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	if v.conf.Audience != "" && !audienceContains(claims["aud"], v.conf.Audience) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+
+	ans := &Claims{ExpiresAt: exp}
+	ans.UserID, err = parseUserID(claims[v.conf.UserIDClaim])
+	if err != nil || !ans.UserID.IsValid() {
+		return nil, fmt.Errorf("%w: invalid user ID claim `%s`", ErrInvalidToken, v.conf.UserIDClaim)
+	}
+	if rawScope, ok := claims[v.conf.ScopeClaim]; ok {
+		// the scope is re-encoded so we can reuse the guard.Scope decoding
+		data, err := json.Marshal(rawScope)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid scope claim", ErrInvalidToken)
+		}
+		var scope guard.Scope
+		if err := json.Unmarshal(data, &scope); err != nil {
+			return nil, fmt.Errorf("%w: invalid scope claim", ErrInvalidToken)
+		}
+		if err := scope.Validate(v.conf.ScopeClaim); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+		}
+		ans.Scope = &scope
+	}
+	return ans, nil
+}
+
+// NewVerifier creates a new verifier and loads its keys.
+// The conf is expected to be validated.
+func NewVerifier(conf *Conf) (*Verifier, error) {
+	keys, err := loadKeys(conf.KeysPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{conf: conf, keys: keys}, nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard/guard"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSecret = []byte("test-secret-test-secret-test-sec")
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func sign(t *testing.T, alg, kid string, claims map[string]any, key any) string {
+	hdr, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": kid})
+	assert.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	assert.NoError(t, err)
+	input := b64(hdr) + "." + b64(payload)
+	var sig []byte
+	switch tKey := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, tKey)
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(input))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, tKey, crypto.SHA256, digest[:])
+		assert.NoError(t, err)
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(tKey, []byte(input))
+	}
+	return input + "." + b64(sig)
+}
+
+func newTestVerifier(t *testing.T, keysFile string, data []byte) *Verifier {
+	path := filepath.Join(t.TempDir(), keysFile)
+	assert.NoError(t, os.WriteFile(path, data, 0600))
+	conf := &Conf{KeysPath: path, Issuer: "wag", Audience: "apiguard"}
+	assert.NoError(t, conf.Validate("jwt"))
+	v, err := NewVerifier(conf)
+	assert.NoError(t, err)
+	return v
+}
+
+func validClaims(now time.Time) map[string]any {
+	return map[string]any{
+		"sub": "42",
+		"iss": "wag",
+		"aud": []string{"other", "apiguard"},
+		"exp": now.Add(time.Minute).Unix(),
+		"nbf": now.Add(-time.Minute).Unix(),
+	}
+}
+
+func TestVerifyAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	jwksDoc, err := json.Marshal(map[string]any{
+		"keys": []map[string]string{
+			{"kty": "oct", "kid": "h1", "k": b64(testSecret)},
+			{"kty": "OKP", "kid": "e1", "crv": "Ed25519", "x": b64(edPub)},
+		},
+	})
+	assert.NoError(t, err)
+	v := newTestVerifier(t, "keys.json", jwksDoc)
+	now := time.Now()
+
+	claims, err := v.Verify(sign(t, AlgHS256, "h1", validClaims(now), testSecret), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, int(claims.UserID))
+
+	_, err = v.Verify(sign(t, AlgEdDSA, "e1", validClaims(now), edPriv), now)
+	assert.NoError(t, err)
+
+	// no RSA key in the JWKS
+	_, err = v.Verify(sign(t, AlgRS256, "", validClaims(now), rsaKey), now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	assert.NoError(t, err)
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	v2 := newTestVerifier(t, "keys.pem", pemData)
+	_, err = v2.Verify(sign(t, AlgRS256, "", validClaims(now), rsaKey), now)
+	assert.NoError(t, err)
+
+	// the RSA public key must not be usable as an HMAC secret
+	_, err = v2.Verify(sign(t, AlgHS256, "", validClaims(now), pemData), now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestVerifyClaims(t *testing.T) {
+	jwksDoc := []byte(`{"keys": [{"kty": "oct", "k": "` + b64(testSecret) + `"}]}`)
+	v := newTestVerifier(t, "keys.json", jwksDoc)
+	now := time.Now()
+
+	expired := validClaims(now)
+	expired["exp"] = now.Add(-time.Second).Unix()
+	_, err := v.Verify(sign(t, AlgHS256, "", expired, testSecret), now)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+
+	noExp := validClaims(now)
+	delete(noExp, "exp")
+	_, err = v.Verify(sign(t, AlgHS256, "", noExp, testSecret), now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	notYet := validClaims(now)
+	notYet["nbf"] = now.Add(time.Minute).Unix()
+	_, err = v.Verify(sign(t, AlgHS256, "", notYet, testSecret), now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	wrongIss := validClaims(now)
+	wrongIss["iss"] = "someone"
+	_, err = v.Verify(sign(t, AlgHS256, "", wrongIss, testSecret), now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	wrongAud := validClaims(now)
+	wrongAud["aud"] = "other"
+	_, err = v.Verify(sign(t, AlgHS256, "", wrongAud, testSecret), now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = v.Verify(sign(t, AlgHS256, "", validClaims(now), []byte("other secret")), now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestVerifyScope(t *testing.T) {
+	jwksDoc := []byte(`{"keys": [{"kty": "oct", "k": "` + b64(testSecret) + `"}]}`)
+	v := newTestVerifier(t, "keys.json", jwksDoc)
+	now := time.Now()
+
+	withScope := validClaims(now)
+	withScope["apiguard_scope"] = map[string]any{"paths": []string{"freqs"}, "methods": []string{"get"}}
+	claims, err := v.Verify(sign(t, AlgHS256, "", withScope, testSecret), now)
+	assert.NoError(t, err)
+	assert.Equal(t, &guard.Scope{Paths: []string{"/freqs"}, Methods: []string{"GET"}}, claims.Scope)
+
+	claims, err = v.Verify(sign(t, AlgHS256, "", validClaims(now), testSecret), now)
+	assert.NoError(t, err)
+	assert.Nil(t, claims.Scope)
+}
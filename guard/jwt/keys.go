@@ -0,0 +1,214 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// verificationKey is a key used to verify JWT signatures. Exactly
+// one of the hmac, rsa, ed fields is set.
+type verificationKey struct {
+	kid  string
+	hmac []byte
+	rsa  *rsa.PublicKey
+	ed   ed25519.PublicKey
+}
+
+// supports tests whether the key can be used with
+// the specified signing algorithm
+func (k verificationKey) supports(alg string) bool {
+	switch alg {
+	case AlgHS256:
+		return k.hmac != nil
+	case AlgRS256:
+		return k.rsa != nil
+	case AlgEdDSA:
+		return k.ed != nil
+	}
+	return false
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+func decodeB64Field(value, name string) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("missing `%s`", name)
+	}
+	ans, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid `%s`: %w", name, err)
+	}
+	return ans, nil
+}
+
+func (k jwk) toVerificationKey() (verificationKey, error) {
+	ans := verificationKey{kid: k.Kid}
+	switch k.Kty {
+	case "oct":
+		secret, err := decodeB64Field(k.K, "k")
+		if err != nil {
+			return ans, err
+		}
+		ans.hmac = secret
+	case "RSA":
+		n, err := decodeB64Field(k.N, "n")
+		if err != nil {
+			return ans, err
+		}
+		e, err := decodeB64Field(k.E, "e")
+		if err != nil {
+			return ans, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return ans, fmt.Errorf("invalid RSA exponent")
+		}
+		ans.rsa = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return ans, fmt.Errorf("unsupported curve `%s`", k.Crv)
+		}
+		x, err := decodeB64Field(k.X, "x")
+		if err != nil {
+			return ans, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return ans, fmt.Errorf("invalid Ed25519 key size")
+		}
+		ans.ed = ed25519.PublicKey(x)
+	default:
+		return ans, fmt.Errorf("unsupported key type `%s`", k.Kty)
+	}
+	return ans, nil
+}
+
+func parseJWKS(data []byte) ([]verificationKey, error) {
+	var doc jwks
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JWKS document: %w", err)
+	}
+	ans := make([]verificationKey, 0, len(doc.Keys))
+	for i, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		vk, err := k.toVerificationKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %d: %w", i, err)
+		}
+		ans = append(ans, vk)
+	}
+	return ans, nil
+}
+
+func publicKeyToVerificationKey(pub any) (verificationKey, error) {
+	switch tPub := pub.(type) {
+	case *rsa.PublicKey:
+		return verificationKey{rsa: tPub}, nil
+	case ed25519.PublicKey:
+		return verificationKey{ed: tPub}, nil
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+func parsePEM(data []byte) ([]verificationKey, error) {
+	ans := make([]verificationKey, 0, 2)
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		var vk verificationKey
+		switch block.Type {
+		case "PUBLIC KEY":
+			pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("invalid PEM public key: %w", err)
+			}
+			if vk, err = publicKeyToVerificationKey(pub); err != nil {
+				return nil, err
+			}
+		case "RSA PUBLIC KEY":
+			pub, err := x509.ParsePKCS1PublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("invalid PEM RSA public key: %w", err)
+			}
+			vk.rsa = pub
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("invalid PEM certificate: %w", err)
+			}
+			if vk, err = publicKeyToVerificationKey(cert.PublicKey); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported PEM block `%s`", block.Type)
+		}
+		ans = append(ans, vk)
+	}
+	return ans, nil
+}
+
+// loadKeys loads verification keys from a local file containing
+// either a JWKS document or PEM encoded public keys/certificates.
+func loadKeys(path string) ([]verificationKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWT keys: %w", err)
+	}
+	var keys []verificationKey
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		keys, err = parseJWKS(data)
+
+	} else {
+		keys, err = parsePEM(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWT keys from %s: %w", path, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("failed to load JWT keys: no usable keys found in %s", path)
+	}
+	return keys, nil
+}
@@ -43,6 +43,7 @@ func (sra *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.Clien
 func (sra *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
 	return guard.ReqEvaluation{
 		ProposedResponse: http.StatusOK,
+		Reason:           guard.Reason{Code: guard.ReasonAllowed, Guard: guard.GuardTypeNull},
 	}
 }
 
@@ -0,0 +1,94 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"github.com/czcorpus/apiguard/proxy"
+	"github.com/rs/zerolog"
+)
+
+// ReasonCode is a machine readable category of a guard decision
+type ReasonCode string
+
+const (
+	ReasonAllowed            ReasonCode = "allowed"
+	ReasonAuthExcluded       ReasonCode = "auth_excluded"
+	ReasonNoCredentials      ReasonCode = "no_credentials"
+	ReasonInvalidCredentials ReasonCode = "invalid_credentials"
+	ReasonScope              ReasonCode = "scope"
+	ReasonRateLimit          ReasonCode = "rate_limit"
+	ReasonQuota              ReasonCode = "quota"
+	ReasonIPBan              ReasonCode = "ip_ban"
+	ReasonUserBan            ReasonCode = "user_ban"
+	ReasonInternalError      ReasonCode = "internal_error"
+
+	// the following codes are used by the fair queue (see guard/fairqueue)
+	ReasonQueued       ReasonCode = "queued"
+	ReasonQueueFull    ReasonCode = "queue_full"
+	ReasonQueueTimeout ReasonCode = "queue_timeout"
+
+	// ReasonHoneypot is used for requests to honeypot paths
+	// (these are handled before any service guard)
+	ReasonHoneypot ReasonCode = "honeypot"
+
+	// ReasonReputation is used for requests from addresses listed
+	// in an IP reputation blocklist (the Rule contains the list name)
+	ReasonReputation ReasonCode = "reputation"
+)
+
+// Reason describes why a guard made its decision about a request.
+// It is intended mainly for logging and auditing - clients
+// should get just DenialMessage().
+type Reason struct {
+	Code ReasonCode `json:"code"`
+
+	// Guard is the type of the guard which made the decision
+	// (this is useful mainly for composite guards)
+	Guard GuardType `json:"guard,omitempty"`
+
+	// Limit is the limit the request did not pass (if applicable)
+	Limit *proxy.Limit `json:"limit,omitempty"`
+
+	// Rule identifies a more specific matched rule - e.g. a failed
+	// token scope, an exhausted quota period or a user ban ID
+	Rule string `json:"rule,omitempty"`
+
+	// Shadow is true if the request should have been denied
+	// but the guard runs in the shadow mode
+	Shadow bool `json:"shadow,omitempty"`
+}
+
+func (r Reason) IsZero() bool {
+	return r.Code == ""
+}
+
+func (r Reason) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("code", string(r.Code))
+	if r.Guard != "" {
+		e.Str("guard", string(r.Guard))
+	}
+	if r.Limit != nil {
+		e.Stringer("limit", r.Limit)
+	}
+	if r.Rule != "" {
+		e.Str("rule", r.Rule)
+	}
+	if r.Shadow {
+		e.Bool("shadow", true)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/globctx"
+	"github.com/czcorpus/apiguard/logging"
+	"github.com/czcorpus/apiguard/reporting"
+	"github.com/czcorpus/apiguard/reputation"
+	"github.com/rs/zerolog/log"
+)
+
+// ReputationGuard wraps a guard and checks client addresses against
+// IP reputation blocklists before the wrapped guard evaluates
+// the request. Based on the service configuration, requests of listed
+// clients are rejected, delayed or just reported.
+// Forwarding headers are considered only for requests coming
+// from known proxies (see logging.ExtractTrustedClientIP).
+type ReputationGuard struct {
+	ServiceGuard
+	serviceKey   string
+	conf         *reputation.ServiceConf
+	blocklists   *reputation.Blocklists
+	knownProxies []string
+	reporting    reporting.ReportingWriter
+	tzLocation   *time.Location
+}
+
+func (g *ReputationGuard) lookup(req *http.Request) (string, string, bool) {
+	clientIP := logging.ExtractTrustedClientIP(req, g.knownProxies)
+	list, listed := g.blocklists.Lookup(net.ParseIP(clientIP))
+	return clientIP, list, listed
+}
+
+func (g *ReputationGuard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) ReqEvaluation {
+	clientIP, list, listed := g.lookup(req)
+	if !listed {
+		return g.ServiceGuard.EvaluateRequest(req, fallbackCookie)
+	}
+	log.Debug().
+		Str("serviceKey", g.serviceKey).
+		Str("clientIp", clientIP).
+		Str("list", list).
+		Str("action", string(g.conf.Action)).
+		Msg("client address found in IP reputation blocklist")
+	g.reporting.Write(&reporting.ReputationHit{
+		Created:  time.Now().In(g.tzLocation),
+		Service:  g.serviceKey,
+		List:     list,
+		Action:   string(g.conf.Action),
+		ClientIP: clientIP,
+		Path:     req.URL.Path,
+	})
+	if g.conf.Action == reputation.ActionBlock {
+		return ReqEvaluation{
+			ClientID:         common.InvalidUserID,
+			ProposedResponse: http.StatusForbidden,
+			Reason:           Reason{Code: ReasonReputation, Rule: list},
+		}
+	}
+	return g.ServiceGuard.EvaluateRequest(req, fallbackCookie)
+}
+
+func (g *ReputationGuard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	delay, err := g.ServiceGuard.CalcDelay(req, clientID)
+	if err != nil {
+		return 0, err
+	}
+	if g.conf.Action != reputation.ActionDelay {
+		return delay, nil
+	}
+	if _, _, listed := g.lookup(req); listed {
+		delay += time.Duration(g.conf.DelaySecs * float64(time.Second))
+	}
+	return delay, nil
+}
+
+// WithReputation wraps the guard by ReputationGuard in case
+// the service has the reputation configured. Otherwise, the original
+// guard is returned. The wrapper should be applied outside WithCosts
+// and outside a fair queue so listed clients are rejected before they
+// consume any tokens or occupy any queue slots.
+func WithReputation(
+	globalCtx *globctx.Context,
+	serviceKey string,
+	conf *reputation.ServiceConf,
+	grd ServiceGuard,
+) ServiceGuard {
+	if conf == nil {
+		return grd
+	}
+	if globalCtx.Reputation == nil {
+		log.Warn().
+			Str("serviceKey", serviceKey).
+			Msg("service has reputation configured but no global blocklists are defined - ignoring")
+		return grd
+	}
+	return &ReputationGuard{
+		ServiceGuard: grd,
+		serviceKey:   serviceKey,
+		conf:         conf,
+		blocklists:   globalCtx.Reputation,
+		knownProxies: globalCtx.KnownProxies,
+		reporting:    globalCtx.ReportingWriter,
+		tzLocation:   globalCtx.TimezoneLocation,
+	}
+}
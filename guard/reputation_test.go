@@ -0,0 +1,143 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/reporting"
+	"github.com/czcorpus/apiguard/reputation"
+	"github.com/stretchr/testify/assert"
+)
+
+func newReputationTestGuard(
+	t *testing.T,
+	conf *reputation.ServiceConf,
+	writer reporting.ReportingWriter,
+) ServiceGuard {
+	ctx := newShadowTestCtx(writer)
+	ctx.Reputation = reputation.NewBlocklists(&reputation.Conf{
+		Lists: []reputation.ListConf{
+			{Name: "drop", Path: "../reputation/testdata/spamhaus_drop.txt"},
+		},
+		RefreshIntervalSecs: 60,
+	})
+	ctx.KnownProxies = []string{"10.0.0.1"}
+	grd := WithReputation(
+		ctx,
+		"1/test",
+		conf,
+		&fixedGuard{eval: ReqEvaluation{ProposedResponse: http.StatusOK}, delay: time.Second},
+	)
+	_, ok := grd.(*ReputationGuard)
+	assert.True(t, ok)
+	return grd
+}
+
+func newReputationTestRequest(ip string) *http.Request {
+	return newForwardedReputationTestRequest(ip, "")
+}
+
+func newForwardedReputationTestRequest(ip, forwardedFor string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/service/1/test/query", nil)
+	req.RemoteAddr = net.JoinHostPort(ip, "50000")
+	if forwardedFor != "" {
+		req.Header.Set("x-forwarded-for", forwardedFor)
+	}
+	return req
+}
+
+func TestWithReputationKeepsGuardWithoutConf(t *testing.T) {
+	grd := &fixedGuard{}
+	ctx := newShadowTestCtx(&recordingWriter{})
+	assert.Same(t, grd, WithReputation(ctx, "1/test", nil, grd))
+	assert.Same(t, grd, WithReputation(ctx, "1/test", &reputation.ServiceConf{Action: reputation.ActionBlock}, grd))
+}
+
+func TestReputationGuardBlock(t *testing.T) {
+	writer := &recordingWriter{}
+	grd := newReputationTestGuard(t, &reputation.ServiceConf{Action: reputation.ActionBlock}, writer)
+
+	ans := grd.EvaluateRequest(newReputationTestRequest("203.0.113.10"), nil)
+	assert.Equal(t, http.StatusForbidden, ans.ProposedResponse)
+	assert.Equal(t, ReasonReputation, ans.Reason.Code)
+	assert.Equal(t, "drop", ans.Reason.Rule)
+	assert.Equal(t, common.InvalidUserID, ans.ClientID)
+	if assert.Len(t, writer.items, 1) {
+		hit := writer.items[0].(*reporting.ReputationHit)
+		assert.Equal(t, "203.0.113.10", hit.ClientIP)
+		assert.Equal(t, "block", hit.Action)
+	}
+
+	ans = grd.EvaluateRequest(newReputationTestRequest("192.0.2.10"), nil)
+	assert.Equal(t, http.StatusOK, ans.ProposedResponse)
+	assert.Len(t, writer.items, 1)
+}
+
+func TestReputationGuardDelay(t *testing.T) {
+	writer := &recordingWriter{}
+	grd := newReputationTestGuard(
+		t, &reputation.ServiceConf{Action: reputation.ActionDelay, DelaySecs: 2.5}, writer)
+
+	req := newReputationTestRequest("203.0.113.10")
+	ans := grd.EvaluateRequest(req, nil)
+	assert.Equal(t, http.StatusOK, ans.ProposedResponse)
+	assert.Len(t, writer.items, 1)
+	delay, err := grd.CalcDelay(req, common.ClientID{IP: "203.0.113.10"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3500*time.Millisecond, delay)
+
+	delay, err = grd.CalcDelay(newReputationTestRequest("192.0.2.10"), common.ClientID{IP: "192.0.2.10"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, delay)
+}
+
+func TestReputationGuardFlag(t *testing.T) {
+	writer := &recordingWriter{}
+	grd := newReputationTestGuard(t, &reputation.ServiceConf{Action: reputation.ActionFlag}, writer)
+
+	req := newReputationTestRequest("2001:db8:dead::1")
+	ans := grd.EvaluateRequest(req, nil)
+	assert.Equal(t, http.StatusOK, ans.ProposedResponse)
+	assert.Len(t, writer.items, 1)
+	delay, err := grd.CalcDelay(req, common.ClientID{IP: "2001:db8:dead::1"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, delay)
+}
+
+func TestReputationGuardTrustsOnlyKnownProxies(t *testing.T) {
+	writer := &recordingWriter{}
+	grd := newReputationTestGuard(t, &reputation.ServiceConf{Action: reputation.ActionBlock}, writer)
+
+	// forged headers are ignored
+	ans := grd.EvaluateRequest(newForwardedReputationTestRequest("203.0.113.10", "192.0.2.10"), nil)
+	assert.Equal(t, http.StatusForbidden, ans.ProposedResponse)
+	ans = grd.EvaluateRequest(newForwardedReputationTestRequest("192.0.2.10", "203.0.113.10"), nil)
+	assert.Equal(t, http.StatusOK, ans.ProposedResponse)
+
+	// a client address forwarded by a known proxy is used
+	ans = grd.EvaluateRequest(newForwardedReputationTestRequest("10.0.0.1", "203.0.113.10"), nil)
+	assert.Equal(t, http.StatusForbidden, ans.ProposedResponse)
+	ans = grd.EvaluateRequest(newForwardedReputationTestRequest("10.0.0.1", "192.0.2.10"), nil)
+	assert.Equal(t, http.StatusOK, ans.ProposedResponse)
+}
@@ -0,0 +1,166 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/czcorpus/cnc-gokit/collections"
+)
+
+const (
+	ScopePaths   = "paths"
+	ScopeMethods = "methods"
+	ScopeCorpora = "corpora"
+)
+
+// corpusQueryArgs are URL arguments typically containing
+// a corpus ID in APIs of CNC services
+var corpusQueryArgs = []string{"corpname", "corpus", "corpusId"}
+
+// CorpusExtractor finds all the corpora a request refers to. The path
+// is relative to the respective service path (e.g. `/freqs/syn2020`).
+type CorpusExtractor func(req *http.Request, relPath string) []string
+
+// CorporaFromQuery is the default CorpusExtractor which searches
+// for corpora in the URL arguments (corpname, corpus, corpusId).
+func CorporaFromQuery(req *http.Request, relPath string) []string {
+	ans := make([]string, 0, 2)
+	query := req.URL.Query()
+	for _, arg := range corpusQueryArgs {
+		ans = append(ans, query[arg]...)
+	}
+	return ans
+}
+
+// CorporaFromPathSegment creates a CorpusExtractor for APIs with
+// a corpus ID as a path segment (e.g. MQuery's `/freqs/syn2020` where
+// the segment index is 1). The URL arguments are searched too.
+func CorporaFromPathSegment(idx int) CorpusExtractor {
+	return func(req *http.Request, relPath string) []string {
+		ans := CorporaFromQuery(req, relPath)
+		segments := strings.Split(strings.Trim(relPath, "/"), "/")
+		if idx < len(segments) && segments[idx] != "" {
+			ans = append(ans, segments[idx])
+		}
+		return ans
+	}
+}
+
+// Scope restricts requests allowed for a client (typically a token holder).
+// Empty restrictions mean "anything is allowed".
+type Scope struct {
+
+	// Paths contains path prefixes (e.g. `/freqs`) or glob patterns
+	// (e.g. `/freqs/syn*`, see path.Match) relative to a service path.
+	Paths []string `json:"paths,omitempty"`
+
+	// Methods contains allowed HTTP methods
+	Methods []string `json:"methods,omitempty"`
+
+	// Corpora contains IDs of corpora allowed to be queried
+	Corpora []string `json:"corpora,omitempty"`
+}
+
+func (s *Scope) Validate(context string) error {
+	if s == nil {
+		return nil
+	}
+	for i, p := range s.Paths {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("%s.paths[%d] is not a valid pattern: %w", context, i, err)
+		}
+		if !strings.HasPrefix(p, "/") {
+			s.Paths[i] = "/" + p
+		}
+	}
+	for i, m := range s.Methods {
+		s.Methods[i] = strings.ToUpper(m)
+	}
+	return nil
+}
+
+// isCleanPath tests whether the path contains no dot segments,
+// duplicate slashes etc. Such paths could be used to escape
+// allowed path prefixes (e.g. `/freqs/../admin`) as the backend
+// resolves them differently than the scope matching would.
+// A trailing slash is allowed.
+func isCleanPath(p string) bool {
+	cleaned := path.Clean(p)
+	return p == cleaned || p == cleaned+"/"
+}
+
+func (s *Scope) matchesPath(relPath string) bool {
+	if !strings.HasPrefix(relPath, "/") {
+		relPath = "/" + relPath
+	}
+	if !isCleanPath(relPath) {
+		return false
+	}
+	if len(s.Paths) == 0 {
+		return true
+	}
+	for _, p := range s.Paths {
+		if strings.ContainsAny(p, "*?[") {
+			if ok, _ := path.Match(p, relPath); ok {
+				return true
+			}
+
+		} else if relPath == p || strings.HasPrefix(relPath, strings.TrimSuffix(p, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Check tests whether the request is within the scope. In case it is not,
+// the first failing scope (ScopePaths, ScopeMethods, ScopeCorpora) is returned.
+// Otherwise, an empty string is returned. A nil scope allows everything.
+// Paths which are not clean (see path.Clean) are always outside
+// of a (non-nil) scope.
+func (s *Scope) Check(req *http.Request, relPath string, corpora CorpusExtractor) string {
+	if s == nil {
+		return ""
+	}
+	if !s.matchesPath(relPath) {
+		return ScopePaths
+	}
+	if len(s.Methods) > 0 && !collections.SliceContains(s.Methods, req.Method) {
+		return ScopeMethods
+	}
+	if len(s.Corpora) > 0 {
+		if corpora == nil {
+			corpora = CorporaFromQuery
+		}
+		for _, corp := range corpora(req, relPath) {
+			if !collections.SliceContains(s.Corpora, corp) {
+				return ScopeCorpora
+			}
+		}
+	}
+	return ""
+}
+
+// ScopeDenialReason creates a message for a client whose
+// request did not pass a scope check.
+func ScopeDenialReason(failedScope string) string {
+	return fmt.Sprintf("request outside of the allowed scope: %s", failedScope)
+}
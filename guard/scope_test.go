@@ -0,0 +1,80 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeNilAllowsAll(t *testing.T) {
+	var scope *Scope
+	req := httptest.NewRequest("DELETE", "/service/0/mquery/anything", nil)
+	assert.Equal(t, "", scope.Check(req, "/anything", nil))
+}
+
+func TestScopePaths(t *testing.T) {
+	scope := &Scope{Paths: []string{"freqs", "/concordance/syn*"}}
+	assert.NoError(t, scope.Validate("scope"))
+	req := httptest.NewRequest("GET", "/x", nil)
+	assert.Equal(t, "", scope.Check(req, "/freqs", nil))
+	assert.Equal(t, "", scope.Check(req, "/freqs/syn2020", nil))
+	assert.Equal(t, ScopePaths, scope.Check(req, "/freqs2", nil))
+	assert.Equal(t, "", scope.Check(req, "/concordance/syn2020", nil))
+	assert.Equal(t, ScopePaths, scope.Check(req, "/concordance/intercorp", nil))
+	assert.Equal(t, ScopePaths, scope.Check(req, "/info/syn2020", nil))
+}
+
+func TestScopePathTraversal(t *testing.T) {
+	scope := &Scope{Paths: []string{"/freqs"}}
+	assert.NoError(t, scope.Validate("scope"))
+	req := httptest.NewRequest("GET", "/x", nil)
+	assert.Equal(t, ScopePaths, scope.Check(req, "/freqs/../admin", nil))
+	assert.Equal(t, ScopePaths, scope.Check(req, "/freqs/./syn2020", nil))
+	assert.Equal(t, ScopePaths, scope.Check(req, "/freqs//syn2020", nil))
+	assert.Equal(t, ScopePaths, scope.Check(req, "/freqs/..", nil))
+	assert.Equal(t, "", scope.Check(req, "/freqs/", nil))
+	assert.Equal(t, "", scope.Check(req, "/freqs/syn2020/", nil))
+
+	// dot segments are rejected even with no path restrictions
+	corpScope := &Scope{Corpora: []string{"syn2020"}}
+	assert.NoError(t, corpScope.Validate("scope"))
+	extr := CorporaFromPathSegment(1)
+	assert.Equal(t, ScopePaths, corpScope.Check(req, "/freqs/syn2020/../intercorp", extr))
+}
+
+func TestScopeMethods(t *testing.T) {
+	scope := &Scope{Methods: []string{"get", "head"}}
+	assert.NoError(t, scope.Validate("scope"))
+	assert.Equal(t, "", scope.Check(httptest.NewRequest("GET", "/x", nil), "/x", nil))
+	assert.Equal(t, ScopeMethods, scope.Check(httptest.NewRequest("POST", "/x", nil), "/x", nil))
+}
+
+func TestScopeCorpora(t *testing.T) {
+	scope := &Scope{Corpora: []string{"syn2020"}}
+	assert.NoError(t, scope.Validate("scope"))
+	extr := CorporaFromPathSegment(1)
+	req := httptest.NewRequest("GET", "/service/0/mquery/freqs/syn2020", nil)
+	assert.Equal(t, "", scope.Check(req, "/freqs/syn2020", extr))
+	req = httptest.NewRequest("GET", "/service/0/mquery/freqs/intercorp", nil)
+	assert.Equal(t, ScopeCorpora, scope.Check(req, "/freqs/intercorp", extr))
+	req = httptest.NewRequest("GET", "/service/0/mquery/speeches?corpname=intercorp", nil)
+	assert.Equal(t, ScopeCorpora, scope.Check(req, "/speeches", nil))
+}
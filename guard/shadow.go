@@ -0,0 +1,140 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/globctx"
+	"github.com/czcorpus/apiguard/logging"
+	"github.com/czcorpus/apiguard/reporting"
+	"github.com/rs/zerolog/log"
+)
+
+// Enforcement specifies whether a service actually applies
+// decisions of its guard.
+type Enforcement string
+
+const (
+	// EnforcementEnforce is the standard mode where denied
+	// requests are rejected
+	EnforcementEnforce Enforcement = "enforce"
+
+	// EnforcementShadow (aka dry-run) mode evaluates requests
+	// the same way as the "enforce" mode does but denied requests
+	// are only logged and reported and then let through.
+	// Response delays are not applied either.
+	EnforcementShadow Enforcement = "shadow"
+)
+
+func (e Enforcement) Validate() error {
+	if e != EnforcementEnforce && e != EnforcementShadow {
+		return fmt.Errorf("invalid enforcement `%s` (supported: enforce, shadow)", e)
+	}
+	return nil
+}
+
+// -----------
+
+// ShadowGuard wraps a guard and suppresses its denials and response
+// delays. Each suppressed denial is logged and written to the reporting
+// so it can be compared with the real traffic before switching
+// the service to the "enforce" mode.
+type ShadowGuard struct {
+	ServiceGuard
+	serviceKey string
+	reporting  reporting.ReportingWriter
+	tzLocation *time.Location
+}
+
+func (g *ShadowGuard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) ReqEvaluation {
+	ans := g.ServiceGuard.EvaluateRequest(req, fallbackCookie)
+	if !ans.ForbidsAccess() {
+		return ans
+	}
+	clientIP := logging.ExtractClientIP(req)
+	var limit string
+	if ans.ExceededLimit != nil {
+		limit = ans.ExceededLimit.String()
+	}
+	log.Warn().
+		Str("serviceKey", g.serviceKey).
+		Str("path", req.URL.Path).
+		Str("clientIp", clientIP).
+		Int("clientID", int(ans.ClientID)).
+		Int("status", ans.ProposedResponse).
+		Object("reason", ans.Reason).
+		Str("limit", limit).
+		Msg("shadow mode - request would be denied")
+	g.reporting.Write(&reporting.ShadowDecision{
+		Created:  time.Now().In(g.tzLocation),
+		Service:  g.serviceKey,
+		Status:   ans.ProposedResponse,
+		Reason:   string(ans.Reason.Code),
+		Rule:     ans.Reason.Rule,
+		Limit:    limit,
+		ClientID: ans.ClientID,
+		ClientIP: clientIP,
+	})
+	ans.ProposedResponse = http.StatusOK
+	ans.ExceededLimit = nil
+	ans.DenialReason = ""
+	ans.Reason.Shadow = true
+	return ans
+}
+
+func (g *ShadowGuard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	delay, err := g.ServiceGuard.CalcDelay(req, clientID)
+	if err != nil {
+		return 0, err
+	}
+	if delay > 0 {
+		log.Debug().
+			Str("serviceKey", g.serviceKey).
+			Str("clientIp", clientID.IP).
+			Dur("delay", delay).
+			Msg("shadow mode - response would be delayed")
+	}
+	return 0, nil
+}
+
+// ApplyEnforcement wraps the guard by ShadowGuard in case
+// the shadow enforcement is configured. Otherwise, the original
+// guard is returned.
+func ApplyEnforcement(
+	globalCtx *globctx.Context,
+	serviceKey string,
+	enforcement Enforcement,
+	grd ServiceGuard,
+) ServiceGuard {
+	if enforcement != EnforcementShadow {
+		return grd
+	}
+	log.Warn().
+		Str("serviceKey", serviceKey).
+		Msg("service guard running in shadow mode - no requests will be denied")
+	return &ShadowGuard{
+		ServiceGuard: grd,
+		serviceKey:   serviceKey,
+		reporting:    globalCtx.ReportingWriter,
+		tzLocation:   globalCtx.TimezoneLocation,
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/globctx"
+	"github.com/czcorpus/apiguard/proxy"
+	"github.com/czcorpus/apiguard/reporting"
+	"github.com/stretchr/testify/assert"
+)
+
+type fixedGuard struct {
+	eval  ReqEvaluation
+	delay time.Duration
+}
+
+func (g *fixedGuard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return g.delay, nil
+}
+
+func (g *fixedGuard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return nil
+}
+
+func (g *fixedGuard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) ReqEvaluation {
+	return g.eval
+}
+
+func (g *fixedGuard) TestUserIsAnonymous(userID common.UserID) bool {
+	return false
+}
+
+func (g *fixedGuard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	return common.InvalidUserID, nil
+}
+
+type recordingWriter struct {
+	reporting.NullWriter
+	items []reporting.Timescalable
+}
+
+func (w *recordingWriter) Write(item reporting.Timescalable) {
+	w.items = append(w.items, item)
+}
+
+func newShadowTestCtx(writer reporting.ReportingWriter) *globctx.Context {
+	ctx := globctx.NewGlobalContext(context.Background())
+	ctx.ReportingWriter = writer
+	ctx.TimezoneLocation = time.UTC
+	return ctx
+}
+
+func TestApplyEnforcementKeepsEnforcingGuard(t *testing.T) {
+	grd := &fixedGuard{}
+	ctx := newShadowTestCtx(&recordingWriter{})
+	assert.Same(t, grd, ApplyEnforcement(ctx, "1/test", EnforcementEnforce, grd))
+	assert.Same(t, grd, ApplyEnforcement(ctx, "1/test", "", grd))
+}
+
+func TestShadowGuardLetsDeniedRequestThrough(t *testing.T) {
+	limit := proxy.Limit{ReqPerTimeThreshold: 10, ReqCheckingIntervalSecs: 60, BurstLimit: 10}
+	grd := &fixedGuard{
+		eval: ReqEvaluation{
+			ClientID:         7,
+			ProposedResponse: http.StatusTooManyRequests,
+			ExceededLimit:    &limit,
+			Reason:           Reason{Code: ReasonRateLimit, Guard: GuardTypeDflt, Limit: &limit},
+		},
+		delay: 3 * time.Second,
+	}
+	writer := &recordingWriter{}
+	shadow := ApplyEnforcement(newShadowTestCtx(writer), "1/test", EnforcementShadow, grd)
+	req := httptest.NewRequest(http.MethodGet, "/service/1/test/foo", nil)
+
+	eval := shadow.EvaluateRequest(req, nil)
+	assert.False(t, eval.ForbidsAccess())
+	assert.Equal(t, http.StatusOK, eval.ProposedResponse)
+	assert.Equal(t, common.UserID(7), eval.ClientID)
+	assert.Nil(t, eval.ExceededLimit)
+	assert.Equal(t, ReasonRateLimit, eval.Reason.Code)
+	assert.True(t, eval.Reason.Shadow)
+
+	assert.Len(t, writer.items, 1)
+	decision := writer.items[0].(*reporting.ShadowDecision)
+	assert.Equal(t, "1/test", decision.Service)
+	assert.Equal(t, http.StatusTooManyRequests, decision.Status)
+	assert.Equal(t, string(ReasonRateLimit), decision.Reason)
+	assert.Equal(t, limit.String(), decision.Limit)
+
+	delay, err := shadow.CalcDelay(req, common.ClientID{})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), delay)
+}
+
+func TestShadowGuardIgnoresPassedAndFailedRequests(t *testing.T) {
+	writer := &recordingWriter{}
+	ctx := newShadowTestCtx(writer)
+	req := httptest.NewRequest(http.MethodGet, "/service/1/test/foo", nil)
+
+	shadow := ApplyEnforcement(ctx, "1/test", EnforcementShadow, &fixedGuard{
+		eval: ReqEvaluation{ProposedResponse: http.StatusOK}})
+	assert.Equal(t, http.StatusOK, shadow.EvaluateRequest(req, nil).ProposedResponse)
+
+	shadow = ApplyEnforcement(ctx, "1/test", EnforcementShadow, &fixedGuard{
+		eval: ReqEvaluation{ProposedResponse: http.StatusInternalServerError}})
+	assert.Equal(t, http.StatusInternalServerError, shadow.EvaluateRequest(req, nil).ProposedResponse)
+	assert.Empty(t, writer.items)
+}
+
+func TestWithAuditLogsDenials(t *testing.T) {
+	writer := &recordingWriter{}
+	ctx := newShadowTestCtx(writer)
+	ctx.Audit, _ = globctx.NewAuditLogger(writer, "")
+	req := httptest.NewRequest(http.MethodPost, "/service/1/test/foo", nil)
+	denying := &fixedGuard{
+		eval: ReqEvaluation{
+			ClientID:         7,
+			ProposedResponse: http.StatusForbidden,
+			Reason:           Reason{Code: ReasonScope, Guard: GuardTypeToken, Rule: "corpus:syn2020"},
+		},
+	}
+
+	eval := WithAudit(ctx, "1/test", denying).EvaluateRequest(req, nil)
+	assert.Equal(t, http.StatusForbidden, eval.ProposedResponse)
+	assert.Len(t, writer.items, 1)
+	denial := writer.items[0].(*reporting.GuardDenial)
+	assert.Equal(t, "1/test", denial.Service)
+	assert.Equal(t, string(ReasonScope), denial.ReasonCode)
+	assert.Equal(t, string(GuardTypeToken), denial.GuardType)
+	assert.Equal(t, "corpus:syn2020", denial.Rule)
+	assert.Equal(t, http.MethodPost, denial.Method)
+	assert.Equal(t, "/service/1/test/foo", denial.Path)
+
+	// shadowed denials go only to the shadow monitoring
+	writer.items = nil
+	eval = WithAudit(
+		ctx, "1/test", ApplyEnforcement(ctx, "1/test", EnforcementShadow, denying)).EvaluateRequest(req, nil)
+	assert.Equal(t, http.StatusOK, eval.ProposedResponse)
+	assert.Len(t, writer.items, 1)
+	assert.IsType(t, &reporting.ShadowDecision{}, writer.items[0])
+}
@@ -0,0 +1,185 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// FileStore keeps tokens in a JSON file (a list of token
+// configurations in the same format as used in service
+// configuration). The file is watched for changes so tokens
+// can be also added/revoked by editing the file.
+type FileStore struct {
+	path     string
+	tokens   tokenSet
+	location *time.Location
+
+	// writeLock serializes modifications made via Add and Revoke
+	writeLock sync.Mutex
+}
+
+func (fst *FileStore) Find(hashedValue string) *TokenConf {
+	return fst.tokens.find(hashedValue)
+}
+
+func (fst *FileStore) List() []TokenConf {
+	return fst.tokens.list()
+}
+
+func (fst *FileStore) Add(tk TokenConf) error {
+	if err := tk.Validate("token", fst.location); err != nil {
+		return err
+	}
+	fst.writeLock.Lock()
+	defer fst.writeLock.Unlock()
+	if fst.tokens.find(tk.HashedValue) != nil {
+		return ErrTokenExists
+	}
+	tokens := append(fst.tokens.list(), tk)
+	if err := fst.save(tokens); err != nil {
+		return err
+	}
+	fst.tokens.put(tk)
+	return nil
+}
+
+func (fst *FileStore) Revoke(hashedValue string) error {
+	fst.writeLock.Lock()
+	defer fst.writeLock.Unlock()
+	tokens := fst.tokens.list()
+	idx := slices.IndexFunc(tokens, func(tk TokenConf) bool {
+		return tk.HashedValue == hashedValue
+	})
+	if idx < 0 {
+		return ErrTokenNotFound
+	}
+	if err := fst.save(slices.Delete(tokens, idx, idx+1)); err != nil {
+		return err
+	}
+	fst.tokens.remove(hashedValue)
+	return nil
+}
+
+func (fst *FileStore) save(tokens []TokenConf) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	tmpPath := fst.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	if err := os.Rename(tmpPath, fst.path); err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	return nil
+}
+
+// load reads tokens from the file. A missing file is considered
+// to be an empty list of tokens. In case the file is invalid,
+// the currently loaded tokens are kept.
+func (fst *FileStore) load() error {
+	data, err := os.ReadFile(fst.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		fst.tokens.replace([]TokenConf{})
+		return nil
+
+	} else if err != nil {
+		return fmt.Errorf("failed to load tokens from %s: %w", fst.path, err)
+	}
+	var tokens []TokenConf
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("failed to load tokens from %s: %w", fst.path, err)
+	}
+	if err := validateTokens(tokens, fst.path, fst.location); err != nil {
+		return fmt.Errorf("failed to load tokens: %w", err)
+	}
+	fst.tokens.replace(tokens)
+	return nil
+}
+
+// watch reloads tokens each time the file changes. The whole
+// directory is watched as the file may be replaced (e.g. by an editor
+// or by the save method).
+func (fst *FileStore) watch(ctx context.Context, watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case <-ctx.Done():
+			log.Warn().Str("path", fst.path).Msg("closing FileStore file watch due to cancellation")
+			watcher.Close()
+			return
+		case evt, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(evt.Name) != fst.path || evt.Has(fsnotify.Chmod) {
+				continue
+			}
+			fst.writeLock.Lock()
+			err := fst.load()
+			fst.writeLock.Unlock()
+			if err != nil {
+				log.Error().Err(err).Msg("failed to reload tokens, keeping the previous ones")
+				continue
+			}
+			log.Info().
+				Str("path", fst.path).
+				Str("operation", evt.Op.String()).
+				Msg("reloaded tokens after a file change")
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Error().Err(err).Msg("FileStore failed to watch for file changes")
+		}
+	}
+}
+
+func NewFileStore(ctx context.Context, path string, loc *time.Location) (*FileStore, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	ans := &FileStore{path: filepath.Clean(path), location: loc}
+	if err := ans.load(); err != nil {
+		return nil, fmt.Errorf("failed to instantiate FileStore: %w", err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate FileStore: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(ans.path)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to instantiate FileStore: %w", err)
+	}
+	log.Info().Str("path", ans.path).Msg("watching token file for changes")
+	go ans.watch(ctx, watcher)
+	return ans, nil
+}
@@ -0,0 +1,278 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+/*
+CREATE TABLE apiguard_token (
+	hashed_value CHAR(64) NOT NULL,
+	service_name VARCHAR(25) NOT NULL,
+	user_id INTEGER NOT NULL,
+	conf TEXT NOT NULL, -- full token configuration (JSON)
+	created DATETIME NOT NULL,
+	revoked DATETIME, -- revoked tokens are kept for auditing purposes
+	PRIMARY KEY (hashed_value, service_name)
+) ENGINE=InnoDB;
+
+grant select, update, insert on apiguard_token to 'apiguard'@'192.168.1.%';
+*/
+
+// revocationCheckInterval specifies how often a cached token
+// is checked for revocation in the database
+const revocationCheckInterval = time.Second
+
+// SQLStore keeps tokens in a database table. Tokens are cached
+// in memory and reloaded periodically. Changes made via Add and
+// Revoke are applied immediately to the instance they are
+// performed on, other APIGuard instances see new tokens after
+// the next reload. To make revocations effective on all the
+// instances, Find checks the revocation state of a found token
+// in the database (at most once per revocationCheckInterval
+// for each token to keep the database off the hot path).
+type SQLStore struct {
+	db          *sql.DB
+	serviceName string
+	tokens      tokenSet
+	location    *time.Location
+
+	// writeLock prevents a running reload from overwriting
+	// changes made via Add and Revoke
+	writeLock sync.Mutex
+
+	// lastChecks stores times of the latest revocation
+	// checks of individual tokens
+	lastChecks   map[string]time.Time
+	lastChecksMu sync.Mutex
+}
+
+func (sst *SQLStore) Find(hashedValue string) *TokenConf {
+	tk := sst.tokens.find(hashedValue)
+	if tk == nil || !sst.reserveRevocationCheck(hashedValue) {
+		return tk
+	}
+	revoked, err := sst.isRevoked(hashedValue)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("service", sst.serviceName).
+			Msg("failed to check token revocation, using the cached token")
+		return tk
+	}
+	if revoked {
+		sst.tokens.remove(hashedValue)
+		return nil
+	}
+	return tk
+}
+
+// reserveRevocationCheck tests whether a token should be checked
+// for revocation. In such case, the check time is updated right away
+// so concurrent requests with the same token do not query the database.
+func (sst *SQLStore) reserveRevocationCheck(hashedValue string) bool {
+	sst.lastChecksMu.Lock()
+	defer sst.lastChecksMu.Unlock()
+	now := time.Now()
+	if now.Sub(sst.lastChecks[hashedValue]) < revocationCheckInterval {
+		return false
+	}
+	sst.lastChecks[hashedValue] = now
+	return true
+}
+
+// isRevoked tests whether a token has been revoked (or removed)
+// in the database.
+func (sst *SQLStore) isRevoked(hashedValue string) (bool, error) {
+	row := sst.db.QueryRow(
+		"SELECT revoked IS NOT NULL FROM apiguard_token WHERE hashed_value = ? AND service_name = ?",
+		hashedValue, sst.serviceName,
+	)
+	var revoked bool
+	if err := row.Scan(&revoked); errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+
+	} else if err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
+
+func (sst *SQLStore) List() []TokenConf {
+	return sst.tokens.list()
+}
+
+func (sst *SQLStore) Add(tk TokenConf) error {
+	if err := tk.Validate("token", sst.location); err != nil {
+		return err
+	}
+	data, err := json.Marshal(tk)
+	if err != nil {
+		return fmt.Errorf("failed to add token: %w", err)
+	}
+	sst.writeLock.Lock()
+	defer sst.writeLock.Unlock()
+	tx, err := sst.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to add token: %w", err)
+	}
+	row := tx.QueryRow(
+		"SELECT COUNT(*) FROM apiguard_token WHERE hashed_value = ? AND service_name = ?",
+		tk.HashedValue, sst.serviceName,
+	)
+	var numFound int
+	if err := row.Scan(&numFound); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to add token: %w", err)
+	}
+	if numFound > 0 {
+		tx.Rollback()
+		return ErrTokenExists
+	}
+	_, err = tx.Exec(
+		"INSERT INTO apiguard_token (hashed_value, service_name, user_id, conf, created) "+
+			"VALUES (?, ?, ?, ?, ?)",
+		tk.HashedValue, sst.serviceName, tk.UserID, string(data), time.Now().In(sst.location),
+	)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to add token: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to add token: %w", err)
+	}
+	sst.tokens.put(tk)
+	return nil
+}
+
+func (sst *SQLStore) Revoke(hashedValue string) error {
+	sst.writeLock.Lock()
+	defer sst.writeLock.Unlock()
+	res, err := sst.db.Exec(
+		"UPDATE apiguard_token SET revoked = ? "+
+			"WHERE hashed_value = ? AND service_name = ? AND revoked IS NULL",
+		time.Now().In(sst.location), hashedValue, sst.serviceName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	numAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	if numAffected == 0 {
+		return ErrTokenNotFound
+	}
+	sst.tokens.remove(hashedValue)
+	return nil
+}
+
+func (sst *SQLStore) load() error {
+	sst.writeLock.Lock()
+	defer sst.writeLock.Unlock()
+	rows, err := sst.db.Query(
+		"SELECT conf FROM apiguard_token WHERE service_name = ? AND revoked IS NULL",
+		sst.serviceName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to load tokens: %w", err)
+	}
+	defer rows.Close()
+	tokens := make([]TokenConf, 0, 50)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return fmt.Errorf("failed to load tokens: %w", err)
+		}
+		var tk TokenConf
+		if err := json.Unmarshal([]byte(data), &tk); err != nil {
+			return fmt.Errorf("failed to load tokens: %w", err)
+		}
+		tokens = append(tokens, tk)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load tokens: %w", err)
+	}
+	if err := validateTokens(tokens, "apiguard_token", sst.location); err != nil {
+		return fmt.Errorf("failed to load tokens: %w", err)
+	}
+	sst.tokens.replace(tokens)
+	sst.lastChecksMu.Lock()
+	for hashedValue := range sst.lastChecks {
+		if sst.tokens.find(hashedValue) == nil {
+			delete(sst.lastChecks, hashedValue)
+		}
+	}
+	sst.lastChecksMu.Unlock()
+	return nil
+}
+
+func (sst *SQLStore) refreshPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := sst.load(); err != nil {
+				log.Error().
+					Err(err).
+					Str("service", sst.serviceName).
+					Msg("failed to refresh tokens, keeping the previous ones")
+			}
+		}
+	}
+}
+
+// NewSQLStore creates a new SQLStore for a service specified by
+// its service key (e.g. `3/mquery`) and loads its tokens.
+func NewSQLStore(
+	ctx context.Context,
+	db *sql.DB,
+	serviceKey string,
+	refreshIntervalSecs int,
+	loc *time.Location,
+) (*SQLStore, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	ans := &SQLStore{
+		db:          db,
+		serviceName: serviceKey,
+		location:    loc,
+		lastChecks:  make(map[string]time.Time),
+	}
+	if err := ans.load(); err != nil {
+		return nil, fmt.Errorf("failed to instantiate SQLStore: %w", err)
+	}
+	if refreshIntervalSecs <= 0 {
+		refreshIntervalSecs = dfltStoreRefreshIntervalSecs
+	}
+	go ans.refreshPeriodically(ctx, time.Duration(refreshIntervalSecs)*time.Second)
+	return ans, nil
+}
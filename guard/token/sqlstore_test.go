@@ -0,0 +1,99 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	loadTokensQuery   = "SELECT conf FROM apiguard_token"
+	revokedTokenQuery = "SELECT revoked IS NOT NULL FROM apiguard_token"
+)
+
+func newMockSQLStore(t *testing.T, tokens ...TokenConf) (*SQLStore, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	rows := sqlmock.NewRows([]string{"conf"})
+	for _, tk := range tokens {
+		data, err := json.Marshal(tk)
+		assert.NoError(t, err)
+		rows.AddRow(string(data))
+	}
+	mock.ExpectQuery(loadTokensQuery).WithArgs("1/mquery").WillReturnRows(rows)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	store, err := NewSQLStore(ctx, db, "1/mquery", 3600, time.UTC)
+	assert.NoError(t, err)
+	return store, mock
+}
+
+// expireRevocationCheck makes the store check the token
+// for revocation on the next Find
+func expireRevocationCheck(store *SQLStore, hashedValue string) {
+	store.lastChecksMu.Lock()
+	store.lastChecks[hashedValue] = time.Now().Add(-revocationCheckInterval)
+	store.lastChecksMu.Unlock()
+}
+
+func TestSQLStoreFindChecksRevocation(t *testing.T) {
+	store, mock := newMockSQLStore(t, TokenConf{HashedValue: "abc", UserID: 3})
+
+	mock.ExpectQuery(revokedTokenQuery).
+		WithArgs("abc", "1/mquery").
+		WillReturnRows(sqlmock.NewRows([]string{"revoked"}).AddRow(false))
+	assert.NotNil(t, store.Find("abc"))
+	// the recently checked token is not checked again
+	assert.NotNil(t, store.Find("abc"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// revoked via another instance
+	expireRevocationCheck(store, "abc")
+	mock.ExpectQuery(revokedTokenQuery).
+		WithArgs("abc", "1/mquery").
+		WillReturnRows(sqlmock.NewRows([]string{"revoked"}).AddRow(true))
+	assert.Nil(t, store.Find("abc"))
+	assert.Nil(t, store.Find("abc"))
+	assert.Empty(t, store.List())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLStoreFindRemovedToken(t *testing.T) {
+	store, mock := newMockSQLStore(t, TokenConf{HashedValue: "abc", UserID: 3})
+	mock.ExpectQuery(revokedTokenQuery).
+		WithArgs("abc", "1/mquery").
+		WillReturnRows(sqlmock.NewRows([]string{"revoked"}))
+	assert.Nil(t, store.Find("abc"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLStoreFindKeepsTokenOnFailedCheck(t *testing.T) {
+	store, mock := newMockSQLStore(t, TokenConf{HashedValue: "abc", UserID: 3})
+	mock.ExpectQuery(revokedTokenQuery).WillReturnError(errors.New("connection lost"))
+	assert.NotNil(t, store.Find("abc"))
+	assert.Nil(t, store.Find("xyz"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
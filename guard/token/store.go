@@ -0,0 +1,285 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard/globctx"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	StoreTypeFile = "file"
+	StoreTypeSQL  = "sql"
+
+	dfltStoreRefreshIntervalSecs = 60
+)
+
+var (
+	ErrReadOnlyStore = errors.New("token store is read-only (tokens are defined in service configuration)")
+	ErrTokenNotFound = errors.New("token not found")
+	ErrTokenExists   = errors.New("token already exists")
+)
+
+// StoreConf configures an external token store which allows
+// for managing tokens without editing service configuration
+// and restarting APIGuard.
+type StoreConf struct {
+
+	// Type is either "file" or "sql"
+	Type string `json:"type"`
+
+	// Path specifies a JSON file with a list of tokens
+	// (for the "file" store). Changes to the file are applied
+	// immediately.
+	Path string `json:"path"`
+
+	// RefreshIntervalSecs specifies how often the "sql" store
+	// reloads tokens from the database to reflect changes made
+	// by other APIGuard instances (60 seconds by default). This is
+	// the longest time a token added via another instance remains
+	// unknown to this instance. Revocations are checked separately
+	// and take effect within a second.
+	RefreshIntervalSecs int `json:"refreshIntervalSecs"`
+}
+
+func (sc *StoreConf) Validate(context string) error {
+	if sc == nil {
+		return nil
+	}
+	switch sc.Type {
+	case StoreTypeFile:
+		if sc.Path == "" {
+			return fmt.Errorf("%s.path is missing/empty", context)
+		}
+	case StoreTypeSQL:
+		if sc.RefreshIntervalSecs == 0 {
+			log.Warn().
+				Int("default", dfltStoreRefreshIntervalSecs).
+				Msgf("%s.refreshIntervalSecs not set, using default", context)
+			sc.RefreshIntervalSecs = dfltStoreRefreshIntervalSecs
+
+		} else if sc.RefreshIntervalSecs < 0 {
+			return fmt.Errorf("%s.refreshIntervalSecs has an invalid value", context)
+		}
+	default:
+		return fmt.Errorf("%s.type has an invalid value `%s` (expected `file` or `sql`)", context, sc.Type)
+	}
+	return nil
+}
+
+// Store provides access to tokens accepted by a token guard.
+// Changes made via Add and Revoke take effect immediately.
+type Store interface {
+
+	// Find returns a token with the specified hashed value
+	// or nil if there is no such token
+	Find(hashedValue string) *TokenConf
+
+	List() []TokenConf
+
+	Add(tk TokenConf) error
+
+	Revoke(hashedValue string) error
+}
+
+// HashToken creates a hashed variant of a raw token value
+// as used in the token configuration.
+func HashToken(rawValue string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(rawValue)))
+}
+
+// GenerateToken creates a new random token. It returns the raw
+// value (to be passed to a client) and its hashed variant (to be
+// stored in APIGuard's configuration).
+func GenerateToken() (string, string, error) {
+	id := uuid.New()
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	tk := base64.URLEncoding.EncodeToString(append([]byte(id.String()), bytes...))
+	return tk, HashToken(tk), nil
+}
+
+// NewStore creates a token store based on the provided configuration.
+// In case conf is nil, a read-only store with tokens from service
+// configuration is created.
+func NewStore(
+	globalCtx *globctx.Context,
+	serviceKey string,
+	conf *StoreConf,
+	confTokens []TokenConf,
+) (Store, error) {
+	if conf == nil {
+		return NewStaticStore(confTokens), nil
+	}
+	switch conf.Type {
+	case StoreTypeFile:
+		return NewFileStore(globalCtx, conf.Path, globalCtx.TimezoneLocation)
+	case StoreTypeSQL:
+		if globalCtx.CNCDB == nil {
+			return nil, fmt.Errorf("the `sql` token store requires cncDb to be configured")
+		}
+		return NewSQLStore(
+			globalCtx, globalCtx.CNCDB, serviceKey, conf.RefreshIntervalSecs, globalCtx.TimezoneLocation)
+	default:
+		return nil, fmt.Errorf("unknown token store type `%s`", conf.Type)
+	}
+}
+
+// ----------------------------
+
+// tokenSet is a concurrency-safe in-memory index of tokens
+// used by all the Store implementations
+type tokenSet struct {
+	mu   sync.RWMutex
+	data map[string]*TokenConf
+}
+
+func (ts *tokenSet) find(hashedValue string) *TokenConf {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.data[hashedValue]
+}
+
+func (ts *tokenSet) list() []TokenConf {
+	ts.mu.RLock()
+	ans := make([]TokenConf, 0, len(ts.data))
+	for _, tk := range ts.data {
+		ans = append(ans, *tk)
+	}
+	ts.mu.RUnlock()
+	slices.SortFunc(ans, func(a, b TokenConf) int {
+		if a.UserID != b.UserID {
+			return int(a.UserID) - int(b.UserID)
+		}
+		return strings.Compare(a.HashedValue, b.HashedValue)
+	})
+	return ans
+}
+
+// replace sets new tokens. The tokens are expected to be validated.
+func (ts *tokenSet) replace(tokens []TokenConf) {
+	data := make(map[string]*TokenConf, len(tokens))
+	for i := range tokens {
+		data[tokens[i].HashedValue] = &tokens[i]
+	}
+	ts.mu.Lock()
+	ts.data = data
+	ts.mu.Unlock()
+}
+
+func (ts *tokenSet) put(tk TokenConf) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.data == nil {
+		ts.data = make(map[string]*TokenConf)
+	}
+	ts.data[tk.HashedValue] = &tk
+}
+
+func (ts *tokenSet) remove(hashedValue string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	delete(ts.data, hashedValue)
+}
+
+// validateTokens validates (and normalizes) loaded tokens
+// and checks for duplicities
+func validateTokens(tokens []TokenConf, context string, loc *time.Location) error {
+	used := make(map[string]bool, len(tokens))
+	for i := range tokens {
+		if err := tokens[i].Validate(fmt.Sprintf("%s[%d]", context, i), loc); err != nil {
+			return err
+		}
+		if used[tokens[i].HashedValue] {
+			return fmt.Errorf("%s[%d]: %w", context, i, ErrTokenExists)
+		}
+		used[tokens[i].HashedValue] = true
+	}
+	return nil
+}
+
+// ----------------------------
+
+// StaticStore provides tokens defined directly in service
+// configuration. The store is read-only.
+type StaticStore struct {
+	tokens tokenSet
+}
+
+func (s *StaticStore) Find(hashedValue string) *TokenConf {
+	return s.tokens.find(hashedValue)
+}
+
+func (s *StaticStore) List() []TokenConf {
+	return s.tokens.list()
+}
+
+func (s *StaticStore) Add(tk TokenConf) error {
+	return ErrReadOnlyStore
+}
+
+func (s *StaticStore) Revoke(hashedValue string) error {
+	return ErrReadOnlyStore
+}
+
+// NewStaticStore creates a read-only store. The tokens are
+// expected to be validated.
+func NewStaticStore(tokens []TokenConf) *StaticStore {
+	ans := &StaticStore{}
+	ans.tokens.replace(slices.Clone(tokens))
+	return ans
+}
+
+// ----------------------------
+
+// Registry keeps token stores of individual services so
+// the tokens can be managed via the admin API.
+type Registry struct {
+	mu     sync.RWMutex
+	stores map[string]Store
+}
+
+func (r *Registry) Register(serviceKey string, store Store) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stores[serviceKey] = store
+}
+
+func (r *Registry) Get(serviceKey string) (Store, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	store, ok := r.stores[serviceKey]
+	return store, ok
+}
+
+func NewRegistry() *Registry {
+	return &Registry{stores: make(map[string]Store)}
+}
@@ -0,0 +1,93 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStoreAddRevoke(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store, err := NewFileStore(ctx, path, time.UTC)
+	assert.NoError(t, err)
+	assert.Empty(t, store.List())
+
+	raw, hashed, err := GenerateToken()
+	assert.NoError(t, err)
+	assert.Equal(t, HashToken(raw), hashed)
+	assert.NoError(t, store.Add(TokenConf{HashedValue: hashed, UserID: 3}))
+	assert.ErrorIs(t, store.Add(TokenConf{HashedValue: hashed, UserID: 4}), ErrTokenExists)
+	assert.Equal(t, 3, int(store.Find(hashed).UserID))
+
+	// a new store must see the persisted token
+	store2, err := NewFileStore(ctx, path, time.UTC)
+	assert.NoError(t, err)
+	assert.NotNil(t, store2.Find(hashed))
+
+	assert.NoError(t, store.Revoke(hashed))
+	assert.Nil(t, store.Find(hashed))
+	assert.ErrorIs(t, store.Revoke(hashed), ErrTokenNotFound)
+}
+
+func TestFileStoreReloadsOnChange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`[{"value": "abc", "userId": 1}]`), 0600))
+	store, err := NewFileStore(ctx, path, time.UTC)
+	assert.NoError(t, err)
+	assert.NotNil(t, store.Find("abc"))
+
+	assert.NoError(t, os.WriteFile(path, []byte(`[{"value": "def", "userId": 2}]`), 0600))
+	assert.Eventually(t, func() bool {
+		return store.Find("abc") == nil && store.Find("def") != nil
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestFileStoreKeepsTokensOnInvalidFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`[{"value": "def", "userId": 2}]`), 0600))
+	store, err := NewFileStore(ctx, path, time.UTC)
+	assert.NoError(t, err)
+
+	// an invalid file must not revoke the current tokens (we call
+	// the reload directly to test its result deterministically)
+	assert.NoError(t, os.WriteFile(path, []byte(`[{"userId": 2}]`), 0600))
+	store.writeLock.Lock()
+	err = store.load()
+	store.writeLock.Unlock()
+	assert.Error(t, err)
+	assert.NotNil(t, store.Find("def"))
+}
+
+func TestStaticStoreIsReadOnly(t *testing.T) {
+	store := NewStaticStore([]TokenConf{{HashedValue: "abc", UserID: 1}})
+	assert.NotNil(t, store.Find("abc"))
+	assert.ErrorIs(t, store.Add(TokenConf{HashedValue: "def"}), ErrReadOnlyStore)
+	assert.ErrorIs(t, store.Revoke("abc"), ErrReadOnlyStore)
+}
@@ -18,28 +18,104 @@
 package token
 
 import (
-	"crypto/sha256"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
-	"sync"
+	"strings"
 	"time"
 
+	"github.com/czcorpus/apiguard/cnc"
 	"github.com/czcorpus/apiguard/common"
 	"github.com/czcorpus/apiguard/globctx"
 	"github.com/czcorpus/apiguard/guard"
 	"github.com/czcorpus/apiguard/logging"
 	"github.com/czcorpus/apiguard/proxy"
+	"github.com/czcorpus/apiguard/ratelimit"
 	"github.com/czcorpus/apiguard/telemetry"
 
 	"github.com/rs/zerolog/log"
-	"golang.org/x/time/rate"
 )
 
 type TokenConf struct {
 	HashedValue string        `json:"value"`
 	UserID      common.UserID `json:"userId"`
+
+	// Limits specifies rate limits applied to all the requests
+	// with the token (no matter which IP they come from). If empty,
+	// the service limits are applied (also per token).
+	Limits []proxy.Limit `json:"limits,omitempty"`
+
+	// DailyQuota specifies max. number of requests per calendar
+	// day (0 = no quota)
+	DailyQuota int `json:"dailyQuota,omitempty"`
+
+	// MonthlyQuota specifies max. number of requests per calendar
+	// month (0 = no quota)
+	MonthlyQuota int `json:"monthlyQuota,omitempty"`
+
+	// Expires specifies an optional expiration of the token. Either
+	// a date (YYYY-MM-DD, the token is valid until the end of the day
+	// in the configured time zone) or an RFC3339 datetime can be used.
+	Expires string `json:"expires,omitempty"`
+
+	// Scope optionally restricts paths, methods and corpora
+	// the token can be used for
+	Scope *guard.Scope `json:"scope,omitempty"`
+
+	expiresAt time.Time
+}
+
+// Validate checks the token configuration. The loc argument specifies
+// a location in which date-only expiration values are interpreted.
+func (tc *TokenConf) Validate(context string, loc *time.Location) error {
+	if tc.HashedValue == "" {
+		return fmt.Errorf("%s.value is missing/empty", context)
+	}
+	for i, limit := range tc.Limits {
+		if limit.ReqPerTimeThreshold <= 0 || limit.ReqCheckingIntervalSecs <= 0 {
+			return fmt.Errorf("%s.limits[%d] has an invalid value", context, i)
+		}
+		if limit.BurstLimit == 0 {
+			log.Warn().
+				Int("default", limit.ReqPerTimeThreshold).
+				Msgf("%s.limits[%d].burstLimit not set, using reqPerTimeThreshold", context, i)
+			tc.Limits[i].BurstLimit = limit.ReqPerTimeThreshold
+		}
+	}
+	if tc.DailyQuota < 0 {
+		return fmt.Errorf("%s.dailyQuota has an invalid value", context)
+	}
+	if tc.MonthlyQuota < 0 {
+		return fmt.Errorf("%s.monthlyQuota has an invalid value", context)
+	}
+	if err := tc.Scope.Validate(context + ".scope"); err != nil {
+		return err
+	}
+	if tc.Expires != "" {
+		if t, err := time.ParseInLocation(time.DateOnly, tc.Expires, loc); err == nil {
+			tc.expiresAt = t.AddDate(0, 0, 1)
+
+		} else if t, err := time.Parse(time.RFC3339, tc.Expires); err == nil {
+			tc.expiresAt = t
+
+		} else {
+			return fmt.Errorf("%s.expires has an invalid value (expected YYYY-MM-DD or RFC3339)", context)
+		}
+	}
+	return nil
+}
+
+// IsExpired tests whether the token is expired at the time t
+func (tc *TokenConf) IsExpired(t time.Time) bool {
+	return !tc.expiresAt.IsZero() && !t.Before(tc.expiresAt)
+}
+
+// limitingKey returns a value identifying the token for rate limiting
+// and quotas. The hashed value is used so no secret is exposed
+// in e.g. Redis keys.
+func (tc *TokenConf) limitingKey() string {
+	return "token:" + tc.HashedValue
 }
 
 // Guard in the `token` package - besides standard functions like throttling
@@ -54,36 +130,52 @@ type Guard struct {
 
 	tokenHeaderName string
 
-	rateLimiters map[string]*rate.Limiter
+	serviceKey string
 
-	confLimits []proxy.Limit
+	rateLimiters ratelimit.Limiter
 
-	rateLimitersMu sync.Mutex
+	quotas *ratelimit.QuotaStore
 
-	hashedTokens []TokenConf
+	userBans *cnc.UserBans
+
+	confLimits []proxy.Limit
+
+	tokens Store
 
 	authExcludedPathPrefixes []string
+
+	corpusExtractor guard.CorpusExtractor
+
+	delayPolicy *guard.DelayPolicy
 }
 
 func (g *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
-	return 0, nil
+	return g.delayPolicy.CalcDelay(req, clientID)
+}
+
+func (g *Guard) EstimateDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return g.delayPolicy.EstimateDelay(req, clientID)
 }
 
 func (g *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
 	return g.tlmtrStorage.LogAppliedDelay(respDelay, clientID)
 }
 
-func (g *Guard) validateToken(token string) common.UserID {
+// findToken returns a token from the token store matching the provided
+// raw value. In case nothing is found, nil is returned.
+func (g *Guard) findToken(token string) *TokenConf {
 	if token == "" {
-		return common.InvalidUserID
+		return nil
 	}
-	hToken := fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
-	for _, tk := range g.hashedTokens {
-		if tk.HashedValue == hToken {
-			return tk.UserID
-		}
+	return g.tokens.Find(HashToken(token))
+}
+
+func (g *Guard) validateToken(token string) common.UserID {
+	tk := g.findToken(token)
+	if tk == nil || tk.IsExpired(time.Now()) {
+		return common.InvalidUserID
 	}
-	return common.InvalidUserID
+	return tk.UserID
 }
 
 func (g *Guard) checkForBan(req *http.Request, clientID common.ClientID) (bool, error) {
@@ -117,38 +209,78 @@ func (g *Guard) pathMatchesExclude(req *http.Request) bool {
 }
 
 func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
-	userID := g.validateToken(req.Header.Get(g.tokenHeaderName))
-	if !(userID.IsValid() || g.pathMatchesExclude(req)) {
+	tk := g.findToken(req.Header.Get(g.tokenHeaderName))
+	if tk != nil && tk.IsExpired(time.Now()) {
 		return guard.ReqEvaluation{
 			ProposedResponse: http.StatusUnauthorized,
 			ClientID:         common.InvalidUserID,
 			SessionID:        "",
-			Error:            fmt.Errorf("invalid authentication token"),
+			DenialReason:     "authentication token expired",
+			Reason: guard.Reason{
+				Code: guard.ReasonInvalidCredentials, Guard: guard.GuardTypeToken, Rule: "expired"},
 		}
 	}
-	clientIP := logging.ExtractClientIP(req)
-
-	if len(g.confLimits) > 0 {
-		g.rateLimitersMu.Lock()
-		defer g.rateLimitersMu.Unlock()
-		limiter, exists := g.rateLimiters[clientIP]
-		if !exists {
-			flimit := g.confLimits[0]
-			limiter = rate.NewLimiter(
-				flimit.NormLimitPerSec(),
-				flimit.BurstLimit,
-			)
-			g.rateLimiters[clientIP] = limiter
+	userID := common.InvalidUserID
+	if tk != nil {
+		userID = tk.UserID
+	}
+	isExcluded := g.pathMatchesExclude(req)
+	if !(userID.IsValid() || isExcluded) {
+		noTokenReason := guard.ReasonInvalidCredentials
+		if req.Header.Get(g.tokenHeaderName) == "" {
+			noTokenReason = guard.ReasonNoCredentials
 		}
-		if !limiter.Allow() {
-			log.Debug().Str("clientIp", clientIP).Msg("limiting client with status 429")
+		return guard.ReqEvaluation{
+			ProposedResponse: http.StatusUnauthorized,
+			ClientID:         common.InvalidUserID,
+			SessionID:        "",
+			Error:            fmt.Errorf("invalid authentication token"),
+			Reason:           guard.Reason{Code: noTokenReason, Guard: guard.GuardTypeToken},
+		}
+	}
+	if tk != nil && !isExcluded {
+		relPath := strings.TrimPrefix(req.URL.Path, g.servicePath)
+		if failed := tk.Scope.Check(req, relPath, g.corpusExtractor); failed != "" {
+			log.Debug().
+				Int("userId", int(userID)).
+				Str("path", relPath).
+				Str("scope", failed).
+				Msg("token used outside of its scope")
 			return guard.ReqEvaluation{
-				ProposedResponse: http.StatusTooManyRequests,
+				ProposedResponse: http.StatusForbidden,
 				ClientID:         userID,
 				SessionID:        "",
+				DenialReason:     guard.ScopeDenialReason(failed),
+				Reason:           guard.Reason{Code: guard.ReasonScope, Guard: guard.GuardTypeToken, Rule: failed},
 			}
 		}
 	}
+	clientIP := logging.ExtractClientIP(req)
+
+	// requests with a token are limited per token, the rest per IP
+	limitingKey := clientIP
+	limits := g.confLimits
+	if tk != nil {
+		limitingKey = tk.limitingKey()
+		if len(tk.Limits) > 0 {
+			limits = tk.Limits
+		}
+	}
+
+	if ok, limit := g.rateLimiters.AllowN(g.serviceKey, limitingKey, limits, guard.RequestCost(req)); !ok {
+		log.Debug().
+			Str("clientIp", clientIP).
+			Int("userId", int(userID)).
+			Stringer("limit", limit).
+			Msg("limiting client with status 429")
+		return guard.ReqEvaluation{
+			ProposedResponse: http.StatusTooManyRequests,
+			ClientID:         userID,
+			SessionID:        "",
+			ExceededLimit:    limit,
+			Reason:           guard.Reason{Code: guard.ReasonRateLimit, Guard: guard.GuardTypeToken, Limit: limit},
+		}
+	}
 
 	// test ip ban
 	banned, err := g.checkForBan(req, common.ClientID{IP: clientIP, ID: userID})
@@ -156,19 +288,56 @@ func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie)
 		return guard.ReqEvaluation{
 			ProposedResponse: http.StatusInternalServerError,
 			Error:            err,
+			Reason:           guard.Reason{Code: guard.ReasonInternalError, Guard: guard.GuardTypeToken},
 		}
 	}
 	if banned {
 		return guard.ReqEvaluation{
 			ProposedResponse: http.StatusForbidden,
+			Reason:           guard.Reason{Code: guard.ReasonIPBan, Guard: guard.GuardTypeToken, Rule: clientIP},
+		}
+	}
+	if ev, banned := guard.CheckUserBan(g.userBans, g.anonymousUsers, userID); banned {
+		ev.Reason.Guard = guard.GuardTypeToken
+		return ev
+	}
+
+	if tk != nil && (tk.DailyQuota > 0 || tk.MonthlyQuota > 0) {
+		ok, period := g.quotas.Consume(
+			g.serviceKey, tk.limitingKey(), tk.DailyQuota, tk.MonthlyQuota)
+		if !ok {
+			quota := tk.DailyQuota
+			if period == ratelimit.QuotaPeriodMonthly {
+				quota = tk.MonthlyQuota
+			}
+			log.Debug().
+				Int("userId", int(userID)).
+				Str("period", period).
+				Msg("token quota exhausted")
+			return guard.ReqEvaluation{
+				ProposedResponse: http.StatusTooManyRequests,
+				ClientID:         userID,
+				SessionID:        "",
+				DenialReason:     fmt.Sprintf("%s quota of %d requests exhausted", period, quota),
+				Reason:           guard.Reason{Code: guard.ReasonQuota, Guard: guard.GuardTypeToken, Rule: period},
+			}
 		}
 	}
+
 	return guard.ReqEvaluation{
 		ProposedResponse: http.StatusOK,
 		ClientID:         userID,
 		SessionID:        "",
 		Error:            err,
+		Reason:           allowedReason(tk == nil && isExcluded),
+	}
+}
+
+func allowedReason(authExcluded bool) guard.Reason {
+	if authExcluded {
+		return guard.Reason{Code: guard.ReasonAuthExcluded, Guard: guard.GuardTypeToken}
 	}
+	return guard.Reason{Code: guard.ReasonAllowed, Guard: guard.GuardTypeToken}
 }
 
 func (g *Guard) TestUserIsAnonymous(userID common.UserID) bool {
@@ -185,14 +354,19 @@ func (g *Guard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
 // as they are used relative to respective APIGuard's service URL path.
 // E.g. to exclude endpoint `/openapi`, one defines the argument
 // as []string{"openapi"} and APIGuard adds that to respective service
-// URL path - e.g. `/service/3/mquery/openapi`
+// URL path - e.g. `/service/3/mquery/openapi`.
+// The `corpusExtractor` is used to check tokens' corpora scopes
+// (if nil, guard.CorporaFromQuery is used).
 func NewGuard(
 	globalCtx *globctx.Context,
+	serviceKey string,
 	servicePath string,
 	tokenHeaderName string,
 	confLimits []proxy.Limit,
-	hashedTokens []TokenConf,
+	tokens Store,
 	authExcludedPathPrefixes []string,
+	corpusExtractor guard.CorpusExtractor,
+	delayPolicy *guard.DelayPolicy,
 ) *Guard {
 	return &Guard{
 		servicePath:              servicePath,
@@ -200,8 +374,13 @@ func NewGuard(
 		anonymousUsers:           globalCtx.AnonymousUserIDs,
 		tokenHeaderName:          tokenHeaderName,
 		confLimits:               confLimits,
-		rateLimiters:             make(map[string]*rate.Limiter),
-		hashedTokens:             hashedTokens,
+		serviceKey:               serviceKey,
+		rateLimiters:             globalCtx.RateLimiters,
+		quotas:                   globalCtx.Quotas,
+		userBans:                 globalCtx.UserBans,
+		tokens:                   tokens,
 		authExcludedPathPrefixes: authExcludedPathPrefixes,
+		corpusExtractor:          corpusExtractor,
+		delayPolicy:              delayPolicy,
 	}
 }
@@ -0,0 +1,40 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenExpiresInConfiguredLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	tk := TokenConf{HashedValue: "abc", Expires: "2025-06-30"}
+	assert.NoError(t, tk.Validate("token", loc))
+	assert.False(t, tk.IsExpired(time.Date(2025, 6, 30, 21, 59, 0, 0, time.UTC)))
+	assert.True(t, tk.IsExpired(time.Date(2025, 6, 30, 22, 0, 0, 0, time.UTC)))
+
+	tk = TokenConf{HashedValue: "abc", Expires: "2025-06-30T12:00:00Z"}
+	assert.NoError(t, tk.Validate("token", loc))
+	assert.True(t, tk.IsExpired(time.Date(2025, 6, 30, 12, 0, 0, 0, time.UTC)))
+
+	tk = TokenConf{HashedValue: "abc", Expires: "30.6.2025"}
+	assert.Error(t, tk.Validate("token", loc))
+}
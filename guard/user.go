@@ -20,6 +20,7 @@ package guard
 import (
 	"database/sql"
 
+	"github.com/czcorpus/apiguard/cnc"
 	"github.com/czcorpus/apiguard/common"
 	"github.com/czcorpus/apiguard/globctx"
 	"github.com/czcorpus/apiguard/session"
@@ -112,8 +113,42 @@ func (uf *SQLUserFinder) InvalidUserIsOK() bool {
 
 // --------------------------------------
 
+// CachingUserFinder wraps a UserFinder and caches its session
+// lookups. Allowlists are not cached as they are loaded
+// only during initialization.
+type CachingUserFinder struct {
+	finder UserFinder
+	cache  *cnc.SessionCache
+}
+
+func (uf *CachingUserFinder) FindUserBySession(sessionID session.HTTPSession) (common.UserID, error) {
+	return uf.cache.FindUser(
+		sessionID.SrchSelector(),
+		sessionID.String(),
+		func() (common.UserID, error) {
+			return uf.finder.FindUserBySession(sessionID)
+		},
+	)
+}
+
+func (uf *CachingUserFinder) GetAllowlistUsers(service string) ([]common.UserID, error) {
+	return uf.finder.GetAllowlistUsers(service)
+}
+
+func (uf *CachingUserFinder) InvalidUserIsOK() bool {
+	return uf.finder.InvalidUserIsOK()
+}
+
+// --------------------------------------
+
 func NewUserFinder(globalCtx *globctx.Context) UserFinder {
-	if globalCtx.CNCDB != nil {
+	if globalCtx.CNCDB != nil && globalCtx.UserSessions != nil {
+		return &CachingUserFinder{
+			finder: &SQLUserFinder{db: globalCtx.CNCDB},
+			cache:  globalCtx.UserSessions,
+		}
+
+	} else if globalCtx.CNCDB != nil {
 		return &SQLUserFinder{db: globalCtx.CNCDB}
 	}
 	return &NilUserFinder{}
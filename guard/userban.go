@@ -0,0 +1,66 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/czcorpus/apiguard/cnc"
+	"github.com/czcorpus/apiguard/common"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CheckUserBan tests whether a registered user is banned. In such case,
+// it returns an evaluation with status 403 (including the ban expiry)
+// and true. The caller is expected to fill in its guard type into
+// the evaluation's Reason. Anonymous users (i.e. accounts shared by many clients)
+// are never tested.
+func CheckUserBan(
+	bans *cnc.UserBans,
+	anonymousUsers common.AnonymousUsers,
+	userID common.UserID,
+) (ReqEvaluation, bool) {
+	if !userID.IsValid() || anonymousUsers.IsAnonymous(userID) {
+		return ReqEvaluation{}, false
+	}
+	ban, err := bans.FindActive(userID)
+	if err != nil {
+		return ReqEvaluation{
+			ProposedResponse: http.StatusInternalServerError,
+			ClientID:         userID,
+			Error:            err,
+			Reason:           Reason{Code: ReasonInternalError},
+		}, true
+	}
+	if ban == nil {
+		return ReqEvaluation{}, false
+	}
+	log.Debug().
+		Int("userId", int(userID)).
+		Time("banEnd", ban.End).
+		Msg("applied user ban")
+	return ReqEvaluation{
+		ProposedResponse: http.StatusForbidden,
+		ClientID:         userID,
+		DenialReason:     fmt.Sprintf("user banned until %s", ban.End.Format(time.RFC3339)),
+		Reason:           Reason{Code: ReasonUserBan, Rule: fmt.Sprintf("ban:%d", ban.ID)},
+	}, true
+}
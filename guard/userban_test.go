@@ -0,0 +1,85 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/czcorpus/apiguard/cnc"
+	"github.com/czcorpus/apiguard/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockUserBans(t *testing.T) (*cnc.UserBans, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return cnc.NewUserBans(db, time.UTC), mock
+}
+
+func TestCheckUserBanRejectsBannedUser(t *testing.T) {
+	bans, mock := newMockUserBans(t)
+	end := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT id, report_id, user_id, start_dt, end_dt FROM api_user_ban").
+		WithArgs(common.UserID(42), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "report_id", "user_id", "start_dt", "end_dt"}).
+			AddRow(7, "r1", 42, end.Add(-24*time.Hour), end))
+
+	ev, banned := CheckUserBan(bans, common.AnonymousUsers{}, 42)
+	assert.True(t, banned)
+	assert.Equal(t, http.StatusForbidden, ev.ProposedResponse)
+	assert.Equal(t, common.UserID(42), ev.ClientID)
+	assert.Equal(t, "user banned until 2030-01-01T12:00:00Z", ev.DenialReason)
+	assert.Equal(t, ReasonUserBan, ev.Reason.Code)
+	assert.Equal(t, "ban:7", ev.Reason.Rule)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckUserBanSkipsAnonymousUsers(t *testing.T) {
+	bans, mock := newMockUserBans(t)
+	_, banned := CheckUserBan(bans, common.AnonymousUsers{1}, 1)
+	assert.False(t, banned)
+	_, banned = CheckUserBan(bans, common.AnonymousUsers{1}, common.InvalidUserID)
+	assert.False(t, banned)
+	// no query expected
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckUserBanNotBanned(t *testing.T) {
+	bans, mock := newMockUserBans(t)
+	mock.ExpectQuery("SELECT id, report_id, user_id, start_dt, end_dt FROM api_user_ban").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "report_id", "user_id", "start_dt", "end_dt"}))
+	_, banned := CheckUserBan(bans, common.AnonymousUsers{1}, 42)
+	assert.False(t, banned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckUserBanFailedLookup(t *testing.T) {
+	bans, mock := newMockUserBans(t)
+	mock.ExpectQuery("SELECT id, report_id, user_id, start_dt, end_dt FROM api_user_ban").
+		WillReturnError(errors.New("connection lost"))
+	ev, banned := CheckUserBan(bans, common.AnonymousUsers{}, 42)
+	assert.True(t, banned)
+	assert.Equal(t, http.StatusInternalServerError, ev.ProposedResponse)
+	assert.Error(t, ev.Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -75,6 +76,40 @@ func ExtractClientIP(req *http.Request) string {
 	return strings.Split(req.RemoteAddr, ":")[0]
 }
 
+// normalizedIP returns a canonical form of a single IP address
+// or an empty string if the value is not a valid IP address
+func normalizedIP(value string) string {
+	ip := net.ParseIP(strings.TrimSpace(value))
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// ExtractTrustedClientIP returns an IP address of a requesting client.
+// Unlike ExtractClientIP, the forwarding headers (x-forwarded-for, x-real-ip)
+// are considered only in case the request comes from one of knownProxies
+// as anyone else can forge them. In x-forwarded-for, the rightmost address
+// not belonging to knownProxies is used. In case no valid single IP address
+// can be determined, an empty string is returned.
+func ExtractTrustedClientIP(req *http.Request, knownProxies []string) string {
+	remoteIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		remoteIP = req.RemoteAddr
+	}
+	if !slices.Contains(knownProxies, remoteIP) {
+		return normalizedIP(remoteIP)
+	}
+	forwarded := strings.Split(strings.Join(req.Header.Values("x-forwarded-for"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+		if ip != "" && !slices.Contains(knownProxies, ip) {
+			return normalizedIP(ip)
+		}
+	}
+	return normalizedIP(req.Header.Get("x-real-ip"))
+}
+
 func NewLGRequestRecord(req *http.Request) *LGRequestRecord {
 	ip := ExtractClientIP(req)
 	session, err := req.Cookie(WaGSessionName)
@@ -47,6 +47,32 @@ const (
 
 type reqCounterItem struct {
 	Created time.Time
+
+	// Weight specifies how many requests the item stands for
+	// (see guard.RequestInfo.NumRequests). Zero value (e.g. in items
+	// loaded from an older status file) stands for a single request.
+	Weight int
+}
+
+func (item reqCounterItem) weight() int {
+	return max(1, item.Weight)
+}
+
+type reportsCompaction struct {
+	maxAge             time.Duration
+	includeNonReviewed bool
+	result             chan<- CleanupResult
+}
+
+type reportReview struct {
+	reviewCode string
+	reviewer   string
+	result     chan<- reportReviewResult
+}
+
+type reportReviewResult struct {
+	report *AlarmReport
+	err    error
 }
 
 type handleReviewPayload struct {
@@ -82,6 +108,30 @@ type AlarmTicker struct {
 	tDBWriter       reporting.ReportingWriter
 	reportTicker    time.Ticker
 	userFinder      guardImpl.UserFinder
+
+	// compactions passes report compaction requests to the Run goroutine
+	// (which is the only one modifying the reports)
+	compactions chan reportsCompaction
+
+	// reviews passes report reviews to the Run goroutine
+	reviews chan reportReview
+
+	// activity contains the most recent activity snapshots of
+	// watched clients. The snapshots are written by the Run goroutine
+	// and read by guards' delay policies.
+	activity *collections.ConcurrentMap[string, guardImpl.ClientActivity]
+}
+
+func (aticker *AlarmTicker) mkActivityKey(service string, userID common.UserID, ip string) string {
+	return fmt.Sprintf("%s|%d@%s", service, userID, ip)
+}
+
+// ClientActivity returns the most recent activity snapshot of a client
+// accessing a service. Please note that clients without a valid user ID
+// are not watched by AlarmTicker so for them, an empty activity is always
+// returned.
+func (aticker *AlarmTicker) ClientActivity(service string, clientID common.ClientID) guardImpl.ClientActivity {
+	return aticker.activity.Get(aticker.mkActivityKey(service, clientID.ID, clientID.IP))
 }
 
 func (aticker *AlarmTicker) ServiceProps(servName string) *serviceEntry {
@@ -172,6 +222,7 @@ func (aticker *AlarmTicker) removeUsersWithNoRecentActivity() {
 			mostRecent := limitInfo.Requests.Last()
 			if mostRecent.Created.Before(oldestTime) {
 				service.ClientRequests.Delete(userID)
+				aticker.activity.Delete(fmt.Sprintf("%s|%s", service.Service, userID))
 			}
 			return true
 		})
@@ -182,11 +233,19 @@ func (aticker *AlarmTicker) removeUsersWithNoRecentActivity() {
 
 func (aticker *AlarmTicker) checkServiceUsage(
 	service *serviceEntry, userActivity *UserActivity, req guardImpl.RequestInfo) {
+	var activity guardImpl.ClientActivity
+	defer func() {
+		aticker.activity.Set(aticker.mkActivityKey(service.Service, req.UserID, req.IP), activity)
+	}()
 	for checkInterval, limit := range service.limits {
 		t0 := time.Now().In(aticker.location)
 		numReq := userActivity.NumReqSince(time.Duration(checkInterval), aticker.location)
 		userActivity.NumReqAboveLimit.registerMeasurement(t0, checkInterval, numReq, limit)
 		movAvg := userActivity.NumReqAboveLimit.relativeExceeding(t0, checkInterval, limit)
+		if limit > 0 {
+			activity.Density = max(activity.Density, float64(numReq)/float64(limit))
+		}
+		activity.Exceeding = max(activity.Exceeding, movAvg)
 		log.Debug().
 			Str("service", service.Service).
 			Int("userId", int(req.UserID)).
@@ -225,7 +284,8 @@ func (aticker *AlarmTicker) checkServiceUsage(
 					},
 					aticker.location,
 				)
-				// TODO !!!! attach flag "user is anonymous"
+				newReport.UserID = req.UserID
+				newReport.IsAnonymousUser = aticker.ctx.AnonymousUserIDs.IsAnonymous(req.UserID)
 				aticker.reports = append(aticker.reports, newReport)
 				userActivity.LastReportAt = t0
 				go aticker.sendReport(service, newReport, numReq)
@@ -299,6 +359,11 @@ func (aticker *AlarmTicker) Run(reloadChan <-chan bool) {
 			go func() {
 				aticker.reportSummary()
 			}()
+		case req := <-aticker.compactions:
+			req.result <- aticker.compactReports(req.maxAge, req.includeNonReviewed)
+		case req := <-aticker.reviews:
+			report, err := aticker.reviewReport(req.reviewCode, req.reviewer)
+			req.result <- reportReviewResult{report: report, err: err}
 		case reload := <-reloadChan:
 			if reload {
 				aticker.loadAllowList()
@@ -320,7 +385,8 @@ func (aticker *AlarmTicker) Run(reloadChan <-chan bool) {
 						userActivity,
 					)
 				}
-				userActivity.Requests.Append(reqCounterItem{Created: reqInfo.Created})
+				userActivity.Requests.Append(
+					reqCounterItem{Created: reqInfo.Created, Weight: reqInfo.NumRequests})
 				aticker.checkServiceUsage(entry, userActivity, reqInfo)
 				// from time to time, remove users with no recent activity
 				if rand.Float64() < entry.Conf.RecCounterCleanupProbability {
@@ -390,5 +456,8 @@ func NewAlarmTicker(
 		tDBWriter:       ctx.ReportingWriter,
 		reportTicker:    *time.NewTicker(monitoringSendInterval),
 		userFinder:      guardImpl.NewUserFinder(ctx),
+		activity:        collections.NewConcurrentMap[string, guardImpl.ClientActivity](),
+		compactions:     make(chan reportsCompaction),
+		reviews:         make(chan reportReview),
 	}
 }
@@ -30,6 +30,7 @@ const (
 	DfltUserReqCounterBufferSize = 500
 	DfltExceedingsBufferSize     = 10
 	DfltExceedingThreshold       = 0.05
+	DfltRetentionBatchSize       = 1000
 )
 
 // AlarmConf describes alarm setup for a concrete service
@@ -43,11 +44,24 @@ type MailConf struct {
 }
 
 type LimitingConf struct {
+
+	// DelayLogCleanupMaxAgeDays specifies max. age of delay log records,
+	// client actions, expired IP bans and reviewed alarm reports
+	// kept by the cleanup (see also RetentionIntervalSecs)
 	DelayLogCleanupMaxAgeDays int     `json:"delayLogCleanupMaxAgeDays"`
 	StatusDataDir             string  `json:"statusDataDir"`
 	UserReqCounterBufferSize  int     `json:"userReqCounterBufferSize"`
 	ExceedingsBufferSize      int     `json:"exceedingsBufferSize"`
 	ExceedingThreshold        float64 `json:"exceedingThreshold"`
+
+	// RetentionIntervalSecs specifies how often a running APIGuard
+	// performs the cleanup. Zero value disables the cleanup
+	// (`apiguard cleanup` can be used instead).
+	RetentionIntervalSecs int `json:"retentionIntervalSecs"`
+
+	// RetentionBatchSize specifies max. number of database
+	// rows removed by a single query during the cleanup
+	RetentionBatchSize int `json:"retentionBatchSize"`
 }
 
 func (lconf *LimitingConf) ValidateAndDefaults() error {
@@ -94,6 +108,20 @@ func (lconf *LimitingConf) ValidateAndDefaults() error {
 		return fmt.Errorf("limiting.exceedingThreshold has an invalid value - must be between 0 and 1 (excluding)")
 	}
 
+	if lconf.RetentionIntervalSecs < 0 {
+		return fmt.Errorf("limiting.retentionIntervalSecs has an invalid value")
+	}
+
+	if lconf.RetentionBatchSize == 0 {
+		lconf.RetentionBatchSize = DfltRetentionBatchSize
+		log.Warn().
+			Int("value", DfltRetentionBatchSize).
+			Msg("limiting.retentionBatchSize not set, using default")
+
+	} else if lconf.RetentionBatchSize < 0 {
+		return fmt.Errorf("limiting.retentionBatchSize has an invalid value")
+	}
+
 	isDir, err := fs.IsDir(lconf.StatusDataDir)
 	if err != nil {
 		return fmt.Errorf("failed to test limiting.statusDataDir: %w", err)
@@ -181,13 +181,14 @@ type UserActivity struct {
 }
 
 // NumReqSince counts requests with time after a specified interval
-// from now (e.g. "newer than 2 hours ago")
+// from now (e.g. "newer than 2 hours ago"). Requests are counted
+// along with their weights.
 func (ulm *UserActivity) NumReqSince(interval time.Duration, loc *time.Location) int {
 	limit := time.Now().In(loc).Add(-interval)
 	var ans int
 	ulm.Requests.ForEach(func(i int, item reqCounterItem) bool {
 		if item.Created.After(limit) {
-			ans++
+			ans += item.weight()
 		}
 		return true
 	})
@@ -232,12 +233,16 @@ func NewClientRequestsFrom(data map[string]*UserActivity) *ClientRequests {
 	}
 }
 
+// CountRequests counts (weighted) requests of all the clients
 func (cr *ClientRequests) CountRequests() (ans int) {
 	cr.ForEach(func(k string, v *UserActivity, ok bool) {
 		if !ok {
 			return
 		}
-		ans += v.Requests.Len()
+		v.Requests.ForEach(func(i int, item reqCounterItem) bool {
+			ans += item.weight()
+			return true
+		})
 	})
 	return
 }
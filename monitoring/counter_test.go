@@ -0,0 +1,80 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestUserActivity(conf *LimitingConf) *UserActivity {
+	return &UserActivity{
+		Requests:         collections.NewCircularList[reqCounterItem](conf.UserReqCounterBufferSize),
+		NumReqAboveLimit: NewLimitExceedings(conf),
+	}
+}
+
+func TestNumReqSinceCountsWeights(t *testing.T) {
+	ua := newTestUserActivity(&LimitingConf{UserReqCounterBufferSize: 10})
+	now := time.Now()
+	ua.Requests.Append(reqCounterItem{Created: now.Add(-time.Hour), Weight: 3})
+	ua.Requests.Append(reqCounterItem{Created: now, Weight: 5})
+	// an item without weight (e.g. from an older status file)
+	ua.Requests.Append(reqCounterItem{Created: now})
+	assert.Equal(t, 6, ua.NumReqSince(time.Minute, time.UTC))
+	assert.Equal(t, 9, ua.NumReqSince(2*time.Hour, time.UTC))
+
+	cr := NewClientRequests()
+	cr.Set("1@192.168.1.10", ua)
+	assert.Equal(t, 9, cr.CountRequests())
+}
+
+func TestCostlyRequestTripsLimit(t *testing.T) {
+	conf := &LimitingConf{UserReqCounterBufferSize: 10, ExceedingsBufferSize: 10, ExceedingThreshold: 1}
+	aticker := &AlarmTicker{
+		location:     time.UTC,
+		limitingConf: conf,
+		activity:     collections.NewConcurrentMap[string, guard.ClientActivity](),
+	}
+	interval := common.CheckInterval(time.Minute)
+	service := &serviceEntry{
+		Service:        "test",
+		limits:         map[common.CheckInterval]int{interval: 5},
+		ClientRequests: NewClientRequests(),
+	}
+	req := guard.RequestInfo{
+		Created:     time.Now(),
+		Service:     "test",
+		NumRequests: 5,
+		UserID:      1,
+		IP:          "192.168.1.10",
+	}
+	ua := newTestUserActivity(conf)
+	ua.Requests.Append(reqCounterItem{Created: req.Created, Weight: req.NumRequests})
+	aticker.checkServiceUsage(service, ua, req)
+
+	_, tripped := ua.NumReqAboveLimit.Get(interval)
+	assert.True(t, tripped)
+	activity := aticker.ClientActivity("test", common.ClientID{ID: 1, IP: "192.168.1.10"})
+	assert.Equal(t, 1.0, activity.Density)
+}
@@ -18,6 +18,7 @@
 package monitoring
 
 import (
+	"context"
 	"net/http"
 	"sort"
 	"time"
@@ -28,7 +29,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-type cleanActionResponse struct {
+// CleanupResult describes a result of alarm reports compaction
+type CleanupResult struct {
 	NumDeleted   int `json:"numDeleted"`
 	NumRemaining int `json:"numRemaining"`
 }
@@ -72,6 +74,22 @@ func (aticker *AlarmTicker) HandleCleanAction(ctx *gin.Context) {
 		includeNonReviewed = true
 	}
 
+	resp, err := aticker.CompactReports(ctx.Request.Context(), maxAge, includeNonReviewed)
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer,
+			uniresp.NewActionErrorFrom(err),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, resp)
+}
+
+// compactReports removes reports older than maxAge. Unless includeNonReviewed
+// is set, only reviewed reports are removed.
+// The method must be called from the Run goroutine (or before Run starts).
+func (aticker *AlarmTicker) compactReports(maxAge time.Duration, includeNonReviewed bool) CleanupResult {
 	remainReports := make([]*AlarmReport, 0, len(aticker.reports))
 	now := time.Now().In(aticker.location)
 	for _, report := range aticker.reports {
@@ -82,9 +100,37 @@ func (aticker *AlarmTicker) HandleCleanAction(ctx *gin.Context) {
 	sort.Slice(remainReports, func(i, j int) bool {
 		return remainReports[i].Created.Before(remainReports[j].Created)
 	})
-	var resp cleanActionResponse
+	var resp CleanupResult
 	resp.NumDeleted = len(aticker.reports) - len(remainReports)
 	resp.NumRemaining = len(remainReports)
 	aticker.reports = remainReports
-	uniresp.WriteJSONResponse(ctx.Writer, resp)
+	return resp
+}
+
+// CompactReports removes reports older than maxAge. Unless includeNonReviewed
+// is set, only reviewed reports are removed. The compaction is performed by
+// the Run goroutine so the method blocks until Run processes the request
+// or until the ctx is cancelled.
+func (aticker *AlarmTicker) CompactReports(
+	ctx context.Context,
+	maxAge time.Duration,
+	includeNonReviewed bool,
+) (CleanupResult, error) {
+	result := make(chan CleanupResult, 1)
+	req := reportsCompaction{
+		maxAge:             maxAge,
+		includeNonReviewed: includeNonReviewed,
+		result:             result,
+	}
+	select {
+	case aticker.compactions <- req:
+	case <-ctx.Done():
+		return CleanupResult{}, ctx.Err()
+	}
+	select {
+	case resp := <-result:
+		return resp, nil
+	case <-ctx.Done():
+		return CleanupResult{}, ctx.Err()
+	}
 }
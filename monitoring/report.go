@@ -50,6 +50,9 @@ type Reviewer struct {
 }
 
 type AlarmReport struct {
+	// ID identifies the report e.g. in user bans created
+	// based on the report (see api_user_ban.report_id)
+	ID              string            `json:"id"`
 	RequestInfo     guard.RequestInfo `json:"requestInfo"`
 	Alarm           AlarmConf         `json:"-"`
 	Rules           proxy.Limit       `json:"rules"`
@@ -74,6 +77,7 @@ func (report *AlarmReport) MarshalJSON() ([]byte, error) {
 	}
 	return json.Marshal(
 		struct {
+			ID              string            `json:"id,omitempty"`
 			RequestInfo     guard.RequestInfo `json:"requestInfo"`
 			Rules           AlarmConf         `json:"rules"`
 			Created         time.Time         `json:"created"`
@@ -83,6 +87,7 @@ func (report *AlarmReport) MarshalJSON() ([]byte, error) {
 			IsAnonymousUser bool              `json:"isAnonymousUser"`
 			Reviewers       []string          `json:"reviewers"`
 		}{
+			ID:              report.ID,
 			RequestInfo:     report.RequestInfo,
 			Rules:           report.Alarm,
 			Created:         report.Created,
@@ -157,6 +162,7 @@ func NewAlarmReport(
 	loc *time.Location,
 ) *AlarmReport {
 	return &AlarmReport{
+		ID:          uuid.New().String(),
 		Reviews:     make([]Reviewer, 0, 5),
 		Created:     time.Now().In(loc),
 		RequestInfo: reqInfo,
@@ -0,0 +1,141 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/czcorpus/apiguard/cnc"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// reviewReport confirms a review of a report specified by its review code.
+// A copy of the reviewed report is returned.
+func (aticker *AlarmTicker) reviewReport(reviewCode, reviewer string) (*AlarmReport, error) {
+	for _, report := range aticker.reports {
+		if report.ReviewCode != reviewCode {
+			continue
+		}
+		if err := report.ConfirmReviewViaEmail(reviewCode, reviewer); err != nil {
+			return nil, err
+		}
+		ans := *report
+		ans.Reviews = slices.Clone(report.Reviews)
+		return &ans, nil
+	}
+	return nil, ErrConfirmationKeyNotFound
+}
+
+// ReviewReport confirms a review of a report specified by its review code.
+// The review is performed by the Run goroutine so the method blocks until
+// Run processes the request or until the ctx is cancelled.
+func (aticker *AlarmTicker) ReviewReport(
+	ctx context.Context,
+	reviewCode string,
+	reviewer string,
+) (*AlarmReport, error) {
+	result := make(chan reportReviewResult, 1)
+	req := reportReview{
+		reviewCode: reviewCode,
+		reviewer:   reviewer,
+		result:     result,
+	}
+	select {
+	case aticker.reviews <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case resp := <-result:
+		return resp.report, resp.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// HandleReviewAction confirms a review of an alarm report. In case
+// the `banHours` argument is positive, the reported user is banned
+// (the ban is linked with the report). Anonymous users cannot be
+// banned this way - an IP ban should be used instead.
+func (aticker *AlarmTicker) HandleReviewAction(ctx *gin.Context) {
+	var payload handleReviewPayload
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&payload); err != nil && err != io.EOF {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	if payload.Reviewer == "" {
+		payload.Reviewer = ctx.Query("reviewer")
+	}
+	if payload.BanHours < 0 {
+		uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("invalid banHours value"), http.StatusBadRequest)
+		return
+	}
+	report, err := aticker.ReviewReport(ctx.Request.Context(), ctx.Param("id"), payload.Reviewer)
+	if errors.Is(err, ErrConfirmationKeyNotFound) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusNotFound)
+		return
+
+	} else if errors.Is(err, ErrMissingReviewerIdentification) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+
+	} else if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	resp := handleReviewResponse{Confirmed: true, Report: report}
+	if payload.BanHours > 0 {
+		if !report.UserID.IsValid() || report.IsAnonymousUser {
+			uniresp.RespondWithErrorJSON(
+				ctx,
+				fmt.Errorf("review confirmed but an anonymous user cannot be banned - please use an IP ban"),
+				http.StatusUnprocessableEntity,
+			)
+			return
+		}
+		ban, err := aticker.ctx.UserBans.Insert(
+			report.UserID, report.ID, time.Duration(payload.BanHours)*time.Hour)
+		if errors.Is(err, cnc.ErrUserAlreadyBanned) {
+			uniresp.RespondWithErrorJSON(
+				ctx, fmt.Errorf("review confirmed but failed to ban user: %w", err), http.StatusConflict)
+			return
+
+		} else if err != nil {
+			uniresp.RespondWithErrorJSON(
+				ctx, fmt.Errorf("review confirmed but failed to ban user: %w", err), http.StatusInternalServerError)
+			return
+		}
+		log.Info().
+			Int("userId", int(report.UserID)).
+			Str("reportId", report.ID).
+			Str("reviewer", payload.Reviewer).
+			Time("banEnd", ban.End).
+			Msg("banned user based on an alarm report review")
+		resp.BanID = ban.ID
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, resp)
+}
@@ -0,0 +1,135 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/czcorpus/apiguard/cnc"
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/globctx"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newReviewTestTicker creates an AlarmTicker with a single report
+// and processes its reviews the same way Run does
+func newReviewTestTicker(t *testing.T, report *AlarmReport) (*AlarmTicker, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	globalCtx := globctx.NewGlobalContext(ctx)
+	globalCtx.UserBans = cnc.NewUserBans(db, time.UTC)
+	aticker := &AlarmTicker{
+		ctx:      globalCtx,
+		location: time.UTC,
+		reports:  []*AlarmReport{report},
+		reviews:  make(chan reportReview),
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case req := <-aticker.reviews:
+				report, err := aticker.reviewReport(req.reviewCode, req.reviewer)
+				req.result <- reportReviewResult{report: report, err: err}
+			}
+		}
+	}()
+	return aticker, mock
+}
+
+func postReview(aticker *AlarmTicker, reviewCode, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/alarm/:id/confirmation", aticker.HandleReviewAction)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(
+		w,
+		httptest.NewRequest(http.MethodPost, "/alarm/"+reviewCode+"/confirmation", strings.NewReader(body)),
+	)
+	return w
+}
+
+func TestHandleReviewActionBansUser(t *testing.T) {
+	aticker, mock := newReviewTestTicker(
+		t, &AlarmReport{ID: "r1", ReviewCode: "abc", UserID: 42, location: time.UTC})
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT").
+		WithArgs(common.UserID(42), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO api_user_ban").
+		WithArgs("r1", common.UserID(42), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectCommit()
+
+	w := postReview(aticker, "abc", `{"reviewer": "admin@example.com", "banHours": 24}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Confirmed bool  `json:"confirmed"`
+		BanID     int64 `json:"banId"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Confirmed)
+	assert.Equal(t, int64(7), resp.BanID)
+	assert.Len(t, aticker.reports[0].Reviews, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleReviewActionAlreadyBanned(t *testing.T) {
+	aticker, mock := newReviewTestTicker(
+		t, &AlarmReport{ID: "r1", ReviewCode: "abc", UserID: 42, location: time.UTC})
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	w := postReview(aticker, "abc", `{"reviewer": "admin@example.com", "banHours": 24}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleReviewActionDoesNotBanAnonymousUser(t *testing.T) {
+	aticker, mock := newReviewTestTicker(
+		t, &AlarmReport{ID: "r1", ReviewCode: "abc", UserID: 1, IsAnonymousUser: true, location: time.UTC})
+
+	w := postReview(aticker, "abc", `{"reviewer": "admin@example.com", "banHours": 24}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	// the review itself is confirmed
+	assert.Len(t, aticker.reports[0].Reviews, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleReviewActionInvalidBanHours(t *testing.T) {
+	aticker, mock := newReviewTestTicker(
+		t, &AlarmReport{ID: "r1", ReviewCode: "abc", UserID: 42, location: time.UTC})
+
+	w := postReview(aticker, "abc", `{"reviewer": "admin@example.com", "banHours": -1}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, aticker.reports[0].Reviews)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -23,6 +23,9 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
 
 	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/czcorpus/cnc-gokit/fs"
@@ -133,3 +136,90 @@ func LoadState(aticker *AlarmTicker) error {
 	}
 	return nil
 }
+
+// StoredClientInfo contains information about a client found
+// in the saved AlarmTicker state.
+type StoredClientInfo struct {
+
+	// StateSaved is the modification time of the state file
+	// (nil if there is no state file)
+	StateSaved *time.Time `json:"stateSaved"`
+
+	// Reports contains alarm reports involving the client
+	Reports []*AlarmReport `json:"reports"`
+
+	// UserIDs contains all the users seen accessing watched
+	// services from the client's IP address
+	UserIDs []common.UserID `json:"userIds"`
+}
+
+// FindStoredClientInfo searches for a client with the specified IP addresses
+// in the state saved by an APIGuard instance during its last shutdown.
+// Please note that a running instance keeps the state in memory so the
+// information may be outdated.
+func FindStoredClientInfo(conf *LimitingConf, loc *time.Location, clientIPs ...string) (StoredClientInfo, error) {
+	ans := StoredClientInfo{
+		Reports: []*AlarmReport{},
+		UserIDs: []common.UserID{},
+	}
+	aticker := &AlarmTicker{
+		limitingConf: conf,
+		location:     loc,
+		clients:      collections.NewConcurrentMap[string, *serviceEntry](),
+	}
+	if err := LoadState(aticker); err != nil {
+		return ans, err
+	}
+	finfo, err := os.Stat(path.Join(conf.StatusDataDir, alarmStatusFile))
+	if err == nil {
+		mtime := finfo.ModTime().In(loc)
+		ans.StateSaved = &mtime
+	}
+	for _, report := range aticker.reports {
+		if collections.SliceContains(clientIPs, report.RequestInfo.IP) {
+			ans.Reports = append(ans.Reports, report)
+		}
+	}
+	aticker.clients.ForEach(func(service string, se *serviceEntry, ok bool) {
+		if !ok {
+			return
+		}
+		se.ClientRequests.ForEach(func(key string, v *UserActivity, ok bool) {
+			if !ok {
+				return
+			}
+			var userID common.UserID
+			var ip string
+			if _, err := fmt.Sscanf(key, "%d@%s", &userID, &ip); err != nil || !collections.SliceContains(clientIPs, ip) {
+				return
+			}
+			if !collections.SliceContains(ans.UserIDs, userID) {
+				ans.UserIDs = append(ans.UserIDs, userID)
+			}
+		})
+	})
+	return ans, nil
+}
+
+// CompactStoredReports removes old reviewed reports from the state saved
+// by an APIGuard instance during its last shutdown. Please note that a running
+// instance keeps the state in memory and overwrites the file on shutdown
+// (in such case, CompactReports is applied by the instance itself).
+func CompactStoredReports(conf *LimitingConf, loc *time.Location, maxAge time.Duration) (int, error) {
+	aticker := &AlarmTicker{
+		limitingConf: conf,
+		location:     loc,
+		clients:      collections.NewConcurrentMap[string, *serviceEntry](),
+	}
+	if err := LoadState(aticker); err != nil {
+		return 0, err
+	}
+	if len(aticker.reports) == 0 {
+		return 0, nil
+	}
+	resp := aticker.compactReports(maxAge, false)
+	if resp.NumDeleted == 0 {
+		return 0, nil
+	}
+	return resp.NumDeleted, SaveState(aticker)
+}
@@ -0,0 +1,144 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltAdaptiveMinInFlight    = 1
+	dfltAdaptiveDecreaseFactor = 0.7
+)
+
+// AdaptiveLimitConf configures an AIMD (additive increase,
+// multiplicative decrease) limit of concurrent backend requests.
+type AdaptiveLimitConf struct {
+
+	// TargetLatencyMs is the highest acceptable backend response time
+	// (measured until response headers arrive). Slower responses
+	// make the limit decrease.
+	TargetLatencyMs int `json:"targetLatencyMs"`
+
+	// MinInFlight is the lowest value the limit can drop to
+	MinInFlight int `json:"minInFlight"`
+
+	// DecreaseFactor is applied to the limit once latency exceeds
+	// the target or the backend responds with a 5xx status.
+	DecreaseFactor float64 `json:"decreaseFactor"`
+}
+
+func (conf *AdaptiveLimitConf) TargetLatency() time.Duration {
+	return time.Duration(conf.TargetLatencyMs) * time.Millisecond
+}
+
+// Validate checks the configuration and sets defaults where needed.
+// The maxInFlight argument is the static limit of the respective
+// proxy which also serves as the upper bound of the adaptive one.
+func (conf *AdaptiveLimitConf) Validate(context string, maxInFlight int) error {
+	if conf == nil {
+		return nil
+	}
+	if maxInFlight <= 0 {
+		return fmt.Errorf("%s requires maxInFlight to be set", context)
+	}
+	if conf.TargetLatencyMs <= 0 {
+		return fmt.Errorf("%s.targetLatencyMs must be a positive number", context)
+	}
+	if conf.MinInFlight < 0 {
+		return fmt.Errorf("%s.minInFlight must be a positive number", context)
+
+	} else if conf.MinInFlight == 0 {
+		log.Warn().
+			Int("default", dfltAdaptiveMinInFlight).
+			Msgf("%s.minInFlight not set, using default", context)
+		conf.MinInFlight = dfltAdaptiveMinInFlight
+	}
+	if conf.MinInFlight > maxInFlight {
+		return fmt.Errorf("%s.minInFlight cannot be greater than maxInFlight", context)
+	}
+	if conf.DecreaseFactor == 0 {
+		log.Warn().
+			Float64("default", dfltAdaptiveDecreaseFactor).
+			Msgf("%s.decreaseFactor not set, using default", context)
+		conf.DecreaseFactor = dfltAdaptiveDecreaseFactor
+
+	} else if conf.DecreaseFactor < 0 || conf.DecreaseFactor >= 1 {
+		return fmt.Errorf("%s.decreaseFactor must be in the (0, 1) interval", context)
+	}
+	return nil
+}
+
+// -------
+
+// AdaptiveLimit calculates a concurrency limit based on observed
+// backend responses. Each successful response within the target latency
+// increases the limit by 1/limit (i.e. by one per a full "window"
+// of requests), while a slow or failed response multiplies the limit by
+// the decrease factor. To prevent responses of requests which were already
+// in flight during a decrease from cutting the limit repeatedly, the limit
+// can be decreased at most once per the target latency period.
+type AdaptiveLimit struct {
+	mu           sync.Mutex
+	conf         AdaptiveLimitConf
+	maxLimit     int
+	limit        float64
+	lastDecrease time.Time
+	nowProvider  func() time.Time
+}
+
+// Observe registers a finished backend request and returns
+// the updated limit.
+func (al *AdaptiveLimit) Observe(latency time.Duration, status int) int {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if status >= http.StatusInternalServerError || latency > al.conf.TargetLatency() {
+		now := al.nowProvider()
+		if now.Sub(al.lastDecrease) >= al.conf.TargetLatency() {
+			al.limit = max(float64(al.conf.MinInFlight), math.Floor(al.limit*al.conf.DecreaseFactor))
+			al.lastDecrease = now
+		}
+
+	} else {
+		al.limit = min(float64(al.maxLimit), al.limit+1/al.limit)
+	}
+	return int(al.limit)
+}
+
+func (al *AdaptiveLimit) Limit() int {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	return int(al.limit)
+}
+
+// NewAdaptiveLimit creates a new AdaptiveLimit starting
+// at maxLimit.
+func NewAdaptiveLimit(conf AdaptiveLimitConf, maxLimit int) *AdaptiveLimit {
+	return &AdaptiveLimit{
+		conf:        conf,
+		maxLimit:    maxLimit,
+		limit:       float64(maxLimit),
+		nowProvider: time.Now,
+	}
+}
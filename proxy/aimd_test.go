@@ -0,0 +1,104 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAdaptiveLimit(maxLimit int, now *time.Time) *AdaptiveLimit {
+	al := NewAdaptiveLimit(
+		AdaptiveLimitConf{TargetLatencyMs: 100, MinInFlight: 2, DecreaseFactor: 0.5},
+		maxLimit,
+	)
+	al.nowProvider = func() time.Time { return *now }
+	return al
+}
+
+func TestAdaptiveLimitDecreasesOnSlowResponse(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	al := newTestAdaptiveLimit(20, &now)
+	assert.Equal(t, 10, al.Observe(200*time.Millisecond, http.StatusOK))
+}
+
+func TestAdaptiveLimitDecreasesOnServerError(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	al := newTestAdaptiveLimit(20, &now)
+	assert.Equal(t, 10, al.Observe(10*time.Millisecond, http.StatusBadGateway))
+}
+
+func TestAdaptiveLimitDecreasesOncePerTargetLatency(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	al := newTestAdaptiveLimit(20, &now)
+	al.Observe(200*time.Millisecond, http.StatusOK)
+	assert.Equal(t, 10, al.Observe(200*time.Millisecond, http.StatusOK))
+	now = now.Add(100 * time.Millisecond)
+	assert.Equal(t, 5, al.Observe(200*time.Millisecond, http.StatusOK))
+}
+
+func TestAdaptiveLimitRespectsMinimum(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	al := newTestAdaptiveLimit(4, &now)
+	for i := 0; i < 5; i++ {
+		al.Observe(time.Second, http.StatusOK)
+		now = now.Add(time.Second)
+	}
+	assert.Equal(t, 2, al.Limit())
+}
+
+func TestAdaptiveLimitIncreasesAdditively(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	al := newTestAdaptiveLimit(20, &now)
+	al.Observe(time.Second, http.StatusOK)
+	assert.Equal(t, 10, al.Limit())
+	// roughly one window of fast responses increases the limit by one
+	for i := 0; i < 11; i++ {
+		al.Observe(50*time.Millisecond, http.StatusOK)
+	}
+	assert.Equal(t, 11, al.Limit())
+}
+
+func TestAdaptiveLimitRespectsMaximum(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	al := newTestAdaptiveLimit(5, &now)
+	for i := 0; i < 100; i++ {
+		al.Observe(50*time.Millisecond, http.StatusOK)
+	}
+	assert.Equal(t, 5, al.Limit())
+}
+
+func TestAdaptiveLimitConfValidate(t *testing.T) {
+	var conf *AdaptiveLimitConf
+	assert.NoError(t, conf.Validate("test", 0))
+
+	conf = &AdaptiveLimitConf{TargetLatencyMs: 100}
+	assert.Error(t, conf.Validate("test", 0))
+	assert.NoError(t, conf.Validate("test", 10))
+	assert.Equal(t, dfltAdaptiveMinInFlight, conf.MinInFlight)
+	assert.Equal(t, dfltAdaptiveDecreaseFactor, conf.DecreaseFactor)
+
+	conf = &AdaptiveLimitConf{TargetLatencyMs: 100, DecreaseFactor: 1.5}
+	assert.Error(t, conf.Validate("test", 10))
+
+	conf = &AdaptiveLimitConf{TargetLatencyMs: 100, MinInFlight: 20}
+	assert.Error(t, conf.Validate("test", 10))
+}
@@ -18,6 +18,8 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -60,6 +62,13 @@ type CoreProxy struct {
 	BackendURL  *url.URL
 	FrontendURL *url.URL
 	client      *http.Client
+	inFlight    *InFlightLimiter
+}
+
+// Load provides current numbers of in-flight and queued
+// requests to the backend.
+func (proxy *CoreProxy) Load() InFlightStats {
+	return proxy.inFlight.Stats()
 }
 
 func (proxy *CoreProxy) transformRedirect(headers http.Header) error {
@@ -84,7 +93,27 @@ func (proxy *CoreProxy) transformRedirect(headers http.Header) error {
 	return nil
 }
 
+// wrapBody makes sure an acquired in-flight slot is
+// released once the response body is closed.
+func (proxy *CoreProxy) wrapBody(body io.ReadCloser) io.ReadCloser {
+	if proxy.inFlight == nil {
+		return body
+	}
+	return &releasingReadCloser{ReadCloser: body, release: proxy.inFlight.Release}
+}
+
+// observeFailure passes a failed backend request to the adaptive
+// limit. Requests cancelled by the client say nothing about the backend
+// so they are not observed (their slot is just released).
+func (proxy *CoreProxy) observeFailure(ctx context.Context, err error, latency time.Duration) {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	proxy.inFlight.Observe(latency, http.StatusBadGateway)
+}
+
 func (proxy *CoreProxy) Request(
+	ctx context.Context,
 	urlPath string,
 	args url.Values,
 	method string,
@@ -94,7 +123,7 @@ func (proxy *CoreProxy) Request(
 
 	targetURL := proxy.BackendURL.JoinPath(urlPath)
 	targetURL.RawQuery = args.Encode()
-	req, err := http.NewRequest(method, targetURL.String(), rbody)
+	req, err := http.NewRequestWithContext(ctx, method, targetURL.String(), rbody)
 	if err != nil {
 		return &BackendProxiedResponse{
 			BodyReader: EmptyReadCloser{},
@@ -104,8 +133,21 @@ func (proxy *CoreProxy) Request(
 		}
 	}
 	req.Header = headers
+	if !proxy.inFlight.Acquire(ctx) {
+		log.Warn().
+			Str("url", targetURL.String()).
+			Msg("backend overloaded, rejecting request")
+		return &BackendProxiedResponse{
+			BodyReader: overloadedBody(),
+			Headers:    overloadedHeaders(proxy.inFlight.RetryAfterSecs()),
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	t0 := time.Now()
 	resp, err := proxy.client.Do(req)
 	if err != nil {
+		proxy.observeFailure(ctx, err, time.Since(t0))
+		proxy.inFlight.Release()
 		return &BackendProxiedResponse{
 			BodyReader: EmptyReadCloser{},
 			Headers:    http.Header{},
@@ -113,6 +155,7 @@ func (proxy *CoreProxy) Request(
 			Err:        err,
 		}
 	}
+	proxy.inFlight.Observe(time.Since(t0), resp.StatusCode)
 	log.Debug().
 		Str("url", targetURL.String()).
 		Err(err).
@@ -122,7 +165,7 @@ func (proxy *CoreProxy) Request(
 	ansHeaders := resp.Header
 	proxy.transformRedirect(ansHeaders)
 	return &BackendProxiedResponse{
-		BodyReader: resp.Body,
+		BodyReader: proxy.wrapBody(resp.Body),
 		Headers:    ansHeaders,
 		StatusCode: resp.StatusCode,
 		Err:        nil,
@@ -130,6 +173,7 @@ func (proxy *CoreProxy) Request(
 }
 
 func (proxy *CoreProxy) RequestStream(
+	ctx context.Context,
 	urlPath string,
 	args url.Values,
 	method string,
@@ -139,7 +183,7 @@ func (proxy *CoreProxy) RequestStream(
 
 	targetURL := proxy.BackendURL.JoinPath(urlPath)
 	targetURL.RawQuery = args.Encode()
-	req, err := http.NewRequest(method, targetURL.String(), rbody)
+	req, err := http.NewRequestWithContext(ctx, method, targetURL.String(), rbody)
 	if err != nil {
 		return &BackendProxiedStreamResponse{
 			BodyReader: EmptyReadCloser{},
@@ -149,8 +193,21 @@ func (proxy *CoreProxy) RequestStream(
 		}
 	}
 	req.Header = headers
+	if !proxy.inFlight.Acquire(ctx) {
+		log.Warn().
+			Str("url", targetURL.String()).
+			Msg("backend overloaded, rejecting request")
+		return &BackendProxiedStreamResponse{
+			BodyReader: overloadedBody(),
+			Headers:    overloadedHeaders(proxy.inFlight.RetryAfterSecs()),
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	t0 := time.Now()
 	resp, err := proxy.client.Do(req)
 	if err != nil {
+		proxy.observeFailure(ctx, err, time.Since(t0))
+		proxy.inFlight.Release()
 		return &BackendProxiedStreamResponse{
 			BodyReader: EmptyReadCloser{},
 			Headers:    http.Header{},
@@ -158,6 +215,7 @@ func (proxy *CoreProxy) RequestStream(
 			Err:        err,
 		}
 	}
+	proxy.inFlight.Observe(time.Since(t0), resp.StatusCode)
 	log.Debug().
 		Str("url", targetURL.String()).
 		Err(err).
@@ -167,7 +225,7 @@ func (proxy *CoreProxy) RequestStream(
 	ansHeaders := resp.Header
 	proxy.transformRedirect(ansHeaders)
 	return &BackendProxiedStreamResponse{
-		BodyReader: resp.Body,
+		BodyReader: proxy.wrapBody(resp.Body),
 		Headers:    ansHeaders,
 		StatusCode: resp.StatusCode,
 		Err:        nil,
@@ -198,5 +256,10 @@ func NewCoreProxy(conf GeneralProxyConf) (*CoreProxy, error) {
 			Timeout:   time.Duration(conf.ReqTimeoutSecs) * time.Second,
 			Transport: transport,
 		},
+		inFlight: NewInFlightLimiter(
+			conf.MaxInFlight,
+			time.Duration(conf.QueueTimeoutMs)*time.Millisecond,
+			conf.AdaptiveConcurrency,
+		),
 	}, nil
 }
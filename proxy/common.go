@@ -41,6 +41,10 @@ func (m Limit) NormLimitPerSec() rate.Limit {
 	return rate.Limit(float64(m.ReqPerTimeThreshold) / float64(m.ReqCheckingIntervalSecs))
 }
 
+func (m Limit) String() string {
+	return fmt.Sprintf("%d requests per %d seconds", m.ReqPerTimeThreshold, m.ReqCheckingIntervalSecs)
+}
+
 // --------------------------
 
 type GeneralProxyConf struct {
@@ -49,6 +53,19 @@ type GeneralProxyConf struct {
 	ReqTimeoutSecs      int
 	IdleConnTimeoutSecs int
 	Limits              []Limit
+
+	// MaxInFlight limits the number of concurrent requests
+	// to the backend (0 = no limit)
+	MaxInFlight int
+
+	// QueueTimeoutMs specifies how long a request over
+	// the MaxInFlight limit may wait for a free slot
+	QueueTimeoutMs int
+
+	// AdaptiveConcurrency (optional) makes the in-flight limit
+	// adapt to observed backend latency (MaxInFlight is then
+	// the upper bound)
+	AdaptiveConcurrency *AdaptiveLimitConf
 }
 
 // ---------------------------
@@ -0,0 +1,308 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard/reporting"
+	"github.com/czcorpus/cnc-gokit/collections"
+)
+
+const (
+	backendLoadReportInterval = 30 * time.Second
+)
+
+// InFlightStats provides live information about requests
+// processed by a backend.
+type InFlightStats struct {
+	MaxInFlight int   `json:"maxInFlight"`
+	Limit       int   `json:"limit"`
+	Adaptive    bool  `json:"adaptive"`
+	InFlight    int   `json:"inFlight"`
+	Queued      int   `json:"queued"`
+	Rejected    int64 `json:"rejected"`
+}
+
+// InFlightLimiter caps the number of concurrent requests to a backend.
+// Requests over the cap wait (in FIFO order) for a free slot for up
+// to queueTimeout, after that they are rejected. The cap can be changed
+// at runtime (see AdaptiveLimit) but it never exceeds maxInFlight.
+// A nil limiter admits everything.
+type InFlightLimiter struct {
+	mu           sync.Mutex
+	maxInFlight  int
+	limit        int
+	inFlight     int
+	waiters      *list.List
+	queueTimeout time.Duration
+	rejected     int64
+	adaptive     *AdaptiveLimit
+}
+
+// grantWaiting passes free slots to waiting requests.
+// The caller must hold the lock.
+func (lim *InFlightLimiter) grantWaiting() {
+	for lim.inFlight < lim.limit && lim.waiters.Len() > 0 {
+		ch := lim.waiters.Remove(lim.waiters.Front()).(chan struct{})
+		lim.inFlight++
+		close(ch)
+	}
+}
+
+// Acquire obtains a slot for a backend request. It returns false
+// in case no slot became available within the queue timeout or
+// in case the ctx has been cancelled while waiting.
+// Each successful Acquire must be followed by Release.
+func (lim *InFlightLimiter) Acquire(ctx context.Context) bool {
+	if lim == nil {
+		return true
+	}
+	lim.mu.Lock()
+	if lim.inFlight < lim.limit && lim.waiters.Len() == 0 {
+		lim.inFlight++
+		lim.mu.Unlock()
+		return true
+	}
+	if lim.queueTimeout <= 0 {
+		lim.rejected++
+		lim.mu.Unlock()
+		return false
+	}
+	ch := make(chan struct{})
+	elm := lim.waiters.PushBack(ch)
+	lim.mu.Unlock()
+
+	timer := time.NewTimer(lim.queueTimeout)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return true
+	case <-timer.C:
+		return lim.leaveQueue(elm, true)
+	case <-ctx.Done():
+		// the client is gone so we do not count this as a rejection
+		return lim.leaveQueue(elm, false)
+	}
+}
+
+// leaveQueue removes a waiting request from the queue. In case the request
+// has been granted a slot in the meantime, the slot is kept and true is returned.
+func (lim *InFlightLimiter) leaveQueue(elm *list.Element, countRejected bool) bool {
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	select {
+	case <-elm.Value.(chan struct{}):
+		// the slot has been granted in the meantime
+		return true
+	default:
+	}
+	lim.waiters.Remove(elm)
+	if countRejected {
+		lim.rejected++
+	}
+	return false
+}
+
+func (lim *InFlightLimiter) Release() {
+	if lim == nil {
+		return
+	}
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	lim.inFlight--
+	lim.grantWaiting()
+}
+
+// SetLimit changes the current limit. The value is clamped
+// to the [1, maxInFlight] interval.
+func (lim *InFlightLimiter) SetLimit(limit int) {
+	if lim == nil {
+		return
+	}
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	lim.limit = min(max(1, limit), lim.maxInFlight)
+	lim.grantWaiting()
+}
+
+// Observe passes information about a finished backend request
+// to the adaptive limit (if configured).
+func (lim *InFlightLimiter) Observe(latency time.Duration, status int) {
+	if lim == nil || lim.adaptive == nil {
+		return
+	}
+	lim.SetLimit(lim.adaptive.Observe(latency, status))
+}
+
+// RetryAfterSecs provides a value for the Retry-After header
+// sent along with rejected requests.
+func (lim *InFlightLimiter) RetryAfterSecs() int {
+	if lim == nil {
+		return 1
+	}
+	return max(1, int(math.Ceil(lim.queueTimeout.Seconds())))
+}
+
+func (lim *InFlightLimiter) Stats() InFlightStats {
+	if lim == nil {
+		return InFlightStats{}
+	}
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	return InFlightStats{
+		MaxInFlight: lim.maxInFlight,
+		Limit:       lim.limit,
+		Adaptive:    lim.adaptive != nil,
+		InFlight:    lim.inFlight,
+		Queued:      lim.waiters.Len(),
+		Rejected:    lim.rejected,
+	}
+}
+
+// NewInFlightLimiter creates a new limiter. For maxInFlight <= 0,
+// nil (i.e. no limit) is returned. The adaptive argument is optional.
+func NewInFlightLimiter(
+	maxInFlight int,
+	queueTimeout time.Duration,
+	adaptive *AdaptiveLimitConf,
+) *InFlightLimiter {
+	if maxInFlight <= 0 {
+		return nil
+	}
+	ans := &InFlightLimiter{
+		maxInFlight:  maxInFlight,
+		limit:        maxInFlight,
+		waiters:      list.New(),
+		queueTimeout: queueTimeout,
+	}
+	if adaptive != nil {
+		ans.adaptive = NewAdaptiveLimit(*adaptive, maxInFlight)
+	}
+	return ans
+}
+
+// ------------------------------------
+
+// releasingReadCloser frees a limiter slot once the wrapped
+// response body is closed. This way, a slot is held for the whole
+// time a backend sends its response (which matters e.g. for streams).
+type releasingReadCloser struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (rc *releasingReadCloser) Close() error {
+	err := rc.ReadCloser.Close()
+	rc.once.Do(rc.release)
+	return err
+}
+
+func overloadedHeaders(retryAfterSecs int) http.Header {
+	hdrs := http.Header{}
+	hdrs.Set("Content-Type", "application/json")
+	hdrs.Set("Retry-After", strconv.Itoa(retryAfterSecs))
+	return hdrs
+}
+
+func overloadedBody() io.ReadCloser {
+	return io.NopCloser(
+		strings.NewReader(`{"error":"backend is overloaded, please try again later"}`))
+}
+
+// ------------------------------------
+
+// BackendLoadRegistry keeps track of backend proxies so
+// their load can be inspected via the administration API
+// and periodically reported to the reporting storage.
+type BackendLoadRegistry struct {
+	proxies    *collections.ConcurrentMap[string, *CoreProxy]
+	tDBWriter  reporting.ReportingWriter
+	tzLocation *time.Location
+}
+
+func (reg *BackendLoadRegistry) Register(serviceKey string, proxy *CoreProxy) {
+	if reg == nil {
+		return
+	}
+	reg.proxies.Set(serviceKey, proxy)
+}
+
+func (reg *BackendLoadRegistry) Stats() map[string]InFlightStats {
+	ans := make(map[string]InFlightStats)
+	if reg == nil {
+		return ans
+	}
+	reg.proxies.ForEach(func(k string, v *CoreProxy, ok bool) {
+		ans[k] = v.Load()
+	})
+	return ans
+}
+
+func (reg *BackendLoadRegistry) report() {
+	now := time.Now().In(reg.tzLocation)
+	for serviceKey, stats := range reg.Stats() {
+		if stats.MaxInFlight == 0 {
+			continue
+		}
+		reg.tDBWriter.Write(&reporting.BackendConcurrency{
+			Created:     now,
+			Service:     serviceKey,
+			MaxInFlight: stats.MaxInFlight,
+			Limit:       stats.Limit,
+			InFlight:    stats.InFlight,
+			Queued:      stats.Queued,
+			Rejected:    stats.Rejected,
+		})
+	}
+}
+
+// Run periodically reports the current limits and loads of registered
+// proxies (only the ones with a concurrency limit configured).
+func (reg *BackendLoadRegistry) Run(ctx context.Context) {
+	ticker := time.NewTicker(backendLoadReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reg.report()
+		}
+	}
+}
+
+func NewBackendLoadRegistry(
+	tDBWriter reporting.ReportingWriter,
+	tzLocation *time.Location,
+) *BackendLoadRegistry {
+	return &BackendLoadRegistry{
+		proxies:    collections.NewConcurrentMap[string, *CoreProxy](),
+		tDBWriter:  tDBWriter,
+		tzLocation: tzLocation,
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInFlightLimiterNilAdmitsEverything(t *testing.T) {
+	var lim *InFlightLimiter
+	assert.True(t, lim.Acquire(context.Background()))
+	lim.Release()
+	assert.Equal(t, InFlightStats{}, lim.Stats())
+}
+
+func TestInFlightLimiterRejectsOverCap(t *testing.T) {
+	lim := NewInFlightLimiter(2, 0, nil)
+	assert.True(t, lim.Acquire(context.Background()))
+	assert.True(t, lim.Acquire(context.Background()))
+	assert.False(t, lim.Acquire(context.Background()))
+	stats := lim.Stats()
+	assert.Equal(t, 2, stats.MaxInFlight)
+	assert.Equal(t, 2, stats.InFlight)
+	assert.Equal(t, int64(1), stats.Rejected)
+	lim.Release()
+	assert.True(t, lim.Acquire(context.Background()))
+}
+
+func TestInFlightLimiterQueuedRequestGetsFreedSlot(t *testing.T) {
+	lim := NewInFlightLimiter(1, time.Second, nil)
+	assert.True(t, lim.Acquire(context.Background()))
+	done := make(chan bool)
+	go func() {
+		done <- lim.Acquire(context.Background())
+	}()
+	assert.Eventually(t, func() bool { return lim.Stats().Queued == 1 }, time.Second, time.Millisecond)
+	lim.Release()
+	assert.True(t, <-done)
+	assert.Equal(t, 0, lim.Stats().Queued)
+}
+
+func TestInFlightLimiterQueueTimeout(t *testing.T) {
+	lim := NewInFlightLimiter(1, 20*time.Millisecond, nil)
+	assert.True(t, lim.Acquire(context.Background()))
+	assert.False(t, lim.Acquire(context.Background()))
+	assert.Equal(t, int64(1), lim.Stats().Rejected)
+	assert.Equal(t, 1, lim.RetryAfterSecs())
+}
+
+func TestInFlightLimiterCancelledWaiting(t *testing.T) {
+	lim := NewInFlightLimiter(1, time.Minute, nil)
+	assert.True(t, lim.Acquire(context.Background()))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		done <- lim.Acquire(ctx)
+	}()
+	assert.Eventually(t, func() bool { return lim.Stats().Queued == 1 }, time.Second, time.Millisecond)
+	cancel()
+	assert.False(t, <-done)
+	stats := lim.Stats()
+	assert.Equal(t, 0, stats.Queued)
+	assert.Equal(t, 1, stats.InFlight)
+	assert.Equal(t, int64(0), stats.Rejected)
+}
+
+func TestInFlightLimiterRaisedLimitGrantsWaiting(t *testing.T) {
+	lim := NewInFlightLimiter(2, time.Second, nil)
+	lim.SetLimit(1)
+	assert.True(t, lim.Acquire(context.Background()))
+	done := make(chan bool)
+	go func() {
+		done <- lim.Acquire(context.Background())
+	}()
+	assert.Eventually(t, func() bool { return lim.Stats().Queued == 1 }, time.Second, time.Millisecond)
+	lim.SetLimit(2)
+	assert.True(t, <-done)
+	assert.Equal(t, 2, lim.Stats().InFlight)
+}
+
+func TestInFlightLimiterSetLimitIsClamped(t *testing.T) {
+	lim := NewInFlightLimiter(3, 0, nil)
+	lim.SetLimit(10)
+	assert.Equal(t, 3, lim.Stats().Limit)
+	lim.SetLimit(0)
+	assert.Equal(t, 1, lim.Stats().Limit)
+}
+
+func TestCoreProxyRejectsOverloadedBackend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	prx, err := NewCoreProxy(GeneralProxyConf{
+		BackendURL:  srv.URL,
+		FrontendURL: "http://localhost",
+		MaxInFlight: 1,
+	})
+	assert.NoError(t, err)
+
+	resp1 := prx.Request(context.Background(), "/", url.Values{}, http.MethodGet, http.Header{}, nil)
+	assert.Equal(t, http.StatusOK, resp1.StatusCode)
+	assert.Equal(t, 1, prx.Load().InFlight)
+
+	resp2 := prx.Request(context.Background(), "/", url.Values{}, http.MethodGet, http.Header{}, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, resp2.StatusCode)
+	assert.Equal(t, "1", resp2.Headers.Get("Retry-After"))
+	assert.NoError(t, resp2.Err)
+
+	_, err = io.ReadAll(resp1.BodyReader)
+	assert.NoError(t, err)
+	assert.NoError(t, resp1.CloseBodyReader())
+	assert.NoError(t, resp1.CloseBodyReader())
+	assert.Equal(t, 0, prx.Load().InFlight)
+
+	resp3 := prx.Request(context.Background(), "/", url.Values{}, http.MethodGet, http.Header{}, nil)
+	assert.Equal(t, http.StatusOK, resp3.StatusCode)
+	resp3.CloseBodyReader()
+}
+
+func TestCoreProxyCancelledRequestDoesNotLowerLimit(t *testing.T) {
+	started := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	prx, err := NewCoreProxy(GeneralProxyConf{
+		BackendURL:  srv.URL,
+		FrontendURL: "http://localhost",
+		MaxInFlight: 4,
+		AdaptiveConcurrency: &AdaptiveLimitConf{
+			TargetLatencyMs: 10000,
+			MinInFlight:     1,
+			DecreaseFactor:  0.5,
+		},
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	resp := prx.Request(ctx, "/", url.Values{}, http.MethodGet, http.Header{}, nil)
+	assert.Error(t, resp.Err)
+	assert.Equal(t, 4, prx.Load().Limit)
+	assert.Equal(t, 0, prx.Load().InFlight)
+}
@@ -24,12 +24,15 @@ import (
 	"strings"
 	"time"
 
+	"github.com/czcorpus/apiguard/cnc"
 	"github.com/czcorpus/apiguard/common"
 	"github.com/czcorpus/apiguard/globctx"
 	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/apiguard/guard/fairqueue"
 	"github.com/czcorpus/apiguard/proxy"
 	"github.com/czcorpus/apiguard/proxy/cache"
 	"github.com/czcorpus/apiguard/reporting"
+	"github.com/czcorpus/apiguard/reputation"
 	"github.com/czcorpus/apiguard/session"
 
 	"github.com/czcorpus/cnc-gokit/logging"
@@ -67,12 +70,30 @@ type PublicAPIProxyOpts struct {
 	ReadTimeoutSecs            int
 	ResponseInterceptor        func(*proxy.BackendProxiedResponse)
 	IsStreamingMode            bool
+
+	// Enforcement specifies whether guard decisions are applied
+	// or just reported (see guard.EnforcementShadow)
+	Enforcement guard.Enforcement
+
+	// FairQueue configures queueing of requests exceeding rate limits.
+	// If nil, such requests are rejected immediately. In the shadow mode
+	// (see Enforcement), requests are never queued.
+	FairQueue *fairqueue.Conf
+
+	// Costs specifies how many rate limit tokens
+	// particular requests consume (default is 1)
+	Costs guard.CostRules
+
+	// Reputation specifies how clients listed in IP reputation
+	// blocklists are treated. If nil, the blocklists are not used.
+	Reputation *reputation.ServiceConf
 }
 
 // Proxy is a service proxy which - in general - does not
 // forbid any user from accessing protected API. But it still
 // distinguishes between logged-in users and anonymous ones. And
-// it may throttle requests with some favouring of logged-in users.
+// it may throttle requests with some favouring of logged-in users
+// (see PublicAPIProxyOpts.FairQueue).
 type Proxy struct {
 	servicePath                string
 	serviceKey                 string
@@ -91,6 +112,7 @@ type Proxy struct {
 	responseInterceptor        func(resp *proxy.BackendProxiedResponse)
 	monitoring                 reporting.ReportingWriter
 	userFinder                 guard.UserFinder
+	userSessions               *cnc.SessionCache
 	isStreamingMode            bool
 }
 
@@ -135,6 +157,11 @@ func (prox *Proxy) RestrictResponseTime(ctx *gin.Context, clientID common.Client
 		)
 		return err
 	}
+	if respDelay > 0 {
+		if err := prox.guard.LogAppliedDelay(respDelay, clientID); err != nil {
+			log.Error().Err(err).Msg("failed to log applied delay")
+		}
+	}
 	time.Sleep(respDelay)
 	return nil
 }
@@ -222,7 +249,7 @@ func (prox *Proxy) AnyPath(ctx *gin.Context) {
 		return
 
 	} else if reqProps.ForbidsAccess() {
-		http.Error(ctx.Writer, http.StatusText(reqProps.ProposedResponse), reqProps.ProposedResponse)
+		http.Error(ctx.Writer, reqProps.DenialMessage(), reqProps.ProposedResponse)
 		return
 	}
 
@@ -240,6 +267,7 @@ func (prox *Proxy) AnyPath(ctx *gin.Context) {
 	respHandler.HandleCacheMiss(func() proxy.BackendResponse {
 		internalPath := strings.TrimPrefix(path, prox.servicePath)
 		bResp := prox.basicProxy.Request(
+			ctx.Request.Context(),
 			internalPath,
 			ctx.Request.URL.Query(),
 			ctx.Request.Method,
@@ -249,6 +277,11 @@ func (prox *Proxy) AnyPath(ctx *gin.Context) {
 		prox.responseInterceptor(bResp)
 		return bResp
 	})
+	if prox.userSessions.IsLogoutPath(path) {
+		if sessionVal := prox.getUserCNCSessionID(ctx.Request); !sessionVal.IsZero() {
+			prox.userSessions.Invalidate(sessionVal.SrchSelector())
+		}
+	}
 	respHandler.WriteResponse(ctx.Writer)
 	prox.monitoring.Write(&reporting.ProxyProcReport{
 		DateTime: time.Now().In(prox.tzLocation),
@@ -301,11 +334,11 @@ func NewProxy(
 		basicProxy:          basicProxy,
 		clientCounter:       clientCounter,
 		cache:               globalCtx.Cache,
-		guard:               sGuard,
 		responseInterceptor: respInt,
 		monitoring:          globalCtx.ReportingWriter,
 		tzLocation:          globalCtx.TimezoneLocation,
 		userFinder:          guard.NewUserFinder(globalCtx),
+		userSessions:        globalCtx.UserSessions,
 	}
 
 	if opts.AuthCookieName == "" {
@@ -350,6 +383,7 @@ func NewProxy(
 
 	p.serviceKey = opts.ServiceKey
 	p.servicePath = fmt.Sprintf("/service/%s", p.serviceKey)
+	globalCtx.BackendLoad.Register(p.serviceKey, basicProxy)
 
 	if opts.UserIDHeaderName == "" {
 		log.Warn().Msg("UserIDHeaderName not set for public proxy, no CNC user ID will be passed via headers")
@@ -367,5 +401,24 @@ func NewProxy(
 
 	p.isStreamingMode = opts.IsStreamingMode
 
+	grd := guard.WithCosts(opts.Costs, sGuard)
+	if opts.FairQueue != nil && opts.Enforcement == guard.EnforcementShadow {
+		log.Warn().
+			Str("serviceKey", opts.ServiceKey).
+			Msg("fair queue is not applied in shadow mode")
+
+	} else if opts.FairQueue != nil {
+		grd = fairqueue.New(globalCtx, opts.ServiceKey, opts.FairQueue, grd, p.determineTrueUserID)
+	}
+	// the reputation is checked outside the fair queue so listed
+	// clients cannot occupy queue slots
+	grd = guard.ApplyEnforcement(
+		globalCtx,
+		opts.ServiceKey,
+		opts.Enforcement,
+		guard.WithReputation(globalCtx, opts.ServiceKey, opts.Reputation, grd),
+	)
+	p.guard = guard.WithAudit(globalCtx, opts.ServiceKey, grd)
+
 	return p
 }
@@ -305,6 +305,7 @@ func (ncw *DirectResponse) String() string {
 }
 
 func (ncw *DirectResponse) ExportResponse() ([]byte, error) {
+	defer ncw.boundResp.CloseBodyReader()
 	data, err := io.ReadAll(ncw.boundResp.GetBodyReader())
 	if err != nil {
 		return nil, fmt.Errorf("failed to export response from DirectResponse: %w", err)
@@ -314,6 +315,7 @@ func (ncw *DirectResponse) ExportResponse() ([]byte, error) {
 
 // DirectResponse
 func (ncw *DirectResponse) WriteResponse(w http.ResponseWriter) {
+	defer ncw.boundResp.CloseBodyReader()
 	data, err := io.ReadAll(ncw.boundResp.GetBodyReader())
 	if err != nil {
 		uniresp.WriteJSONErrorResponse(
@@ -0,0 +1,80 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/czcorpus/apiguard/proxy"
+)
+
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Limiter decides whether clients' requests fit within configured limits.
+// Guards use a single shared instance and distinguish between services
+// via namespaces.
+type Limiter interface {
+
+	// Allow tests whether a client identified by clientKey (IP, token, ...)
+	// may perform a request within the namespace. In case it may not,
+	// the exceeded limit is returned (if known).
+	Allow(namespace, clientKey string, limits []proxy.Limit) (bool, *proxy.Limit)
+
+	// AllowN is like Allow but the request consumes n tokens
+	// (see guard.CostRules). The cost is capped by the burst limit
+	// of each limit so even an expensive request can pass when
+	// the client has a full bucket.
+	AllowN(namespace, clientKey string, limits []proxy.Limit, n int) (bool, *proxy.Limit)
+
+	// Stats provides JSON-serializable information about the limiter
+	// state (used by admin endpoints).
+	Stats() any
+
+	// Run performs limiter's background maintenance (if any).
+	// The method blocks until the context is cancelled.
+	Run(ctx context.Context)
+}
+
+// namespacedLimiter allows a single limiter to be used by several
+// guards of the same service without sharing their limits
+// (see WithNamespaceSuffix).
+type namespacedLimiter struct {
+	Limiter
+	suffix string
+}
+
+func (nl *namespacedLimiter) Allow(namespace, clientKey string, limits []proxy.Limit) (bool, *proxy.Limit) {
+	return nl.Limiter.Allow(namespace+nl.suffix, clientKey, limits)
+}
+
+func (nl *namespacedLimiter) AllowN(namespace, clientKey string, limits []proxy.Limit, n int) (bool, *proxy.Limit) {
+	return nl.Limiter.AllowN(namespace+nl.suffix, clientKey, limits, n)
+}
+
+// Run does nothing as the maintenance is performed by the wrapped limiter
+func (nl *namespacedLimiter) Run(ctx context.Context) {
+}
+
+// WithNamespaceSuffix wraps a limiter so the suffix is appended to all
+// the namespaces the wrapper is used with.
+func WithNamespaceSuffix(limiter Limiter, suffix string) Limiter {
+	return &namespacedLimiter{Limiter: limiter, suffix: suffix}
+}
@@ -0,0 +1,133 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DfltNumShards           = 32
+	DfltMaxEntries          = 100000
+	DfltIdleTTLSecs         = 3600
+	DfltCleanupIntervalSecs = 60
+	DfltRedisTimeoutMs      = 200
+)
+
+// Conf configures the limiter shared by all the guards.
+type Conf struct {
+
+	// Backend specifies where limiters' state is kept. It can be either
+	// "memory" (default) or "redis". The latter allows multiple APIGuard
+	// instances to share the limits and it uses Redis connection specified
+	// in the `cache` section.
+	Backend string `json:"backend"`
+
+	// RedisFailOpen specifies whether requests should be allowed
+	// (true) or rejected (false) in case Redis cannot be reached.
+	RedisFailOpen bool `json:"redisFailOpen"`
+
+	// RedisTimeoutMs is a maximum time spent on a single limiter
+	// evaluation in Redis.
+	RedisTimeoutMs int `json:"redisTimeoutMs"`
+
+	// NumShards specifies how many independently locked parts
+	// the registry is split into.
+	NumShards int `json:"numShards"`
+
+	// MaxEntries is the maximum number of limiters (i.e. tracked clients)
+	// the registry keeps. Once reached, least recently used limiters are
+	// evicted.
+	MaxEntries int `json:"maxEntries"`
+
+	// IdleTTLSecs specifies how long an unused limiter is kept.
+	// It should be higher than the longest configured limit interval,
+	// otherwise an idle client may obtain a fresh limiter (with a full bucket)
+	// sooner than it would regenerate on its own.
+	IdleTTLSecs int `json:"idleTtlSecs"`
+
+	CleanupIntervalSecs int `json:"cleanupIntervalSecs"`
+}
+
+func (conf *Conf) ValidateAndDefaults(confContext string) error {
+	if conf.Backend == "" {
+		conf.Backend = BackendMemory
+
+	} else if conf.Backend != BackendMemory && conf.Backend != BackendRedis {
+		return fmt.Errorf(
+			"%s.backend has an invalid value (supported: %s, %s)",
+			confContext, BackendMemory, BackendRedis,
+		)
+	}
+
+	if conf.Backend == BackendRedis {
+		if conf.RedisTimeoutMs == 0 {
+			conf.RedisTimeoutMs = DfltRedisTimeoutMs
+			log.Warn().
+				Int("value", DfltRedisTimeoutMs).
+				Msgf("%s.redisTimeoutMs not set, using default", confContext)
+
+		} else if conf.RedisTimeoutMs < 0 {
+			return fmt.Errorf("%s.redisTimeoutMs has an invalid value", confContext)
+		}
+		return nil
+	}
+
+	if conf.NumShards == 0 {
+		conf.NumShards = DfltNumShards
+		log.Warn().
+			Int("value", DfltNumShards).
+			Msgf("%s.numShards not set, using default", confContext)
+
+	} else if conf.NumShards < 0 {
+		return fmt.Errorf("%s.numShards has an invalid value", confContext)
+	}
+
+	if conf.MaxEntries == 0 {
+		conf.MaxEntries = DfltMaxEntries
+		log.Warn().
+			Int("value", DfltMaxEntries).
+			Msgf("%s.maxEntries not set, using default", confContext)
+
+	} else if conf.MaxEntries < conf.NumShards {
+		return fmt.Errorf("%s.maxEntries must be at least %d (numShards)", confContext, conf.NumShards)
+	}
+
+	if conf.IdleTTLSecs == 0 {
+		conf.IdleTTLSecs = DfltIdleTTLSecs
+		log.Warn().
+			Int("value", DfltIdleTTLSecs).
+			Msgf("%s.idleTtlSecs not set, using default", confContext)
+
+	} else if conf.IdleTTLSecs < 0 {
+		return fmt.Errorf("%s.idleTtlSecs has an invalid value", confContext)
+	}
+
+	if conf.CleanupIntervalSecs == 0 {
+		conf.CleanupIntervalSecs = DfltCleanupIntervalSecs
+		log.Warn().
+			Int("value", DfltCleanupIntervalSecs).
+			Msgf("%s.cleanupIntervalSecs not set, using default", confContext)
+
+	} else if conf.CleanupIntervalSecs < 0 {
+		return fmt.Errorf("%s.cleanupIntervalSecs has an invalid value", confContext)
+	}
+	return nil
+}
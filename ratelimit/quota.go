@@ -0,0 +1,213 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	QuotaPeriodDaily   = "daily"
+	QuotaPeriodMonthly = "monthly"
+
+	quotaSaveInterval = time.Minute
+)
+
+type quotaCounter struct {
+	Day        string `json:"day"`
+	DayCount   int    `json:"dayCount"`
+	Month      string `json:"month"`
+	MonthCount int    `json:"monthCount"`
+}
+
+func (qc *quotaCounter) roll(now time.Time) {
+	day := now.Format("2006-01-02")
+	if qc.Day != day {
+		qc.Day = day
+		qc.DayCount = 0
+	}
+	month := now.Format("2006-01")
+	if qc.Month != month {
+		qc.Month = month
+		qc.MonthCount = 0
+	}
+}
+
+// QuotaUsage describes how many requests a client
+// has made in the current day and month.
+type QuotaUsage struct {
+	Day        string `json:"day"`
+	DayCount   int    `json:"dayCount"`
+	Month      string `json:"month"`
+	MonthCount int    `json:"monthCount"`
+}
+
+// QuotaStore counts daily and monthly requests of clients (typically
+// identified by their access tokens). The counters are periodically
+// saved to a file so they survive APIGuard restarts.
+type QuotaStore struct {
+	path     string
+	loc      *time.Location
+	counters map[string]*quotaCounter
+	dirty    bool
+	mu       sync.Mutex
+}
+
+func (qs *QuotaStore) mkKey(namespace, clientKey string) string {
+	return namespace + "|" + clientKey
+}
+
+// Consume registers a request of a client in case neither of the quotas
+// is exhausted. Otherwise, it returns false and the exhausted period
+// (QuotaPeriodDaily, QuotaPeriodMonthly). Zero quota means "unlimited".
+func (qs *QuotaStore) Consume(namespace, clientKey string, dailyQuota, monthlyQuota int) (bool, string) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	key := qs.mkKey(namespace, clientKey)
+	counter, ok := qs.counters[key]
+	if !ok {
+		counter = &quotaCounter{}
+		qs.counters[key] = counter
+	}
+	counter.roll(time.Now().In(qs.loc))
+	if dailyQuota > 0 && counter.DayCount >= dailyQuota {
+		return false, QuotaPeriodDaily
+	}
+	if monthlyQuota > 0 && counter.MonthCount >= monthlyQuota {
+		return false, QuotaPeriodMonthly
+	}
+	counter.DayCount++
+	counter.MonthCount++
+	qs.dirty = true
+	return true, ""
+}
+
+// Usage returns the current usage of a client
+func (qs *QuotaStore) Usage(namespace, clientKey string) QuotaUsage {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	counter, ok := qs.counters[qs.mkKey(namespace, clientKey)]
+	if !ok {
+		counter = &quotaCounter{}
+	}
+	counter.roll(time.Now().In(qs.loc))
+	return QuotaUsage(*counter)
+}
+
+// Load loads saved counters. A missing file is not considered an error.
+func (qs *QuotaStore) Load() error {
+	if qs.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(qs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+
+	} else if err != nil {
+		return fmt.Errorf("failed to load quota counters: %w", err)
+	}
+	counters := make(map[string]*quotaCounter)
+	if err := json.Unmarshal(data, &counters); err != nil {
+		return fmt.Errorf("failed to load quota counters: %w", err)
+	}
+	qs.mu.Lock()
+	qs.counters = counters
+	qs.mu.Unlock()
+	log.Info().
+		Str("path", qs.path).
+		Int("numItems", len(counters)).
+		Msg("loaded quota counters")
+	return nil
+}
+
+// Save writes counters to the file in case there
+// are any unsaved changes.
+func (qs *QuotaStore) Save() error {
+	if qs.path == "" {
+		return nil
+	}
+	qs.mu.Lock()
+	if !qs.dirty {
+		qs.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(qs.counters)
+	qs.dirty = false
+	qs.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to save quota counters: %w", err)
+	}
+	tmpPath := qs.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to save quota counters: %w", err)
+	}
+	if err := os.Rename(tmpPath, qs.path); err != nil {
+		return fmt.Errorf("failed to save quota counters: %w", err)
+	}
+	return nil
+}
+
+// Run periodically saves the counters until the ctx is cancelled
+func (qs *QuotaStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(quotaSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := qs.Save(); err != nil {
+				log.Error().Err(err).Msg("failed to save quota counters")
+			}
+		}
+	}
+}
+
+func (qs *QuotaStore) Shutdown(ctx context.Context) error {
+	saveDone := make(chan error, 1)
+	go func() {
+		saveDone <- qs.Save()
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-saveDone:
+		return err
+	}
+}
+
+// NewQuotaStore creates a new QuotaStore. In case the path
+// is empty, the counters are not persistent.
+func NewQuotaStore(path string, loc *time.Location) *QuotaStore {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &QuotaStore{
+		path:     path,
+		loc:      loc,
+		counters: make(map[string]*quotaCounter),
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotaStoreConsume(t *testing.T) {
+	qs := NewQuotaStore("", nil)
+	for i := 0; i < 3; i++ {
+		ok, _ := qs.Consume("0/mquery", "token:a", 3, 10)
+		assert.True(t, ok)
+	}
+	ok, period := qs.Consume("0/mquery", "token:a", 3, 10)
+	assert.False(t, ok)
+	assert.Equal(t, QuotaPeriodDaily, period)
+
+	ok, _ = qs.Consume("0/mquery", "token:b", 3, 10)
+	assert.True(t, ok)
+	ok, _ = qs.Consume("1/wss", "token:a", 3, 10)
+	assert.True(t, ok)
+	assert.Equal(t, 3, qs.Usage("0/mquery", "token:a").DayCount)
+}
+
+func TestQuotaStoreMonthly(t *testing.T) {
+	qs := NewQuotaStore("", nil)
+	ok, _ := qs.Consume("0/mquery", "token:a", 0, 1)
+	assert.True(t, ok)
+	ok, period := qs.Consume("0/mquery", "token:a", 0, 1)
+	assert.False(t, ok)
+	assert.Equal(t, QuotaPeriodMonthly, period)
+}
+
+func TestQuotaStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	qs := NewQuotaStore(path, nil)
+	qs.Consume("0/mquery", "token:a", 2, 0)
+	qs.Consume("0/mquery", "token:a", 2, 0)
+	assert.NoError(t, qs.Save())
+
+	qs2 := NewQuotaStore(path, nil)
+	assert.NoError(t, qs2.Load())
+	ok, period := qs2.Consume("0/mquery", "token:a", 2, 0)
+	assert.False(t, ok)
+	assert.Equal(t, QuotaPeriodDaily, period)
+}
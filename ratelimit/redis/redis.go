@@ -0,0 +1,176 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/czcorpus/apiguard/proxy"
+	"github.com/czcorpus/apiguard/ratelimit"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultRedisPort = 6379
+
+	redisKeyPrefix = "apiguard:ratelimit"
+)
+
+// gcraScript implements the generic cell rate algorithm (GCRA)
+// for multiple limits at once. For each limit (= key), the script
+// expects the increment of the request (emission interval multiplied by
+// the request cost) and burst tolerance (both in microseconds) in ARGV.
+// All the limits are tested first and only if all of them pass,
+// the new theoretical arrival times (TAT) are stored. This means that
+// a rejected request does not consume anything.
+// The script returns 0 if the request is allowed. Otherwise, it returns
+// the (1-based) index of the first exceeded limit.
+// Redis server time is used so instances with unsynchronized clocks
+// still share the same limits (replicate_commands is needed for Redis < 5
+// to allow writes after TIME).
+var gcraScript = redis.NewScript(`
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local newTats = {}
+for i, key in ipairs(KEYS) do
+	local increment = tonumber(ARGV[2 * i - 1])
+	local tolerance = tonumber(ARGV[2 * i])
+	local tat = tonumber(redis.call('GET', key))
+	if not tat or tat < now then
+		tat = now
+	end
+	local newTat = tat + increment
+	if newTat - tolerance > now then
+		return i
+	end
+	newTats[i] = newTat
+end
+for i, key in ipairs(KEYS) do
+	local ttl = math.max(1, math.ceil((newTats[i] - now) / 1000))
+	redis.call('SET', key, string.format('%.0f', newTats[i]), 'PX', ttl)
+end
+return 0
+`)
+
+// Stats provides basic information about the Redis limiter
+type Stats struct {
+	Backend     string `json:"backend"`
+	FailOpen    bool   `json:"failOpen"`
+	NumAllowed  int64  `json:"numAllowed"`
+	NumRejected int64  `json:"numRejected"`
+	NumErrors   int64  `json:"numErrors"`
+}
+
+// Limiter is a ratelimit.Limiter implementation keeping
+// limiters' state in Redis so multiple APIGuard instances
+// can share the same limits.
+type Limiter struct {
+	redisClient *redis.Client
+	timeout     time.Duration
+	failOpen    bool
+	numAllowed  atomic.Int64
+	numRejected atomic.Int64
+	numErrors   atomic.Int64
+}
+
+func (lim *Limiter) Allow(namespace, clientKey string, limits []proxy.Limit) (bool, *proxy.Limit) {
+	return lim.AllowN(namespace, clientKey, limits, 1)
+}
+
+func (lim *Limiter) AllowN(namespace, clientKey string, limits []proxy.Limit, n int) (bool, *proxy.Limit) {
+	if len(limits) == 0 {
+		return true, nil
+	}
+	keys := make([]string, len(limits))
+	args := make([]any, 0, 2*len(limits))
+	for i, limit := range limits {
+		keys[i] = fmt.Sprintf("%s:%s:%s:%d", redisKeyPrefix, namespace, clientKey, i)
+		interval := limit.ReqCheckingInterval().Microseconds() / int64(max(limit.ReqPerTimeThreshold, 1))
+		cost := int64(min(max(n, 1), max(limit.BurstLimit, 1)))
+		args = append(args, interval*cost, interval*int64(limit.BurstLimit))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lim.timeout)
+	defer cancel()
+	exceeded, err := gcraScript.Run(ctx, lim.redisClient, keys, args...).Int()
+	if err != nil {
+		lim.numErrors.Add(1)
+		log.Error().
+			Err(err).
+			Str("namespace", namespace).
+			Bool("failOpen", lim.failOpen).
+			Msg("failed to evaluate rate limit in Redis")
+		return lim.failOpen, nil
+	}
+	if exceeded > 0 && exceeded <= len(limits) {
+		lim.numRejected.Add(1)
+		return false, &limits[exceeded-1]
+	}
+	lim.numAllowed.Add(1)
+	return true, nil
+}
+
+func (lim *Limiter) Stats() any {
+	return Stats{
+		Backend:     ratelimit.BackendRedis,
+		FailOpen:    lim.failOpen,
+		NumAllowed:  lim.numAllowed.Load(),
+		NumRejected: lim.numRejected.Load(),
+		NumErrors:   lim.numErrors.Load(),
+	}
+}
+
+// Run only waits for the context to be cancelled and closes
+// the Redis connection as all the cleanup is performed by Redis
+// via keys' TTL.
+func (lim *Limiter) Run(ctx context.Context) {
+	<-ctx.Done()
+	if err := lim.redisClient.Close(); err != nil {
+		log.Error().Err(err).Msg("failed to close Redis rate limiter connection")
+	}
+}
+
+// New creates a new Redis-based limiter using Redis
+// connection configured for the response cache.
+func New(cacheConf *proxy.CacheConf, conf *ratelimit.Conf) *Limiter {
+	addr := cacheConf.RedisAddr
+	addrElms := strings.Split(addr, ":")
+	if len(addrElms) == 1 {
+		addr = fmt.Sprintf("%s:%d", addr, defaultRedisPort)
+		log.Warn().Msgf("Rate limiting: Redis port not specified, using %d", defaultRedisPort)
+	}
+	timeout := time.Duration(conf.RedisTimeoutMs) * time.Millisecond
+	return &Limiter{
+		redisClient: redis.NewClient(&redis.Options{
+			Addr:         addr,
+			DB:           cacheConf.RedisDB,
+			DialTimeout:  timeout,
+			ReadTimeout:  timeout,
+			WriteTimeout: timeout,
+			MaxRetries:   -1,
+		}),
+		timeout:  timeout,
+		failOpen: conf.RedisFailOpen,
+	}
+}
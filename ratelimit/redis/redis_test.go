@@ -0,0 +1,156 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard/proxy"
+	"github.com/czcorpus/apiguard/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+// startRedisServer runs a temporary redis-server instance
+// (without persistence) on a free port. In case redis-server
+// is not installed, the test is skipped.
+func startRedisServer(t *testing.T) string {
+	bin, err := exec.LookPath("redis-server")
+	if err != nil {
+		t.Skip("redis-server not available")
+	}
+	lsn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := lsn.Addr().(*net.TCPAddr).Port
+	lsn.Close()
+	cmd := exec.Command(
+		bin, "--port", fmt.Sprint(port), "--bind", "127.0.0.1",
+		"--save", "", "--appendonly", "no",
+	)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	for i := 0; i < 50; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return addr
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("redis-server failed to start")
+	return ""
+}
+
+func TestAllowRespectsAllLimits(t *testing.T) {
+	addr := startRedisServer(t)
+	lim := New(
+		&proxy.CacheConf{RedisAddr: addr},
+		&ratelimit.Conf{RedisTimeoutMs: 1000},
+	)
+	limits := []proxy.Limit{
+		{ReqPerTimeThreshold: 100, ReqCheckingIntervalSecs: 1, BurstLimit: 100},
+		{ReqPerTimeThreshold: 3, ReqCheckingIntervalSecs: 3600, BurstLimit: 3},
+	}
+	for i := 0; i < 3; i++ {
+		ok, limit := lim.Allow("0/test", "192.168.1.1", limits)
+		assert.True(t, ok)
+		assert.Nil(t, limit)
+	}
+	ok, limit := lim.Allow("0/test", "192.168.1.1", limits)
+	assert.False(t, ok)
+	assert.Equal(t, &limits[1], limit)
+
+	// different client and different namespace must not be affected
+	ok, _ = lim.Allow("0/test", "192.168.1.2", limits)
+	assert.True(t, ok)
+	ok, _ = lim.Allow("1/test", "192.168.1.1", limits)
+	assert.True(t, ok)
+}
+
+func TestRejectedRequestDoesNotConsume(t *testing.T) {
+	addr := startRedisServer(t)
+	lim := New(
+		&proxy.CacheConf{RedisAddr: addr},
+		&ratelimit.Conf{RedisTimeoutMs: 1000},
+	)
+	limits := []proxy.Limit{
+		{ReqPerTimeThreshold: 1, ReqCheckingIntervalSecs: 1, BurstLimit: 1},
+		{ReqPerTimeThreshold: 2, ReqCheckingIntervalSecs: 3600, BurstLimit: 2},
+	}
+	ok, _ := lim.Allow("0/test", "192.168.1.1", limits)
+	assert.True(t, ok)
+	for i := 0; i < 5; i++ {
+		ok, limit := lim.Allow("0/test", "192.168.1.1", limits)
+		assert.False(t, ok)
+		assert.Equal(t, &limits[0], limit)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	// the second (long-term) limit must still have one request left
+	ok, _ = lim.Allow("0/test", "192.168.1.1", limits)
+	assert.True(t, ok)
+}
+
+func TestUnreachableRedis(t *testing.T) {
+	limits := []proxy.Limit{
+		{ReqPerTimeThreshold: 10, ReqCheckingIntervalSecs: 1, BurstLimit: 10},
+	}
+	failOpen := New(
+		&proxy.CacheConf{RedisAddr: "127.0.0.1:1"},
+		&ratelimit.Conf{RedisTimeoutMs: 100, RedisFailOpen: true},
+	)
+	ok, limit := failOpen.Allow("0/test", "192.168.1.1", limits)
+	assert.True(t, ok)
+	assert.Nil(t, limit)
+
+	failClosed := New(
+		&proxy.CacheConf{RedisAddr: "127.0.0.1:1"},
+		&ratelimit.Conf{RedisTimeoutMs: 100, RedisFailOpen: false},
+	)
+	ok, limit = failClosed.Allow("0/test", "192.168.1.1", limits)
+	assert.False(t, ok)
+	assert.Nil(t, limit)
+	assert.Equal(t, int64(1), failClosed.Stats().(Stats).NumErrors)
+}
+
+func TestAllowNConsumesCost(t *testing.T) {
+	addr := startRedisServer(t)
+	lim := New(
+		&proxy.CacheConf{RedisAddr: addr},
+		&ratelimit.Conf{RedisTimeoutMs: 1000},
+	)
+	limits := []proxy.Limit{
+		{ReqPerTimeThreshold: 10, ReqCheckingIntervalSecs: 3600, BurstLimit: 10},
+	}
+	ok, _ := lim.AllowN("0/test", "192.168.1.1", limits, 8)
+	assert.True(t, ok)
+	ok, limit := lim.AllowN("0/test", "192.168.1.1", limits, 3)
+	assert.False(t, ok)
+	assert.Equal(t, &limits[0], limit)
+	ok, _ = lim.AllowN("0/test", "192.168.1.1", limits, 2)
+	assert.True(t, ok)
+}
@@ -0,0 +1,216 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/czcorpus/apiguard/proxy"
+	"github.com/rs/zerolog/log"
+)
+
+type registryEntry struct {
+	key        string
+	namespace  string
+	limiter    *Windowed
+	lastAccess time.Time
+}
+
+// shard is an independently locked part of the registry.
+// Its entries are kept in an LRU list (most recently used
+// entries at the front).
+type shard struct {
+	mu         sync.Mutex
+	items      map[string]*list.Element
+	lru        *list.List
+	maxEntries int
+}
+
+func (sh *shard) remove(elm *list.Element) {
+	entry := elm.Value.(*registryEntry)
+	sh.lru.Remove(elm)
+	delete(sh.items, entry.key)
+}
+
+// RegistryStats provides basic information about
+// the registry state.
+type RegistryStats struct {
+	LiveEntries       int64          `json:"liveEntries"`
+	MaxEntries        int            `json:"maxEntries"`
+	IdleEvictions     int64          `json:"idleEvictions"`
+	CapacityEvictions int64          `json:"capacityEvictions"`
+	Namespaces        map[string]int `json:"namespaces"`
+}
+
+// Registry is an in-memory Limiter keeping rate limiters of individual
+// clients for all the guards. Each guard uses its own namespace (typically
+// a service key) so limiters of different services do not collide.
+// To keep the memory bounded, limiters not used for a configured time
+// are removed and in case the registry is full, the least recently
+// used limiters are evicted.
+type Registry struct {
+	shards               []*shard
+	maxEntries           int
+	idleTTL              time.Duration
+	cleanupInterval      time.Duration
+	numLive              atomic.Int64
+	numIdleEvictions     atomic.Int64
+	numCapacityEvictions atomic.Int64
+}
+
+func (reg *Registry) shardFor(key string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return reg.shards[h.Sum32()%uint32(len(reg.shards))]
+}
+
+// getLimiter returns a limiter of the client. In case the client's
+// limits have changed since the limiter was created (e.g. reloaded
+// per-token limits), the limiter is replaced by a new one.
+func (reg *Registry) getLimiter(namespace, clientKey string, limits []proxy.Limit) *Windowed {
+	key := namespace + "|" + clientKey
+	sh := reg.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	now := time.Now()
+	if elm, ok := sh.items[key]; ok {
+		entry := elm.Value.(*registryEntry)
+		entry.lastAccess = now
+		sh.lru.MoveToFront(elm)
+		if !entry.limiter.HasLimits(limits) {
+			entry.limiter = NewWindowed(limits)
+		}
+		return entry.limiter
+	}
+	if sh.lru.Len() >= sh.maxEntries {
+		sh.remove(sh.lru.Back())
+		reg.numLive.Add(-1)
+		reg.numCapacityEvictions.Add(1)
+	}
+	entry := &registryEntry{
+		key:        key,
+		namespace:  namespace,
+		limiter:    NewWindowed(limits),
+		lastAccess: now,
+	}
+	sh.items[key] = sh.lru.PushFront(entry)
+	reg.numLive.Add(1)
+	return entry.limiter
+}
+
+func (reg *Registry) Allow(namespace, clientKey string, limits []proxy.Limit) (bool, *proxy.Limit) {
+	if len(limits) == 0 {
+		return true, nil
+	}
+	return reg.getLimiter(namespace, clientKey, limits).Allow()
+}
+
+func (reg *Registry) AllowN(namespace, clientKey string, limits []proxy.Limit, n int) (bool, *proxy.Limit) {
+	if len(limits) == 0 {
+		return true, nil
+	}
+	return reg.getLimiter(namespace, clientKey, limits).AllowN(n)
+}
+
+func (reg *Registry) evictIdle() {
+	deadline := time.Now().Add(-reg.idleTTL)
+	var numEvicted int64
+	for _, sh := range reg.shards {
+		sh.mu.Lock()
+		for elm := sh.lru.Back(); elm != nil; {
+			if elm.Value.(*registryEntry).lastAccess.After(deadline) {
+				break
+			}
+			prev := elm.Prev()
+			sh.remove(elm)
+			numEvicted++
+			elm = prev
+		}
+		sh.mu.Unlock()
+	}
+	reg.numLive.Add(-numEvicted)
+	reg.numIdleEvictions.Add(numEvicted)
+	if numEvicted > 0 {
+		log.Debug().
+			Int64("numEvicted", numEvicted).
+			Int64("numLive", reg.numLive.Load()).
+			Msg("removed idle rate limiters")
+	}
+}
+
+// Stats returns current registry statistics. Please note that
+// the per-namespace numbers are calculated by walking through
+// all the shards so the method should not be called too often.
+func (reg *Registry) Stats() any {
+	ans := RegistryStats{
+		LiveEntries:       reg.numLive.Load(),
+		MaxEntries:        reg.maxEntries,
+		IdleEvictions:     reg.numIdleEvictions.Load(),
+		CapacityEvictions: reg.numCapacityEvictions.Load(),
+		Namespaces:        make(map[string]int),
+	}
+	for _, sh := range reg.shards {
+		sh.mu.Lock()
+		for _, elm := range sh.items {
+			ans.Namespaces[elm.Value.(*registryEntry).namespace]++
+		}
+		sh.mu.Unlock()
+	}
+	return ans
+}
+
+// Run periodically removes idle limiters. The method
+// blocks until the context is cancelled.
+func (reg *Registry) Run(ctx context.Context) {
+	ticker := time.NewTicker(reg.cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("stopping rate limiter registry cleanup")
+			return
+		case <-ticker.C:
+			reg.evictIdle()
+		}
+	}
+}
+
+// NewRegistry creates a new limiter registry. The conf
+// is expected to be validated already.
+func NewRegistry(conf *Conf) *Registry {
+	ans := &Registry{
+		shards:          make([]*shard, conf.NumShards),
+		maxEntries:      conf.MaxEntries,
+		idleTTL:         time.Duration(conf.IdleTTLSecs) * time.Second,
+		cleanupInterval: time.Duration(conf.CleanupIntervalSecs) * time.Second,
+	}
+	shardSize := conf.MaxEntries / conf.NumShards
+	for i := range ans.shards {
+		ans.shards[i] = &shard{
+			items:      make(map[string]*list.Element),
+			lru:        list.New(),
+			maxEntries: shardSize,
+		}
+	}
+	return ans
+}
@@ -0,0 +1,144 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard/proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+var registryTestLimits = []proxy.Limit{
+	{ReqPerTimeThreshold: 2, ReqCheckingIntervalSecs: 3600, BurstLimit: 2},
+}
+
+func newTestRegistry(numShards, maxEntries int) *Registry {
+	return NewRegistry(&Conf{
+		NumShards:           numShards,
+		MaxEntries:          maxEntries,
+		IdleTTLSecs:         60,
+		CleanupIntervalSecs: 60,
+	})
+}
+
+func TestRegistryKeepsClientState(t *testing.T) {
+	reg := newTestRegistry(4, 100)
+	for i := 0; i < 2; i++ {
+		ok, _ := reg.Allow("1/test", "192.168.1.10", registryTestLimits)
+		assert.True(t, ok)
+	}
+	ok, limit := reg.Allow("1/test", "192.168.1.10", registryTestLimits)
+	assert.False(t, ok)
+	assert.Equal(t, registryTestLimits[0], *limit)
+
+	// other clients and other namespaces have their own limiters
+	ok, _ = reg.Allow("1/test", "192.168.1.11", registryTestLimits)
+	assert.True(t, ok)
+	ok, _ = reg.Allow("2/test", "192.168.1.10", registryTestLimits)
+	assert.True(t, ok)
+	stats := reg.Stats().(RegistryStats)
+	assert.Equal(t, int64(3), stats.LiveEntries)
+	assert.Equal(t, map[string]int{"1/test": 2, "2/test": 1}, stats.Namespaces)
+}
+
+func TestRegistryDistributesClientsToShards(t *testing.T) {
+	reg := newTestRegistry(8, 8000)
+	for i := 0; i < 1000; i++ {
+		reg.Allow("1/test", fmt.Sprintf("10.0.%d.%d", i/256, i%256), registryTestLimits)
+	}
+	var total int
+	for _, sh := range reg.shards {
+		assert.NotEmpty(t, sh.items)
+		total += len(sh.items)
+	}
+	assert.Equal(t, 1000, total)
+	assert.Same(t, reg.shardFor("1/test|10.0.0.1"), reg.shardFor("1/test|10.0.0.1"))
+}
+
+func TestRegistryEvictsLeastRecentlyUsed(t *testing.T) {
+	reg := newTestRegistry(1, 2)
+	reg.Allow("1/test", "a", registryTestLimits)
+	reg.Allow("1/test", "a", registryTestLimits)
+	reg.Allow("1/test", "b", registryTestLimits)
+	// "a" is now the most recently used one
+	reg.Allow("1/test", "a", registryTestLimits)
+	reg.Allow("1/test", "c", registryTestLimits)
+
+	sh := reg.shards[0]
+	assert.Contains(t, sh.items, "1/test|a")
+	assert.Contains(t, sh.items, "1/test|c")
+	assert.NotContains(t, sh.items, "1/test|b")
+	stats := reg.Stats().(RegistryStats)
+	assert.Equal(t, int64(2), stats.LiveEntries)
+	assert.Equal(t, int64(1), stats.CapacityEvictions)
+
+	// the limiter of "a" survived along with its state
+	ok, _ := reg.Allow("1/test", "a", registryTestLimits)
+	assert.False(t, ok)
+}
+
+func TestRegistryEvictsIdleEntries(t *testing.T) {
+	reg := newTestRegistry(2, 100)
+	reg.Allow("1/test", "a", registryTestLimits)
+	reg.Allow("1/test", "b", registryTestLimits)
+	sh := reg.shardFor("1/test|a")
+	sh.items["1/test|a"].Value.(*registryEntry).lastAccess = time.Now().Add(-2 * reg.idleTTL)
+
+	reg.evictIdle()
+	assert.NotContains(t, sh.items, "1/test|a")
+	assert.Contains(t, reg.shardFor("1/test|b").items, "1/test|b")
+	stats := reg.Stats().(RegistryStats)
+	assert.Equal(t, int64(1), stats.LiveEntries)
+	assert.Equal(t, int64(1), stats.IdleEvictions)
+}
+
+func TestRegistryAppliesChangedLimits(t *testing.T) {
+	reg := newTestRegistry(4, 100)
+	reg.Allow("1/test", "token", registryTestLimits)
+	reg.Allow("1/test", "token", registryTestLimits)
+	ok, _ := reg.Allow("1/test", "token", registryTestLimits)
+	assert.False(t, ok)
+
+	raised := []proxy.Limit{
+		{ReqPerTimeThreshold: 10, ReqCheckingIntervalSecs: 3600, BurstLimit: 10},
+	}
+	ok, _ = reg.Allow("1/test", "token", raised)
+	assert.True(t, ok)
+
+	lowered := []proxy.Limit{
+		{ReqPerTimeThreshold: 1, ReqCheckingIntervalSecs: 3600, BurstLimit: 1},
+	}
+	ok, _ = reg.Allow("1/test", "token", lowered)
+	assert.True(t, ok)
+	ok, limit := reg.Allow("1/test", "token", lowered)
+	assert.False(t, ok)
+	assert.Equal(t, lowered[0], *limit)
+	assert.Equal(t, int64(1), reg.Stats().(RegistryStats).LiveEntries)
+}
+
+func TestRegistryWithoutLimitsAllowsEverything(t *testing.T) {
+	reg := newTestRegistry(4, 100)
+	for i := 0; i < 10; i++ {
+		ok, _ := reg.Allow("1/test", "a", []proxy.Limit{})
+		assert.True(t, ok)
+	}
+	assert.Equal(t, int64(0), reg.Stats().(RegistryStats).LiveEntries)
+}
@@ -0,0 +1,86 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard/proxy"
+	"golang.org/x/time/rate"
+)
+
+// Windowed is a rate limiter enforcing multiple limits
+// (e.g. a per-minute one and a per-day one) at once. Each
+// configured proxy.Limit is backed by its own token bucket.
+type Windowed struct {
+	limits   []proxy.Limit
+	limiters []*rate.Limiter
+	mu       sync.Mutex
+}
+
+// Allow tests whether a request is allowed by all the configured
+// limits. In case it is not, the first exhausted limit is returned.
+// A rejected request does not consume anything from the other
+// limits so a client hitting e.g. a per-minute limit does not
+// exhaust its daily limit at the same time.
+func (w *Windowed) Allow() (bool, *proxy.Limit) {
+	return w.AllowN(1)
+}
+
+// AllowN is like Allow but the request consumes n tokens from
+// each limit. To prevent expensive requests from being rejected
+// forever, n is capped by the burst limit of the respective limit.
+func (w *Windowed) AllowN(n int) (bool, *proxy.Limit) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	reservations := make([]*rate.Reservation, 0, len(w.limiters))
+	for i, limiter := range w.limiters {
+		r := limiter.ReserveN(now, min(max(n, 1), limiter.Burst()))
+		if !r.OK() || r.DelayFrom(now) > 0 {
+			r.CancelAt(now)
+			for _, prev := range reservations {
+				prev.CancelAt(now)
+			}
+			return false, &w.limits[i]
+		}
+		reservations = append(reservations, r)
+	}
+	return true, nil
+}
+
+// HasLimits tests whether the limiter enforces exactly
+// the provided limits.
+func (w *Windowed) HasLimits(limits []proxy.Limit) bool {
+	return slices.Equal(w.limits, limits)
+}
+
+// NewWindowed creates a new limiter for the provided limits.
+// With no limits, the limiter allows everything.
+func NewWindowed(limits []proxy.Limit) *Windowed {
+	ans := &Windowed{
+		limits:   slices.Clone(limits),
+		limiters: make([]*rate.Limiter, len(limits)),
+	}
+	for i, limit := range limits {
+		ans.limiters[i] = rate.NewLimiter(limit.NormLimitPerSec(), limit.BurstLimit)
+	}
+	return ans
+}
@@ -0,0 +1,115 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/czcorpus/apiguard/proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowedAllowsWithinLimits(t *testing.T) {
+	w := NewWindowed([]proxy.Limit{
+		{ReqPerTimeThreshold: 3, ReqCheckingIntervalSecs: 3600, BurstLimit: 3},
+	})
+	for i := 0; i < 3; i++ {
+		ok, limit := w.Allow()
+		assert.True(t, ok)
+		assert.Nil(t, limit)
+	}
+	ok, _ := w.Allow()
+	assert.False(t, ok)
+}
+
+func TestWindowedReportsExceededLimit(t *testing.T) {
+	limits := []proxy.Limit{
+		{ReqPerTimeThreshold: 100, ReqCheckingIntervalSecs: 86400, BurstLimit: 100},
+		{ReqPerTimeThreshold: 2, ReqCheckingIntervalSecs: 60, BurstLimit: 2},
+	}
+	w := NewWindowed(limits)
+	w.Allow()
+	w.Allow()
+	ok, limit := w.Allow()
+	assert.False(t, ok)
+	assert.Equal(t, &limits[1], limit)
+}
+
+func TestWindowedRejectionDoesNotConsumeOtherLimits(t *testing.T) {
+	limits := []proxy.Limit{
+		{ReqPerTimeThreshold: 10, ReqCheckingIntervalSecs: 86400, BurstLimit: 10},
+		{ReqPerTimeThreshold: 1, ReqCheckingIntervalSecs: 60, BurstLimit: 1},
+	}
+	w := NewWindowed(limits)
+	ok, _ := w.Allow()
+	assert.True(t, ok)
+	for i := 0; i < 5; i++ {
+		ok, limit := w.Allow()
+		assert.False(t, ok)
+		assert.Equal(t, &limits[1], limit)
+	}
+	assert.InDelta(t, 9.0, w.limiters[0].Tokens(), 0.1)
+}
+
+func TestWindowedWithoutLimitsAllowsEverything(t *testing.T) {
+	w := NewWindowed([]proxy.Limit{})
+	for i := 0; i < 100; i++ {
+		ok, _ := w.Allow()
+		assert.True(t, ok)
+	}
+}
+
+func TestWindowedAllowNConsumesCost(t *testing.T) {
+	limits := []proxy.Limit{
+		{ReqPerTimeThreshold: 10, ReqCheckingIntervalSecs: 3600, BurstLimit: 10},
+	}
+	w := NewWindowed(limits)
+	ok, _ := w.AllowN(8)
+	assert.True(t, ok)
+	ok, limit := w.AllowN(3)
+	assert.False(t, ok)
+	assert.Equal(t, &limits[0], limit)
+	ok, _ = w.AllowN(2)
+	assert.True(t, ok)
+	ok, _ = w.Allow()
+	assert.False(t, ok)
+}
+
+func TestWindowedAllowNCapsCostByBurst(t *testing.T) {
+	w := NewWindowed([]proxy.Limit{
+		{ReqPerTimeThreshold: 5, ReqCheckingIntervalSecs: 3600, BurstLimit: 5},
+	})
+	ok, _ := w.AllowN(50)
+	assert.True(t, ok)
+	ok, _ = w.Allow()
+	assert.False(t, ok)
+}
+
+func TestWindowedRejectedCostDoesNotConsumeOtherLimits(t *testing.T) {
+	limits := []proxy.Limit{
+		{ReqPerTimeThreshold: 100, ReqCheckingIntervalSecs: 3600, BurstLimit: 100},
+		{ReqPerTimeThreshold: 5, ReqCheckingIntervalSecs: 60, BurstLimit: 5},
+	}
+	w := NewWindowed(limits)
+	ok, _ := w.AllowN(5)
+	assert.True(t, ok)
+	ok, limit := w.AllowN(5)
+	assert.False(t, ok)
+	assert.Equal(t, &limits[1], limit)
+	assert.InDelta(t, 95.0, w.limiters[0].Tokens(), 0.1)
+}
@@ -34,4 +34,51 @@ create table apiguard_alarm_monitoring (
   num_users int,
   num_requests int
 );
-select create_hypertable('apiguard_alarm_monitoring', 'time');
\ No newline at end of file
+select create_hypertable('apiguard_alarm_monitoring', 'time');
+create table apiguard_shadow_monitoring (
+  "time" timestamp with time zone NOT NULL,
+  service TEXT,
+  status int,
+  reason TEXT,
+  rule TEXT,
+  exceeded_limit TEXT,
+  client_id int,
+  client_ip TEXT
+);
+select create_hypertable('apiguard_shadow_monitoring', 'time');
+
+create table apiguard_guard_audit (
+  "time" timestamp with time zone NOT NULL,
+  service TEXT,
+  status int,
+  reason TEXT,
+  guard_type TEXT,
+  rule TEXT,
+  exceeded_limit TEXT,
+  client_id int,
+  client_ip TEXT,
+  method TEXT,
+  path TEXT
+);
+select create_hypertable('apiguard_guard_audit', 'time');
+
+create table apiguard_backend_concurrency (
+  "time" timestamp with time zone NOT NULL,
+  service TEXT,
+  max_in_flight int,
+  current_limit int,
+  in_flight int,
+  queued int,
+  rejected int
+);
+select create_hypertable('apiguard_backend_concurrency', 'time');
+
+create table apiguard_reputation_monitoring (
+  "time" timestamp with time zone NOT NULL,
+  service TEXT,
+  list TEXT,
+  action TEXT,
+  client_ip TEXT,
+  path TEXT
+);
+select create_hypertable('apiguard_reputation_monitoring', 'time');
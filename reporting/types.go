@@ -29,6 +29,10 @@ const ProxyMonitoringTable = "apiguard_proxy_monitoring"
 const TelemetryMonitoringTable = "apiguard_telemetry_monitoring"
 const BackendMonitoringTable = "apiguard_backend_monitoring"
 const AlarmMonitoringTable = "apiguard_alarm_monitoring"
+const ShadowMonitoringTable = "apiguard_shadow_monitoring"
+const GuardAuditTable = "apiguard_guard_audit"
+const BackendConcurrencyTable = "apiguard_backend_concurrency"
+const ReputationMonitoringTable = "apiguard_reputation_monitoring"
 
 const BackendActionTypeQuery = "query"
 const BackendActionTypeLogin = "login"
@@ -221,3 +225,226 @@ func (report *AlarmStatus) MarshalJSON() ([]byte, error) {
 		NumRequests: report.NumRequests,
 	})
 }
+
+// ----
+
+// ShadowDecision describes a request which would have been denied
+// by a guard running in the shadow mode.
+type ShadowDecision struct {
+	Created  time.Time
+	Service  string
+	Status   int
+	Reason   string
+	Rule     string
+	Limit    string
+	ClientID common.UserID
+	ClientIP string
+}
+
+func (sd *ShadowDecision) ToTimescaleDB(tableWriter *hltscl.TableWriter) *hltscl.Entry {
+	return tableWriter.NewEntry(sd.Created).
+		Str("service", sd.Service).
+		Int("status", sd.Status).
+		Str("reason", sd.Reason).
+		Str("rule", sd.Rule).
+		Str("exceeded_limit", sd.Limit).
+		Int("client_id", int(sd.ClientID)).
+		Str("client_ip", sd.ClientIP)
+}
+
+func (sd *ShadowDecision) GetTime() time.Time {
+	return sd.Created
+}
+
+func (sd *ShadowDecision) GetTableName() string {
+	return ShadowMonitoringTable
+}
+
+func (sd *ShadowDecision) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Created  time.Time     `json:"created"`
+		Service  string        `json:"service"`
+		Status   int           `json:"status"`
+		Reason   string        `json:"reason,omitempty"`
+		Rule     string        `json:"rule,omitempty"`
+		Limit    string        `json:"exceededLimit,omitempty"`
+		ClientID common.UserID `json:"clientId"`
+		ClientIP string        `json:"clientIp"`
+	}{
+		Created:  sd.Created,
+		Service:  sd.Service,
+		Status:   sd.Status,
+		Reason:   sd.Reason,
+		Rule:     sd.Rule,
+		Limit:    sd.Limit,
+		ClientID: sd.ClientID,
+		ClientIP: sd.ClientIP,
+	})
+}
+
+// ----
+
+// GuardDenial is an audit record of a request denied by a guard
+type GuardDenial struct {
+	Created    time.Time
+	Service    string
+	Status     int
+	ReasonCode string
+	GuardType  string
+	Rule       string
+	Limit      string
+	ClientID   common.UserID
+	ClientIP   string
+	Method     string
+	Path       string
+}
+
+func (gd *GuardDenial) ToTimescaleDB(tableWriter *hltscl.TableWriter) *hltscl.Entry {
+	return tableWriter.NewEntry(gd.Created).
+		Str("service", gd.Service).
+		Int("status", gd.Status).
+		Str("reason", gd.ReasonCode).
+		Str("guard_type", gd.GuardType).
+		Str("rule", gd.Rule).
+		Str("exceeded_limit", gd.Limit).
+		Int("client_id", int(gd.ClientID)).
+		Str("client_ip", gd.ClientIP).
+		Str("method", gd.Method).
+		Str("path", gd.Path)
+}
+
+func (gd *GuardDenial) GetTime() time.Time {
+	return gd.Created
+}
+
+func (gd *GuardDenial) GetTableName() string {
+	return GuardAuditTable
+}
+
+func (gd *GuardDenial) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Created    time.Time     `json:"created"`
+		Service    string        `json:"service"`
+		Status     int           `json:"status"`
+		ReasonCode string        `json:"reason"`
+		GuardType  string        `json:"guardType,omitempty"`
+		Rule       string        `json:"rule,omitempty"`
+		Limit      string        `json:"exceededLimit,omitempty"`
+		ClientID   common.UserID `json:"clientId"`
+		ClientIP   string        `json:"clientIp"`
+		Method     string        `json:"method"`
+		Path       string        `json:"path"`
+	}{
+		Created:    gd.Created,
+		Service:    gd.Service,
+		Status:     gd.Status,
+		ReasonCode: gd.ReasonCode,
+		GuardType:  gd.GuardType,
+		Rule:       gd.Rule,
+		Limit:      gd.Limit,
+		ClientID:   gd.ClientID,
+		ClientIP:   gd.ClientIP,
+		Method:     gd.Method,
+		Path:       gd.Path,
+	})
+}
+
+// ----
+
+// BackendConcurrency describes the current (possibly adaptive) limit
+// and load of concurrent requests to a backend.
+type BackendConcurrency struct {
+	Created     time.Time
+	Service     string
+	MaxInFlight int
+	Limit       int
+	InFlight    int
+	Queued      int
+	Rejected    int64
+}
+
+func (bc *BackendConcurrency) ToTimescaleDB(tableWriter *hltscl.TableWriter) *hltscl.Entry {
+	return tableWriter.NewEntry(bc.Created).
+		Str("service", bc.Service).
+		Int("max_in_flight", bc.MaxInFlight).
+		Int("current_limit", bc.Limit).
+		Int("in_flight", bc.InFlight).
+		Int("queued", bc.Queued).
+		Int("rejected", int(bc.Rejected))
+}
+
+func (bc *BackendConcurrency) GetTime() time.Time {
+	return bc.Created
+}
+
+func (bc *BackendConcurrency) GetTableName() string {
+	return BackendConcurrencyTable
+}
+
+func (bc *BackendConcurrency) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Created     time.Time `json:"created"`
+		Service     string    `json:"service"`
+		MaxInFlight int       `json:"maxInFlight"`
+		Limit       int       `json:"limit"`
+		InFlight    int       `json:"inFlight"`
+		Queued      int       `json:"queued"`
+		Rejected    int64     `json:"rejected"`
+	}{
+		Created:     bc.Created,
+		Service:     bc.Service,
+		MaxInFlight: bc.MaxInFlight,
+		Limit:       bc.Limit,
+		InFlight:    bc.InFlight,
+		Queued:      bc.Queued,
+		Rejected:    bc.Rejected,
+	})
+}
+
+// ----
+
+// ReputationHit describes a request from an address listed
+// in an IP reputation blocklist.
+type ReputationHit struct {
+	Created  time.Time
+	Service  string
+	List     string
+	Action   string
+	ClientIP string
+	Path     string
+}
+
+func (rh *ReputationHit) ToTimescaleDB(tableWriter *hltscl.TableWriter) *hltscl.Entry {
+	return tableWriter.NewEntry(rh.Created).
+		Str("service", rh.Service).
+		Str("list", rh.List).
+		Str("action", rh.Action).
+		Str("client_ip", rh.ClientIP).
+		Str("path", rh.Path)
+}
+
+func (rh *ReputationHit) GetTime() time.Time {
+	return rh.Created
+}
+
+func (rh *ReputationHit) GetTableName() string {
+	return ReputationMonitoringTable
+}
+
+func (rh *ReputationHit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Created  time.Time `json:"created"`
+		Service  string    `json:"service"`
+		List     string    `json:"list"`
+		Action   string    `json:"action"`
+		ClientIP string    `json:"clientIp"`
+		Path     string    `json:"path"`
+	}{
+		Created:  rh.Created,
+		Service:  rh.Service,
+		List:     rh.List,
+		Action:   rh.Action,
+		ClientIP: rh.ClientIP,
+		Path:     rh.Path,
+	})
+}
@@ -0,0 +1,238 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reputation
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ListStats provides information about a loaded blocklist
+type ListStats struct {
+	Name        string    `json:"name"`
+	Path        string    `json:"path"`
+	NumPrefixes int       `json:"numPrefixes"`
+	NumInvalid  int       `json:"numInvalid"`
+	Modified    time.Time `json:"modified"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+type listState struct {
+	conf       ListConf
+	modTime    time.Time
+	prefixes   []*net.IPNet
+	numInvalid int
+	lastError  error
+}
+
+// parseEntry parses an IP address or a CIDR range
+func parseEntry(value string) (*net.IPNet, error) {
+	if strings.Contains(value, "/") {
+		_, ipNet, err := net.ParseCIDR(value)
+		return ipNet, err
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %s", value)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// parseBlocklist reads IP addresses and ranges from a plain text
+// source (see ListConf.Path for the format). Invalid lines are skipped
+// and just counted.
+func parseBlocklist(src io.Reader) ([]*net.IPNet, int, error) {
+	ans := make([]*net.IPNet, 0, 1000)
+	var numInvalid int
+	scanner := bufio.NewScanner(src)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		ipNet, err := parseEntry(fields[0])
+		if err != nil {
+			numInvalid++
+			continue
+		}
+		ans = append(ans, ipNet)
+	}
+	return ans, numInvalid, scanner.Err()
+}
+
+// Blocklists keeps IP reputation blocklists loaded from files
+// and provides fast lookups of client addresses. The files are
+// periodically checked for changes and reloaded (see Run).
+// In case a file cannot be loaded, the previously loaded data
+// of the list are kept.
+type Blocklists struct {
+	refreshInterval time.Duration
+	lists           []*listState
+	listsMu         sync.Mutex
+	index           atomic.Pointer[prefixSet]
+}
+
+// Lookup tests whether the ip is listed in any of the blocklists.
+// If so, the name of the (first) list containing the ip is returned.
+func (bl *Blocklists) Lookup(ip net.IP) (string, bool) {
+	if bl == nil || ip == nil {
+		return "", false
+	}
+	idx := bl.index.Load()
+	if idx == nil {
+		return "", false
+	}
+	return idx.lookup(ip)
+}
+
+func (bl *Blocklists) loadList(lst *listState) (bool, error) {
+	info, err := os.Stat(lst.conf.Path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(lst.modTime) {
+		return false, nil
+	}
+	f, err := os.Open(lst.conf.Path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	prefixes, numInvalid, err := parseBlocklist(f)
+	if err != nil {
+		return false, err
+	}
+	lst.modTime = info.ModTime()
+	lst.prefixes = prefixes
+	lst.numInvalid = numInvalid
+	return true, nil
+}
+
+// Reload loads all the lists changed since the last load
+// and rebuilds the lookup index if needed.
+func (bl *Blocklists) Reload() {
+	bl.listsMu.Lock()
+	defer bl.listsMu.Unlock()
+	var changed bool
+	for _, lst := range bl.lists {
+		ok, err := bl.loadList(lst)
+		lst.lastError = err
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("list", lst.conf.Name).
+				Str("path", lst.conf.Path).
+				Msg("failed to load IP reputation blocklist, keeping previous data")
+			continue
+		}
+		if ok {
+			log.Info().
+				Str("list", lst.conf.Name).
+				Int("numPrefixes", len(lst.prefixes)).
+				Int("numInvalid", lst.numInvalid).
+				Msg("loaded IP reputation blocklist")
+			changed = true
+		}
+	}
+	if changed || bl.index.Load() == nil {
+		idx := newPrefixSet()
+		for _, lst := range bl.lists {
+			for _, ipNet := range lst.prefixes {
+				idx.insert(ipNet, lst.conf.Name)
+			}
+		}
+		bl.index.Store(idx)
+	}
+}
+
+// Stats returns information about all the configured lists
+func (bl *Blocklists) Stats() []ListStats {
+	if bl == nil {
+		return []ListStats{}
+	}
+	bl.listsMu.Lock()
+	defer bl.listsMu.Unlock()
+	ans := make([]ListStats, len(bl.lists))
+	for i, lst := range bl.lists {
+		ans[i] = ListStats{
+			Name:        lst.conf.Name,
+			Path:        lst.conf.Path,
+			NumPrefixes: len(lst.prefixes),
+			NumInvalid:  lst.numInvalid,
+			Modified:    lst.modTime,
+		}
+		if lst.lastError != nil {
+			ans[i].LastError = lst.lastError.Error()
+		}
+	}
+	return ans
+}
+
+// Run periodically reloads changed blocklists. The method
+// blocks until the context is cancelled.
+func (bl *Blocklists) Run(ctx context.Context) {
+	if bl == nil {
+		return
+	}
+	ticker := time.NewTicker(bl.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("stopping IP reputation blocklists refresh")
+			return
+		case <-ticker.C:
+			bl.Reload()
+		}
+	}
+}
+
+// NewBlocklists creates a new Blocklists instance and loads
+// the configured lists. For nil conf, nil is returned (which is
+// a valid value always reporting addresses as not listed).
+func NewBlocklists(conf *Conf) *Blocklists {
+	if conf == nil {
+		return nil
+	}
+	ans := &Blocklists{
+		refreshInterval: time.Duration(conf.RefreshIntervalSecs) * time.Second,
+		lists:           make([]*listState, len(conf.Lists)),
+	}
+	for i, lst := range conf.Lists {
+		ans.lists[i] = &listState{conf: lst}
+	}
+	ans.Reload()
+	return ans
+}
@@ -0,0 +1,171 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reputation
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBlocklistFireHOL(t *testing.T) {
+	f, err := os.Open("testdata/firehol_level1.netset")
+	assert.NoError(t, err)
+	defer f.Close()
+	prefixes, numInvalid, err := parseBlocklist(f)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, numInvalid)
+	if assert.Len(t, prefixes, 4) {
+		assert.Equal(t, "0.0.0.0/8", prefixes[0].String())
+		assert.Equal(t, "198.51.100.17/32", prefixes[3].String())
+	}
+}
+
+func TestParseBlocklistSpamhausDROP(t *testing.T) {
+	f, err := os.Open("testdata/spamhaus_drop.txt")
+	assert.NoError(t, err)
+	defer f.Close()
+	prefixes, numInvalid, err := parseBlocklist(f)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, numInvalid)
+	if assert.Len(t, prefixes, 3) {
+		assert.Equal(t, "1.10.16.0/20", prefixes[0].String())
+		assert.Equal(t, "2001:db8:dead::/48", prefixes[2].String())
+	}
+}
+
+func TestParseBlocklistSingleIPv6(t *testing.T) {
+	prefixes, numInvalid, err := parseBlocklist(strings.NewReader("2001:db8::1\n\n  # comment\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, numInvalid)
+	if assert.Len(t, prefixes, 1) {
+		assert.Equal(t, "2001:db8::1/128", prefixes[0].String())
+	}
+}
+
+func newFixtureBlocklists() *Blocklists {
+	return NewBlocklists(&Conf{
+		Lists: []ListConf{
+			{Name: "firehol", Path: "testdata/firehol_level1.netset"},
+			{Name: "drop", Path: "testdata/spamhaus_drop.txt"},
+		},
+		RefreshIntervalSecs: 60,
+	})
+}
+
+func TestBlocklistsLookup(t *testing.T) {
+	bl := newFixtureBlocklists()
+	list, ok := bl.Lookup(net.ParseIP("192.0.2.99"))
+	assert.True(t, ok)
+	assert.Equal(t, "firehol", list)
+
+	list, ok = bl.Lookup(net.ParseIP("203.0.113.5"))
+	assert.True(t, ok)
+	assert.Equal(t, "drop", list)
+
+	list, ok = bl.Lookup(net.ParseIP("2001:db8:dead:1::5"))
+	assert.True(t, ok)
+	assert.Equal(t, "drop", list)
+
+	_, ok = bl.Lookup(net.ParseIP("203.0.113.200"))
+	assert.False(t, ok)
+	_, ok = bl.Lookup(net.ParseIP("198.51.100.18"))
+	assert.False(t, ok)
+	_, ok = bl.Lookup(net.ParseIP("2001:db8:beef::1"))
+	assert.False(t, ok)
+}
+
+func TestBlocklistsLookupFirstListWins(t *testing.T) {
+	bl := newFixtureBlocklists()
+	list, ok := bl.Lookup(net.ParseIP("1.10.20.1"))
+	assert.True(t, ok)
+	assert.Equal(t, "firehol", list)
+}
+
+func TestNilBlocklists(t *testing.T) {
+	var bl *Blocklists
+	assert.Nil(t, NewBlocklists(nil))
+	_, ok := bl.Lookup(net.ParseIP("192.0.2.1"))
+	assert.False(t, ok)
+	assert.Empty(t, bl.Stats())
+}
+
+func TestBlocklistsReloadOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("192.0.2.0/24\n"), 0644))
+	bl := NewBlocklists(&Conf{Lists: []ListConf{{Name: "local", Path: path}}, RefreshIntervalSecs: 60})
+	_, ok := bl.Lookup(net.ParseIP("192.0.2.1"))
+	assert.True(t, ok)
+
+	assert.NoError(t, os.WriteFile(path, []byte("203.0.113.0/24\n"), 0644))
+	future := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(path, future, future))
+	bl.Reload()
+	_, ok = bl.Lookup(net.ParseIP("192.0.2.1"))
+	assert.False(t, ok)
+	_, ok = bl.Lookup(net.ParseIP("203.0.113.1"))
+	assert.True(t, ok)
+}
+
+func TestBlocklistsKeepDataOnMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("192.0.2.0/24\n"), 0644))
+	bl := NewBlocklists(&Conf{Lists: []ListConf{{Name: "local", Path: path}}, RefreshIntervalSecs: 60})
+	assert.NoError(t, os.Remove(path))
+	bl.Reload()
+	_, ok := bl.Lookup(net.ParseIP("192.0.2.1"))
+	assert.True(t, ok)
+	stats := bl.Stats()
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, 1, stats[0].NumPrefixes)
+		assert.NotEmpty(t, stats[0].LastError)
+	}
+}
+
+func TestBlocklistsMissingFileOnStart(t *testing.T) {
+	bl := NewBlocklists(&Conf{
+		Lists:               []ListConf{{Name: "missing", Path: "testdata/nonexistent.txt"}},
+		RefreshIntervalSecs: 60,
+	})
+	_, ok := bl.Lookup(net.ParseIP("192.0.2.1"))
+	assert.False(t, ok)
+}
+
+func TestConfValidateAndDefaults(t *testing.T) {
+	conf := &Conf{Lists: []ListConf{{Name: "a", Path: "a.txt"}}}
+	assert.NoError(t, conf.ValidateAndDefaults("reputation"))
+	assert.Equal(t, dfltRefreshIntervalSecs, conf.RefreshIntervalSecs)
+
+	conf = &Conf{Lists: []ListConf{{Name: "a", Path: "a.txt"}, {Name: "a", Path: "b.txt"}}}
+	assert.Error(t, conf.ValidateAndDefaults("reputation"))
+
+	var nilConf *Conf
+	assert.NoError(t, nilConf.ValidateAndDefaults("reputation"))
+}
+
+func TestServiceConfValidate(t *testing.T) {
+	assert.NoError(t, (&ServiceConf{Action: ActionFlag}).Validate("svc.reputation"))
+	assert.Error(t, (&ServiceConf{Action: ActionDelay}).Validate("svc.reputation"))
+	assert.NoError(t, (&ServiceConf{Action: ActionDelay, DelaySecs: 2}).Validate("svc.reputation"))
+	assert.Error(t, (&ServiceConf{Action: "drop"}).Validate("svc.reputation"))
+}
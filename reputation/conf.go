@@ -0,0 +1,129 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reputation
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltRefreshIntervalSecs = 300
+)
+
+// ListConf describes a single blocklist file
+type ListConf struct {
+
+	// Name identifies the list in logs and reports (e.g. "spamhaus-drop")
+	Name string `json:"name"`
+
+	// Path is a path of a plain text file with one IP address or CIDR
+	// range per line. Comments starting with `#` or `;` are ignored, as well
+	// as anything after the first address on a line (this is compatible
+	// e.g. with FireHOL netsets and Spamhaus DROP lists).
+	Path string `json:"path"`
+}
+
+// Conf configures blocklists shared by all the services.
+// The files are expected to be downloaded by some external
+// tool (e.g. a cron job), APIGuard just reloads them on change.
+type Conf struct {
+	Lists []ListConf `json:"lists"`
+
+	// RefreshIntervalSecs specifies how often the files are checked
+	// for changes
+	RefreshIntervalSecs int `json:"refreshIntervalSecs"`
+}
+
+func (conf *Conf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return nil
+	}
+	if len(conf.Lists) == 0 {
+		return fmt.Errorf("%s.lists must contain at least one list", context)
+	}
+	names := make(map[string]bool)
+	for i, lst := range conf.Lists {
+		if lst.Name == "" {
+			return fmt.Errorf("%s.lists[%d].name is missing/empty", context, i)
+		}
+		if names[lst.Name] {
+			return fmt.Errorf("%s.lists[%d].name `%s` is not unique", context, i, lst.Name)
+		}
+		names[lst.Name] = true
+		if lst.Path == "" {
+			return fmt.Errorf("%s.lists[%d].path is missing/empty", context, i)
+		}
+	}
+	if conf.RefreshIntervalSecs < 0 {
+		return fmt.Errorf("%s.refreshIntervalSecs must be a positive number", context)
+
+	} else if conf.RefreshIntervalSecs == 0 {
+		log.Warn().
+			Int("default", dfltRefreshIntervalSecs).
+			Msgf("%s.refreshIntervalSecs not set, using default", context)
+		conf.RefreshIntervalSecs = dfltRefreshIntervalSecs
+	}
+	return nil
+}
+
+// -------
+
+// Action specifies how a service treats clients found in a blocklist
+type Action string
+
+const (
+	// ActionBlock rejects requests of listed clients
+	ActionBlock Action = "block"
+
+	// ActionDelay delays responses to listed clients
+	ActionDelay Action = "delay"
+
+	// ActionFlag just writes listed clients' requests to the reporting
+	ActionFlag Action = "flag"
+)
+
+func (a Action) Validate() error {
+	if a == ActionBlock || a == ActionDelay || a == ActionFlag {
+		return nil
+	}
+	return fmt.Errorf("invalid reputation action `%s`", a)
+}
+
+// ServiceConf configures how a service uses the blocklists
+type ServiceConf struct {
+	Action Action `json:"action"`
+
+	// DelaySecs specifies a delay added to responses
+	// in case of ActionDelay
+	DelaySecs float64 `json:"delaySecs"`
+}
+
+func (conf *ServiceConf) Validate(context string) error {
+	if conf == nil {
+		return nil
+	}
+	if err := conf.Action.Validate(); err != nil {
+		return fmt.Errorf("%s.action is invalid: %w", context, err)
+	}
+	if conf.Action == ActionDelay && conf.DelaySecs <= 0 {
+		return fmt.Errorf("%s.delaySecs must be a positive number for the `delay` action", context)
+	}
+	return nil
+}
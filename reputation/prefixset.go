@@ -0,0 +1,106 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reputation
+
+import (
+	"net"
+)
+
+type prefixNode struct {
+	children [2]*prefixNode
+
+	// list specifies a name of a blocklist containing the prefix
+	// represented by the node (empty string = not listed)
+	list string
+}
+
+// prefixSet is a binary prefix tree of listed IP addresses and ranges
+// (it works the same way as the IP ban index in tstorage). The set
+// is immutable once built - a reload creates a new one.
+type prefixSet struct {
+	v4   *prefixNode
+	v6   *prefixNode
+	size int
+}
+
+func bitAt(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+// insert adds a prefix to the set. In case the prefix is already
+// present (e.g. from another list), the original list is kept.
+func (set *prefixSet) insert(ipNet *net.IPNet, list string) {
+	var node *prefixNode
+	var ip net.IP
+	ones, bits := ipNet.Mask.Size()
+	if ip4 := ipNet.IP.To4(); ip4 != nil && (bits == 32 || ones >= 96) {
+		node, ip = set.v4, ip4
+		if bits == 128 {
+			ones -= 96
+		}
+
+	} else if ip16 := ipNet.IP.To16(); ip16 != nil && bits == 128 {
+		node, ip = set.v6, ip16
+
+	} else {
+		return
+	}
+	for i := 0; i < ones; i++ {
+		b := bitAt(ip, i)
+		if node.children[b] == nil {
+			node.children[b] = &prefixNode{}
+		}
+		node = node.children[b]
+	}
+	if node.list == "" {
+		node.list = list
+	}
+	set.size++
+}
+
+// lookup finds a list containing the ip (either directly
+// or as a part of a range)
+func (set *prefixSet) lookup(ip net.IP) (string, bool) {
+	node := set.v6
+	if ip4 := ip.To4(); ip4 != nil {
+		node, ip = set.v4, ip4
+
+	} else {
+		ip = ip.To16()
+	}
+	if ip == nil {
+		return "", false
+	}
+	for i := 0; node != nil; i++ {
+		if node.list != "" {
+			return node.list, true
+		}
+		if i == len(ip)*8 {
+			break
+		}
+		node = node.children[bitAt(ip, i)]
+	}
+	return "", false
+}
+
+func newPrefixSet() *prefixSet {
+	return &prefixSet{
+		v4: &prefixNode{},
+		v6: &prefixNode{},
+	}
+}
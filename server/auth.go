@@ -67,6 +67,13 @@ func isKnownProxy(conf *config.Configuration, ip string) bool {
 	return false
 }
 
+// ForbiddenWithoutAuth rejects all the requests. It is used for actions
+// which must not be available in case no authentication is configured.
+func ForbiddenWithoutAuth(ctx *gin.Context) {
+	ctx.AbortWithStatusJSON(
+		http.StatusForbidden, gin.H{"error": "action not available without configured authentication"})
+}
+
 func AuthRequired(conf *config.Configuration) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		remoteIP, _, err := net.SplitHostPort(ctx.Request.RemoteAddr)
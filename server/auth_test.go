@@ -0,0 +1,81 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard/config"
+	"github.com/czcorpus/apiguard/globctx"
+	"github.com/czcorpus/apiguard/guard/token"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAdminTestEngine(conf *config.Configuration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	globalCtx := globctx.NewGlobalContext(context.Background())
+	globalCtx.TimezoneLocation = time.UTC
+	engine := gin.New()
+	initAdminRoutes(conf, globalCtx, nil, token.NewRegistry(), engine)
+	return engine
+}
+
+func TestAdminMutationsForbiddenWithoutAuth(t *testing.T) {
+	engine := newAdminTestEngine(&config.Configuration{})
+	for _, tt := range []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/admin/bans/192.168.1.10"},
+		{http.MethodDelete, "/admin/bans/192.168.1.0/24"},
+		{http.MethodPost, "/admin/userBans/42"},
+		{http.MethodDelete, "/admin/userBans/42"},
+		{http.MethodGet, "/admin/tokens/1/mquery"},
+		{http.MethodPost, "/admin/tokens/1/mquery"},
+		{http.MethodDelete, "/admin/tokens/1/mquery/abc"},
+	} {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		assert.Equal(t, http.StatusForbidden, w.Code, "%s %s", tt.method, tt.path)
+	}
+}
+
+func TestAdminMutationsRequireToken(t *testing.T) {
+	engine := newAdminTestEngine(&config.Configuration{
+		ServerHost: "127.0.0.1",
+		Auth:       &config.AuthConf{TokenHeaderName: "X-Api-Key", Tokens: []string{"secret"}},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/admin/tokens/1/mquery", nil)
+	req.RemoteAddr = "192.168.1.10:4000"
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/tokens/1/mquery", nil)
+	req.RemoteAddr = "192.168.1.10:4000"
+	req.Header.Set("X-Api-Key", "secret")
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	// authorized, the service just does not exist
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,283 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/czcorpus/apiguard/cnc"
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/config"
+	"github.com/czcorpus/apiguard/globctx"
+	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/apiguard/telemetry"
+	"github.com/czcorpus/cnc-gokit/datetime"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	dfltBansListingMaxAgeDays = 7
+	dfltUserBanDuration       = 24 * time.Hour
+)
+
+// parseBannedIP parses a single IP address or a CIDR range.
+// Leading slash (added by a catch-all route parameter) is ignored.
+func parseBannedIP(value string) (*net.IPNet, error) {
+	return telemetry.ParseIPBanTarget(strings.TrimPrefix(value, "/"))
+}
+
+// RunBan bans an IP address or a CIDR range for conf.IPBanTTLSecs
+// (which can be overridden by the -ban-duration option)
+func RunBan(conf *config.Configuration, ipValue string) error {
+	ip, err := parseBannedIP(ipValue)
+	if err != nil {
+		return err
+	}
+	if conf.CNCDB == nil {
+		return fmt.Errorf("failed to ban IP: no database configured (cncDb)")
+	}
+	db := openCNCDatabase(conf.CNCDB)
+	defer db.Close()
+	if err := guard.InsertIPBan(db, ip, conf.IPBanTTLSecs, guard.IPBanSourceCLI, conf.TimezoneLocation()); err != nil {
+		return fmt.Errorf("failed to ban IP: %w", err)
+	}
+	fmt.Printf(
+		"banned %s for %s\n", telemetry.IPBanKey(ip), time.Duration(conf.IPBanTTLSecs)*time.Second)
+	return nil
+}
+
+// RunUnban lifts an active ban of an IP address or a CIDR range
+func RunUnban(conf *config.Configuration, ipValue string) error {
+	ip, err := parseBannedIP(ipValue)
+	if err != nil {
+		return err
+	}
+	if conf.CNCDB == nil {
+		return fmt.Errorf("failed to unban IP: no database configured (cncDb)")
+	}
+	db := openCNCDatabase(conf.CNCDB)
+	defer db.Close()
+	if err := guard.RemoveIPBan(db, ip, conf.TimezoneLocation()); err != nil {
+		return fmt.Errorf("failed to unban IP: %w", err)
+	}
+	fmt.Printf("ban of %s lifted\n", telemetry.IPBanKey(ip))
+	return nil
+}
+
+// PrintBans writes active bans and bans expired within
+// the last maxAgeDays days to stdout.
+func PrintBans(conf *config.Configuration, maxAgeDays int, asJSON bool) error {
+	if conf.CNCDB == nil {
+		return fmt.Errorf("failed to list bans: no database configured (cncDb)")
+	}
+	if maxAgeDays <= 0 {
+		maxAgeDays = dfltBansListingMaxAgeDays
+	}
+	db := openCNCDatabase(conf.CNCDB)
+	defer db.Close()
+	loc := conf.TimezoneLocation()
+	since := time.Now().In(loc).AddDate(0, 0, -maxAgeDays)
+	bans, err := guard.ListIPBans(db, since, loc)
+	if err != nil {
+		return fmt.Errorf("failed to list bans: %w", err)
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(bans)
+	}
+	fmt.Printf("IP bans active or expired within the last %d days:\n", maxAgeDays)
+	if len(bans) == 0 {
+		fmt.Println("\t-")
+	}
+	for _, ban := range bans {
+		state := "expired"
+		if ban.Active {
+			state = "ACTIVE"
+		}
+		source := ban.Source
+		if source == "" {
+			source = "-"
+		}
+		fmt.Printf(
+			"\t%s: %s, %s - %s, source: %s\n",
+			ban.ClientIP, state, ban.Start.Format(statusTimeFormat),
+			ban.End.Format(statusTimeFormat), source,
+		)
+	}
+	return nil
+}
+
+// ---------------- admin actions
+
+type banActions struct {
+	conf      *config.Configuration
+	globalCtx *globctx.Context
+}
+
+// Ban bans an IP address or a CIDR range (e.g. /admin/bans/10.0.0.0/24).
+// The ban duration can be specified
+// via the `duration` query argument (e.g. 90s, 2d, 8h30m).
+// Otherwise, the configured IPBanTTLSecs is used.
+func (a *banActions) Ban(ctx *gin.Context) {
+	ip, err := parseBannedIP(ctx.Param("ip"))
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	if a.globalCtx.CNCDB == nil {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("no database configured"), http.StatusServiceUnavailable)
+		return
+	}
+	ttl := a.conf.IPBanTTLSecs
+	queryValue := ctx.Request.URL.Query().Get("duration")
+	if queryValue != "" {
+		duration, err := datetime.ParseDuration(queryValue)
+		if err != nil {
+			uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+			return
+		}
+		ttl = int(duration.Seconds())
+	}
+	err = guard.InsertIPBan(
+		a.globalCtx.CNCDB, ip, ttl, guard.IPBanSourceAdminAPI, a.globalCtx.TimezoneLocation)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusConflict)
+		return
+	}
+	if err := a.globalCtx.TelemetryDB.RefreshIPBans(); err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	ban, err := a.globalCtx.TelemetryDB.FindIPBan(ip.IP)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, ban)
+}
+
+// Unban lifts an active ban of an IP address or a CIDR range
+func (a *banActions) Unban(ctx *gin.Context) {
+	ip, err := parseBannedIP(ctx.Param("ip"))
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	if a.globalCtx.CNCDB == nil {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("no database configured"), http.StatusServiceUnavailable)
+		return
+	}
+	err = guard.RemoveIPBan(a.globalCtx.CNCDB, ip, a.globalCtx.TimezoneLocation)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusNotFound)
+		return
+	}
+	if err := a.globalCtx.TelemetryDB.RefreshIPBans(); err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, map[string]any{"ok": true})
+}
+
+func parseUserID(value string) (common.UserID, error) {
+	id, err := strconv.Atoi(value)
+	if err != nil || !common.UserID(id).IsValid() {
+		return common.InvalidUserID, fmt.Errorf("invalid user ID `%s`", value)
+	}
+	return common.UserID(id), nil
+}
+
+// ListUserBans lists active bans of registered users
+func (a *banActions) ListUserBans(ctx *gin.Context) {
+	bans, err := a.globalCtx.UserBans.ListActive()
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, map[string]any{"bans": bans})
+}
+
+// BanUser bans a registered user (e.g. /admin/userBans/1234).
+// The ban duration can be specified via the `duration` query argument
+// (24 hours by default) and the ban can be linked with an alarm report
+// via the `reportId` query argument.
+func (a *banActions) BanUser(ctx *gin.Context) {
+	userID, err := parseUserID(ctx.Param("userId"))
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	duration := dfltUserBanDuration
+	queryValue := ctx.Request.URL.Query().Get("duration")
+	if queryValue != "" {
+		duration, err = datetime.ParseDuration(queryValue)
+		if err != nil {
+			uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+			return
+		}
+	}
+	ban, err := a.globalCtx.UserBans.Insert(userID, ctx.Query("reportId"), duration)
+	if errors.Is(err, cnc.ErrUserAlreadyBanned) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusConflict)
+		return
+
+	} else if errors.Is(err, cnc.ErrNoDatabaseForBans) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusServiceUnavailable)
+		return
+
+	} else if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, ban)
+}
+
+// UnbanUser lifts active bans of a registered user
+func (a *banActions) UnbanUser(ctx *gin.Context) {
+	userID, err := parseUserID(ctx.Param("userId"))
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	err = a.globalCtx.UserBans.Remove(userID)
+	if errors.Is(err, cnc.ErrUserBanNotFound) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusNotFound)
+		return
+
+	} else if errors.Is(err, cnc.ErrNoDatabaseForBans) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusServiceUnavailable)
+		return
+
+	} else if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, map[string]any{"ok": true})
+}
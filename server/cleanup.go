@@ -0,0 +1,119 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/czcorpus/apiguard/config"
+	"github.com/czcorpus/apiguard/globctx"
+	"github.com/czcorpus/apiguard/monitoring"
+	"github.com/czcorpus/apiguard/telemetry"
+	"github.com/czcorpus/apiguard/tstorage"
+	"github.com/rs/zerolog/log"
+)
+
+type cleanupResult struct {
+	telemetry.CleanupStats
+	AlarmReports int `json:"alarmReports"`
+}
+
+// RunCleanup removes old delay log records, client actions, expired
+// IP bans and reviewed alarm reports stored by a stopped instance.
+// In case maxAgeDays is zero, monitoring.delayLogCleanupMaxAgeDays is used.
+func RunCleanup(conf *config.Configuration, maxAgeDays int, asJSON bool) error {
+	if maxAgeDays <= 0 {
+		maxAgeDays = conf.Monitoring.DelayLogCleanupMaxAgeDays
+	}
+	loc := conf.TimezoneLocation()
+	db := openCNCDatabase(conf.CNCDB)
+	if db != nil {
+		defer db.Close()
+	}
+	storage := tstorage.Open(db, loc)
+	maxAge := time.Duration(maxAgeDays) * 24 * time.Hour
+
+	var ans cleanupResult
+	var err error
+	ans.CleanupStats, err = storage.CleanupOldRecords(
+		time.Now().In(loc).Add(-maxAge), conf.Monitoring.RetentionBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to clean up old records: %w", err)
+	}
+	ans.AlarmReports, err = monitoring.CompactStoredReports(conf.Monitoring, loc, maxAge)
+	if err != nil {
+		return fmt.Errorf("failed to clean up old records: %w", err)
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ans)
+	}
+	fmt.Printf("removed records older than %d days:\n", maxAgeDays)
+	fmt.Printf("\tdelay log: %d\n", ans.DelayLog)
+	fmt.Printf("\tclient actions: %d\n", ans.ClientActions)
+	fmt.Printf("\texpired IP bans: %d\n", ans.IPBans)
+	fmt.Printf("\talarm reports (saved state): %d\n", ans.AlarmReports)
+	return nil
+}
+
+// runRetention periodically removes old records (see RunCleanup).
+// Alarm reports are compacted directly in the running AlarmTicker.
+func runRetention(
+	ctx context.Context,
+	conf *config.Configuration,
+	globalCtx *globctx.Context,
+	alarm *monitoring.AlarmTicker,
+) {
+	maxAge := time.Duration(conf.Monitoring.DelayLogCleanupMaxAgeDays) * 24 * time.Hour
+	ticker := time.NewTicker(time.Duration(conf.Monitoring.RetentionIntervalSecs) * time.Second)
+	defer ticker.Stop()
+	log.Info().
+		Int("intervalSecs", conf.Monitoring.RetentionIntervalSecs).
+		Int("maxAgeDays", conf.Monitoring.DelayLogCleanupMaxAgeDays).
+		Msg("starting retention job")
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("stopping retention job")
+			return
+		case <-ticker.C:
+			stats, err := globalCtx.TelemetryDB.CleanupOldRecords(
+				time.Now().In(globalCtx.TimezoneLocation).Add(-maxAge),
+				conf.Monitoring.RetentionBatchSize,
+			)
+			if err != nil {
+				log.Error().Err(err).Msg("retention job failed to clean up old records")
+			}
+			reports, err := alarm.CompactReports(ctx, maxAge, false)
+			if err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Msg("retention job failed to compact alarm reports")
+			}
+			log.Info().
+				Int64("delayLog", stats.DelayLog).
+				Int64("clientActions", stats.ClientActions).
+				Int64("ipBans", stats.IPBans).
+				Int("alarmReports", reports.NumDeleted).
+				Msg("retention job removed old records")
+		}
+	}
+}
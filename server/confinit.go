@@ -42,6 +42,7 @@ type CmdOptions struct {
 	BanDurationStr    string
 	IgnoreStoredState bool
 	StreamingMode     bool
+	JSONOutput        bool
 }
 
 func (opts CmdOptions) BanDuration() (time.Duration, error) {
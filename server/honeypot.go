@@ -0,0 +1,226 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/config"
+	"github.com/czcorpus/apiguard/globctx"
+	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/apiguard/logging"
+	"github.com/czcorpus/apiguard/reporting"
+	"github.com/czcorpus/apiguard/telemetry"
+	"github.com/czcorpus/cnc-gokit/datetime"
+	"github.com/czcorpus/cnc-gokit/mail"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltHoneypotBanTTLSecs = 86400
+)
+
+// honeypotTrap bans clients requesting paths no legitimate client
+// should ever access (see config.HoneypotConf). To keep scanners
+// probing many paths at once from hammering the database, already
+// banned addresses (see telemetry.Storage.TestIPBan) and addresses
+// being banned right now are skipped.
+type honeypotTrap struct {
+	conf      *config.Configuration
+	globalCtx *globctx.Context
+	patterns  []*regexp.Regexp
+	banTTL    time.Duration
+	banning   map[string]bool
+	banningMu sync.Mutex
+}
+
+// matchingPattern returns a pattern matching the path
+// or an empty string if there is no such pattern
+func (hp *honeypotTrap) matchingPattern(path string) string {
+	for _, p := range hp.patterns {
+		if p.MatchString(path) {
+			return p.String()
+		}
+	}
+	return ""
+}
+
+func (hp *honeypotTrap) isTrusted(clientIP string) bool {
+	return hp.conf.Auth != nil && isLocalNetwork(hp.conf, clientIP)
+}
+
+// clientIP determines the client's address. Forwarding headers
+// are trusted only for requests coming from known proxies.
+func (hp *honeypotTrap) clientIP(req *http.Request) string {
+	var knownProxies []string
+	if hp.conf.Auth != nil {
+		knownProxies = hp.conf.Auth.KnownProxies
+	}
+	return logging.ExtractTrustedClientIP(req, knownProxies)
+}
+
+// startBanning returns false in case the address
+// is already being banned by another request.
+func (hp *honeypotTrap) startBanning(clientIP string) bool {
+	hp.banningMu.Lock()
+	defer hp.banningMu.Unlock()
+	if hp.banning[clientIP] {
+		return false
+	}
+	hp.banning[clientIP] = true
+	return true
+}
+
+func (hp *honeypotTrap) finishBanning(clientIP string) {
+	hp.banningMu.Lock()
+	defer hp.banningMu.Unlock()
+	delete(hp.banning, clientIP)
+}
+
+func (hp *honeypotTrap) ban(clientIP, path string) {
+	if hp.globalCtx.CNCDB == nil {
+		log.Warn().
+			Str("clientIp", clientIP).
+			Msg("cannot ban client accessing a honeypot path - no database configured")
+		return
+	}
+	target, err := telemetry.ParseIPBanTarget(clientIP)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to ban client accessing a honeypot path")
+		return
+	}
+	if ones, bits := target.Mask.Size(); ones != bits {
+		log.Error().
+			Str("clientIp", clientIP).
+			Msg("failed to ban client accessing a honeypot path - not a single address")
+		return
+	}
+	banned, err := hp.globalCtx.TelemetryDB.TestIPBan(target.IP)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to ban client accessing a honeypot path")
+		return
+	}
+	if banned || !hp.startBanning(clientIP) {
+		return
+	}
+	defer hp.finishBanning(clientIP)
+	banEnd := time.Now().Add(hp.banTTL)
+	err = guard.InsertIPBan(
+		hp.globalCtx.CNCDB,
+		target,
+		int(hp.banTTL.Seconds()),
+		guard.IPBanSourceHoneypot,
+		hp.globalCtx.TimezoneLocation,
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to ban client accessing a honeypot path")
+		return
+	}
+	hp.globalCtx.TelemetryDB.ApplyIPBan(target, banEnd)
+	log.Warn().
+		Str("clientIp", clientIP).
+		Str("path", path).
+		Stringer("duration", hp.banTTL).
+		Msg("banned client accessing a honeypot path")
+	if len(hp.conf.Honeypot.Recipients) > 0 {
+		go hp.sendNotification(clientIP, path)
+	}
+}
+
+func (hp *honeypotTrap) sendNotification(clientIP, path string) {
+	msg := mail.FormattedNotification{
+		Subject: fmt.Sprintf("CNC APIGuard - zablokována IP adresa %s (honeypot)", clientIP),
+		Divs: []string{
+			fmt.Sprintf(
+				"Z IP adresy %s byl zaznamenán přístup na cestu '%s', která slouží jako past (honeypot).<br /> "+
+					"Adresa byla automaticky zablokována na %s.",
+				clientIP, path, datetime.DurationToHMS(hp.banTTL),
+			),
+			"Blokaci lze zrušit přes administrační API (DELETE /admin/bans/[IP]) nebo příkazem `apiguard unban`.",
+		},
+	}
+	msgCnf := hp.conf.Mail.WithRecipients(hp.conf.Honeypot.Recipients...)
+	if err := mail.SendNotification(&msgCnf, hp.globalCtx.TimezoneLocation, msg); err != nil {
+		log.Error().Err(err).Msg("failed to send a honeypot notification e-mail")
+	}
+}
+
+// Handle is a middleware handler which responds with a plain 404
+// to requests of honeypot paths (banning the client) and lets other
+// requests pass.
+func (hp *honeypotTrap) Handle(ctx *gin.Context) {
+	pattern := hp.matchingPattern(ctx.Request.URL.Path)
+	if pattern == "" {
+		ctx.Next()
+		return
+	}
+	clientIP := hp.clientIP(ctx.Request)
+	if hp.isTrusted(clientIP) {
+		ctx.Next()
+		return
+	}
+	hp.globalCtx.Audit.Log(&reporting.GuardDenial{
+		Created:    time.Now().In(hp.globalCtx.TimezoneLocation),
+		Status:     http.StatusNotFound,
+		ReasonCode: string(guard.ReasonHoneypot),
+		Rule:       pattern,
+		ClientID:   common.InvalidUserID,
+		ClientIP:   clientIP,
+		Method:     ctx.Request.Method,
+		Path:       ctx.Request.URL.Path,
+	})
+	if clientIP != "" {
+		hp.ban(clientIP, ctx.Request.URL.Path)
+
+	} else {
+		log.Warn().
+			Str("path", ctx.Request.URL.Path).
+			Msg("cannot ban client accessing a honeypot path - unknown client address")
+	}
+	ctx.Data(http.StatusNotFound, "text/plain", []byte("404 page not found"))
+	ctx.Abort()
+}
+
+// newHoneypotTrap creates a new honeypot handler. The configuration
+// is expected to be validated already.
+func newHoneypotTrap(conf *config.Configuration, globalCtx *globctx.Context) *honeypotTrap {
+	ans := &honeypotTrap{
+		conf:      conf,
+		globalCtx: globalCtx,
+		patterns:  make([]*regexp.Regexp, len(conf.Honeypot.PathPatterns)),
+		banning:   make(map[string]bool),
+	}
+	for i, p := range conf.Honeypot.PathPatterns {
+		ans.patterns[i] = regexp.MustCompile(p)
+	}
+	ttl := conf.Honeypot.BanTTLSecs
+	if ttl == 0 {
+		ttl = conf.IPBanTTLSecs
+	}
+	if ttl <= 0 {
+		ttl = dfltHoneypotBanTTLSecs
+	}
+	ans.banTTL = time.Duration(ttl) * time.Second
+	return ans
+}
@@ -0,0 +1,234 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/czcorpus/apiguard/config"
+	"github.com/czcorpus/apiguard/globctx"
+	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/apiguard/tstorage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	honeypotActiveBansQuery = "SELECT ip_address, start_dt, end_dt, source FROM api_ip_ban"
+	honeypotCountBansQuery  = "SELECT COUNT(*) FROM api_ip_ban"
+	honeypotInsertBanQuery  = "INSERT INTO api_ip_ban"
+)
+
+// timeArg matches any time value and stores it
+// so it can be examined later
+type timeArg struct {
+	value *time.Time
+}
+
+func (ta timeArg) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	if ok {
+		*ta.value = t
+	}
+	return ok
+}
+
+func newHoneypotTestEngine(conf *config.Configuration) *gin.Engine {
+	globalCtx := globctx.NewGlobalContext(context.Background())
+	globalCtx.TimezoneLocation = time.UTC
+	return newHoneypotTestEngineWithCtx(conf, globalCtx)
+}
+
+// newHoneypotTestEngineWithDB creates a honeypot engine with
+// a mocked database used both for inserting and testing bans
+func newHoneypotTestEngineWithDB(t *testing.T, conf *config.Configuration) (*gin.Engine, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherFunc(
+		func(expectedSQL, actualSQL string) error {
+			if !strings.Contains(actualSQL, expectedSQL) {
+				return fmt.Errorf("query `%s` does not contain `%s`", actualSQL, expectedSQL)
+			}
+			return nil
+		},
+	)))
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	globalCtx := globctx.NewGlobalContext(context.Background())
+	globalCtx.TimezoneLocation = time.UTC
+	globalCtx.CNCDB = db
+	globalCtx.TelemetryDB = tstorage.NewMySQLStorage(db, time.UTC)
+	return newHoneypotTestEngineWithCtx(conf, globalCtx), mock
+}
+
+// expectBansIndexLoad sets expectation of the initial loading
+// of the (empty) IP bans index
+func expectBansIndexLoad(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(honeypotActiveBansQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"ip_address", "start_dt", "end_dt", "source"}))
+}
+
+// expectHoneypotBan sets expectations of a successful ban of the clientIP.
+// The start and end of the ban are stored to the provided variables.
+// The ban is applied directly to the bans index so no reload is expected.
+func expectHoneypotBan(mock sqlmock.Sqlmock, clientIP string, start, end *time.Time) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(honeypotCountBansQuery).
+		WithArgs(clientIP, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(honeypotInsertBanQuery).
+		WithArgs(clientIP, timeArg{start}, timeArg{end}, guard.IPBanSourceHoneypot).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+}
+
+func newHoneypotTestEngineWithCtx(conf *config.Configuration, globalCtx *globctx.Context) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(newHoneypotTrap(conf, globalCtx).Handle)
+	engine.GET("/service/1/kontext/*path", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "ok")
+	})
+	return engine
+}
+
+func doHoneypotTestRequest(engine *gin.Engine, path, clientIP string) *httptest.ResponseRecorder {
+	return doHoneypotForwardedTestRequest(engine, path, clientIP, "")
+}
+
+func doHoneypotForwardedTestRequest(
+	engine *gin.Engine, path, clientIP, forwardedFor string,
+) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = clientIP + ":50000"
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestHoneypotTrapRespondsNotFound(t *testing.T) {
+	engine := newHoneypotTestEngine(&config.Configuration{
+		Honeypot: &config.HoneypotConf{PathPatterns: []string{"/wp-login\\.php$", "/\\.env$"}},
+	})
+	w := doHoneypotTestRequest(engine, "/service/1/kontext/wp-login.php", "192.0.2.10")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "404 page not found", w.Body.String())
+
+	w = doHoneypotTestRequest(engine, "/service/1/kontext/query", "192.0.2.10")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHoneypotTrapExemptsLocalNetworks(t *testing.T) {
+	engine := newHoneypotTestEngine(&config.Configuration{
+		Honeypot: &config.HoneypotConf{PathPatterns: []string{"/\\.env$"}},
+		Auth:     &config.AuthConf{LocalNetworks: []string{"10.0.0.0/8"}},
+	})
+	w := doHoneypotTestRequest(engine, "/service/1/kontext/.env", "10.1.2.3")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doHoneypotTestRequest(engine, "/service/1/kontext/.env", "192.0.2.10")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHoneypotTrapBanTTL(t *testing.T) {
+	hp := newHoneypotTrap(
+		&config.Configuration{
+			Honeypot:     &config.HoneypotConf{PathPatterns: []string{"/\\.env$"}},
+			IPBanTTLSecs: 3600,
+		},
+		globctx.NewGlobalContext(context.Background()),
+	)
+	assert.Equal(t, time.Hour, hp.banTTL)
+	assert.True(t, hp.startBanning("192.0.2.10"))
+	assert.False(t, hp.startBanning("192.0.2.10"))
+	assert.True(t, hp.startBanning("192.0.2.11"))
+	hp.finishBanning("192.0.2.10")
+	assert.True(t, hp.startBanning("192.0.2.10"))
+}
+
+func TestHoneypotTrapInsertsBan(t *testing.T) {
+	engine, mock := newHoneypotTestEngineWithDB(t, &config.Configuration{
+		Honeypot: &config.HoneypotConf{PathPatterns: []string{"/\\.env$"}, BanTTLSecs: 7200},
+	})
+	var start, end time.Time
+	expectBansIndexLoad(mock)
+	expectHoneypotBan(mock, "192.0.2.10", &start, &end)
+
+	w := doHoneypotTestRequest(engine, "/service/1/kontext/.env", "192.0.2.10")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, 2*time.Hour, end.Sub(start))
+
+	// the bans index already contains the address
+	// so no other database access is expected
+	w = doHoneypotTestRequest(engine, "/service/1/kontext/.env", "192.0.2.10")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHoneypotTrapRetriesFailedBan(t *testing.T) {
+	engine, mock := newHoneypotTestEngineWithDB(t, &config.Configuration{
+		Honeypot: &config.HoneypotConf{PathPatterns: []string{"/\\.env$"}},
+	})
+	expectBansIndexLoad(mock)
+	mock.ExpectBegin().WillReturnError(errors.New("db down"))
+	var start, end time.Time
+	expectHoneypotBan(mock, "192.0.2.10", &start, &end)
+
+	doHoneypotTestRequest(engine, "/service/1/kontext/.env", "192.0.2.10")
+	doHoneypotTestRequest(engine, "/service/1/kontext/.env", "192.0.2.10")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHoneypotTrapIgnoresForgedHeaders(t *testing.T) {
+	engine, mock := newHoneypotTestEngineWithDB(t, &config.Configuration{
+		Honeypot: &config.HoneypotConf{PathPatterns: []string{"/\\.env$"}},
+		Auth: &config.AuthConf{
+			LocalNetworks: []string{"10.0.0.0/8"},
+			KnownProxies:  []string{"10.0.0.1"},
+		},
+	})
+	var start, end time.Time
+	// neither a range nor a local address in a forged header can be used
+	expectBansIndexLoad(mock)
+	expectHoneypotBan(mock, "192.0.2.10", &start, &end)
+	w := doHoneypotForwardedTestRequest(engine, "/service/1/kontext/.env", "192.0.2.10", "0.0.0.0/0")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doHoneypotForwardedTestRequest(engine, "/service/1/kontext/.env", "192.0.2.10", "10.1.2.3")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// a range forwarded by a known proxy is not banned at all
+	w = doHoneypotForwardedTestRequest(engine, "/service/1/kontext/.env", "10.0.0.1", "0.0.0.0/0")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// a client address forwarded by a known proxy is banned
+	expectHoneypotBan(mock, "192.0.2.20", &start, &end)
+	w = doHoneypotForwardedTestRequest(
+		engine, "/service/1/kontext/.env", "10.0.0.1", "10.1.2.3, 192.0.2.20")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
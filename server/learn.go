@@ -0,0 +1,50 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/czcorpus/apiguard/config"
+	"github.com/czcorpus/apiguard/reporting"
+	"github.com/czcorpus/apiguard/telemetry/analyzer"
+	"github.com/czcorpus/apiguard/tstorage"
+)
+
+// RunLearning fits parameters of the configured telemetry analyzer
+// using stored telemetry of clients with the training flag.
+func RunLearning(conf *config.Configuration) error {
+	if conf.Telemetry == nil {
+		return fmt.Errorf("failed to learn: no telemetry configured")
+	}
+	if conf.CNCDB == nil {
+		return fmt.Errorf("failed to learn: no database configured (cncDb)")
+	}
+	db := openCNCDatabase(conf.CNCDB)
+	defer db.Close()
+	botAnalyzer, err := analyzer.New(
+		conf.Telemetry,
+		tstorage.Open(db, conf.TimezoneLocation()),
+		&reporting.NullWriter{},
+		conf.TimezoneLocation(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to learn: %w", err)
+	}
+	return botAnalyzer.Learn()
+}
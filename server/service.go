@@ -25,6 +25,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"syscall"
@@ -35,14 +36,20 @@ import (
 	"github.com/czcorpus/apiguard/config"
 	"github.com/czcorpus/apiguard/globctx"
 	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/apiguard/guard/token"
 	"github.com/czcorpus/apiguard/monitoring"
 	"github.com/czcorpus/apiguard/proxy"
 	"github.com/czcorpus/apiguard/proxy/cache"
 	"github.com/czcorpus/apiguard/proxy/cache/file"
 	"github.com/czcorpus/apiguard/proxy/cache/null"
 	"github.com/czcorpus/apiguard/proxy/cache/redis"
+	"github.com/czcorpus/apiguard/ratelimit"
+	rlRedis "github.com/czcorpus/apiguard/ratelimit/redis"
 	"github.com/czcorpus/apiguard/reporting"
+	"github.com/czcorpus/apiguard/reputation"
 	"github.com/czcorpus/apiguard/srvfactory"
+	"github.com/czcorpus/apiguard/telemetry"
+	"github.com/czcorpus/apiguard/telemetry/analyzer"
 	"github.com/czcorpus/apiguard/tstorage"
 	"github.com/czcorpus/apiguard/wagstream"
 	"github.com/czcorpus/hltscl"
@@ -65,15 +72,23 @@ import (
 	_ "github.com/czcorpus/apiguard/services/backend/wss"
 )
 
+const (
+	quotaCountersFile = "quota-counters.json"
+)
+
 func initProxyEngine(
 	conf *config.Configuration,
 	globalCtx *globctx.Context,
 	alarm *monitoring.AlarmTicker,
+	tokenStores *token.Registry,
 	skipIPFilter bool,
 ) *gin.Engine {
 	engine := gin.New()
 	engine.Use(gin.Recovery())
 	engine.Use(logging.GinMiddleware())
+	if conf.Honeypot != nil {
+		engine.Use(newHoneypotTrap(conf, globalCtx).Handle)
+	}
 	engine.NoMethod(uniresp.NoMethodHandler)
 	engine.NoRoute(uniresp.NotFoundHandler)
 
@@ -109,6 +124,7 @@ func initProxyEngine(
 	apiRoutes.GET("/alarm", alarm.HandleReportListAction)
 	apiRoutes.GET("/alarms/list", alarm.HandleListAction)
 	apiRoutes.POST("/alarms/clean", alarm.HandleCleanAction)
+	apiRoutes.POST("/alarm/:id/confirmation", alarm.HandleReviewAction)
 
 	// ----------------------
 
@@ -143,6 +159,7 @@ func initProxyEngine(
 				common.InvalidUserID,
 				false,
 				reporting.BackendActionTypeQuery,
+				nil,
 			)
 		}()
 		globalCtx.ReportingWriter.Write(&PingReport{
@@ -167,6 +184,7 @@ func initProxyEngine(
 		apiRoutes,
 		conf,
 		alarm,
+		tokenStores,
 	)
 
 	return engine
@@ -191,16 +209,24 @@ func initWagStreamingEngine(
 func initAdminRoutes(
 	conf *config.Configuration,
 	globalCtx *globctx.Context,
+	botAnalyzer guard.BotAnalyzer,
+	tokenStores *token.Registry,
 	engine *gin.Engine,
 ) {
 	adminRoutes := engine.Group("/admin")
 	if conf.Auth != nil {
 		adminRoutes.Use(AuthRequired(conf))
 	}
+	// actions modifying bans and tokens are never available
+	// without authentication
+	protectedRoutes := adminRoutes.Group("")
+	if conf.Auth == nil {
+		protectedRoutes.Use(ForbiddenWithoutAuth)
+	}
 
 	// administration/monitoring actions
 
-	telemetryActions := tstorage.NewActions(globalCtx.TelemetryDB)
+	telemetryActions := tstorage.NewActions(globalCtx.TelemetryDB, botAnalyzer)
 	adminRoutes.POST("/telemetry", telemetryActions.Store)
 
 	adminRoutes.GET("/delayLogsAnalysis", func(ctx *gin.Context) {
@@ -255,6 +281,35 @@ func initAdminRoutes(
 		}
 	})
 
+	bans := &banActions{conf: conf, globalCtx: globalCtx}
+	// note: a catch-all parameter is used as CIDR ranges contain a slash
+	protectedRoutes.POST("/bans/*ip", bans.Ban)
+	protectedRoutes.DELETE("/bans/*ip", bans.Unban)
+	adminRoutes.GET("/userBans", bans.ListUserBans)
+	protectedRoutes.POST("/userBans/:userId", bans.BanUser)
+	protectedRoutes.DELETE("/userBans/:userId", bans.UnbanUser)
+
+	tokens := &tokenActions{stores: tokenStores, location: globalCtx.TimezoneLocation}
+	protectedRoutes.GET("/tokens/:id/:type", tokens.List)
+	protectedRoutes.POST("/tokens/:id/:type", tokens.Issue)
+	protectedRoutes.DELETE("/tokens/:id/:type/:hash", tokens.Revoke)
+
+	adminRoutes.GET("/rateLimiters", func(ctx *gin.Context) {
+		uniresp.WriteJSONResponse(ctx.Writer, globalCtx.RateLimiters.Stats())
+	})
+
+	adminRoutes.GET("/sessionCache", func(ctx *gin.Context) {
+		uniresp.WriteJSONResponse(ctx.Writer, globalCtx.UserSessions.Stats())
+	})
+
+	adminRoutes.GET("/backendLoad", func(ctx *gin.Context) {
+		uniresp.WriteJSONResponse(ctx.Writer, globalCtx.BackendLoad.Stats())
+	})
+
+	adminRoutes.GET("/reputation", func(ctx *gin.Context) {
+		uniresp.WriteJSONResponse(ctx.Writer, globalCtx.Reputation.Stats())
+	})
+
 	adminRoutes.POST("/cleanCache/:id/:type", func(ctx *gin.Context) {
 		tag := fmt.Sprintf("%s/%s", ctx.Param("id"), ctx.Param("type"))
 		count, err := globalCtx.Cache.Flush(tag)
@@ -315,6 +370,10 @@ func CreateGlobalCtx(
 	tDBWriter.AddTableWriter(reporting.BackendMonitoringTable)
 	tDBWriter.AddTableWriter(reporting.ProxyMonitoringTable)
 	tDBWriter.AddTableWriter(reporting.TelemetryMonitoringTable)
+	tDBWriter.AddTableWriter(reporting.ShadowMonitoringTable)
+	tDBWriter.AddTableWriter(reporting.GuardAuditTable)
+	tDBWriter.AddTableWriter(reporting.BackendConcurrencyTable)
+	tDBWriter.AddTableWriter(reporting.ReputationMonitoringTable)
 
 	cncdb := openCNCDatabase(conf.CNCDB)
 
@@ -355,8 +414,41 @@ func CreateGlobalCtx(
 	if err != nil {
 		return nil, fmt.Errorf("failed to create global ctx: %w", err)
 	}
+	ans.Audit, err = globctx.NewAuditLogger(tDBWriter, conf.AuditLogPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create global ctx: %w", err)
+	}
 	ans.CNCDB = cncdb
+	ans.UserBans = cnc.NewUserBans(cncdb, ans.TimezoneLocation)
+	if cncdb != nil && conf.CNCAuth.SessionCache != nil {
+		ans.UserSessions = cnc.NewSessionCache(conf.CNCAuth.SessionCache)
+		log.Info().
+			Int("maxEntries", conf.CNCAuth.SessionCache.MaxEntries).
+			Msg("using cache for user session lookups")
+	}
 	ans.Cache = cacheBackend
+	ans.BackendLoad = proxy.NewBackendLoadRegistry(tDBWriter, ans.TimezoneLocation)
+	ans.Reputation = reputation.NewBlocklists(conf.Reputation)
+	if conf.Auth != nil {
+		ans.KnownProxies = conf.Auth.KnownProxies
+	}
+	if conf.RateLimiting.Backend == ratelimit.BackendRedis {
+		ans.RateLimiters = rlRedis.New(conf.Cache, conf.RateLimiting)
+		log.Info().
+			Str("addr", conf.Cache.RedisAddr).
+			Bool("failOpen", conf.RateLimiting.RedisFailOpen).
+			Msg("using Redis-based rate limiting")
+
+	} else {
+		ans.RateLimiters = ratelimit.NewRegistry(conf.RateLimiting)
+	}
+	ans.Quotas = ratelimit.NewQuotaStore(
+		filepath.Join(conf.Monitoring.StatusDataDir, quotaCountersFile),
+		ans.TimezoneLocation,
+	)
+	if err := ans.Quotas.Load(); err != nil {
+		return nil, fmt.Errorf("failed to create global ctx: %w", err)
+	}
 	if conf.CNCDB == nil {
 		ans.AnonymousUserIDs = common.AnonymousUsers{}
 	} else {
@@ -365,6 +457,8 @@ func CreateGlobalCtx(
 
 	// delay stats writer and telemetry analyzer
 	ans.TelemetryDB = tstorage.Open(ans.CNCDB, ans.TimezoneLocation)
+	ans.ClientStats = telemetry.NewClientStatsCache(
+		ans.TelemetryDB, conf.Botwatch.WatchedTimeWindowSecs, ans.TimezoneLocation)
 	return ans, nil
 }
 
@@ -391,6 +485,14 @@ func RunService(conf *config.Configuration) {
 		conf.Monitoring,
 	)
 	go alarm.Run(reloadChan)
+	go globalCtx.RateLimiters.Run(ctx)
+	go globalCtx.Quotas.Run(ctx)
+	go globalCtx.ClientStats.Run(ctx)
+	go globalCtx.BackendLoad.Run(ctx)
+	go globalCtx.Reputation.Run(ctx)
+	if conf.Monitoring.RetentionIntervalSecs > 0 {
+		go runRetention(ctx, conf, globalCtx, alarm)
+	}
 
 	go func() {
 		for evt := range syscallChan {
@@ -403,13 +505,14 @@ func RunService(conf *config.Configuration) {
 	}()
 
 	var engine *gin.Engine
+	tokenStores := token.NewRegistry()
 
 	switch conf.OperationMode {
 	case config.OperationModeProxy:
-		engine = initProxyEngine(conf, globalCtx, alarm, false)
+		engine = initProxyEngine(conf, globalCtx, alarm, tokenStores, false)
 		log.Info().Msg("running in the PROXY mode")
 	case config.OperationModeStreaming:
-		apiEngine := initProxyEngine(conf, globalCtx, alarm, true)
+		apiEngine := initProxyEngine(conf, globalCtx, alarm, tokenStores, true)
 		// note that in streaming mode, caching for individual backend
 		// handlers is set to Null cache and only possible caching
 		// is centralized here
@@ -427,7 +530,17 @@ func RunService(conf *config.Configuration) {
 		return
 	}
 
-	initAdminRoutes(conf, globalCtx, engine)
+	botAnalyzer, err := analyzer.New(
+		conf.Telemetry,
+		globalCtx.TelemetryDB,
+		globalCtx.ReportingWriter,
+		globalCtx.TimezoneLocation,
+	)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to start")
+		return
+	}
+	initAdminRoutes(conf, globalCtx, botAnalyzer, tokenStores, engine)
 
 	log.Info().Msgf("starting to listen at %s:%d", conf.ServerHost, conf.ServerPort)
 	srv := &http.Server{
@@ -468,6 +581,14 @@ func RunService(conf *config.Configuration) {
 		}
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := globalCtx.Quotas.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("QuotaStore shutdown error")
+		}
+	}()
+
 	done := make(chan struct{})
 	go func() {
 		wg.Wait()
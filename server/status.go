@@ -0,0 +1,247 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/config"
+	"github.com/czcorpus/apiguard/globctx"
+	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/apiguard/monitoring"
+	"github.com/czcorpus/apiguard/telemetry"
+	"github.com/czcorpus/apiguard/tstorage"
+	"github.com/czcorpus/cnc-gokit/collections"
+)
+
+const (
+	statusStatsMaxAgeSecs = 86400
+	statusNumRecentDelays = 20
+	statusTimeFormat      = time.RFC3339
+)
+
+type clientStats struct {
+	Stats        *telemetry.IPProcData `json:"stats"`
+	IsSuspicious bool                  `json:"isSuspicious"`
+}
+
+type allowlistEntry struct {
+	Service string        `json:"service"`
+	UserID  common.UserID `json:"userId"`
+}
+
+// ClientStatus contains everything APIGuard knows about a client
+// identified either by its IP address or by its session ID.
+type ClientStatus struct {
+	Client       string                      `json:"client"`
+	IPs          []string                    `json:"ips"`
+	IPBans       []*telemetry.IPBan          `json:"ipBans"`
+	Stats        []clientStats               `json:"stats"`
+	RecentDelays []*telemetry.DelayLogRecord `json:"recentDelays"`
+	Alarms       monitoring.StoredClientInfo `json:"alarms"`
+	Allowlists   []allowlistEntry            `json:"allowlists"`
+}
+
+func (cs *ClientStatus) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "client: %s\n", cs.Client)
+	fmt.Fprintf(w, "IP addresses: %s\n", strings.Join(cs.IPs, ", "))
+
+	fmt.Fprintln(w, "\nactive IP bans:")
+	if len(cs.IPBans) == 0 {
+		fmt.Fprintln(w, "\t-")
+	}
+	for _, ban := range cs.IPBans {
+		fmt.Fprintf(
+			w, "\t%s: since %s, expires %s (in %s)\n",
+			ban.ClientIP, ban.Start.Format(statusTimeFormat), ban.End.Format(statusTimeFormat),
+			time.Until(ban.End).Round(time.Second),
+		)
+	}
+
+	fmt.Fprintln(w, "\nclient stats:")
+	if len(cs.Stats) == 0 {
+		fmt.Fprintln(w, "\t-")
+	}
+	for _, item := range cs.Stats {
+		fmt.Fprintf(
+			w, "\tsession: %s, IP: %s, requests: %d, mean interval: %01.2fs, stdev: %01.2fs, "+
+				"first access: %s, last access: %s, suspicious: %t\n",
+			item.Stats.SessionID, item.Stats.ClientIP, item.Stats.Count, item.Stats.Mean,
+			item.Stats.Stdev(), item.Stats.FirstAccess.Format(statusTimeFormat),
+			item.Stats.LastAccess.Format(statusTimeFormat), item.IsSuspicious,
+		)
+	}
+
+	fmt.Fprintln(w, "\nrecent applied delays:")
+	if len(cs.RecentDelays) == 0 {
+		fmt.Fprintln(w, "\t-")
+	}
+	for _, item := range cs.RecentDelays {
+		userID := "-"
+		if item.UserID != nil {
+			userID = item.UserID.String()
+		}
+		fmt.Fprintf(
+			w, "\t%s: %s, user: %s, delay: %01.2fs\n",
+			item.Created.Format(statusTimeFormat), item.ClientIP, userID, item.Delay,
+		)
+	}
+
+	if cs.Alarms.StateSaved != nil {
+		fmt.Fprintf(
+			w, "\nalarm reports (state saved %s):\n", cs.Alarms.StateSaved.Format(statusTimeFormat))
+
+	} else {
+		fmt.Fprintln(w, "\nalarm reports (no saved state found):")
+	}
+	if len(cs.Alarms.Reports) == 0 {
+		fmt.Fprintln(w, "\t-")
+	}
+	for _, report := range cs.Alarms.Reports {
+		reviewed := "no"
+		if report.IsReviewed() {
+			reviewed = report.Reviewed.Format(statusTimeFormat)
+		}
+		fmt.Fprintf(
+			w, "\t%s: service: %s, IP: %s, user: %s, requests: %d, limit: %s, reviewed: %s\n",
+			report.Created.Format(statusTimeFormat), report.RequestInfo.Service,
+			report.RequestInfo.IP, report.UserID, report.RequestInfo.NumRequests,
+			report.Rules, reviewed,
+		)
+	}
+
+	fmt.Fprintln(w, "\nservice allowlists:")
+	if len(cs.Allowlists) == 0 {
+		fmt.Fprintln(w, "\t-")
+	}
+	for _, item := range cs.Allowlists {
+		fmt.Fprintf(w, "\t%s: user %s\n", item.Service, item.UserID)
+	}
+}
+
+// FindClientStatus collects all the information APIGuard has about
+// a client. The client can be specified either by an IP address
+// or by a session ID.
+func FindClientStatus(conf *config.Configuration, client string) (*ClientStatus, error) {
+	db := openCNCDatabase(conf.CNCDB)
+	if db != nil {
+		defer db.Close()
+	}
+	storage := tstorage.Open(db, conf.TimezoneLocation())
+	ans := &ClientStatus{
+		Client:       client,
+		IPs:          []string{},
+		IPBans:       []*telemetry.IPBan{},
+		Stats:        []clientStats{},
+		RecentDelays: []*telemetry.DelayLogRecord{},
+		Allowlists:   []allowlistEntry{},
+	}
+
+	var stats []*telemetry.IPProcData
+	var err error
+	if net.ParseIP(client) != nil {
+		ans.IPs = append(ans.IPs, client)
+		stats, err = storage.FindClientStats(client, "", statusStatsMaxAgeSecs)
+
+	} else {
+		stats, err = storage.FindClientStats("", client, statusStatsMaxAgeSecs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client status: %w", err)
+	}
+	for _, item := range stats {
+		ans.Stats = append(ans.Stats, clientStats{
+			Stats:        item,
+			IsSuspicious: item.IsSuspicious(&conf.Botwatch),
+		})
+		if !collections.SliceContains(ans.IPs, item.ClientIP) {
+			ans.IPs = append(ans.IPs, item.ClientIP)
+		}
+	}
+
+	for _, ip := range ans.IPs {
+		ban, err := storage.FindIPBan(net.ParseIP(ip))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get client status: %w", err)
+		}
+		if ban != nil {
+			ans.IPBans = append(ans.IPBans, ban)
+		}
+		delays, err := storage.LoadClientDelays(ip, statusNumRecentDelays)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get client status: %w", err)
+		}
+		ans.RecentDelays = append(ans.RecentDelays, delays...)
+	}
+
+	ans.Alarms, err = monitoring.FindStoredClientInfo(
+		conf.Monitoring, conf.TimezoneLocation(), ans.IPs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client status: %w", err)
+	}
+	userIDs := ans.Alarms.UserIDs
+	for _, report := range ans.Alarms.Reports {
+		if !collections.SliceContains(userIDs, report.UserID) {
+			userIDs = append(userIDs, report.UserID)
+		}
+	}
+	for _, item := range ans.RecentDelays {
+		if item.UserID != nil && !collections.SliceContains(userIDs, *item.UserID) {
+			userIDs = append(userIDs, *item.UserID)
+		}
+	}
+
+	userFinder := guard.NewUserFinder(&globctx.Context{CNCDB: db})
+	for i, srv := range conf.Services {
+		serviceKey := fmt.Sprintf("%d/%s", i, srv.Type)
+		allowlist, err := userFinder.GetAllowlistUsers(serviceKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get client status: %w", err)
+		}
+		for _, userID := range userIDs {
+			if userID.IsValid() && collections.SliceContains(allowlist, userID) {
+				ans.Allowlists = append(
+					ans.Allowlists, allowlistEntry{Service: serviceKey, UserID: userID})
+			}
+		}
+	}
+	return ans, nil
+}
+
+// PrintClientStatus writes a status of a client to stdout
+// either as a plain text or as a JSON document.
+func PrintClientStatus(conf *config.Configuration, client string, asJSON bool) error {
+	status, err := FindClientStatus(conf, client)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+	status.WriteText(os.Stdout)
+	return nil
+}
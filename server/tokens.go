@@ -0,0 +1,128 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/guard/token"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/gin-gonic/gin"
+)
+
+type issuedToken struct {
+	Token string          `json:"token"`
+	Conf  token.TokenConf `json:"conf"`
+}
+
+type tokenActions struct {
+	stores   *token.Registry
+	location *time.Location
+}
+
+func (a *tokenActions) findStore(ctx *gin.Context) (token.Store, bool) {
+	serviceKey := fmt.Sprintf("%s/%s", ctx.Param("id"), ctx.Param("type"))
+	store, ok := a.stores.Get(serviceKey)
+	if !ok {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			fmt.Errorf("service %s not found or not guarded by tokens", serviceKey),
+			http.StatusNotFound,
+		)
+	}
+	return store, ok
+}
+
+// List lists all the active tokens of a service. Only hashed
+// values of the tokens are available.
+func (a *tokenActions) List(ctx *gin.Context) {
+	store, ok := a.findStore(ctx)
+	if !ok {
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, map[string]any{"tokens": store.List()})
+}
+
+// Issue generates a new token and adds it to the service's token store.
+// The request body is a token configuration (as used in service
+// configuration) without the `value` which is generated. The raw
+// token value is returned just once in the response.
+func (a *tokenActions) Issue(ctx *gin.Context) {
+	store, ok := a.findStore(ctx)
+	if !ok {
+		return
+	}
+	tk := token.TokenConf{UserID: common.InvalidUserID}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&tk); err != nil {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("invalid token configuration: %w", err), http.StatusBadRequest)
+		return
+	}
+	if !tk.UserID.IsValid() {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("missing or invalid userId"), http.StatusBadRequest)
+		return
+	}
+	rawValue, hashedValue, err := token.GenerateToken()
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	tk.HashedValue = hashedValue
+	if err := tk.Validate("token", a.location); err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	if err := store.Add(tk); errors.Is(err, token.ErrReadOnlyStore) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusConflict)
+		return
+
+	} else if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, issuedToken{Token: rawValue, Conf: tk})
+}
+
+// Revoke removes a token (specified by its hashed value) from
+// the service's token store. The change takes effect immediately.
+func (a *tokenActions) Revoke(ctx *gin.Context) {
+	store, ok := a.findStore(ctx)
+	if !ok {
+		return
+	}
+	err := store.Revoke(ctx.Param("hash"))
+	if errors.Is(err, token.ErrReadOnlyStore) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusConflict)
+		return
+
+	} else if errors.Is(err, token.ErrTokenNotFound) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusNotFound)
+		return
+
+	} else if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, map[string]any{"ok": true})
+}
@@ -26,7 +26,9 @@ import (
 	"github.com/czcorpus/apiguard/guard"
 	iGuard "github.com/czcorpus/apiguard/guard"
 	"github.com/czcorpus/apiguard/guard/dflt"
+	"github.com/czcorpus/apiguard/guard/jwt"
 	"github.com/czcorpus/apiguard/guard/token"
+	"github.com/czcorpus/apiguard/proxy"
 	"github.com/czcorpus/apiguard/services"
 	"github.com/czcorpus/apiguard/services/cnc"
 	"github.com/czcorpus/apiguard/session"
@@ -39,6 +41,65 @@ func init() {
 	srvfactory.RegisterServiceInitializer("frodo", create)
 }
 
+// newGuardFactory creates a factory producing guards supported
+// by the service. Composite guards use the same factory to create
+// their children.
+func newGuardFactory(typedConf *Conf) services.GuardFactory {
+	return func(
+		args services.InitArgs,
+		guardType guard.GuardType,
+		limits []proxy.Limit,
+	) (iGuard.ServiceGuard, error) {
+		switch guardType {
+		case guard.GuardTypeToken:
+			tokens, err := args.TokenStore(
+				fmt.Sprintf("%d/frodo", args.SID), typedConf.TokenStore, typedConf.Tokens)
+			if err != nil {
+				return nil, err
+			}
+			return token.NewGuard(
+				args.Ctx,
+				fmt.Sprintf("%d/frodo", args.SID),
+				fmt.Sprintf("/service/%d/frodo", args.SID),
+				typedConf.TokenHeaderName,
+				limits,
+				tokens,
+				[]string{"/openapi"},
+				nil,
+				args.DelayPolicy(fmt.Sprintf("%d/frodo", args.SID), typedConf.Tarpit),
+			), nil
+		case guard.GuardTypeJWT:
+			jwtGuard, err := jwt.NewGuard(
+				args.Ctx,
+				fmt.Sprintf("%d/frodo", args.SID),
+				fmt.Sprintf("/service/%d/frodo", args.SID),
+				typedConf.JWT,
+				limits,
+				[]string{"/openapi"},
+				nil,
+				args.DelayPolicy(fmt.Sprintf("%d/frodo", args.SID), typedConf.Tarpit),
+			)
+			if err != nil {
+				return nil, err
+			}
+			return jwtGuard, nil
+		case guard.GuardTypeDflt:
+			return dflt.New(
+				args.Ctx,
+				fmt.Sprintf("%d/frodo", args.SID),
+				args.GlobalConf.CNCAuth.SessionCookieName,
+				typedConf.SessionValType,
+				limits,
+				args.DelayPolicy(fmt.Sprintf("%d/frodo", args.SID), typedConf.Tarpit),
+			), nil
+		case guard.GuardTypeComposite:
+			return args.CompositeGuard(typedConf.CompositeGuard, limits, newGuardFactory(typedConf))
+		default:
+			return nil, fmt.Errorf("frodo proxy does not support guard type `%s`", guardType)
+		}
+	}
+}
+
 func create(args services.InitArgs) error {
 	var typedConf Conf
 	if err := json.Unmarshal(args.RawConf, &typedConf); err != nil {
@@ -47,7 +108,7 @@ func create(args services.InitArgs) error {
 	if typedConf.SessionValType == "" {
 		typedConf.SessionValType = session.SessionTypeNone
 	}
-	if err := typedConf.Validate("frodo"); err != nil {
+	if err := typedConf.Validate("frodo", args.GlobalConf.TimezoneLocation()); err != nil {
 		return fmt.Errorf("failed to initialize service %d (frodo): %w", args.SID, err)
 	}
 	var frodoReqCounter chan<- guard.RequestInfo
@@ -58,26 +119,9 @@ func create(args services.InitArgs) error {
 			typedConf.Limits,
 		)
 	}
-	var grd iGuard.ServiceGuard
-	switch typedConf.GuardType {
-	case guard.GuardTypeToken:
-		grd = token.NewGuard(
-			args.Ctx,
-			fmt.Sprintf("/service/%d/frodo", args.SID),
-			typedConf.TokenHeaderName,
-			typedConf.Limits,
-			typedConf.Tokens,
-			[]string{"/openapi"},
-		)
-	case guard.GuardTypeDflt:
-		grd = dflt.New(
-			args.Ctx,
-			args.GlobalConf.CNCAuth.SessionCookieName,
-			typedConf.SessionValType,
-			typedConf.Limits,
-		)
-	default:
-		return fmt.Errorf("frodo proxy does not support guard type `%s`", typedConf.GuardType)
+	grd, err := newGuardFactory(&typedConf)(args, typedConf.GuardType, typedConf.Limits)
+	if err != nil {
+		return fmt.Errorf("failed to initialize service %d (frodo): %w", args.SID, err)
 	}
 
 	frodoActions, err := NewFrodoProxy(
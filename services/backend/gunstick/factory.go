@@ -52,9 +52,11 @@ func create(args services.InitArgs) error {
 	)
 	grd := dflt.New(
 		args.Ctx,
+		fmt.Sprintf("%d/gunstick", args.SID),
 		args.GlobalConf.CNCAuth.SessionCookieName,
 		typedConf.SessionValType,
 		typedConf.Limits,
+		args.DelayPolicy(fmt.Sprintf("%d/gunstick", args.SID), typedConf.Tarpit),
 	)
 	go grd.Run()
 	backendURL, err := url.Parse(typedConf.BackendURL)
@@ -85,6 +87,10 @@ func create(args services.InitArgs) error {
 			IsStreamingMode:            args.GlobalConf.OperationMode == config.OperationModeStreaming,
 			UserIDHeaderName:           typedConf.TrueUserIDHeader,
 			InternalRequestsFlagHeader: typedConf.InternalRequestsFlagHeader,
+			Enforcement:                typedConf.Enforcement,
+			FairQueue:                  typedConf.FairQueue,
+			Costs:                      typedConf.Costs,
+			Reputation:                 typedConf.Reputation,
 		},
 	)
 	args.APIRoutes.Any(
@@ -56,10 +56,12 @@ func create(args services.InitArgs) error {
 	case session.SessionTypeCNC:
 		cncGuard = cncauth.New(
 			args.Ctx,
+			fmt.Sprintf("%d/kontext", args.SID),
 			args.GlobalConf.CNCAuth.SessionCookieName,
 			typedConf.FrontendSessionCookieName,
 			typedConf.SessionValType,
 			typedConf.Limits,
+			args.DelayPolicy(fmt.Sprintf("%d/kontext", args.SID), typedConf.Tarpit),
 		)
 	default:
 		return fmt.Errorf(
@@ -58,9 +58,11 @@ func create(args services.InitArgs) error {
 
 	analyzer := dflt.New(
 		args.Ctx,
+		fmt.Sprintf("%d/kwords", args.SID),
 		args.GlobalConf.CNCAuth.SessionCookieName,
 		typedConf.SessionValType,
 		typedConf.Limits,
+		args.DelayPolicy(fmt.Sprintf("%d/kwords", args.SID), typedConf.Tarpit),
 	)
 	go analyzer.Run()
 	backendURL, err := url.Parse(typedConf.BackendURL)
@@ -93,6 +95,10 @@ func create(args services.InitArgs) error {
 			IsStreamingMode:            args.GlobalConf.OperationMode == config.OperationModeStreaming,
 			UserIDHeaderName:           typedConf.TrueUserIDHeader,
 			InternalRequestsFlagHeader: typedConf.InternalRequestsFlagHeader,
+			Enforcement:                typedConf.Enforcement,
+			FairQueue:                  typedConf.FairQueue,
+			Costs:                      typedConf.Costs,
+			Reputation:                 typedConf.Reputation,
 		},
 	)
 	args.APIRoutes.Any(
@@ -19,8 +19,11 @@ package mquery
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/apiguard/guard/composite"
+	"github.com/czcorpus/apiguard/guard/jwt"
 	"github.com/czcorpus/apiguard/guard/token"
 	"github.com/czcorpus/apiguard/services/cnc"
 )
@@ -30,6 +33,17 @@ type Conf struct {
 	GuardType       guard.GuardType   `json:"guardType"`
 	TokenHeaderName string            `json:"tokenHeaderName"`
 	Tokens          []token.TokenConf `json:"tokens"`
+
+	// TokenStore configures an external store of tokens. If defined,
+	// the Tokens must be empty.
+	TokenStore *token.StoreConf `json:"tokenStore"`
+
+	// JWT configures validation of JWTs for the `jwt` guard type
+	JWT *jwt.Conf `json:"jwt"`
+
+	// CompositeGuard configures child guards for the `composite`
+	// guard type
+	CompositeGuard *composite.Conf `json:"compositeGuard"`
 }
 
 type mergeFreqsArgs struct {
@@ -69,12 +83,40 @@ type speechesArgs struct {
 	RightCtx  int      `json:"rightCtx"`
 }
 
-func (c *Conf) Validate(context string) error {
+// usesGuard tests whether the service uses a guard of the specified
+// type (either directly or within a composite guard)
+func (c *Conf) usesGuard(gt guard.GuardType) bool {
+	return c.GuardType == gt ||
+		c.GuardType == guard.GuardTypeComposite && c.CompositeGuard.Includes(gt)
+}
+
+func (c *Conf) Validate(context string, loc *time.Location) error {
 	if err := c.ProxyConf.Validate(context); err != nil {
 		return err
 	}
-	if c.GuardType == guard.GuardTypeToken && len(c.Tokens) == 0 {
+	if c.GuardType == guard.GuardTypeComposite {
+		if err := c.CompositeGuard.Validate(context + ".compositeGuard"); err != nil {
+			return err
+		}
+	}
+	if c.usesGuard(guard.GuardTypeToken) && len(c.Tokens) == 0 && c.TokenStore == nil {
 		return fmt.Errorf("no tokens defined for token guard - the service won't be accessible")
 	}
+	if len(c.Tokens) > 0 && c.TokenStore != nil {
+		return fmt.Errorf("%s.tokens and %s.tokenStore cannot be used together", context, context)
+	}
+	if err := c.TokenStore.Validate(context + ".tokenStore"); err != nil {
+		return err
+	}
+	if c.usesGuard(guard.GuardTypeJWT) {
+		if err := c.JWT.Validate(context + ".jwt"); err != nil {
+			return err
+		}
+	}
+	for i := range c.Tokens {
+		if err := c.Tokens[i].Validate(fmt.Sprintf("%s.tokens[%d]", context, i), loc); err != nil {
+			return err
+		}
+	}
 	return nil
 }
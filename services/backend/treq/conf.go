@@ -20,6 +20,7 @@ package treq
 import (
 	"fmt"
 
+	"github.com/czcorpus/apiguard/guard"
 	"github.com/czcorpus/apiguard/proxy"
 	"github.com/czcorpus/apiguard/services/cnc"
 
@@ -44,6 +45,27 @@ func (c *Conf) Validate(context string) error {
 	if err := c.SessionValType.Validate(); err != nil {
 		return fmt.Errorf("%s.sessionValType is invalid: %w", context, err)
 	}
+	if c.Enforcement == "" {
+		c.Enforcement = guard.EnforcementEnforce
+
+	} else if err := c.Enforcement.Validate(); err != nil {
+		return fmt.Errorf("%s.enforcement is invalid: %w", context, err)
+	}
+	if c.MaxInFlight < 0 {
+		return fmt.Errorf("%s.maxInFlight must be a non-negative number", context)
+	}
+	if c.QueueTimeoutMs < 0 {
+		return fmt.Errorf("%s.queueTimeoutMs must be a non-negative number", context)
+	}
+	if err := c.AdaptiveConcurrency.Validate(context+".adaptiveConcurrency", c.MaxInFlight); err != nil {
+		return err
+	}
+	if err := c.Costs.Validate(context + ".costs"); err != nil {
+		return err
+	}
+	if err := c.Reputation.Validate(context + ".reputation"); err != nil {
+		return err
+	}
 	if c.NumExamplesPerWord == 0 {
 		log.Warn().
 			Int("default", defaultNumExamplesPerWord).
@@ -60,5 +82,8 @@ func (c *Conf) GetCoreConf() proxy.GeneralProxyConf {
 		ReqTimeoutSecs:      c.ReqTimeoutSecs,
 		IdleConnTimeoutSecs: c.IdleConnTimeoutSecs,
 		Limits:              c.Limits,
+		MaxInFlight:         c.MaxInFlight,
+		QueueTimeoutMs:      c.QueueTimeoutMs,
+		AdaptiveConcurrency: c.AdaptiveConcurrency,
 	}
 }
@@ -45,10 +45,12 @@ func create(args services.InitArgs) error {
 	}
 	cnca := cncauth.New(
 		args.Ctx,
+		fmt.Sprintf("%d/treq", args.SID),
 		args.GlobalConf.CNCAuth.SessionCookieName,
 		typedConf.FrontendSessionCookieName,
 		typedConf.SessionValType,
 		typedConf.Limits,
+		args.DelayPolicy(fmt.Sprintf("%d/treq", args.SID), typedConf.Tarpit),
 	)
 	var treqReqCounter chan<- guard.RequestInfo
 	if len(typedConf.Limits) > 0 {
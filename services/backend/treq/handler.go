@@ -111,6 +111,7 @@ func (tp *TreqProxy) AnyPath(ctx *gin.Context) {
 			*loggedUserID,
 			*indirect,
 			reporting.BackendActionTypeQuery,
+			cnc.GuardReason(ctx),
 		)
 	}(&clientID, &humanID, &internalAPICall, t0)
 
@@ -119,6 +120,7 @@ func (tp *TreqProxy) AnyPath(ctx *gin.Context) {
 		return
 	}
 	reqProps := tp.Guard().EvaluateRequest(ctx.Request, tp.authFallbackCookie)
+	cnc.SetGuardReason(ctx, reqProps.Reason)
 	log.Debug().
 		Str("reqPath", ctx.Request.URL.Path).
 		Any("reqProps", reqProps).
@@ -177,7 +179,7 @@ func (tp *TreqProxy) AnyPath(ctx *gin.Context) {
 	} else if reqProps.ForbidsAccess() {
 		proxy.WriteError(
 			ctx,
-			errors.New(http.StatusText(reqProps.ProposedResponse)),
+			errors.New(reqProps.DenialMessage()),
 			reqProps.ProposedResponse,
 		)
 		return
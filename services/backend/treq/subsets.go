@@ -30,6 +30,7 @@ import (
 	"github.com/czcorpus/apiguard/common"
 	"github.com/czcorpus/apiguard/proxy"
 	"github.com/czcorpus/apiguard/reporting"
+	"github.com/czcorpus/apiguard/services/cnc"
 
 	"github.com/czcorpus/cnc-gokit/uniresp"
 	"github.com/gin-gonic/gin"
@@ -71,6 +72,7 @@ func (tp *TreqProxy) Subsets(ctx *gin.Context) {
 			*loggedUserID,
 			*indirect,
 			reporting.BackendActionTypeQuery,
+			cnc.GuardReason(ctx),
 		)
 	}(&clientID, &humanID, &internalAPICall, t0)
 
@@ -79,6 +81,7 @@ func (tp *TreqProxy) Subsets(ctx *gin.Context) {
 		return
 	}
 	reqProps := tp.Guard().EvaluateRequest(ctx.Request, tp.authFallbackCookie)
+	cnc.SetGuardReason(ctx, reqProps.Reason)
 	log.Debug().
 		Str("reqPath", ctx.Request.URL.Path).
 		Any("reqProps", reqProps).
@@ -140,7 +143,7 @@ func (tp *TreqProxy) Subsets(ctx *gin.Context) {
 	} else if reqProps.ForbidsAccess() {
 		proxy.WriteError(
 			ctx,
-			errors.New(http.StatusText(reqProps.ProposedResponse)),
+			errors.New(reqProps.DenialMessage()),
 			reqProps.ProposedResponse,
 		)
 		return
@@ -172,6 +175,7 @@ func (tp *TreqProxy) Subsets(ctx *gin.Context) {
 			req.Method = "GET"
 			req.Body = io.NopCloser(strings.NewReader(""))
 			serviceResp := tp.ProxyRequest(
+				req.Context(),
 				"/",
 				reqArgs.ToQuery(),
 				req.Method,
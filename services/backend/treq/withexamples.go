@@ -35,6 +35,7 @@ import (
 	"github.com/czcorpus/apiguard/proxy"
 	"github.com/czcorpus/apiguard/reporting"
 	"github.com/czcorpus/apiguard/services/backend"
+	"github.com/czcorpus/apiguard/services/cnc"
 
 	"github.com/czcorpus/cnc-gokit/uniresp"
 	"github.com/czcorpus/cnc-gokit/util"
@@ -159,6 +160,7 @@ func (tp *TreqProxy) WithExamples(ctx *gin.Context) {
 			*loggedUserID,
 			*indirect,
 			reporting.BackendActionTypeQuery,
+			cnc.GuardReason(ctx),
 		)
 	}(&clientID, &humanID, &internalAPICall, t0)
 
@@ -167,6 +169,7 @@ func (tp *TreqProxy) WithExamples(ctx *gin.Context) {
 		return
 	}
 	reqProps := tp.Guard().EvaluateRequest(ctx.Request, tp.authFallbackCookie)
+	cnc.SetGuardReason(ctx, reqProps.Reason)
 	log.Debug().
 		Str("reqPath", ctx.Request.URL.Path).
 		Any("reqProps", reqProps).
@@ -225,7 +228,7 @@ func (tp *TreqProxy) WithExamples(ctx *gin.Context) {
 	} else if reqProps.ForbidsAccess() {
 		proxy.WriteError(
 			ctx,
-			errors.New(http.StatusText(reqProps.ProposedResponse)),
+			errors.New(reqProps.DenialMessage()),
 			reqProps.ProposedResponse,
 		)
 		return
@@ -26,7 +26,9 @@ import (
 	"github.com/czcorpus/apiguard/guard"
 	iGuard "github.com/czcorpus/apiguard/guard"
 	"github.com/czcorpus/apiguard/guard/dflt"
+	"github.com/czcorpus/apiguard/guard/jwt"
 	"github.com/czcorpus/apiguard/guard/token"
+	"github.com/czcorpus/apiguard/proxy"
 	"github.com/czcorpus/apiguard/services"
 	"github.com/czcorpus/apiguard/services/cnc"
 	"github.com/czcorpus/apiguard/srvfactory"
@@ -38,19 +40,80 @@ func init() {
 	srvfactory.RegisterServiceInitializer("wss", create)
 }
 
+// newGuardFactory creates a factory producing guards supported
+// by the service. Composite guards use the same factory to create
+// their children.
+func newGuardFactory(typedConf *Conf) services.GuardFactory {
+	return func(
+		args services.InitArgs,
+		guardType guard.GuardType,
+		limits []proxy.Limit,
+	) (iGuard.ServiceGuard, error) {
+		switch guardType {
+		case guard.GuardTypeToken:
+			tokens, err := args.TokenStore(
+				fmt.Sprintf("%d/wss", args.SID), typedConf.TokenStore, typedConf.Tokens)
+			if err != nil {
+				return nil, err
+			}
+			return token.NewGuard(
+				args.Ctx,
+				fmt.Sprintf("%d/wss", args.SID),
+				fmt.Sprintf("/service/%d/wss", args.SID),
+				typedConf.TokenHeaderName,
+				limits,
+				tokens,
+				[]string{"/openapi"},
+				nil,
+				args.DelayPolicy(fmt.Sprintf("%d/wss", args.SID), typedConf.Tarpit),
+			), nil
+		case guard.GuardTypeJWT:
+			jwtGuard, err := jwt.NewGuard(
+				args.Ctx,
+				fmt.Sprintf("%d/wss", args.SID),
+				fmt.Sprintf("/service/%d/wss", args.SID),
+				typedConf.JWT,
+				limits,
+				[]string{"/openapi"},
+				nil,
+				args.DelayPolicy(fmt.Sprintf("%d/wss", args.SID), typedConf.Tarpit),
+			)
+			if err != nil {
+				return nil, err
+			}
+			return jwtGuard, nil
+		case guard.GuardTypeDflt:
+			return dflt.New(
+				args.Ctx,
+				fmt.Sprintf("%d/wss", args.SID),
+				args.GlobalConf.CNCAuth.SessionCookieName,
+				typedConf.SessionValType,
+				limits,
+				args.DelayPolicy(fmt.Sprintf("%d/wss", args.SID), typedConf.Tarpit),
+			), nil
+		case guard.GuardTypeComposite:
+			return args.CompositeGuard(typedConf.CompositeGuard, limits, newGuardFactory(typedConf))
+		default:
+			return nil, fmt.Errorf("WSS proxy does not support guard type `%s`", guardType)
+		}
+	}
+}
+
 func create(args services.InitArgs) error {
 	var typedConf Conf
 	if err := json.Unmarshal(args.RawConf, &typedConf); err != nil {
 		return fmt.Errorf("failed to initialize service %d (wss): %w", args.SID, err)
 	}
-	if err := typedConf.Validate("wss"); err != nil {
+	if err := typedConf.Validate("wss", args.GlobalConf.TimezoneLocation()); err != nil {
 		return fmt.Errorf("failed to initialize service %d (wss): %w", args.SID, err)
 	}
 	analyzer := dflt.New(
 		args.Ctx,
+		fmt.Sprintf("%d/wss", args.SID),
 		args.GlobalConf.CNCAuth.SessionCookieName,
 		typedConf.SessionValType,
 		typedConf.Limits,
+		args.DelayPolicy(fmt.Sprintf("%d/wss", args.SID), typedConf.Tarpit),
 	)
 	go analyzer.Run()
 
@@ -63,26 +126,9 @@ func create(args services.InitArgs) error {
 		)
 	}
 
-	var grd iGuard.ServiceGuard
-	switch typedConf.GuardType {
-	case guard.GuardTypeToken:
-		grd = token.NewGuard(
-			args.Ctx,
-			fmt.Sprintf("/service/%d/wss", args.SID),
-			typedConf.TokenHeaderName,
-			typedConf.Limits,
-			typedConf.Tokens,
-			[]string{"/openapi"},
-		)
-	case guard.GuardTypeDflt:
-		grd = dflt.New(
-			args.Ctx,
-			args.GlobalConf.CNCAuth.SessionCookieName,
-			typedConf.SessionValType,
-			typedConf.Limits,
-		)
-	default:
-		return fmt.Errorf("WSS proxy does not support guard type `%s`", typedConf.GuardType)
+	grd, err := newGuardFactory(&typedConf)(args, typedConf.GuardType, typedConf.Limits)
+	if err != nil {
+		return fmt.Errorf("failed to initialize service %d (wss): %w", args.SID, err)
 	}
 
 	wssActions, err := NewWSServerProxy(
@@ -29,17 +29,23 @@ import (
 	"github.com/czcorpus/apiguard/proxy/cache"
 	"github.com/czcorpus/apiguard/reporting"
 	"github.com/czcorpus/apiguard/services/backend"
+	"github.com/czcorpus/apiguard/session"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	guardReasonCtxKey = "apiguardGuardReason"
+)
+
 func (kp *Proxy) LogRequest(ctx *gin.Context, currHumanID *common.UserID, internalCall *bool, cached *bool, created time.Time) {
 	if kp.reqCounter != nil {
 		kp.reqCounter <- guard.RequestInfo{
 			Created:     created,
 			Service:     kp.rConf.ServiceKey,
-			NumRequests: 1,
+			NumRequests: kp.conf.Costs.CostOf(ctx.Request),
 			UserID:      *currHumanID,
 			IP:          ctx.ClientIP(),
 		}
@@ -52,9 +58,27 @@ func (kp *Proxy) LogRequest(ctx *gin.Context, currHumanID *common.UserID, intern
 		*currHumanID,
 		*internalCall,
 		reporting.BackendActionTypeQuery,
+		GuardReason(ctx),
 	)
 }
 
+// SetGuardReason stores the reason of a guard decision so it can
+// be written to the backend access log once the request is processed.
+func SetGuardReason(ctx *gin.Context, reason guard.Reason) {
+	ctx.Set(guardReasonCtxKey, reason)
+}
+
+// GuardReason returns a guard decision reason stored via SetGuardReason
+// or nil if there is no such value.
+func GuardReason(ctx *gin.Context) zerolog.LogObjectMarshaler {
+	if v, ok := ctx.Get(guardReasonCtxKey); ok {
+		if reason, ok := v.(guard.Reason); ok && !reason.IsZero() {
+			return reason
+		}
+	}
+	return nil
+}
+
 func (kp *Proxy) MonitoringWrite(item reporting.Timescalable) {
 	kp.tDBWriter.Write(item)
 }
@@ -67,6 +91,16 @@ func (kp *Proxy) reqUsesMappedSession(req *http.Request) bool {
 	return err == nil
 }
 
+// requestSession returns a CNC session of the request. In case
+// a mapped (frontend) session cookie is present, it is preferred.
+func (kp *Proxy) requestSession(req *http.Request) session.HTTPSession {
+	if kp.reqUsesMappedSession(req) {
+		return kp.sessionValFactory().UpdatedFrom(
+			proxy.GetCookieValue(req, kp.conf.FrontendSessionCookieName))
+	}
+	return kp.sessionValFactory().UpdatedFrom(proxy.GetCookieValue(req, kp.rConf.CNCAuthCookie))
+}
+
 func (kp *Proxy) IsRegularAPICall(hd http.Header) bool {
 	return !kp.rConf.IsStreamingMode && kp.conf.InternalRequestsFlagHeader != "" && hd.Get(kp.conf.InternalRequestsFlagHeader) != ""
 }
@@ -125,6 +159,7 @@ func (kp *Proxy) ProcessReqHeaders(
 
 func (kp *Proxy) AuthorizeRequestOrRespondErr(ctx *gin.Context) (guard.ReqEvaluation, bool) {
 	reqProps := kp.guard.EvaluateRequest(ctx.Request, nil)
+	SetGuardReason(ctx, reqProps.Reason)
 	log.Debug().
 		Str("reqPath", ctx.Request.URL.Path).
 		Any("reqProps", reqProps).
@@ -139,7 +174,7 @@ func (kp *Proxy) AuthorizeRequestOrRespondErr(ctx *gin.Context) (guard.ReqEvalua
 		return guard.ReqEvaluation{}, false
 
 	} else if reqProps.ForbidsAccess() {
-		http.Error(ctx.Writer, http.StatusText(reqProps.ProposedResponse), reqProps.ProposedResponse)
+		http.Error(ctx.Writer, reqProps.DenialMessage(), reqProps.ProposedResponse)
 		return guard.ReqEvaluation{}, false
 	}
 	return reqProps, true
@@ -171,6 +206,7 @@ func (kp *Proxy) HandleRequest(
 	}
 	respHandler.HandleCacheMiss(func() proxy.BackendResponse {
 		resp := kp.apiProxy.Request(
+			req.Context(),
 			// TODO use some path builder here
 			path.Join("/", req.URL.Path[len(kp.rConf.ServicePath):]),
 			req.URL.Query(),
@@ -200,6 +236,7 @@ func (kp *Proxy) MakeStreamRequest(
 	)
 	resp.HandleCacheMiss(func() proxy.BackendResponse {
 		return kp.apiProxy.Request(
+			req.Context(),
 			// TODO use some path builder here
 			path.Join("/", req.URL.Path[len(kp.rConf.ServicePath):]),
 			req.URL.Query(),
@@ -243,6 +280,7 @@ func (kp *Proxy) MakeCacheablePOSTRequest(
 	)
 	resp.HandleCacheMiss(func() proxy.BackendResponse {
 		backendResp := kp.apiProxy.Request(
+			req.Context(),
 			// TODO use some path builder here
 			path.Join("/", req.URL.Path[len(kp.rConf.ServicePath):]),
 			req.URL.Query(),
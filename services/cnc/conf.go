@@ -21,8 +21,10 @@ import (
 	"fmt"
 
 	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/apiguard/guard/fairqueue"
 	"github.com/czcorpus/apiguard/monitoring"
 	"github.com/czcorpus/apiguard/proxy"
+	"github.com/czcorpus/apiguard/reputation"
 	"github.com/czcorpus/apiguard/session"
 
 	"github.com/rs/zerolog/log"
@@ -85,6 +87,44 @@ type ProxyConf struct {
 	// CachingPerSession allows for more granular caching (per session)
 	// In case of WaG and similar situations, this should be false
 	CachingPerSession bool `json:"cachingPerSession"`
+
+	// Tarpit configures progressive response delays for clients
+	// approaching the service limits. If nil, no delays are applied.
+	Tarpit *guard.TarpitConf `json:"tarpit"`
+
+	// Enforcement specifies whether guard decisions are applied
+	// ("enforce", the default) or just logged and reported ("shadow").
+	// The shadow mode is intended for tuning of new limits.
+	Enforcement guard.Enforcement `json:"enforcement"`
+
+	// FairQueue configures a queue for requests exceeding rate limits
+	// (with weights favouring registered users). Currently, it is
+	// supported only by public proxies (e.g. kwords).
+	FairQueue *fairqueue.Conf `json:"fairQueue"`
+
+	// MaxInFlight limits the number of concurrent requests APIGuard
+	// sends to the backend. Zero means no limit.
+	MaxInFlight int `json:"maxInFlight"`
+
+	// QueueTimeoutMs specifies how long a request over the MaxInFlight
+	// limit waits for a free slot before it is rejected with
+	// the 503 status. Zero means immediate rejection.
+	QueueTimeoutMs int `json:"queueTimeoutMs"`
+
+	// AdaptiveConcurrency makes the MaxInFlight limit adapt to observed
+	// backend latency (MaxInFlight then works as the upper bound).
+	AdaptiveConcurrency *proxy.AdaptiveLimitConf `json:"adaptiveConcurrency"`
+
+	// Costs specifies how many rate limit tokens particular requests
+	// consume (e.g. frequency distributions are much more expensive
+	// than corpus info). The same costs are used when counting requests
+	// for alarms. Requests matching no rule cost 1.
+	Costs guard.CostRules `json:"costs"`
+
+	// Reputation specifies how the service treats clients listed
+	// in IP reputation blocklists (see the global `reputation` section).
+	// If nil, the blocklists are not consulted.
+	Reputation *reputation.ServiceConf `json:"reputation"`
 }
 
 func (c *ProxyConf) Validate(context string) error {
@@ -101,6 +141,33 @@ func (c *ProxyConf) Validate(context string) error {
 	if c.InternalRequestsFlagHeader == "" {
 		log.Warn().Msg("internalRequestsFlagHeader not set - APIGuard won't be able to report internal API use in logs")
 	}
+	if c.Enforcement == "" {
+		c.Enforcement = guard.EnforcementEnforce
+
+	} else if err := c.Enforcement.Validate(); err != nil {
+		return fmt.Errorf("%s.enforcement is invalid: %w", context, err)
+	}
+	if c.MaxInFlight < 0 {
+		return fmt.Errorf("%s.maxInFlight must be a non-negative number", context)
+	}
+	if c.QueueTimeoutMs < 0 {
+		return fmt.Errorf("%s.queueTimeoutMs must be a non-negative number", context)
+	}
+	if err := c.AdaptiveConcurrency.Validate(context+".adaptiveConcurrency", c.MaxInFlight); err != nil {
+		return err
+	}
+	if err := c.Costs.Validate(context + ".costs"); err != nil {
+		return err
+	}
+	if err := c.Reputation.Validate(context + ".reputation"); err != nil {
+		return err
+	}
+	if err := c.FairQueue.Validate(context + ".fairQueue"); err != nil {
+		return err
+	}
+	if err := c.Tarpit.Validate(context + ".tarpit"); err != nil {
+		return err
+	}
 	for i, limit := range c.Limits {
 		if limit.BurstLimit == 0 {
 			log.Warn().
@@ -123,6 +190,9 @@ func (c *ProxyConf) GetCoreConf() proxy.GeneralProxyConf {
 		ReqTimeoutSecs:      c.ReqTimeoutSecs,
 		IdleConnTimeoutSecs: c.IdleConnTimeoutSecs,
 		Limits:              c.Limits,
+		MaxInFlight:         c.MaxInFlight,
+		QueueTimeoutMs:      c.QueueTimeoutMs,
+		AdaptiveConcurrency: c.AdaptiveConcurrency,
 	}
 }
 
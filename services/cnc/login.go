@@ -193,6 +193,7 @@ func (kp *Proxy) Login(ctx *gin.Context) {
 			*currUserID,
 			true,
 			reporting.BackendActionTypeLogin,
+			nil,
 		)
 	}(&userId)
 
@@ -18,6 +18,7 @@
 package cnc
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -118,7 +119,7 @@ func (kp *Proxy) CountRequest(ctx *gin.Context, created time.Time, serviceKey st
 		kp.reqCounter <- guard.RequestInfo{
 			Created:     created,
 			Service:     serviceKey,
-			NumRequests: 1,
+			NumRequests: kp.conf.Costs.CostOf(ctx.Request),
 			UserID:      userID,
 			IP:          ctx.ClientIP(),
 		}
@@ -126,6 +127,7 @@ func (kp *Proxy) CountRequest(ctx *gin.Context, created time.Time, serviceKey st
 }
 
 func (kp *Proxy) ProxyRequest(
+	ctx context.Context,
 	path string,
 	args url.Values,
 	method string,
@@ -133,6 +135,7 @@ func (kp *Proxy) ProxyRequest(
 	rbody io.Reader,
 ) *proxy.BackendProxiedResponse {
 	return kp.apiProxy.Request(
+		ctx,
 		path,
 		args,
 		method,
@@ -159,10 +162,12 @@ func (kp *Proxy) Preflight(ctx *gin.Context) {
 			*currUserID,
 			true,
 			reporting.BackendActionTypePreflight,
+			GuardReason(ctx),
 		)
 	}(&userId)
 
 	reqProps := kp.guard.EvaluateRequest(ctx.Request, nil)
+	SetGuardReason(ctx, reqProps.Reason)
 	log.Debug().
 		Str("reqPath", ctx.Request.URL.Path).
 		Any("reqProps", reqProps).
@@ -177,7 +182,7 @@ func (kp *Proxy) Preflight(ctx *gin.Context) {
 		return
 
 	} else if reqProps.ProposedResponse >= 400 && reqProps.ProposedResponse < 500 {
-		http.Error(ctx.Writer, http.StatusText(reqProps.ProposedResponse), reqProps.ProposedResponse)
+		http.Error(ctx.Writer, reqProps.DenialMessage(), reqProps.ProposedResponse)
 		return
 	}
 	ctx.Writer.WriteHeader(http.StatusNoContent)
@@ -206,6 +211,12 @@ func (kp *Proxy) AnyPath(ctx *gin.Context) {
 		return
 	}
 
+	var logoutSession session.HTTPSession
+	if kp.globalCtx.UserSessions.IsLogoutPath(ctx.Request.URL.Path) {
+		// we must read the session before cookies are remapped
+		logoutSession = kp.requestSession(ctx.Request)
+	}
+
 	humanID, err := kp.guard.DetermineTrueUserID(ctx.Request)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to extract human user ID information")
@@ -240,6 +251,9 @@ func (kp *Proxy) AnyPath(ctx *gin.Context) {
 	rt0 := time.Now().In(kp.globalCtx.TimezoneLocation)
 	serviceResp := kp.HandleRequest(ctx.Request, reqProps, true)
 	cached = serviceResp.IsCacheHit()
+	if logoutSession != nil && !logoutSession.IsZero() {
+		kp.globalCtx.UserSessions.Invalidate(logoutSession.SrchSelector())
+	}
 	kp.tDBWriter.Write(&reporting.ProxyProcReport{
 		DateTime: time.Now().In(kp.globalCtx.TimezoneLocation),
 		ProcTime: time.Since(rt0).Seconds(),
@@ -302,13 +316,29 @@ func NewProxy(
 	if err != nil {
 		return nil, fmt.Errorf("failed to create CoreProxy: %w", err)
 	}
+	globalCtx.BackendLoad.Register(gConf.ServiceKey, proxy)
+	if conf.FairQueue != nil {
+		log.Warn().
+			Str("serviceKey", gConf.ServiceKey).
+			Msg("fairQueue is supported only by public proxies, ignoring")
+	}
 	return &Proxy{
-		globalCtx:         globalCtx,
-		conf:              conf,
-		rConf:             gConf,
-		frontendHost:      fu.Host,
-		BackendURL:        bu,
-		guard:             grd,
+		globalCtx:    globalCtx,
+		conf:         conf,
+		rConf:        gConf,
+		frontendHost: fu.Host,
+		BackendURL:   bu,
+		guard: guard.WithAudit(
+			globalCtx,
+			gConf.ServiceKey,
+			guard.ApplyEnforcement(
+				globalCtx,
+				gConf.ServiceKey,
+				conf.Enforcement,
+				guard.WithReputation(
+					globalCtx, gConf.ServiceKey, conf.Reputation, guard.WithCosts(conf.Costs, grd)),
+			),
+		),
 		apiProxy:          proxy,
 		reqCounter:        reqCounter,
 		tDBWriter:         globalCtx.ReportingWriter,
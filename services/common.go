@@ -19,11 +19,17 @@ package services
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/czcorpus/apiguard/config"
 	"github.com/czcorpus/apiguard/globctx"
+	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/apiguard/guard/composite"
+	"github.com/czcorpus/apiguard/guard/token"
 	"github.com/czcorpus/apiguard/monitoring"
+	"github.com/czcorpus/apiguard/proxy"
+	"github.com/czcorpus/apiguard/ratelimit"
 	"github.com/gin-gonic/gin"
 )
 
@@ -35,11 +41,71 @@ type VersionInfo struct {
 }
 
 type InitArgs struct {
-	Ctx        *globctx.Context
-	SID        int
-	RawConf    json.RawMessage
-	GlobalConf *config.Configuration
-	APIRoutes  *gin.RouterGroup
-	Engine     http.Handler
-	Alarm      *monitoring.AlarmTicker
+	Ctx         *globctx.Context
+	SID         int
+	RawConf     json.RawMessage
+	GlobalConf  *config.Configuration
+	APIRoutes   *gin.RouterGroup
+	Engine      http.Handler
+	Alarm       *monitoring.AlarmTicker
+	TokenStores *token.Registry
+}
+
+// DelayPolicy creates a response delay policy for a service
+// (a nil tarpit configuration produces a policy with no delays).
+func (args InitArgs) DelayPolicy(serviceKey string, tarpit *guard.TarpitConf) *guard.DelayPolicy {
+	return guard.NewDelayPolicy(
+		serviceKey,
+		tarpit,
+		args.Alarm,
+		args.Ctx.ClientStats,
+		&args.GlobalConf.Botwatch,
+	)
+}
+
+// TokenStore creates a token store for a service guarded by tokens
+// and registers it so the tokens can be managed via the admin API.
+func (args InitArgs) TokenStore(
+	serviceKey string,
+	storeConf *token.StoreConf,
+	confTokens []token.TokenConf,
+) (token.Store, error) {
+	store, err := token.NewStore(args.Ctx, serviceKey, storeConf, confTokens)
+	if err != nil {
+		return nil, err
+	}
+	args.TokenStores.Register(serviceKey, store)
+	return store, nil
+}
+
+// GuardFactory creates a guard of a specified type for a service
+type GuardFactory func(args InitArgs, guardType guard.GuardType, limits []proxy.Limit) (guard.ServiceGuard, error)
+
+// CompositeGuard creates a composite guard with children created by
+// the createChild factory. Each child gets its own rate limiting namespace
+// (e.g. `3/mquery#dflt`) so the children do not count the same
+// requests against the same limits.
+func (args InitArgs) CompositeGuard(
+	conf *composite.Conf,
+	serviceLimits []proxy.Limit,
+	createChild GuardFactory,
+) (guard.ServiceGuard, error) {
+	children := make([]guard.ServiceGuard, len(conf.Guards))
+	for i, child := range conf.Guards {
+		childCtx := *args.Ctx
+		childCtx.RateLimiters = ratelimit.WithNamespaceSuffix(
+			args.Ctx.RateLimiters, fmt.Sprintf("#%s", child.Type))
+		childArgs := args
+		childArgs.Ctx = &childCtx
+		limits := serviceLimits
+		if len(child.Limits) > 0 {
+			limits = child.Limits
+		}
+		grd, err := createChild(childArgs, child.Type, limits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create composite guard child %d (%s): %w", i, child.Type, err)
+		}
+		children[i] = grd
+	}
+	return composite.New(conf.Mode, children), nil
 }
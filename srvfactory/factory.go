@@ -22,6 +22,7 @@ import (
 
 	"github.com/czcorpus/apiguard/config"
 	"github.com/czcorpus/apiguard/globctx"
+	"github.com/czcorpus/apiguard/guard/token"
 	"github.com/czcorpus/apiguard/monitoring"
 	"github.com/czcorpus/apiguard/services"
 	"github.com/gin-gonic/gin"
@@ -45,6 +46,7 @@ func InitServices(
 	apiRoutes *gin.RouterGroup,
 	globalConf *config.Configuration,
 	alarm *monitoring.AlarmTicker,
+	tokenStores *token.Registry,
 ) {
 	for sid, servConf := range globalConf.Services {
 
@@ -55,13 +57,14 @@ func InitServices(
 		}
 		log.Info().Msgf("registering service %d/%s", sid, servConf.Type)
 		if err := initialize(services.InitArgs{
-			Ctx:        ctx,
-			Engine:     engine,
-			APIRoutes:  apiRoutes,
-			GlobalConf: globalConf,
-			SID:        sid,
-			RawConf:    servConf.Conf,
-			Alarm:      alarm,
+			Ctx:         ctx,
+			Engine:      engine,
+			APIRoutes:   apiRoutes,
+			GlobalConf:  globalConf,
+			SID:         sid,
+			RawConf:     servConf.Conf,
+			Alarm:       alarm,
+			TokenStores: tokenStores,
 		}); err != nil {
 			log.Fatal().
 				Err(err).
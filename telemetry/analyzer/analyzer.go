@@ -0,0 +1,67 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package analyzer contains bot analyzers based on the
+// telemetry data WaG clients send to APIGuard.
+package analyzer
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/czcorpus/apiguard/guard"
+	"github.com/czcorpus/apiguard/reporting"
+	"github.com/czcorpus/apiguard/telemetry"
+)
+
+const (
+	AnalyzerTypeDumb    = "dumb"
+	AnalyzerTypeEntropy = "entropy"
+)
+
+// DumbAnalyzer considers all the clients to be humans.
+type DumbAnalyzer struct{}
+
+func (a *DumbAnalyzer) Learn() error {
+	return nil
+}
+
+func (a *DumbAnalyzer) BotScore(req *http.Request) (float64, error) {
+	return 0, nil
+}
+
+// New creates a bot analyzer specified in the telemetry configuration.
+// With no telemetry configured, DumbAnalyzer is returned.
+func New(
+	conf *telemetry.Conf,
+	db telemetry.Storage,
+	tDBWriter reporting.ReportingWriter,
+	loc *time.Location,
+) (guard.BotAnalyzer, error) {
+	if conf == nil {
+		return &DumbAnalyzer{}, nil
+	}
+	switch conf.Analyzer {
+	case AnalyzerTypeDumb:
+		return &DumbAnalyzer{}, nil
+	case AnalyzerTypeEntropy:
+		return NewEntropyAnalyzer(conf, db, tDBWriter, loc)
+	default:
+		return nil, fmt.Errorf("unknown telemetry analyzer `%s`", conf.Analyzer)
+	}
+}
@@ -0,0 +1,418 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyzer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard/logging"
+	"github.com/czcorpus/apiguard/reporting"
+	"github.com/czcorpus/apiguard/telemetry"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	modelFileName = "entropy-model.json"
+
+	dfltNumBins             = 10
+	dfltCountingRulesWeight = 0.3
+
+	// minStdev prevents from extreme deviation scores in case
+	// the training clients behave (almost) identically
+	minStdev = 0.05
+)
+
+// entropyConf is loaded from the path specified
+// in telemetry.Conf.CustomConfPath (see entropies.sample.json)
+type entropyConf struct {
+
+	// Entropies maps action names to weights of their
+	// timing entropies in the final score
+	Entropies map[string]float64 `json:"entropies"`
+
+	// NumBins specifies a resolution of the histogram of relative
+	// action times the entropy is calculated from
+	NumBins int `json:"numBins"`
+
+	// CountingRulesWeight specifies how much the counting rules
+	// contribute to the final score (0...1). The rest
+	// is given by the entropies.
+	CountingRulesWeight float64 `json:"countingRulesWeight"`
+}
+
+func loadEntropyConf(path string) (entropyConf, error) {
+	var ans entropyConf
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ans, fmt.Errorf("failed to load entropy analyzer conf: %w", err)
+	}
+	if err := json.Unmarshal(data, &ans); err != nil {
+		return ans, fmt.Errorf("failed to load entropy analyzer conf: %w", err)
+	}
+	if len(ans.Entropies) == 0 {
+		return ans, fmt.Errorf("failed to load entropy analyzer conf: no entropies defined")
+	}
+	if ans.NumBins == 0 {
+		ans.NumBins = dfltNumBins
+
+	} else if ans.NumBins < 2 {
+		return ans, fmt.Errorf("failed to load entropy analyzer conf: numBins must be at least 2")
+	}
+	if ans.CountingRulesWeight == 0 {
+		ans.CountingRulesWeight = dfltCountingRulesWeight
+
+	} else if ans.CountingRulesWeight < 0 || ans.CountingRulesWeight > 1 {
+		return ans, fmt.Errorf("failed to load entropy analyzer conf: countingRulesWeight must be between 0 and 1")
+	}
+	return ans, nil
+}
+
+// ---
+
+type actionStats struct {
+	Mean  float64 `json:"mean"`
+	Stdev float64 `json:"stdev"`
+}
+
+// model contains parameters fitted from telemetry
+// of training clients.
+type model struct {
+	Created    time.Time              `json:"created"`
+	NumClients int                    `json:"numClients"`
+	Actions    map[string]actionStats `json:"actions"`
+}
+
+// ---
+
+// EntropyAnalyzer scores clients based on how their telemetry
+// differs from the telemetry of known human clients (the ones with
+// the training flag). For each configured action, the entropy
+// of the action's relative timing within the client's session is
+// calculated and compared with the entropy distribution learned from
+// the training clients. Also, the numbers of tile actions per query
+// are checked against the counting rules.
+type EntropyAnalyzer struct {
+	conf          *telemetry.Conf
+	aConf         entropyConf
+	db            telemetry.Storage
+	tDBWriter     reporting.ReportingWriter
+	loc           *time.Location
+	model         *model
+	countingRules []*telemetry.CountingRule
+	mu            sync.RWMutex
+}
+
+func (a *EntropyAnalyzer) modelPath() string {
+	return filepath.Join(a.conf.InternalDataPath, modelFileName)
+}
+
+func (a *EntropyAnalyzer) loadModel() error {
+	data, err := os.ReadFile(a.modelPath())
+	if err != nil {
+		return err
+	}
+	var mdl model
+	if err := json.Unmarshal(data, &mdl); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.model = &mdl
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *EntropyAnalyzer) saveModel(mdl *model) error {
+	data, err := json.MarshalIndent(mdl, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(a.modelPath(), data, 0644)
+}
+
+func (a *EntropyAnalyzer) loadCountingRules() error {
+	rules, err := a.db.LoadCountingRules()
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.countingRules = rules
+	a.mu.Unlock()
+	return nil
+}
+
+// normalize converts absolute action times to relative
+// ones (0 = the first action, 1 = the last one). The records
+// are expected to be sorted by time.
+func normalize(records []*telemetry.ActionRecord) []*telemetry.NormalizedActionRecord {
+	ans := make([]*telemetry.NormalizedActionRecord, len(records))
+	if len(records) == 0 {
+		return ans
+	}
+	first := records[0].Created
+	span := records[len(records)-1].Created.Sub(first).Seconds()
+	for i, rec := range records {
+		var relTime float64
+		if span > 0 {
+			relTime = rec.Created.Sub(first).Seconds() / span
+		}
+		ans[i] = &telemetry.NormalizedActionRecord{
+			Client:       rec.Client,
+			ActionName:   rec.ActionName,
+			IsMobile:     rec.IsMobile,
+			IsSubquery:   rec.IsSubquery,
+			TileName:     rec.TileName,
+			RelativeTime: relTime,
+			TrainingFlag: rec.TrainingFlag,
+		}
+	}
+	return ans
+}
+
+// entropy calculates normalized (0...1) Shannon entropy
+// of a histogram of relative times
+func entropy(relTimes []float64, numBins int) float64 {
+	if len(relTimes) == 0 {
+		return 0
+	}
+	bins := make([]int, numBins)
+	for _, v := range relTimes {
+		bins[min(int(v*float64(numBins)), numBins-1)]++
+	}
+	var ans float64
+	for _, cnt := range bins {
+		if cnt > 0 {
+			p := float64(cnt) / float64(len(relTimes))
+			ans -= p * math.Log2(p)
+		}
+	}
+	return ans / math.Log2(float64(numBins))
+}
+
+func (a *EntropyAnalyzer) actionEntropies(records []*telemetry.NormalizedActionRecord) map[string]float64 {
+	relTimes := make(map[string][]float64)
+	for _, rec := range records {
+		if _, ok := a.aConf.Entropies[rec.ActionName]; ok {
+			relTimes[rec.ActionName] = append(relTimes[rec.ActionName], rec.RelativeTime)
+		}
+	}
+	ans := make(map[string]float64)
+	for action := range a.aConf.Entropies {
+		ans[action] = entropy(relTimes[action], a.aConf.NumBins)
+	}
+	return ans
+}
+
+// countingScore returns a number between 0 and 1 describing how much
+// the client violates the counting rules (i.e. expected numbers of tile
+// actions per a single query).
+func (a *EntropyAnalyzer) countingScore(records []*telemetry.NormalizedActionRecord) float64 {
+	a.mu.RLock()
+	rules := a.countingRules
+	a.mu.RUnlock()
+	if len(rules) == 0 {
+		return 0
+	}
+	numQueries := 0
+	for _, rec := range records {
+		if rec.IsMainQuery() {
+			numQueries++
+		}
+	}
+	numQueries = max(numQueries, 1)
+	var ans float64
+	for _, rule := range rules {
+		var cnt int
+		for _, rec := range records {
+			if rec.ActionName == rule.ActionName && (rule.TileName == "" || rec.TileName == rule.TileName) {
+				cnt++
+			}
+		}
+		diff := math.Abs(float64(cnt)/float64(numQueries) - float64(rule.Count))
+		if diff > float64(rule.Tolerance) {
+			ans += min(1, diff/max(float64(rule.Count), 1))
+		}
+	}
+	return ans / float64(len(rules))
+}
+
+// ScoreClient calculates a bot score (0 = human, 1 = bot) of a client
+// identified by its session ID and IP address.
+func (a *EntropyAnalyzer) ScoreClient(sessionID, clientIP string) (*reporting.TelemetryEntropy, error) {
+	records, err := a.db.LoadClientTelemetry(sessionID, clientIP, a.conf.MaxAgeSecsRelevant, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to score client: %w", err)
+	}
+	ans := &reporting.TelemetryEntropy{
+		Created:   time.Now().In(a.loc),
+		SessionID: sessionID,
+		ClientIP:  clientIP,
+	}
+	if len(records) == 0 {
+		ans.Score = 1
+		return ans, nil
+	}
+	normRecords := normalize(records)
+	entropies := a.actionEntropies(normRecords)
+	ans.MAIN_TILE_DATA_LOADED = entropies["MAIN_TILE_DATA_LOADED"]
+	ans.MAIN_TILE_PARTIAL_DATA_LOADED = entropies["MAIN_TILE_PARTIAL_DATA_LOADED"]
+	ans.MAIN_SET_TILE_RENDER_SIZE = entropies["MAIN_SET_TILE_RENDER_SIZE"]
+
+	countingScore := a.countingScore(normRecords)
+	a.mu.RLock()
+	mdl := a.model
+	a.mu.RUnlock()
+	if mdl == nil {
+		ans.Score = countingScore
+		return ans, nil
+	}
+	var deviation, sumWeights float64
+	for action, weight := range a.aConf.Entropies {
+		stats, ok := mdl.Actions[action]
+		if !ok {
+			continue
+		}
+		deviation += weight * math.Abs(entropies[action]-stats.Mean) / max(stats.Stdev, minStdev)
+		sumWeights += weight
+	}
+	var entropyScore float64
+	if sumWeights > 0 {
+		entropyScore = 1 - math.Exp(-deviation/sumWeights)
+	}
+	ans.Score = (1-a.aConf.CountingRulesWeight)*entropyScore +
+		a.aConf.CountingRulesWeight*countingScore
+	return ans, nil
+}
+
+// Learn fits the model parameters using telemetry of training clients.
+// The model is stored to the telemetry.internalDataPath directory.
+func (a *EntropyAnalyzer) Learn() error {
+	if err := a.loadCountingRules(); err != nil {
+		return fmt.Errorf("failed to learn: %w", err)
+	}
+	clients, err := a.db.FindLearningClients(a.conf.MaxAgeSecsRelevant, 0)
+	if err != nil {
+		return fmt.Errorf("failed to learn: %w", err)
+	}
+	type welford struct {
+		count int
+		mean  float64
+		m2    float64
+	}
+	acc := make(map[string]*welford)
+	for action := range a.aConf.Entropies {
+		acc[action] = &welford{}
+	}
+	var numClients int
+	for _, client := range clients {
+		records, err := a.db.LoadClientTelemetry(client.SessionID, client.IP, a.conf.MaxAgeSecsRelevant, 0)
+		if err != nil {
+			return fmt.Errorf("failed to learn: %w", err)
+		}
+		if len(records) == 0 {
+			continue
+		}
+		numClients++
+		for action, value := range a.actionEntropies(normalize(records)) {
+			w := acc[action]
+			w.count++
+			delta := value - w.mean
+			w.mean += delta / float64(w.count)
+			w.m2 += delta * (value - w.mean)
+		}
+	}
+	if numClients == 0 {
+		return fmt.Errorf("failed to learn: no training clients found")
+	}
+	mdl := &model{
+		Created:    time.Now().In(a.loc),
+		NumClients: numClients,
+		Actions:    make(map[string]actionStats),
+	}
+	for action, w := range acc {
+		mdl.Actions[action] = actionStats{
+			Mean:  w.mean,
+			Stdev: math.Sqrt(w.m2 / float64(w.count)),
+		}
+	}
+	if err := a.saveModel(mdl); err != nil {
+		return fmt.Errorf("failed to learn: %w", err)
+	}
+	a.mu.Lock()
+	a.model = mdl
+	a.mu.Unlock()
+	log.Info().
+		Int("numClients", numClients).
+		Any("actions", mdl.Actions).
+		Str("path", a.modelPath()).
+		Msg("entropy analyzer model fitted and saved")
+	return nil
+}
+
+// BotScore calculates the bot score of the client sending the request
+// and writes the result to the reporting database.
+func (a *EntropyAnalyzer) BotScore(req *http.Request) (float64, error) {
+	ip, sessionID := logging.ExtractRequestIdentifiers(req)
+	ans, err := a.ScoreClient(sessionID, ip)
+	if err != nil {
+		return 0, err
+	}
+	a.tDBWriter.Write(ans)
+	return ans.Score, nil
+}
+
+func NewEntropyAnalyzer(
+	conf *telemetry.Conf,
+	db telemetry.Storage,
+	tDBWriter reporting.ReportingWriter,
+	loc *time.Location,
+) (*EntropyAnalyzer, error) {
+	if conf.CustomConfPath == "" {
+		return nil, fmt.Errorf("entropy analyzer requires telemetry.customConfPath")
+	}
+	aConf, err := loadEntropyConf(conf.CustomConfPath)
+	if err != nil {
+		return nil, err
+	}
+	ans := &EntropyAnalyzer{
+		conf:      conf,
+		aConf:     aConf,
+		db:        db,
+		tDBWriter: tDBWriter,
+		loc:       loc,
+	}
+	if err := ans.loadModel(); errors.Is(err, os.ErrNotExist) {
+		log.Warn().
+			Str("path", ans.modelPath()).
+			Msg("entropy analyzer model not found, only counting rules will be applied (run `apiguard learn`)")
+
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load entropy analyzer model: %w", err)
+	}
+	if err := ans.loadCountingRules(); err != nil {
+		return nil, fmt.Errorf("failed to initialize entropy analyzer: %w", err)
+	}
+	return ans, nil
+}
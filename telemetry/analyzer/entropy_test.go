@@ -0,0 +1,224 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard/reporting"
+	"github.com/czcorpus/apiguard/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTelemetryStorage struct {
+	telemetry.Storage
+	records       map[string][]*telemetry.ActionRecord
+	learning      []*telemetry.Client
+	countingRules []*telemetry.CountingRule
+}
+
+func (s *fakeTelemetryStorage) LoadClientTelemetry(
+	sessionID, clientIP string, maxAgeSecs, minAgeSecs int,
+) ([]*telemetry.ActionRecord, error) {
+	return s.records[sessionID], nil
+}
+
+func (s *fakeTelemetryStorage) FindLearningClients(maxAgeSecs, minAgeSecs int) ([]*telemetry.Client, error) {
+	return s.learning, nil
+}
+
+func (s *fakeTelemetryStorage) LoadCountingRules() ([]*telemetry.CountingRule, error) {
+	return s.countingRules, nil
+}
+
+// mkSession creates a session with actions at the provided
+// offsets (in seconds) from the session start
+func mkSession(sessionID string, actions map[string][]int) []*telemetry.ActionRecord {
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	ans := make([]*telemetry.ActionRecord, 0, 20)
+	for name, offsets := range actions {
+		for _, offset := range offsets {
+			ans = append(ans, &telemetry.ActionRecord{
+				Client:     telemetry.Client{SessionID: sessionID, IP: "192.168.1.10"},
+				ActionName: name,
+				Created:    start.Add(time.Duration(offset) * time.Second),
+			})
+		}
+	}
+	// the analyzer expects the records to be sorted by time
+	for i := 1; i < len(ans); i++ {
+		for j := i; j > 0 && ans[j].Created.Before(ans[j-1].Created); j-- {
+			ans[j], ans[j-1] = ans[j-1], ans[j]
+		}
+	}
+	return ans
+}
+
+func writeEntropyConf(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "entropies.json")
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+	return path
+}
+
+func newTestAnalyzer(t *testing.T, storage *fakeTelemetryStorage) *EntropyAnalyzer {
+	confPath := writeEntropyConf(
+		t, `{"entropies": {"MAIN_TILE_DATA_LOADED": 1.0}, "numBins": 4, "countingRulesWeight": 0.5}`)
+	a, err := NewEntropyAnalyzer(
+		&telemetry.Conf{CustomConfPath: confPath, InternalDataPath: t.TempDir(), MaxAgeSecsRelevant: 3600},
+		storage,
+		&reporting.NullWriter{},
+		time.UTC,
+	)
+	assert.NoError(t, err)
+	return a
+}
+
+func TestLoadEntropyConf(t *testing.T) {
+	conf, err := loadEntropyConf(writeEntropyConf(t, `{"entropies": {"MAIN_TILE_DATA_LOADED": 1.0}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, dfltNumBins, conf.NumBins)
+	assert.Equal(t, dfltCountingRulesWeight, conf.CountingRulesWeight)
+
+	invalid := []string{
+		`{"entropies": {}}`,
+		`{"entropies": {"MAIN_TILE_DATA_LOADED": 1.0}, "numBins": 1}`,
+		`{"entropies": {"MAIN_TILE_DATA_LOADED": 1.0}, "countingRulesWeight": 1.5}`,
+		`{"entropies": `,
+	}
+	for _, data := range invalid {
+		_, err := loadEntropyConf(writeEntropyConf(t, data))
+		assert.Error(t, err, data)
+	}
+	_, err = loadEntropyConf(filepath.Join(t.TempDir(), "nonexistent.json"))
+	assert.Error(t, err)
+}
+
+func TestNormalize(t *testing.T) {
+	records := mkSession("s1", map[string][]int{"A": {0, 30}, "B": {120}})
+	norm := normalize(records)
+	if assert.Len(t, norm, 3) {
+		assert.Equal(t, 0.0, norm[0].RelativeTime)
+		assert.Equal(t, 0.25, norm[1].RelativeTime)
+		assert.Equal(t, 1.0, norm[2].RelativeTime)
+		assert.Equal(t, "B", norm[2].ActionName)
+	}
+	assert.Empty(t, normalize([]*telemetry.ActionRecord{}))
+
+	// a single record (or records with the same time) must not produce NaN
+	norm = normalize(mkSession("s1", map[string][]int{"A": {10}}))
+	assert.Equal(t, 0.0, norm[0].RelativeTime)
+}
+
+func TestEntropy(t *testing.T) {
+	tests := []struct {
+		name     string
+		relTimes []float64
+		expected float64
+	}{
+		{"no values", []float64{}, 0},
+		{"single bin", []float64{0.1, 0.1, 0.2}, 0},
+		{"uniform", []float64{0.1, 0.3, 0.6, 0.9}, 1},
+		{"two bins", []float64{0.1, 0.9}, 0.5},
+		{"upper bound", []float64{1.0, 0.0}, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.expected, entropy(tt.relTimes, 4), 1e-9)
+		})
+	}
+}
+
+func TestCountingScore(t *testing.T) {
+	storage := &fakeTelemetryStorage{
+		countingRules: []*telemetry.CountingRule{
+			{ActionName: "MAIN_TILE_DATA_LOADED", Count: 2, Tolerance: 0.5},
+		},
+	}
+	a := newTestAnalyzer(t, storage)
+
+	// two queries, four tile loads => matches the rule
+	matching := normalize(mkSession("s1", map[string][]int{
+		telemetry.QueryActionName: {0, 60},
+		"MAIN_TILE_DATA_LOADED":   {1, 2, 61, 62},
+	}))
+	assert.Equal(t, 0.0, a.countingScore(matching))
+
+	// two queries, no tile loads => max. violation
+	noTiles := normalize(mkSession("s1", map[string][]int{telemetry.QueryActionName: {0, 60}}))
+	assert.Equal(t, 1.0, a.countingScore(noTiles))
+
+	// sub-queries are not counted as queries
+	records := mkSession("s1", map[string][]int{
+		telemetry.QueryActionName: {0, 60},
+		"MAIN_TILE_DATA_LOADED":   {1, 2},
+	})
+	for _, rec := range records {
+		if rec.ActionName == telemetry.QueryActionName && rec.Created.Minute() == 1 {
+			rec.IsSubquery = true
+		}
+	}
+	assert.Equal(t, 0.0, a.countingScore(normalize(records)))
+}
+
+func TestScoreClientWithoutTelemetry(t *testing.T) {
+	a := newTestAnalyzer(t, &fakeTelemetryStorage{})
+	ans, err := a.ScoreClient("unknown", "192.168.1.10")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, ans.Score)
+}
+
+func TestLearnAndScore(t *testing.T) {
+	human := map[string][]int{"MAIN_TILE_DATA_LOADED": {0, 100, 200, 300}}
+	storage := &fakeTelemetryStorage{
+		records: map[string][]*telemetry.ActionRecord{
+			"h1":  mkSession("h1", human),
+			"h2":  mkSession("h2", human),
+			"bot": mkSession("bot", map[string][]int{"MAIN_TILE_DATA_LOADED": {0, 1, 2, 300}}),
+		},
+		learning: []*telemetry.Client{
+			{SessionID: "h1", IP: "192.168.1.10"},
+			{SessionID: "h2", IP: "192.168.1.10"},
+		},
+	}
+	a := newTestAnalyzer(t, storage)
+	assert.NoError(t, a.Learn())
+	assert.Equal(t, 2, a.model.NumClients)
+	assert.InDelta(t, 1.0, a.model.Actions["MAIN_TILE_DATA_LOADED"].Mean, 1e-9)
+	assert.FileExists(t, a.modelPath())
+
+	humanScore, err := a.ScoreClient("h1", "192.168.1.10")
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.0, humanScore.Score, 1e-9)
+	botScore, err := a.ScoreClient("bot", "192.168.1.10")
+	assert.NoError(t, err)
+	assert.Greater(t, botScore.Score, 0.4)
+
+	// a new analyzer loads the stored model
+	b, err := NewEntropyAnalyzer(a.conf, storage, &reporting.NullWriter{}, time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, a.model.Actions, b.model.Actions)
+}
+
+func TestLearnWithoutTrainingClients(t *testing.T) {
+	a := newTestAnalyzer(t, &fakeTelemetryStorage{})
+	assert.Error(t, a.Learn())
+	assert.NoFileExists(t, a.modelPath())
+}
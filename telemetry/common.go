@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/czcorpus/apiguard/botwatch"
@@ -67,6 +68,7 @@ func (ips *IPProcData) MarshalJSON() ([]byte, error) {
 		SessionID:   ips.SessionID,
 		ClientIP:    ips.ClientIP,
 		Count:       ips.Count,
+		Mean:        ips.Mean,
 		Stdev:       ips.Stdev(),
 		FirstAccess: ips.FirstAccess,
 		LastAccess:  ips.LastAccess,
@@ -136,6 +138,10 @@ type CountingRule struct {
 
 // ------
 
+// QueryActionName is a WaG action produced once per each
+// user query
+const QueryActionName = "MAIN_REQUEST_QUERY_RESPONSE"
+
 type Payload struct {
 	Telemetry []*ActionRecord `json:"telemetry"`
 }
@@ -163,6 +169,12 @@ type NormalizedActionRecord struct {
 	TrainingFlag int     `json:"trainingFlag"`
 }
 
+// IsMainQuery tests whether the record represents a user query
+// (i.e. not a sub-query or any other action)
+func (nar *NormalizedActionRecord) IsMainQuery() bool {
+	return nar.ActionName == QueryActionName && !nar.IsSubquery
+}
+
 func (nar *NormalizedActionRecord) String() string {
 	return fmt.Sprintf(
 		"NormalizedActionRecord{SessionID: %s, ClientIP: %s, ActionName: %s, RelativeTime: %01.2f",
@@ -186,6 +198,76 @@ type ActionRecord struct {
 type BanRow struct {
 	ClientIP string `json:"clientIp"`
 	Bans     int    `json:"bans"`
+	IsRange  bool   `json:"isRange"`
+	Active   bool   `json:"active"`
+}
+
+// --------
+
+// ParseIPBanTarget parses either a single IP address or a CIDR range
+// (e.g. 192.168.1.0/24, 2001:db8::/64). A single address is returned
+// as a network with a full mask.
+func ParseIPBanTarget(value string) (*net.IPNet, error) {
+	if strings.Contains(value, "/") {
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP range %s: %w", value, err)
+		}
+		return ipNet, nil
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address: %s", value)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// IPBanKey returns a value representing a banned network
+// in storage. Single addresses are stored without a prefix length.
+func IPBanKey(ipNet *net.IPNet) string {
+	ones, bits := ipNet.Mask.Size()
+	if ones == bits {
+		return ipNet.IP.String()
+	}
+	return ipNet.String()
+}
+
+// --------
+
+// IPBan describes a ban of a single IP address or of an IP range
+// (in such case, ClientIP contains a CIDR notation of the range).
+type IPBan struct {
+	ClientIP string    `json:"clientIp"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Source   string    `json:"source"`
+	Active   bool      `json:"active"`
+}
+
+// --------
+
+type DelayLogRecord struct {
+	ClientIP string         `json:"clientIp"`
+	UserID   *common.UserID `json:"userId"`
+	Delay    float64        `json:"delay"`
+	Created  time.Time      `json:"created"`
+}
+
+// --------
+
+// CleanupStats contains numbers of removed records
+// per cleaned up table
+type CleanupStats struct {
+	DelayLog      int64 `json:"delayLog"`
+	ClientActions int64 `json:"clientActions"`
+	IPBans        int64 `json:"ipBans"`
+}
+
+func (cs CleanupStats) Total() int64 {
+	return cs.DelayLog + cs.ClientActions + cs.IPBans
 }
 
 // --------
@@ -204,6 +286,28 @@ type Storage interface {
 	LoadStats(clientIP, sessionID string, maxAgeSecs int, insertIfNone bool) (*IPProcData, error)
 	LoadIPStats(clientIP string, maxAgeSecs int) (*IPAggData, error)
 	TestIPBan(IP net.IP) (bool, error)
+
+	// FindIPBan returns an active ban of the IP address (either an exact
+	// one or a ban of a range containing the address) or nil if there is none.
+	// In case there are more matching bans, the most specific one is returned.
+	FindIPBan(IP net.IP) (*IPBan, error)
+
+	// RefreshIPBans reloads active IP bans used by TestIPBan. Storages
+	// refresh the bans periodically so the method is needed only to
+	// apply changes immediately.
+	RefreshIPBans() error
+
+	// ApplyIPBan adds a ban just inserted into the database to the bans
+	// used by TestIPBan. Unlike RefreshIPBans, it does not reload all
+	// the bans so it is cheap enough to be used while handling requests.
+	ApplyIPBan(target *net.IPNet, end time.Time)
+
+	// FindClientStats returns stats of all the sessions matching
+	// the provided session ID and/or client IP (an empty value
+	// matches any session ID/IP)
+	FindClientStats(clientIP, sessionID string, maxAgeSecs int) ([]*IPProcData, error)
+
+	LoadClientDelays(clientIP string, limit int) ([]*DelayLogRecord, error)
 	LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error
 	FindLearningClients(maxAgeSecs, minAgeSecs int) ([]*Client, error)
 	LoadCountingRules() ([]*CountingRule, error)
@@ -214,6 +318,11 @@ type Storage interface {
 	InsertTelemetry(transact *sql.Tx, data Payload) error
 	AnalyzeDelayLog(binWidth float64, otherLimit float64) (*DelayLogsHistogram, error)
 	AnalyzeBans(timeAgo time.Duration) ([]BanRow, error)
+
+	// CleanupOldRecords removes delay log records, client actions
+	// and IP bans (by their end) older than the specified time.
+	// Records are removed in batches of batchSize items.
+	CleanupOldRecords(olderThan time.Time, batchSize int) (CleanupStats, error)
 	StartTx() (*sql.Tx, error)
 	RollbackTx(*sql.Tx) error
 	CommitTx(*sql.Tx) error
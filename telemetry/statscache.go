@@ -0,0 +1,180 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	clientStatsFlushInterval = 5 * time.Second
+)
+
+type cachedClientStats struct {
+	data  IPProcData
+	dirty bool
+}
+
+// ClientStatsCache keeps request interval stats of recently active
+// clients in memory so the stats are not loaded and stored on each
+// request. A client's stats are loaded from the storage only when
+// the client is seen for the first time (within the watched time window)
+// and changed stats are written to the storage in batches (see Run).
+// This means other readers of the stored data may see up to
+// a few seconds old values.
+type ClientStatsCache struct {
+	storage    Storage
+	windowSecs int
+	loc        *time.Location
+	items      map[string]*cachedClientStats
+	mu         sync.Mutex
+}
+
+func (cache *ClientStatsCache) window() time.Duration {
+	return time.Duration(cache.windowSecs) * time.Second
+}
+
+func (cache *ClientStatsCache) get(key, clientIP, sessionID string) (*cachedClientStats, error) {
+	cache.mu.Lock()
+	entry, ok := cache.items[key]
+	cache.mu.Unlock()
+	if ok {
+		return entry, nil
+	}
+	// we do not want to hold the lock during the (slow) storage access
+	stats, err := cache.storage.LoadStats(clientIP, sessionID, cache.windowSecs, false)
+	if err != nil {
+		return nil, err
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if entry, ok := cache.items[key]; ok {
+		return entry, nil
+	}
+	entry = &cachedClientStats{data: *stats}
+	cache.items[key] = entry
+	return entry, nil
+}
+
+// RecordRequest updates the stats of request intervals for the client
+// and returns the updated values. The stats are reset once they
+// span more than the watched time window.
+func (cache *ClientStatsCache) RecordRequest(clientIP, sessionID string) (IPProcData, error) {
+	key := sessionID + "|" + clientIP
+	entry, err := cache.get(key, clientIP, sessionID)
+	if err != nil {
+		return IPProcData{}, err
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	stats := &entry.data
+	now := time.Now().In(cache.loc)
+	entry.dirty = true
+	if now.Sub(stats.FirstAccess) > cache.window() {
+		stats.Count = 0
+		stats.Mean = 0
+		stats.M2 = 0
+		stats.FirstAccess = now
+		stats.LastAccess = now
+		return *stats, nil
+	}
+	if !stats.LastAccess.IsZero() && now.After(stats.LastAccess) {
+		// Welford's online algorithm for request intervals
+		interval := now.Sub(stats.LastAccess).Seconds()
+		stats.Count++
+		delta := interval - stats.Mean
+		stats.Mean += delta / float64(stats.Count)
+		stats.M2 += delta * (interval - stats.Mean)
+	}
+	stats.LastAccess = now
+	return *stats, nil
+}
+
+// Stats returns the current stats of request intervals for the client
+// without recording a new request.
+func (cache *ClientStatsCache) Stats(clientIP, sessionID string) (IPProcData, error) {
+	entry, err := cache.get(sessionID+"|"+clientIP, clientIP, sessionID)
+	if err != nil {
+		return IPProcData{}, err
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if time.Now().In(cache.loc).Sub(entry.data.FirstAccess) > cache.window() {
+		return IPProcData{SessionID: sessionID, ClientIP: clientIP}, nil
+	}
+	return entry.data, nil
+}
+
+// Flush writes all the changed stats to the storage and removes
+// stats of clients inactive for more than the watched time window.
+func (cache *ClientStatsCache) Flush() {
+	cache.mu.Lock()
+	changed := make([]IPProcData, 0, len(cache.items))
+	deadline := time.Now().Add(-cache.window())
+	for key, entry := range cache.items {
+		if entry.dirty {
+			changed = append(changed, entry.data)
+			entry.dirty = false
+
+		} else if entry.data.LastAccess.Before(deadline) {
+			delete(cache.items, key)
+		}
+	}
+	cache.mu.Unlock()
+	for i := range changed {
+		if err := cache.storage.UpdateStats(&changed[i]); err != nil {
+			log.Error().
+				Err(err).
+				Str("clientIp", changed[i].ClientIP).
+				Msg("failed to store client stats")
+		}
+	}
+}
+
+// Run periodically writes changed stats to the storage. The method
+// blocks until the context is cancelled (the stats are flushed
+// once more before the method returns).
+func (cache *ClientStatsCache) Run(ctx context.Context) {
+	ticker := time.NewTicker(clientStatsFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			cache.Flush()
+			log.Info().Msg("stopping client stats cache")
+			return
+		case <-ticker.C:
+			cache.Flush()
+		}
+	}
+}
+
+// NewClientStatsCache creates a new cache. The windowSecs should
+// be the botwatch's watched time window.
+func NewClientStatsCache(storage Storage, windowSecs int, loc *time.Location) *ClientStatsCache {
+	return &ClientStatsCache{
+		storage:    storage,
+		windowSecs: windowSecs,
+		loc:        loc,
+		items:      make(map[string]*cachedClientStats),
+	}
+}
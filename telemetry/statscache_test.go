@@ -0,0 +1,142 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStatsStorage struct {
+	Storage
+	mu      sync.Mutex
+	stored  map[string]IPProcData
+	loads   int
+	updates int
+	loadErr error
+}
+
+func (s *fakeStatsStorage) LoadStats(
+	clientIP, sessionID string, maxAgeSecs int, insertIfNone bool,
+) (*IPProcData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loads++
+	if s.loadErr != nil {
+		return nil, s.loadErr
+	}
+	if data, ok := s.stored[sessionID+"|"+clientIP]; ok {
+		return &data, nil
+	}
+	now := time.Now()
+	return &IPProcData{SessionID: sessionID, ClientIP: clientIP, FirstAccess: now, LastAccess: now}, nil
+}
+
+func (s *fakeStatsStorage) UpdateStats(data *IPProcData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates++
+	s.stored[data.SessionID+"|"+data.ClientIP] = *data
+	return nil
+}
+
+func newFakeStatsStorage() *fakeStatsStorage {
+	return &fakeStatsStorage{stored: make(map[string]IPProcData)}
+}
+
+func TestClientStatsCacheLoadsOnlyOnce(t *testing.T) {
+	storage := newFakeStatsStorage()
+	cache := NewClientStatsCache(storage, 60, time.UTC)
+	for i := 0; i < 5; i++ {
+		stats, err := cache.RecordRequest("192.168.1.10", "s1")
+		assert.NoError(t, err)
+		// note: the first request measures the interval from
+		// the stats' initialization
+		assert.Equal(t, i+1, stats.Count)
+	}
+	assert.Equal(t, 1, storage.loads)
+	assert.Equal(t, 0, storage.updates)
+}
+
+func TestClientStatsCacheFlushWritesChangedStats(t *testing.T) {
+	storage := newFakeStatsStorage()
+	cache := NewClientStatsCache(storage, 60, time.UTC)
+	cache.RecordRequest("192.168.1.10", "s1")
+	cache.RecordRequest("192.168.1.10", "s1")
+	cache.RecordRequest("192.168.1.11", "")
+
+	cache.Flush()
+	assert.Equal(t, 2, storage.updates)
+	assert.Equal(t, 2, storage.stored["s1|192.168.1.10"].Count)
+
+	// unchanged stats are not written again
+	cache.Flush()
+	assert.Equal(t, 2, storage.updates)
+}
+
+func TestClientStatsCacheResetsOldStats(t *testing.T) {
+	storage := newFakeStatsStorage()
+	old := time.Now().Add(-2 * time.Minute)
+	storage.stored["s1|192.168.1.10"] = IPProcData{
+		SessionID: "s1", ClientIP: "192.168.1.10", Count: 30, Mean: 2, M2: 1,
+		FirstAccess: old, LastAccess: old.Add(time.Minute),
+	}
+	cache := NewClientStatsCache(storage, 60, time.UTC)
+	stats, err := cache.RecordRequest("192.168.1.10", "s1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.Count)
+	assert.Equal(t, 0.0, stats.Mean)
+}
+
+func TestClientStatsCacheStatsDoesNotRecord(t *testing.T) {
+	storage := newFakeStatsStorage()
+	cache := NewClientStatsCache(storage, 60, time.UTC)
+	cache.RecordRequest("192.168.1.10", "s1")
+	for i := 0; i < 3; i++ {
+		stats, err := cache.Stats("192.168.1.10", "s1")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, stats.Count)
+	}
+	assert.Equal(t, 1, storage.loads)
+
+	cache.Flush()
+	assert.Equal(t, 1, storage.updates)
+}
+
+func TestClientStatsCacheEvictsIdleClients(t *testing.T) {
+	storage := newFakeStatsStorage()
+	cache := NewClientStatsCache(storage, 60, time.UTC)
+	cache.RecordRequest("192.168.1.10", "s1")
+	cache.Flush()
+	cache.items["s1|192.168.1.10"].data.LastAccess = time.Now().Add(-2 * time.Minute)
+	cache.Flush()
+	assert.Empty(t, cache.items)
+}
+
+func TestClientStatsCacheLoadError(t *testing.T) {
+	storage := newFakeStatsStorage()
+	storage.loadErr = errors.New("db down")
+	cache := NewClientStatsCache(storage, 60, time.UTC)
+	_, err := cache.RecordRequest("192.168.1.10", "s1")
+	assert.Error(t, err)
+	assert.Empty(t, cache.items)
+}
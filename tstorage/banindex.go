@@ -0,0 +1,118 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tstorage
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type banNode struct {
+	children [2]*banNode
+
+	// end specifies the end of a ban of the prefix represented
+	// by the node (zero value = no ban)
+	end time.Time
+}
+
+// banIndex is a binary prefix tree of banned IP addresses and ranges.
+// Both insertion and lookup are O(address bits) so testing an address
+// is cheap no matter how many bans there are. A refresh creates a new
+// index, bans inserted by the running instance are added to the current
+// one (see MySQLStorage.ApplyIPBan).
+type banIndex struct {
+	mu      sync.RWMutex
+	v4      *banNode
+	v6      *banNode
+	size    int
+	created time.Time
+}
+
+func (idx *banIndex) root(ip net.IP) (*banNode, net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return idx.v4, ip4
+	}
+	return idx.v6, ip.To16()
+}
+
+func bitAt(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+func (idx *banIndex) insert(ipNet *net.IPNet, end time.Time) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	var node *banNode
+	var ip net.IP
+	ones, bits := ipNet.Mask.Size()
+	if ip4 := ipNet.IP.To4(); ip4 != nil && (bits == 32 || ones >= 96) {
+		// IPv4 addresses (incl. IPv4-mapped IPv6 ones) are always
+		// looked up in the v4 tree
+		node, ip = idx.v4, ip4
+		if bits == 128 {
+			ones -= 96
+		}
+
+	} else if ip16 := ipNet.IP.To16(); ip16 != nil && bits == 128 {
+		node, ip = idx.v6, ip16
+
+	} else {
+		return
+	}
+	for i := 0; i < ones; i++ {
+		b := bitAt(ip, i)
+		if node.children[b] == nil {
+			node.children[b] = &banNode{}
+		}
+		node = node.children[b]
+	}
+	if end.After(node.end) {
+		node.end = end
+	}
+	idx.size++
+}
+
+// contains tests whether the ip is covered by any prefix
+// with a ban still active at the time `now`
+func (idx *banIndex) contains(ip net.IP, now time.Time) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	node, ip := idx.root(ip)
+	if ip == nil {
+		return false
+	}
+	for i := 0; node != nil; i++ {
+		if node.end.After(now) {
+			return true
+		}
+		if i == len(ip)*8 {
+			break
+		}
+		node = node.children[bitAt(ip, i)]
+	}
+	return false
+}
+
+func newBanIndex(created time.Time) *banIndex {
+	return &banIndex{
+		v4:      &banNode{},
+		v6:      &banNode{},
+		created: created,
+	}
+}
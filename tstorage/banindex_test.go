@@ -0,0 +1,83 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tstorage
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+func mkIndex(t *testing.T, now time.Time, bans map[string]time.Time) *banIndex {
+	idx := newBanIndex(now)
+	for target, end := range bans {
+		ipNet, err := telemetry.ParseIPBanTarget(target)
+		assert.NoError(t, err)
+		idx.insert(ipNet, end)
+	}
+	return idx
+}
+
+func TestBanIndexSingleAddress(t *testing.T) {
+	now := time.Now()
+	idx := mkIndex(t, now, map[string]time.Time{
+		"192.168.1.10": now.Add(time.Hour),
+		"2001:db8::1":  now.Add(time.Hour),
+	})
+	assert.True(t, idx.contains(net.ParseIP("192.168.1.10"), now))
+	assert.False(t, idx.contains(net.ParseIP("192.168.1.11"), now))
+	assert.True(t, idx.contains(net.ParseIP("2001:db8::1"), now))
+	assert.False(t, idx.contains(net.ParseIP("2001:db8::2"), now))
+}
+
+func TestBanIndexRanges(t *testing.T) {
+	now := time.Now()
+	idx := mkIndex(t, now, map[string]time.Time{
+		"10.20.30.0/24":         now.Add(time.Hour),
+		"2001:db8:1:2::/64":     now.Add(time.Hour),
+		"::ffff:172.16.0.0/108": now.Add(time.Hour),
+	})
+	assert.True(t, idx.contains(net.ParseIP("10.20.30.0"), now))
+	assert.True(t, idx.contains(net.ParseIP("10.20.30.255"), now))
+	assert.False(t, idx.contains(net.ParseIP("10.20.31.1"), now))
+	assert.True(t, idx.contains(net.ParseIP("2001:db8:1:2:abcd::1"), now))
+	assert.False(t, idx.contains(net.ParseIP("2001:db8:1:3::1"), now))
+	assert.True(t, idx.contains(net.ParseIP("172.16.5.1"), now))
+	assert.False(t, idx.contains(net.ParseIP("172.32.0.1"), now))
+}
+
+func TestBanIndexExpiredBan(t *testing.T) {
+	now := time.Now()
+	idx := mkIndex(t, now, map[string]time.Time{
+		"10.0.0.0/8":  now.Add(time.Minute),
+		"10.1.0.0/16": now.Add(time.Hour),
+	})
+	later := now.Add(10 * time.Minute)
+	assert.True(t, idx.contains(net.ParseIP("10.2.0.1"), now))
+	assert.False(t, idx.contains(net.ParseIP("10.2.0.1"), later))
+	assert.True(t, idx.contains(net.ParseIP("10.1.0.1"), later))
+}
+
+func TestBanIndexEmpty(t *testing.T) {
+	idx := newBanIndex(time.Now())
+	assert.False(t, idx.contains(net.ParseIP("127.0.0.1"), time.Now()))
+	assert.False(t, idx.contains(net.ParseIP("::1"), time.Now()))
+}
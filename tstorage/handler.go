@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/czcorpus/apiguard/guard"
 	"github.com/czcorpus/apiguard/logging"
 	"github.com/czcorpus/apiguard/telemetry"
 
@@ -32,11 +33,12 @@ import (
 )
 
 type actionRecord struct {
-	ActionName  string `json:"actionName"`
-	IsMobile    bool   `json:"isMobile"`
-	IsSubquery  bool   `json:"isSubquery"`
-	TileName    string `json:"tileName"`
-	TimestampMS int64  `json:"timestamp"`
+	ActionName   string `json:"actionName"`
+	IsMobile     bool   `json:"isMobile"`
+	IsSubquery   bool   `json:"isSubquery"`
+	TileName     string `json:"tileName"`
+	TimestampMS  int64  `json:"timestamp"`
+	TrainingFlag int    `json:"trainingFlag"`
 }
 
 type payload struct {
@@ -44,18 +46,21 @@ type payload struct {
 }
 
 type Actions struct {
-	db telemetry.Storage
+	db       telemetry.Storage
+	analyzer guard.BotAnalyzer
 }
 
 func (a *Actions) Store(ctx *gin.Context) {
 	rawPayload, err := io.ReadAll(ctx.Request.Body)
 	if err != nil {
 		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
 	}
 	var payloadTmp payload
 	err = json.Unmarshal(rawPayload, &payloadTmp)
 	if err != nil {
 		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
 	}
 	ip, sessionID := logging.ExtractRequestIdentifiers(ctx.Request)
 	payload := telemetry.Payload{
@@ -67,11 +72,12 @@ func (a *Actions) Store(ctx *gin.Context) {
 				SessionID: sessionID,
 				IP:        ip,
 			},
-			ActionName: item.ActionName,
-			IsMobile:   item.IsMobile,
-			IsSubquery: item.IsSubquery,
-			TileName:   item.TileName,
-			Created:    time.UnixMilli(item.TimestampMS),
+			ActionName:   item.ActionName,
+			IsMobile:     item.IsMobile,
+			IsSubquery:   item.IsSubquery,
+			TileName:     item.TileName,
+			Created:      time.UnixMilli(item.TimestampMS),
+			TrainingFlag: item.TrainingFlag,
 		}
 	}
 
@@ -91,10 +97,21 @@ func (a *Actions) Store(ctx *gin.Context) {
 	err = a.db.CommitTx(transact)
 	if err != nil {
 		log.Error().Err(err).Msg("")
+		return
 	}
 
+	score, err := a.analyzer.BotScore(ctx.Request)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to calculate client's bot score")
+		return
+	}
+	log.Debug().
+		Str("sessionId", sessionID).
+		Str("clientIp", ip).
+		Float64("score", score).
+		Msg("calculated client's bot score")
 }
 
-func NewActions(db telemetry.Storage) *Actions {
-	return &Actions{db: db}
+func NewActions(db telemetry.Storage, analyzer guard.BotAnalyzer) *Actions {
+	return &Actions{db: db, analyzer: analyzer}
 }
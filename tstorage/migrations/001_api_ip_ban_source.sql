@@ -0,0 +1,5 @@
+-- Adds a source of IP bans (e.g. cli, admin-api) to installations
+-- created before APIGuard started to record it. Without the column,
+-- all the ban inserts fail.
+
+ALTER TABLE api_ip_ban ADD COLUMN source varchar(63) AFTER end_dt;
@@ -0,0 +1,4 @@
+-- Extends the banned address column so it can store CIDR ranges
+-- (the longest one is an IPv6 address with a /128 suffix).
+
+ALTER TABLE api_ip_ban MODIFY ip_address varchar(49) NOT NULL;
@@ -0,0 +1,697 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tstorage
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/telemetry"
+	"github.com/rs/zerolog/log"
+)
+
+/*
+CREATE TABLE api_ip_ban (
+	id int(11) NOT NULL AUTO_INCREMENT,
+	ip_address varchar(49) NOT NULL, -- an address or a CIDR range
+	start_dt DATETIME NOT NULL,
+	end_dt DATETIME NOT NULL,
+	source varchar(63),
+	PRIMARY KEY (id),
+	KEY api_ip_ban_ip_address_idx (ip_address)
+) ENGINE=InnoDB;
+
+-- for older installations, apply the respective scripts from
+-- the tstorage/migrations directory (in order)
+
+CREATE TABLE apiguard_delay_log (
+	id int(11) NOT NULL AUTO_INCREMENT,
+	client_ip varchar(45) NOT NULL,
+	user_id int(11),
+	delay FLOAT NOT NULL,
+	created DATETIME NOT NULL,
+	PRIMARY KEY (id),
+	KEY apiguard_delay_log_created_idx (created)
+) ENGINE=InnoDB;
+
+CREATE TABLE apiguard_client_stats (
+	session_id varchar(64) NOT NULL,
+	client_ip varchar(45) NOT NULL,
+	num_requests int(11) NOT NULL DEFAULT 0,
+	mean FLOAT NOT NULL DEFAULT 0,
+	m2 FLOAT NOT NULL DEFAULT 0,
+	first_access DATETIME NOT NULL,
+	last_access DATETIME NOT NULL,
+	PRIMARY KEY (session_id, client_ip)
+) ENGINE=InnoDB;
+
+CREATE TABLE apiguard_client_actions (
+	id int(11) NOT NULL AUTO_INCREMENT,
+	session_id varchar(64) NOT NULL,
+	client_ip varchar(45) NOT NULL,
+	action_name varchar(127) NOT NULL,
+	tile_name varchar(127),
+	is_mobile TINYINT NOT NULL DEFAULT 0,
+	is_subquery TINYINT NOT NULL DEFAULT 0,
+	training_flag TINYINT NOT NULL DEFAULT 0,
+	created DATETIME(3) NOT NULL,
+	PRIMARY KEY (id),
+	KEY apiguard_client_actions_client_idx (session_id, client_ip),
+	KEY apiguard_client_actions_created_idx (created)
+) ENGINE=InnoDB;
+
+CREATE TABLE apiguard_client_counting_rules (
+	tile_name varchar(127) NOT NULL,
+	action_name varchar(127) NOT NULL,
+	count FLOAT NOT NULL,
+	tolerance FLOAT NOT NULL,
+	PRIMARY KEY (tile_name, action_name)
+) ENGINE=InnoDB;
+*/
+
+const (
+	// botLikeActionName marks a telemetry record inserted by APIGuard
+	// itself for clients which make requests without producing any
+	// matching telemetry (i.e. likely scripted clients)
+	botLikeActionName = "APIGUARD_BOT_LIKE_ACTIVITY"
+
+	// ipBansRefreshInterval specifies max. age of the IP bans index
+	// before it is reloaded from the database
+	ipBansRefreshInterval = 30 * time.Second
+)
+
+// MySQLStorage is a telemetry.Storage implementation based on
+// CNC's MySQL/MariaDB database (see cnc/conf.go for privileges
+// required for APIGuard's database user).
+type MySQLStorage struct {
+	db       *sql.DB
+	location *time.Location
+
+	// bans is an index of active IP bans used by TestIPBan
+	bans           atomic.Pointer[banIndex]
+	refreshingBans atomic.Bool
+
+	// appliedBans are bans added to the index via ApplyIPBan. As a running
+	// refresh may have missed them, they are re-applied to the refreshed
+	// index. The mutex also serializes index replacement with ApplyIPBan.
+	appliedBans   []appliedIPBan
+	appliedBansMu sync.Mutex
+}
+
+type appliedIPBan struct {
+	target  *net.IPNet
+	end     time.Time
+	applied time.Time
+}
+
+func (storage *MySQLStorage) now() time.Time {
+	return time.Now().In(storage.location)
+}
+
+func (storage *MySQLStorage) secsAgo(secs int) time.Time {
+	return storage.now().Add(-time.Duration(secs) * time.Second)
+}
+
+func (storage *MySQLStorage) LoadClientTelemetry(
+	sessionID, clientIP string,
+	maxAgeSecs, minAgeSecs int,
+) ([]*telemetry.ActionRecord, error) {
+	rows, err := storage.db.Query(
+		"SELECT session_id, client_ip, action_name, tile_name, is_mobile, is_subquery, "+
+			"training_flag, created "+
+			"FROM apiguard_client_actions "+
+			"WHERE session_id = ? AND client_ip = ? AND created >= ? AND created <= ? "+
+			"ORDER BY created",
+		sessionID, clientIP, storage.secsAgo(maxAgeSecs), storage.secsAgo(minAgeSecs),
+	)
+	if err != nil {
+		return []*telemetry.ActionRecord{}, fmt.Errorf("failed to load client telemetry: %w", err)
+	}
+	defer rows.Close()
+	ans := make([]*telemetry.ActionRecord, 0, 100)
+	for rows.Next() {
+		var tileName sql.NullString
+		item := new(telemetry.ActionRecord)
+		err := rows.Scan(
+			&item.Client.SessionID, &item.Client.IP, &item.ActionName, &tileName,
+			&item.IsMobile, &item.IsSubquery, &item.TrainingFlag, &item.Created,
+		)
+		if err != nil {
+			return []*telemetry.ActionRecord{}, fmt.Errorf("failed to load client telemetry: %w", err)
+		}
+		item.TileName = tileName.String
+		ans = append(ans, item)
+	}
+	return ans, rows.Err()
+}
+
+func (storage *MySQLStorage) LoadStats(
+	clientIP, sessionID string,
+	maxAgeSecs int,
+	insertIfNone bool,
+) (*telemetry.IPProcData, error) {
+	row := storage.db.QueryRow(
+		"SELECT num_requests, mean, m2, first_access, last_access "+
+			"FROM apiguard_client_stats "+
+			"WHERE session_id = ? AND client_ip = ? AND last_access >= ?",
+		sessionID, clientIP, storage.secsAgo(maxAgeSecs),
+	)
+	ans := &telemetry.IPProcData{
+		SessionID: sessionID,
+		ClientIP:  clientIP,
+	}
+	err := row.Scan(&ans.Count, &ans.Mean, &ans.M2, &ans.FirstAccess, &ans.LastAccess)
+	if err == sql.ErrNoRows {
+		now := storage.now()
+		ans.FirstAccess = now
+		ans.LastAccess = now
+		if insertIfNone {
+			// note: there may be an outdated record for the same client
+			// so we must be able to replace it
+			_, err := storage.db.Exec(
+				"INSERT INTO apiguard_client_stats "+
+					"(session_id, client_ip, num_requests, mean, m2, first_access, last_access) "+
+					"VALUES (?, ?, 0, 0, 0, ?, ?) "+
+					"ON DUPLICATE KEY UPDATE num_requests = 0, mean = 0, m2 = 0, "+
+					"first_access = VALUES(first_access), last_access = VALUES(last_access)",
+				sessionID, clientIP, now, now,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("failed to insert client stats: %w", err)
+			}
+		}
+		return ans, nil
+
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load client stats: %w", err)
+	}
+	return ans, nil
+}
+
+// LoadIPStats aggregates stats of all the sessions with the same IP address.
+// Partial variances are merged using Chan's parallel algorithm.
+func (storage *MySQLStorage) LoadIPStats(clientIP string, maxAgeSecs int) (*telemetry.IPAggData, error) {
+	rows, err := storage.db.Query(
+		"SELECT num_requests, mean, m2, first_access, last_access "+
+			"FROM apiguard_client_stats "+
+			"WHERE client_ip = ? AND last_access >= ?",
+		clientIP, storage.secsAgo(maxAgeSecs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load IP stats: %w", err)
+	}
+	defer rows.Close()
+	ans := &telemetry.IPAggData{ClientIP: clientIP}
+	for rows.Next() {
+		var count int
+		var mean, m2 float64
+		var firstAccess, lastAccess time.Time
+		if err := rows.Scan(&count, &mean, &m2, &firstAccess, &lastAccess); err != nil {
+			return nil, fmt.Errorf("failed to load IP stats: %w", err)
+		}
+		if count == 0 {
+			continue
+		}
+		total := ans.Count + count
+		delta := mean - ans.Mean
+		ans.M2 = ans.M2 + m2 + delta*delta*float64(ans.Count)*float64(count)/float64(total)
+		ans.Mean = (ans.Mean*float64(ans.Count) + mean*float64(count)) / float64(total)
+		ans.Count = total
+		if ans.FirstAccess.IsZero() || firstAccess.Before(ans.FirstAccess) {
+			ans.FirstAccess = firstAccess
+		}
+		if lastAccess.After(ans.LastAccess) {
+			ans.LastAccess = lastAccess
+		}
+	}
+	return ans, rows.Err()
+}
+
+// TestIPBan tests whether the IP address is banned (either directly
+// or as a part of a banned range). The test is performed using an in-memory
+// index of active bans which is periodically refreshed in background.
+func (storage *MySQLStorage) TestIPBan(IP net.IP) (bool, error) {
+	if IP == nil {
+		return false, nil
+	}
+	idx := storage.bans.Load()
+	if idx == nil {
+		if err := storage.RefreshIPBans(); err != nil {
+			return false, fmt.Errorf("failed to test IP ban: %w", err)
+		}
+		idx = storage.bans.Load()
+
+	} else if time.Since(idx.created) > ipBansRefreshInterval &&
+		storage.refreshingBans.CompareAndSwap(false, true) {
+		go func() {
+			defer storage.refreshingBans.Store(false)
+			if err := storage.RefreshIPBans(); err != nil {
+				log.Error().Err(err).Msg("failed to refresh IP bans index")
+			}
+		}()
+	}
+	return idx.contains(IP, storage.now()), nil
+}
+
+func (storage *MySQLStorage) loadActiveIPBans() ([]*telemetry.IPBan, error) {
+	now := storage.now()
+	rows, err := storage.db.Query(
+		"SELECT ip_address, start_dt, end_dt, source FROM api_ip_ban "+
+			"WHERE start_dt <= ? AND end_dt > ?",
+		now, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ans := make([]*telemetry.IPBan, 0, 50)
+	for rows.Next() {
+		item := &telemetry.IPBan{Active: true}
+		var source sql.NullString
+		if err := rows.Scan(&item.ClientIP, &item.Start, &item.End, &source); err != nil {
+			return nil, err
+		}
+		item.Source = source.String
+		ans = append(ans, item)
+	}
+	return ans, rows.Err()
+}
+
+func (storage *MySQLStorage) RefreshIPBans() error {
+	started := time.Now()
+	bans, err := storage.loadActiveIPBans()
+	if err != nil {
+		return fmt.Errorf("failed to refresh IP bans: %w", err)
+	}
+	idx := newBanIndex(started)
+	for _, ban := range bans {
+		ipNet, err := telemetry.ParseIPBanTarget(ban.ClientIP)
+		if err != nil {
+			log.Warn().Err(err).Msg("ignoring invalid IP ban record")
+			continue
+		}
+		idx.insert(ipNet, ban.End)
+	}
+	storage.appliedBansMu.Lock()
+	defer storage.appliedBansMu.Unlock()
+	// bans applied before the refresh started are already loaded
+	// from the database
+	storage.appliedBans = slices.DeleteFunc(storage.appliedBans, func(ban appliedIPBan) bool {
+		return ban.applied.Before(started)
+	})
+	for _, ban := range storage.appliedBans {
+		idx.insert(ban.target, ban.end)
+	}
+	storage.bans.Store(idx)
+	log.Debug().Int("numBans", idx.size).Msg("refreshed IP bans index")
+	return nil
+}
+
+// ApplyIPBan adds a ban (already inserted into the database) to the in-memory
+// index used by TestIPBan so the ban takes effect without reloading all the bans.
+func (storage *MySQLStorage) ApplyIPBan(target *net.IPNet, end time.Time) {
+	storage.appliedBansMu.Lock()
+	defer storage.appliedBansMu.Unlock()
+	// in case the index is not loaded yet, the ban is applied
+	// once the index is created
+	if idx := storage.bans.Load(); idx != nil {
+		idx.insert(target, end)
+	}
+	storage.appliedBans = append(
+		storage.appliedBans, appliedIPBan{target: target, end: end, applied: time.Now()})
+}
+
+func (storage *MySQLStorage) FindIPBan(IP net.IP) (*telemetry.IPBan, error) {
+	if IP == nil {
+		return nil, nil
+	}
+	bans, err := storage.loadActiveIPBans()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find IP ban: %w", err)
+	}
+	var ans *telemetry.IPBan
+	bestPrefix := -1
+	for _, ban := range bans {
+		ipNet, err := telemetry.ParseIPBanTarget(ban.ClientIP)
+		if err != nil || !ipNet.Contains(IP) {
+			continue
+		}
+		if ones, _ := ipNet.Mask.Size(); ones > bestPrefix {
+			ans = ban
+			bestPrefix = ones
+		}
+	}
+	return ans, nil
+}
+
+func (storage *MySQLStorage) FindClientStats(
+	clientIP, sessionID string,
+	maxAgeSecs int,
+) ([]*telemetry.IPProcData, error) {
+	rows, err := storage.db.Query(
+		"SELECT session_id, client_ip, num_requests, mean, m2, first_access, last_access "+
+			"FROM apiguard_client_stats "+
+			"WHERE (? = '' OR session_id = ?) AND (? = '' OR client_ip = ?) AND last_access >= ? "+
+			"ORDER BY last_access DESC",
+		sessionID, sessionID, clientIP, clientIP, storage.secsAgo(maxAgeSecs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find client stats: %w", err)
+	}
+	defer rows.Close()
+	ans := make([]*telemetry.IPProcData, 0, 10)
+	for rows.Next() {
+		item := &telemetry.IPProcData{}
+		err := rows.Scan(
+			&item.SessionID, &item.ClientIP, &item.Count, &item.Mean, &item.M2,
+			&item.FirstAccess, &item.LastAccess,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find client stats: %w", err)
+		}
+		ans = append(ans, item)
+	}
+	return ans, rows.Err()
+}
+
+func (storage *MySQLStorage) LoadClientDelays(clientIP string, limit int) ([]*telemetry.DelayLogRecord, error) {
+	rows, err := storage.db.Query(
+		"SELECT user_id, delay, created FROM apiguard_delay_log "+
+			"WHERE client_ip = ? ORDER BY created DESC LIMIT ?",
+		clientIP, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client delays: %w", err)
+	}
+	defer rows.Close()
+	ans := make([]*telemetry.DelayLogRecord, 0, limit)
+	for rows.Next() {
+		item := &telemetry.DelayLogRecord{ClientIP: clientIP}
+		var userID sql.NullInt64
+		if err := rows.Scan(&userID, &item.Delay, &item.Created); err != nil {
+			return nil, fmt.Errorf("failed to load client delays: %w", err)
+		}
+		if userID.Valid {
+			uid := common.UserID(userID.Int64)
+			item.UserID = &uid
+		}
+		ans = append(ans, item)
+	}
+	return ans, rows.Err()
+}
+
+func (storage *MySQLStorage) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	var userID sql.NullInt64
+	if clientID.ID.IsValid() {
+		userID.Int64 = int64(clientID.ID)
+		userID.Valid = true
+	}
+	_, err := storage.db.Exec(
+		"INSERT INTO apiguard_delay_log (client_ip, user_id, delay, created) VALUES (?, ?, ?, ?)",
+		clientID.IP, userID, respDelay.Seconds(), storage.now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to log applied delay: %w", err)
+	}
+	return nil
+}
+
+func (storage *MySQLStorage) FindLearningClients(maxAgeSecs, minAgeSecs int) ([]*telemetry.Client, error) {
+	rows, err := storage.db.Query(
+		"SELECT DISTINCT session_id, client_ip FROM apiguard_client_actions "+
+			"WHERE training_flag > 0 AND created >= ? AND created <= ?",
+		storage.secsAgo(maxAgeSecs), storage.secsAgo(minAgeSecs),
+	)
+	if err != nil {
+		return []*telemetry.Client{}, fmt.Errorf("failed to find learning clients: %w", err)
+	}
+	defer rows.Close()
+	ans := make([]*telemetry.Client, 0, 50)
+	for rows.Next() {
+		client := new(telemetry.Client)
+		if err := rows.Scan(&client.SessionID, &client.IP); err != nil {
+			return []*telemetry.Client{}, fmt.Errorf("failed to find learning clients: %w", err)
+		}
+		ans = append(ans, client)
+	}
+	return ans, rows.Err()
+}
+
+func (storage *MySQLStorage) LoadCountingRules() ([]*telemetry.CountingRule, error) {
+	rows, err := storage.db.Query(
+		"SELECT tile_name, action_name, count, tolerance FROM apiguard_client_counting_rules",
+	)
+	if err != nil {
+		return []*telemetry.CountingRule{}, fmt.Errorf("failed to load counting rules: %w", err)
+	}
+	defer rows.Close()
+	ans := make([]*telemetry.CountingRule, 0, 20)
+	for rows.Next() {
+		rule := new(telemetry.CountingRule)
+		if err := rows.Scan(&rule.TileName, &rule.ActionName, &rule.Count, &rule.Tolerance); err != nil {
+			return []*telemetry.CountingRule{}, fmt.Errorf("failed to load counting rules: %w", err)
+		}
+		ans = append(ans, rule)
+	}
+	return ans, rows.Err()
+}
+
+func (storage *MySQLStorage) ResetStats(data *telemetry.IPProcData) error {
+	now := storage.now()
+	data.Count = 0
+	data.Mean = 0
+	data.M2 = 0
+	data.FirstAccess = now
+	data.LastAccess = now
+	return storage.UpdateStats(data)
+}
+
+func (storage *MySQLStorage) UpdateStats(data *telemetry.IPProcData) error {
+	if math.IsNaN(data.Mean) || math.IsNaN(data.M2) {
+		return fmt.Errorf("failed to update client stats: invalid (NaN) values")
+	}
+	_, err := storage.db.Exec(
+		"INSERT INTO apiguard_client_stats "+
+			"(session_id, client_ip, num_requests, mean, m2, first_access, last_access) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?) "+
+			"ON DUPLICATE KEY UPDATE num_requests = VALUES(num_requests), mean = VALUES(mean), "+
+			"m2 = VALUES(m2), first_access = VALUES(first_access), last_access = VALUES(last_access)",
+		data.SessionID, data.ClientIP, data.Count, data.Mean, data.M2,
+		data.FirstAccess, data.LastAccess,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update client stats: %w", err)
+	}
+	return nil
+}
+
+// CalcStatsTelemetryDiscrepancy returns the difference between the number
+// of requests registered for a client and the number of (non-sub)queries
+// the client reported via its telemetry within the `historySecs` period.
+// A high positive value means the client sends requests without any
+// user interface interaction.
+func (storage *MySQLStorage) CalcStatsTelemetryDiscrepancy(clientIP, sessionID string, historySecs int) (int, error) {
+	since := storage.secsAgo(historySecs)
+	row := storage.db.QueryRow(
+		"SELECT "+
+			"(SELECT COALESCE(SUM(num_requests), 0) FROM apiguard_client_stats "+
+			" WHERE session_id = ? AND client_ip = ? AND last_access >= ?) - "+
+			"(SELECT COUNT(*) FROM apiguard_client_actions "+
+			" WHERE session_id = ? AND client_ip = ? AND created >= ? "+
+			" AND action_name = ? AND is_subquery = 0)",
+		sessionID, clientIP, since,
+		sessionID, clientIP, since, telemetry.QueryActionName,
+	)
+	var ans int
+	if err := row.Scan(&ans); err != nil {
+		return 0, fmt.Errorf("failed to calculate stats-telemetry discrepancy: %w", err)
+	}
+	return ans, nil
+}
+
+func (storage *MySQLStorage) InsertBotLikeTelemetry(clientIP, sessionID string) error {
+	_, err := storage.db.Exec(
+		"INSERT INTO apiguard_client_actions "+
+			"(session_id, client_ip, action_name, tile_name, is_mobile, is_subquery, training_flag, created) "+
+			"VALUES (?, ?, ?, NULL, 0, 0, 0, ?)",
+		sessionID, clientIP, botLikeActionName, storage.now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert bot-like telemetry: %w", err)
+	}
+	return nil
+}
+
+func (storage *MySQLStorage) InsertTelemetry(transact *sql.Tx, data telemetry.Payload) error {
+	for _, rec := range data.Telemetry {
+		_, err := transact.Exec(
+			"INSERT INTO apiguard_client_actions "+
+				"(session_id, client_ip, action_name, tile_name, is_mobile, is_subquery, training_flag, created) "+
+				"VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			rec.Client.SessionID, rec.Client.IP, rec.ActionName,
+			sql.NullString{String: rec.TileName, Valid: rec.TileName != ""},
+			rec.IsMobile, rec.IsSubquery, rec.TrainingFlag, rec.Created.In(storage.location),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert telemetry: %w", err)
+		}
+	}
+	return nil
+}
+
+func (storage *MySQLStorage) AnalyzeDelayLog(binWidth float64, otherLimit float64) (*telemetry.DelayLogsHistogram, error) {
+	if binWidth <= 0 {
+		return nil, fmt.Errorf("failed to analyze delay log: binWidth must be a positive number")
+	}
+	ans := &telemetry.DelayLogsHistogram{
+		BinWidth:   binWidth,
+		OtherLimit: otherLimit,
+		Data:       make(map[string]int),
+	}
+	var oldest sql.NullTime
+	row := storage.db.QueryRow("SELECT MIN(created) FROM apiguard_delay_log")
+	if err := row.Scan(&oldest); err != nil {
+		return nil, fmt.Errorf("failed to analyze delay log: %w", err)
+	}
+	if oldest.Valid {
+		ans.OldestRecord = &oldest.Time
+	}
+	rows, err := storage.db.Query(
+		"SELECT FLOOR(delay / ?) AS bin, COUNT(*) FROM apiguard_delay_log "+
+			"WHERE delay < ? GROUP BY bin ORDER BY bin",
+		binWidth, otherLimit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze delay log: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bin int64
+		var count int
+		if err := rows.Scan(&bin, &count); err != nil {
+			return nil, fmt.Errorf("failed to analyze delay log: %w", err)
+		}
+		ans.Data[fmt.Sprintf("%01.2f", float64(bin)*binWidth)] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to analyze delay log: %w", err)
+	}
+	var numOther int
+	row = storage.db.QueryRow("SELECT COUNT(*) FROM apiguard_delay_log WHERE delay >= ?", otherLimit)
+	if err := row.Scan(&numOther); err != nil {
+		return nil, fmt.Errorf("failed to analyze delay log: %w", err)
+	}
+	ans.Data["other"] = numOther
+	return ans, nil
+}
+
+// AnalyzeBans returns numbers of bans per banned address/range started
+// within the specified time. Currently active bans are always included.
+func (storage *MySQLStorage) AnalyzeBans(timeAgo time.Duration) ([]telemetry.BanRow, error) {
+	now := storage.now()
+	rows, err := storage.db.Query(
+		"SELECT ip_address, COUNT(*) AS num_bans, MAX(start_dt <= ? AND end_dt > ?) AS active "+
+			"FROM api_ip_ban "+
+			"WHERE start_dt >= ? OR (start_dt <= ? AND end_dt > ?) "+
+			"GROUP BY ip_address ORDER BY active DESC, num_bans DESC",
+		now, now, now.Add(-timeAgo), now, now,
+	)
+	if err != nil {
+		return []telemetry.BanRow{}, fmt.Errorf("failed to analyze bans: %w", err)
+	}
+	defer rows.Close()
+	ans := make([]telemetry.BanRow, 0, 50)
+	for rows.Next() {
+		var item telemetry.BanRow
+		if err := rows.Scan(&item.ClientIP, &item.Bans, &item.Active); err != nil {
+			return []telemetry.BanRow{}, fmt.Errorf("failed to analyze bans: %w", err)
+		}
+		item.IsRange = strings.Contains(item.ClientIP, "/")
+		ans = append(ans, item)
+	}
+	return ans, rows.Err()
+}
+
+func (storage *MySQLStorage) deleteInBatches(query string, olderThan time.Time, batchSize int) (int64, error) {
+	var total int64
+	for {
+		res, err := storage.db.Exec(query+" LIMIT ?", olderThan.In(storage.location), batchSize)
+		if err != nil {
+			return total, err
+		}
+		numDeleted, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += numDeleted
+		if numDeleted < int64(batchSize) {
+			return total, nil
+		}
+	}
+}
+
+func (storage *MySQLStorage) CleanupOldRecords(olderThan time.Time, batchSize int) (telemetry.CleanupStats, error) {
+	var ans telemetry.CleanupStats
+	var err error
+	ans.DelayLog, err = storage.deleteInBatches(
+		"DELETE FROM apiguard_delay_log WHERE created < ?", olderThan, batchSize)
+	if err != nil {
+		return ans, fmt.Errorf("failed to clean up delay log: %w", err)
+	}
+	ans.ClientActions, err = storage.deleteInBatches(
+		"DELETE FROM apiguard_client_actions WHERE created < ?", olderThan, batchSize)
+	if err != nil {
+		return ans, fmt.Errorf("failed to clean up client actions: %w", err)
+	}
+	ans.IPBans, err = storage.deleteInBatches(
+		"DELETE FROM api_ip_ban WHERE end_dt < ?", olderThan, batchSize)
+	if err != nil {
+		return ans, fmt.Errorf("failed to clean up IP bans: %w", err)
+	}
+	return ans, nil
+}
+
+func (storage *MySQLStorage) StartTx() (*sql.Tx, error) {
+	return storage.db.Begin()
+}
+
+func (storage *MySQLStorage) RollbackTx(transact *sql.Tx) error {
+	return transact.Rollback()
+}
+
+func (storage *MySQLStorage) CommitTx(transact *sql.Tx) error {
+	return transact.Commit()
+}
+
+func NewMySQLStorage(db *sql.DB, location *time.Location) *MySQLStorage {
+	if location == nil {
+		location = time.Local
+	}
+	return &MySQLStorage{
+		db:       db,
+		location: location,
+	}
+}
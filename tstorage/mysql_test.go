@@ -0,0 +1,250 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tstorage
+
+import (
+	"errors"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/czcorpus/apiguard/common"
+	"github.com/czcorpus/apiguard/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+const activeBansQuery = "SELECT ip_address, start_dt, end_dt, source FROM api_ip_ban"
+
+func newMockStorage(t *testing.T) (*MySQLStorage, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return NewMySQLStorage(db, time.UTC), mock
+}
+
+func activeBanRows(now time.Time, targets ...string) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"ip_address", "start_dt", "end_dt", "source"})
+	for _, target := range targets {
+		rows.AddRow(target, now.Add(-time.Hour), now.Add(time.Hour), "cli")
+	}
+	return rows
+}
+
+func TestLoadStatsExistingRecord(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	first := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT num_requests, mean, m2, first_access, last_access FROM apiguard_client_stats").
+		WithArgs("s1", "192.168.1.10", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"num_requests", "mean", "m2", "first_access", "last_access"}).
+			AddRow(5, 1.5, 0.2, first, first.Add(time.Minute)))
+
+	stats, err := storage.LoadStats("192.168.1.10", "s1", 60, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, stats.Count)
+	assert.Equal(t, 1.5, stats.Mean)
+	assert.Equal(t, first, stats.FirstAccess)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoadStatsInsertsMissingRecord(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	mock.ExpectQuery("SELECT num_requests, mean, m2, first_access, last_access FROM apiguard_client_stats").
+		WillReturnRows(sqlmock.NewRows([]string{"num_requests", "mean", "m2", "first_access", "last_access"}))
+	mock.ExpectExec("INSERT INTO apiguard_client_stats").
+		WithArgs("s1", "192.168.1.10", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	stats, err := storage.LoadStats("192.168.1.10", "s1", 60, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.Count)
+	assert.False(t, stats.FirstAccess.IsZero())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoadStatsWithoutInsert(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	mock.ExpectQuery("SELECT num_requests, mean, m2, first_access, last_access FROM apiguard_client_stats").
+		WillReturnRows(sqlmock.NewRows([]string{"num_requests", "mean", "m2", "first_access", "last_access"}))
+
+	stats, err := storage.LoadStats("192.168.1.10", "s1", 60, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.10", stats.ClientIP)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoadIPStatsMergesSessions(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	t0 := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT num_requests, mean, m2, first_access, last_access FROM apiguard_client_stats").
+		WithArgs("192.168.1.10", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"num_requests", "mean", "m2", "first_access", "last_access"}).
+			AddRow(2, 1.0, 0.0, t0, t0.Add(time.Minute)).
+			AddRow(0, 0.0, 0.0, t0, t0).
+			AddRow(2, 3.0, 0.0, t0.Add(-time.Minute), t0.Add(2*time.Minute)))
+
+	stats, err := storage.LoadIPStats("192.168.1.10", 60)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, stats.Count)
+	assert.Equal(t, 2.0, stats.Mean)
+	// sum of squared deviations of the intervals {1, 1, 3, 3}
+	assert.Equal(t, 4.0, stats.M2)
+	assert.Equal(t, t0.Add(-time.Minute), stats.FirstAccess)
+	assert.Equal(t, t0.Add(2*time.Minute), stats.LastAccess)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateStats(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	t0 := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	data := &telemetry.IPProcData{
+		SessionID: "s1", ClientIP: "192.168.1.10", Count: 3, Mean: 1.2, M2: 0.5,
+		FirstAccess: t0, LastAccess: t0.Add(time.Minute),
+	}
+	mock.ExpectExec("INSERT INTO apiguard_client_stats").
+		WithArgs("s1", "192.168.1.10", 3, 1.2, 0.5, t0, t0.Add(time.Minute)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	assert.NoError(t, storage.UpdateStats(data))
+
+	data.Mean = math.NaN()
+	assert.Error(t, storage.UpdateStats(data))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshIPBansBuildsIndex(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	now := time.Now()
+	mock.ExpectQuery(activeBansQuery).
+		WillReturnRows(activeBanRows(now, "192.168.1.10", "10.20.0.0/16", "invalid-target"))
+
+	assert.NoError(t, storage.RefreshIPBans())
+	assert.Equal(t, 2, storage.bans.Load().size)
+	banned, err := storage.TestIPBan(net.ParseIP("10.20.30.40"))
+	assert.NoError(t, err)
+	assert.True(t, banned)
+	banned, err = storage.TestIPBan(net.ParseIP("192.168.1.11"))
+	assert.NoError(t, err)
+	assert.False(t, banned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTestIPBanLoadsIndexOnFirstUse(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	mock.ExpectQuery(activeBansQuery).WillReturnRows(activeBanRows(time.Now(), "2001:db8::/32"))
+
+	banned, err := storage.TestIPBan(net.ParseIP("2001:db8::1"))
+	assert.NoError(t, err)
+	assert.True(t, banned)
+	// the index is fresh so no other query is expected
+	banned, err = storage.TestIPBan(net.ParseIP("2001:db9::1"))
+	assert.NoError(t, err)
+	assert.False(t, banned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTestIPBanRefreshesStaleIndex(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	mock.ExpectQuery(activeBansQuery).WillReturnRows(activeBanRows(time.Now(), "192.168.1.10"))
+	stale := newBanIndex(time.Now().Add(-2 * ipBansRefreshInterval))
+	storage.bans.Store(stale)
+
+	// the stale index is still used for the current test
+	banned, err := storage.TestIPBan(net.ParseIP("192.168.1.10"))
+	assert.NoError(t, err)
+	assert.False(t, banned)
+	assert.Eventually(t, func() bool {
+		return storage.bans.Load() != stale && !storage.refreshingBans.Load()
+	}, time.Second, 10*time.Millisecond)
+	banned, err = storage.TestIPBan(net.ParseIP("192.168.1.10"))
+	assert.NoError(t, err)
+	assert.True(t, banned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTestIPBanFailedInitialLoad(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	mock.ExpectQuery(activeBansQuery).WillReturnError(errors.New("connection refused"))
+
+	_, err := storage.TestIPBan(net.ParseIP("192.168.1.10"))
+	assert.Error(t, err)
+	assert.Nil(t, storage.bans.Load())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTestIPBanNilAddress(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	banned, err := storage.TestIPBan(nil)
+	assert.NoError(t, err)
+	assert.False(t, banned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyIPBan(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	mock.ExpectQuery(activeBansQuery).WillReturnRows(activeBanRows(time.Now()))
+	assert.NoError(t, storage.RefreshIPBans())
+
+	target, err := telemetry.ParseIPBanTarget("192.168.1.20")
+	assert.NoError(t, err)
+	storage.ApplyIPBan(target, time.Now().Add(time.Hour))
+	banned, err := storage.TestIPBan(net.ParseIP("192.168.1.20"))
+	assert.NoError(t, err)
+	assert.True(t, banned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// bans applied before a refresh are loaded from the database
+	mock.ExpectQuery(activeBansQuery).WillReturnRows(activeBanRows(time.Now(), "192.168.1.20"))
+	assert.NoError(t, storage.RefreshIPBans())
+	assert.Empty(t, storage.appliedBans)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshIPBansKeepsBansAppliedDuringRefresh(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	target, err := telemetry.ParseIPBanTarget("192.168.1.20")
+	assert.NoError(t, err)
+	// the refresh started before the ban was inserted does not see it
+	mock.ExpectQuery(activeBansQuery).
+		WillDelayFor(100 * time.Millisecond).
+		WillReturnRows(activeBanRows(time.Now()))
+	refreshed := make(chan error)
+	go func() {
+		refreshed <- storage.RefreshIPBans()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	storage.ApplyIPBan(target, time.Now().Add(time.Hour))
+	assert.NoError(t, <-refreshed)
+
+	banned, err := storage.TestIPBan(net.ParseIP("192.168.1.20"))
+	assert.NoError(t, err)
+	assert.True(t, banned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLogAppliedDelay(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	mock.ExpectExec("INSERT INTO apiguard_delay_log").
+		WithArgs("192.168.1.10", nil, 1.5, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := storage.LogAppliedDelay(
+		1500*time.Millisecond, common.ClientID{IP: "192.168.1.10", ID: common.InvalidUserID})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -54,6 +54,25 @@ func (storage *NilStorage) TestIPBan(IP net.IP) (bool, error) {
 	return false, nil
 }
 
+func (storage *NilStorage) FindIPBan(IP net.IP) (*telemetry.IPBan, error) {
+	return nil, nil
+}
+
+func (storage *NilStorage) RefreshIPBans() error {
+	return nil
+}
+
+func (storage *NilStorage) ApplyIPBan(target *net.IPNet, end time.Time) {
+}
+
+func (storage *NilStorage) FindClientStats(clientIP, sessionID string, maxAgeSecs int) ([]*telemetry.IPProcData, error) {
+	return []*telemetry.IPProcData{}, nil
+}
+
+func (storage *NilStorage) LoadClientDelays(clientIP string, limit int) ([]*telemetry.DelayLogRecord, error) {
+	return []*telemetry.DelayLogRecord{}, nil
+}
+
 func (storage *NilStorage) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
 	return nil
 }
@@ -94,6 +113,10 @@ func (storage *NilStorage) AnalyzeBans(timeAgo time.Duration) ([]telemetry.BanRo
 	return []telemetry.BanRow{}, nil
 }
 
+func (storage *NilStorage) CleanupOldRecords(olderThan time.Time, batchSize int) (telemetry.CleanupStats, error) {
+	return telemetry.CleanupStats{}, nil
+}
+
 func (storage *NilStorage) StartTx() (*sql.Tx, error) {
 	return nil, fmt.Errorf("nil storage cannot start a transaction")
 }
@@ -106,6 +129,11 @@ func (storage *NilStorage) CommitTx(*sql.Tx) error {
 	return nil
 }
 
+// Open returns a database-backed telemetry storage in case
+// the database is configured. Otherwise, NilStorage is returned.
 func Open(db *sql.DB, location *time.Location) telemetry.Storage {
-	return &NilStorage{}
+	if db == nil {
+		return &NilStorage{}
+	}
+	return NewMySQLStorage(db, location)
 }